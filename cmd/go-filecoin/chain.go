@@ -4,13 +4,17 @@ package commands
 import (
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/filecoin-project/go-filecoin/internal/pkg/block"
+	"github.com/filecoin-project/go-filecoin/internal/pkg/chain"
+	"github.com/filecoin-project/specs-actors/actors/abi"
 	"github.com/ipfs/go-cid"
 	cmdkit "github.com/ipfs/go-ipfs-cmdkit"
 	cmds "github.com/ipfs/go-ipfs-cmds"
 	files "github.com/ipfs/go-ipfs-files"
 	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/pkg/errors"
 )
 
 var chainCmd = &cmds.Command{
@@ -18,13 +22,16 @@ var chainCmd = &cmds.Command{
 		Tagline: "Inspect the filecoin blockchain",
 	},
 	Subcommands: map[string]*cmds.Command{
-		"export":   storeExportCmd,
-		"head":     storeHeadCmd,
-		"import":   storeImportCmd,
-		"ls":       storeLsCmd,
-		"status":   storeStatusCmd,
-		"set-head": storeSetHeadCmd,
-		"sync":     storeSyncCmd,
+		"checkpoint": storeCheckpointCmd,
+		"export":     storeExportCmd,
+		"fsck":       storeFsckCmd,
+		"head":       storeHeadCmd,
+		"import":     storeImportCmd,
+		"ls":         storeLsCmd,
+		"notify":     storeNotifyCmd,
+		"status":     storeStatusCmd,
+		"set-head":   storeSetHeadCmd,
+		"sync":       storeSyncCmd,
 	},
 }
 
@@ -71,6 +78,85 @@ var storeLsCmd = &cmds.Command{
 	Type: []block.Block{},
 }
 
+// HeadChangeEvent is one line of the output of `chain notify`.
+type HeadChangeEvent struct {
+	// Type is "current", "revert" or "apply".
+	Type   string
+	Height abi.ChainEpoch
+	Key    block.TipSetKey
+}
+
+var storeNotifyCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Follow changes to the chain head",
+		ShortDescription: `Emits the current head, then an event for each tipset that leaves or joins the chain as the head changes.
+For each change, the reverted tipsets are emitted in order from the previous head down, followed by the applied tipsets in order up to the new head.
+The command runs until it is interrupted, or fails if the events are not read fast enough to keep up with the chain.`,
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		// The first change delivered applies only the current head.
+		current := true
+		for change := range GetPorcelainAPI(env).ChainNotify(req.Context) {
+			if current {
+				current = false
+				if len(change.Apply) > 0 {
+					if err := emitHeadChangeEvent(re, "current", change.Apply[0]); err != nil {
+						return err
+					}
+				}
+				continue
+			}
+			for _, ts := range change.Revert {
+				if err := emitHeadChangeEvent(re, "revert", ts); err != nil {
+					return err
+				}
+			}
+			for i := len(change.Apply) - 1; i >= 0; i-- {
+				if err := emitHeadChangeEvent(re, "apply", change.Apply[i]); err != nil {
+					return err
+				}
+			}
+		}
+		if req.Context.Err() == nil {
+			return errors.New("head changes stopped: either the node is stopping or this command fell too far behind the chain head")
+		}
+		return nil
+	},
+	Type: &HeadChangeEvent{},
+}
+
+func emitHeadChangeEvent(re cmds.ResponseEmitter, typ string, ts block.TipSet) error {
+	h, err := ts.Height()
+	if err != nil {
+		return err
+	}
+	return re.Emit(&HeadChangeEvent{
+		Type:   typ,
+		Height: h,
+		Key:    ts.Key(),
+	})
+}
+
+var storeFsckCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Check the integrity of the chain store",
+		ShortDescription: `Walks the chain from the head to genesis and checks that every block header, message collection, receipt collection and state tree is present and decodable.
+Missing and corrupt objects are reported. State that has been pruned is not checked.`,
+	},
+	Options: []cmdkit.Option{
+		cmdkit.BoolOption("refetch", "Fetch missing and corrupt objects from peers"),
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		refetch, _ := req.Options["refetch"].(bool)
+		report, err := GetPorcelainAPI(env).ChainFsck(req.Context, refetch)
+		if err != nil {
+			return err
+		}
+		return re.Emit(report)
+	},
+	Type: &chain.FsckReport{},
+}
+
 var storeStatusCmd = &cmds.Command{
 	Helptext: cmdkit.HelpText{
 		Tagline: "Show status of chain sync operation.",
@@ -101,6 +187,37 @@ var storeSetHeadCmd = &cmds.Command{
 	},
 }
 
+var storeCheckpointCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Show or set the checkpoint tipset, below which the chain is never reorganized.",
+		ShortDescription: `With no arguments, shows the checkpoint tipset key, if any.
+Given the CIDs of the blocks of a tipset on the current chain, pins that tipset so that the node never adopts a chain that forks before it.`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("cids", false, true, "CID's of the blocks of the tipset to checkpoint."),
+	},
+	Options: []cmdkit.Option{
+		cmdkit.BoolOption("clear", "Remove the checkpoint"),
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		clearCheckpoint, _ := req.Options["clear"].(bool)
+		if clearCheckpoint && len(req.Arguments) > 0 {
+			return fmt.Errorf("cannot both set and clear the checkpoint")
+		}
+		if clearCheckpoint || len(req.Arguments) > 0 {
+			cids, err := cidsFromSlice(req.Arguments)
+			if err != nil {
+				return err
+			}
+			if err := GetPorcelainAPI(env).ChainSetCheckpoint(req.Context, block.NewTipSetKey(cids...)); err != nil {
+				return err
+			}
+		}
+		return re.Emit(GetPorcelainAPI(env).ChainCheckpoint())
+	},
+	Type: block.TipSetKey{},
+}
+
 var storeSyncCmd = &cmds.Command{
 	Helptext: cmdkit.HelpText{
 		Tagline: "Instruct the chain syncer to sync a specific chain head, going to network if required.",
@@ -140,6 +257,9 @@ var storeExportCmd = &cmds.Command{
 		cmdkit.StringArg("file", true, false, "File to export chain data to."),
 		cmdkit.StringArg("cids", true, true, "CID's of the blocks of the tipset to export from."),
 	},
+	Options: []cmdkit.Option{
+		cmdkit.UintOption("state-depth", "Export a snapshot with state trees and receipts for only this many of the most recent tipsets. Older tipsets are exported as headers and messages."),
+	},
 	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
 		f, err := os.Create(req.Arguments[0])
 		if err != nil {
@@ -153,6 +273,9 @@ var storeExportCmd = &cmds.Command{
 		}
 		expKey := block.NewTipSetKey(expCids...)
 
+		if stateDepth, ok := req.Options["state-depth"].(uint); ok {
+			return GetPorcelainAPI(env).ChainExportSnapshot(req.Context, expKey, stateDepth, f)
+		}
 		if err := GetPorcelainAPI(env).ChainExport(req.Context, expKey, f); err != nil {
 			return err
 		}
@@ -163,10 +286,21 @@ var storeExportCmd = &cmds.Command{
 var storeImportCmd = &cmds.Command{
 	Helptext: cmdkit.HelpText{
 		Tagline: "Import the chain from a car file.",
+		ShortDescription: `
+With --validate, every imported tipset is re-executed and its headers are
+validated against their parents. With --checkpoint, the checkpoint tipset and
+its ancestors are trusted: they are not re-executed, and their headers are only
+checked for consistency with their parents, without validating signatures,
+tickets or elections. Only use a checkpoint from a source you trust.
+`,
 	},
 	Arguments: []cmdkit.Argument{
 		cmdkit.FileArg("file", true, false, "File to import chain data from.").EnableStdin(),
 	},
+	Options: []cmdkit.Option{
+		cmdkit.BoolOption("validate", "Re-execute the imported tipsets and fail on the first state or receipt root mismatch"),
+		cmdkit.StringOption("checkpoint", "Comma separated CIDs of a trusted imported tipset. Only tipsets above it are re-executed when validating"),
+	},
 	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
 		iter := req.Files.Entries()
 		if !iter.Next() {
@@ -178,7 +312,29 @@ var storeImportCmd = &cmds.Command{
 			return fmt.Errorf("given file was not a files.File")
 		}
 		defer func() { _ = fi.Close() }()
-		headKey, err := GetPorcelainAPI(env).ChainImport(req.Context, fi)
+
+		checkpoint := block.TipSetKey{}
+		if cp, ok := req.Options["checkpoint"].(string); ok && cp != "" {
+			cpCids, err := cidsFromSlice(strings.Split(cp, ","))
+			if err != nil {
+				return err
+			}
+			checkpoint = block.NewTipSetKey(cpCids...)
+		}
+
+		validate, _ := req.Options["validate"].(bool)
+		if !validate {
+			if !checkpoint.Empty() {
+				return fmt.Errorf("--checkpoint requires --validate")
+			}
+			headKey, err := GetPorcelainAPI(env).ChainImport(req.Context, fi)
+			if err != nil {
+				return err
+			}
+			return re.Emit(headKey)
+		}
+
+		headKey, err := GetPorcelainAPI(env).ChainImportValidated(req.Context, fi, checkpoint)
 		if err != nil {
 			return err
 		}
@@ -8,6 +8,7 @@ import (
 	"net"
 	"net/url"
 	"os"
+	"strconv"
 	"syscall"
 
 	cmdkit "github.com/ipfs/go-ipfs-cmdkit"
@@ -19,6 +20,7 @@ import (
 	"github.com/pkg/errors"
 
 	"github.com/filecoin-project/go-filecoin/internal/app/go-filecoin/paths"
+	"github.com/filecoin-project/go-filecoin/internal/app/go-filecoin/plumbing/msg"
 	"github.com/filecoin-project/go-filecoin/internal/pkg/repo"
 	"github.com/filecoin-project/go-filecoin/internal/pkg/types"
 	"github.com/filecoin-project/go-filecoin/internal/pkg/vm/gas"
@@ -358,19 +360,26 @@ func isConnectionRefused(err error) bool {
 	return syscallErr.Err == syscall.ECONNREFUSED
 }
 
-var priceOption = cmdkit.StringOption("gas-price", "Price (FIL e.g. 0.00013) to pay for each GasUnit consumed mining this message")
-var limitOption = cmdkit.Int64Option("gas-limit", "Maximum GasUnits this message is allowed to consume")
+var priceOption = cmdkit.StringOption("gas-price", "Price (FIL e.g. 0.00013) to pay for each GasUnit consumed mining this message, or \"auto\" to use a price suggested by recent blocks")
+var limitOption = cmdkit.StringOption("gas-limit", "Maximum GasUnits this message is allowed to consume, or \"auto\" to estimate it")
 var previewOption = cmdkit.BoolOption("preview", "Preview the Gas cost of this command without actually executing it")
 
+// gasAuto is the value of the gas options requesting automatic estimation.
+const gasAuto = "auto"
+
 func parseGasOptions(req *cmds.Request) (types.AttoFIL, gas.Unit, bool, error) {
 	priceOption := req.Options["gas-price"]
 	if priceOption == nil {
 		return types.ZeroAttoFIL, gas.Zero, false, errors.New("gas-price option is required")
 	}
 
-	price, ok := types.NewAttoFILFromFILString(priceOption.(string))
-	if !ok {
-		return types.ZeroAttoFIL, gas.NewGas(0), false, errors.New("invalid gas price (specify FIL as a decimal number)")
+	price := msg.GasPriceAuto
+	if priceOption.(string) != gasAuto {
+		var ok bool
+		price, ok = types.NewAttoFILFromFILString(priceOption.(string))
+		if !ok {
+			return types.ZeroAttoFIL, gas.NewGas(0), false, errors.New("invalid gas price (specify FIL as a decimal number)")
+		}
 	}
 
 	limitOption := req.Options["gas-limit"]
@@ -378,13 +387,16 @@ func parseGasOptions(req *cmds.Request) (types.AttoFIL, gas.Unit, bool, error) {
 		return types.ZeroAttoFIL, gas.NewGas(0), false, errors.New("gas-limit option is required")
 	}
 
-	gasLimitInt, ok := limitOption.(int64)
-	if !ok {
-		msg := fmt.Sprintf("invalid gas limit: %s", limitOption)
-		return types.ZeroAttoFIL, gas.NewGas(0), false, errors.New(msg)
+	limit := msg.GasLimitAuto
+	if limitOption.(string) != gasAuto {
+		gasLimitInt, err := strconv.ParseInt(limitOption.(string), 10, 64)
+		if err != nil || gasLimitInt < 0 {
+			return types.ZeroAttoFIL, gas.NewGas(0), false, fmt.Errorf("invalid gas limit: %s", limitOption)
+		}
+		limit = gas.NewGas(gasLimitInt)
 	}
 
 	preview, _ := req.Options["preview"].(bool)
 
-	return price, gas.NewGas(gasLimitInt), preview, nil
+	return price, limit, preview, nil
 }
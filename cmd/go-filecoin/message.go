@@ -1,9 +1,13 @@
 package commands
 
 import (
+	"bufio"
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/filecoin-project/go-address"
@@ -13,6 +17,7 @@ import (
 	"github.com/ipfs/go-cid"
 	cmdkit "github.com/ipfs/go-ipfs-cmdkit"
 	cmds "github.com/ipfs/go-ipfs-cmds"
+	files "github.com/ipfs/go-ipfs-files"
 	"github.com/pkg/errors"
 
 	"github.com/filecoin-project/go-filecoin/internal/pkg/block"
@@ -30,10 +35,14 @@ var msgCmd = &cmds.Command{
 		Tagline: "Send and monitor messages",
 	},
 	Subcommands: map[string]*cmds.Command{
+		"list":       msgListCmd,
 		"send":       msgSendCmd,
+		"send-batch": msgSendBatchCmd,
+		"replace":    msgReplaceCmd,
 		"sendsigned": signedMsgSendCmd,
 		"status":     msgStatusCmd,
 		"wait":       msgWaitCmd,
+		"watch":      msgWatchCmd,
 	},
 }
 
@@ -131,6 +140,233 @@ var msgSendCmd = &cmds.Command{
 	Type: &MessageSendResult{},
 }
 
+// MessageBatchLineResult is the outcome of sending the message on one line of a batch manifest.
+// For JSON manifests, Line is the position of the message in the manifest, counting from 1.
+type MessageBatchLineResult struct {
+	Line  int
+	Cid   cid.Cid
+	Error string `json:",omitempty"`
+}
+
+var msgSendBatchCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Send a batch of messages listed in a manifest file",
+		ShortDescription: `
+Sends a message for each line of a manifest, with consecutive nonces. Each line
+has the form
+
+  <target>,<value>[,<method>]
+
+where value is in FIL and method is a method number, defaulting to a plain send.
+Blank lines and lines starting with # are ignored.
+
+A manifest may instead be a JSON array of messages, such as
+
+  [{"to": "t0100", "value": "1.5"}, {"to": "t0101", "value": "2", "method": 3}]
+
+The format is detected from the manifest's content, unless given by --format.
+
+A result is reported for each message: the CID of the message sent, or the
+reason it failed. Messages that fail are skipped without leaving a gap in the
+nonces of those that follow.
+`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.FileArg("file", true, false, "Manifest of messages to send").EnableStdin(),
+	},
+	Options: []cmdkit.Option{
+		cmdkit.StringOption("from", "Address to send messages from"),
+		cmdkit.StringOption("format", "Format of the manifest: csv or json (default: detected)"),
+		priceOption,
+		limitOption,
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		format, _ := req.Options["format"].(string)
+
+		iter := req.Files.Entries()
+		if !iter.Next() {
+			return fmt.Errorf("no file given: %s", iter.Err())
+		}
+
+		fi, ok := iter.Node().(files.File)
+		if !ok {
+			return fmt.Errorf("given file was not a files.File")
+		}
+
+		fromAddr, err := fromAddrOrDefault(req, env)
+		if err != nil {
+			return err
+		}
+
+		gasPrice, gasLimit, _, err := parseGasOptions(req)
+		if err != nil {
+			return err
+		}
+
+		lines, entries, results, err := parseBatchManifest(fi, format, gasLimit)
+		if err != nil {
+			return err
+		}
+
+		sent, err := GetPorcelainAPI(env).MessageSendBatch(req.Context, fromAddr, gasPrice, entries)
+		if err != nil {
+			return err
+		}
+		for i, result := range sent {
+			res := &results[lines[i]]
+			res.Cid = result.Cid
+			if result.Err != nil {
+				res.Error = result.Err.Error()
+			}
+		}
+
+		for i := range results {
+			if err := re.Emit(&results[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	Type: &MessageBatchLineResult{},
+}
+
+// Formats of batch manifests.
+const (
+	batchManifestCSV  = "csv"
+	batchManifestJSON = "json"
+)
+
+// parseBatchManifest reads the messages of a batch manifest in `format`, or in the format
+// detected from its content if `format` is empty. It returns the entries to send, a result for
+// each message, and the index into the results of each entry. Messages that cannot be parsed
+// have their error recorded in their result and produce no entry.
+func parseBatchManifest(r io.Reader, format string, gasLimit gas.Unit) ([]int, []message.BatchEntry, []MessageBatchLineResult, error) {
+	br := bufio.NewReader(r)
+	if format == "" {
+		var err error
+		format, err = detectBatchManifestFormat(br)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	var lines []int
+	var entries []message.BatchEntry
+	var results []MessageBatchLineResult
+	add := func(lineNum int, entry message.BatchEntry, err error) {
+		results = append(results, MessageBatchLineResult{Line: lineNum})
+		if err != nil {
+			results[len(results)-1].Error = err.Error()
+			return
+		}
+		entry.GasLimit = gasLimit
+		entries = append(entries, entry)
+		lines = append(lines, len(results)-1)
+	}
+
+	switch format {
+	case batchManifestCSV:
+		scanner := bufio.NewScanner(br)
+		for lineNum := 1; scanner.Scan(); lineNum++ {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			entry, err := parseBatchLine(line)
+			add(lineNum, entry, err)
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, nil, nil, errors.Wrap(err, "failed to read manifest")
+		}
+	case batchManifestJSON:
+		var msgs []json.RawMessage
+		if err := json.NewDecoder(br).Decode(&msgs); err != nil {
+			return nil, nil, nil, errors.Wrap(err, "failed to read manifest")
+		}
+		for i, raw := range msgs {
+			entry, err := parseBatchJSON(raw)
+			add(i+1, entry, err)
+		}
+	default:
+		return nil, nil, nil, fmt.Errorf("unknown manifest format %q, expected %s or %s", format, batchManifestCSV, batchManifestJSON)
+	}
+	return lines, entries, results, nil
+}
+
+// detectBatchManifestFormat detects a JSON manifest by its opening bracket, without consuming
+// any of the manifest.
+func detectBatchManifestFormat(br *bufio.Reader) (string, error) {
+	for n := 1; ; n++ {
+		peeked, err := br.Peek(n)
+		if err == io.EOF || err == bufio.ErrBufferFull {
+			return batchManifestCSV, nil
+		}
+		if err != nil {
+			return "", errors.Wrap(err, "failed to read manifest")
+		}
+		switch peeked[n-1] {
+		case ' ', '\t', '\r', '\n':
+			continue
+		case '[':
+			return batchManifestJSON, nil
+		default:
+			return batchManifestCSV, nil
+		}
+	}
+}
+
+func parseBatchLine(line string) (message.BatchEntry, error) {
+	fields := strings.Split(line, ",")
+	if len(fields) < 2 || len(fields) > 3 {
+		return message.BatchEntry{}, fmt.Errorf("expected <target>,<value>[,<method>], got %d fields", len(fields))
+	}
+
+	methodID := builtin.MethodSend
+	if len(fields) == 3 {
+		method, err := strconv.ParseUint(strings.TrimSpace(fields[2]), 10, 64)
+		if err != nil {
+			return message.BatchEntry{}, errors.Wrap(err, "invalid method")
+		}
+		methodID = abi.MethodNum(method)
+	}
+
+	return newBatchEntry(strings.TrimSpace(fields[0]), strings.TrimSpace(fields[1]), methodID)
+}
+
+// batchManifestMessage is a message of a JSON batch manifest.
+type batchManifestMessage struct {
+	To     string
+	Value  string
+	Method *abi.MethodNum
+}
+
+func parseBatchJSON(raw json.RawMessage) (message.BatchEntry, error) {
+	var msg batchManifestMessage
+	if err := json.Unmarshal(raw, &msg); err != nil {
+		return message.BatchEntry{}, errors.Wrap(err, "invalid message")
+	}
+
+	methodID := builtin.MethodSend
+	if msg.Method != nil {
+		methodID = *msg.Method
+	}
+	return newBatchEntry(msg.To, msg.Value, methodID)
+}
+
+func newBatchEntry(to, value string, methodID abi.MethodNum) (message.BatchEntry, error) {
+	target, err := address.NewFromString(to)
+	if err != nil {
+		return message.BatchEntry{}, errors.Wrap(err, "invalid target")
+	}
+
+	val, ok := types.NewAttoFILFromFILString(value)
+	if !ok {
+		return message.BatchEntry{}, errors.New("mal-formed value")
+	}
+
+	return message.BatchEntry{To: target, Value: val, Method: methodID}, nil
+}
+
 var signedMsgSendCmd = &cmds.Command{
 	Helptext: cmdkit.HelpText{
 		Tagline: "Send a signed message",
@@ -169,16 +405,67 @@ var signedMsgSendCmd = &cmds.Command{
 	Type: &MessageSendResult{},
 }
 
+var msgReplaceCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Replace a pending message with one paying a higher gas price",
+		ShortDescription: `
+Re-signs a message sent from this node that has not yet been mined with a new
+gas price, and broadcasts it in place of the original. The new gas price must
+be sufficiently higher than the original's for the network to accept it.
+`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("cid", true, false, "CID of the message to replace"),
+	},
+	Options: []cmdkit.Option{
+		priceOption,
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		msgCid, err := cid.Parse(req.Arguments[0])
+		if err != nil {
+			return errors.Wrap(err, "invalid message cid")
+		}
+
+		rawPrice, ok := req.Options["gas-price"].(string)
+		if !ok {
+			return errors.New("gas-price option is required")
+		}
+		gasPrice, ok := types.NewAttoFILFromFILString(rawPrice)
+		if !ok {
+			return errors.New("invalid gas price (specify FIL as a decimal number)")
+		}
+
+		c, err := GetPorcelainAPI(env).MessageReplace(req.Context, msgCid, gasPrice)
+		if err != nil {
+			return err
+		}
+
+		return re.Emit(&MessageSendResult{
+			Cid:     c,
+			GasUsed: gas.NewGas(0),
+			Preview: false,
+		})
+	},
+	Type: &MessageSendResult{},
+}
+
 // WaitResult is the result of a message wait call.
 type WaitResult struct {
 	Message   *types.SignedMessage
 	Receipt   *vm.MessageReceipt
 	Signature vm.ActorMethodSignature
+	// Key of the tipset including the message
+	TipSet block.TipSetKey
 }
 
 var msgWaitCmd = &cmds.Command{
 	Helptext: cmdkit.HelpText{
 		Tagline: "Wait for a message to appear in a mined block",
+		ShortDescription: `
+Waits for a message to appear in a mined block and prints the message, its receipt and the
+key of the tipset including it. With --confidence N, waits until that tipset is N epochs
+below the chain head, waiting again for the message if the tipset is reverted before then.
+`,
 	},
 	Arguments: []cmdkit.Argument{
 		cmdkit.StringArg("cid", true, false, "CID of the message to wait for"),
@@ -188,6 +475,7 @@ var msgWaitCmd = &cmds.Command{
 		cmdkit.BoolOption("receipt", "Print the whole message receipt").WithDefault(true),
 		cmdkit.BoolOption("return", "Print the return value from the receipt").WithDefault(false),
 		cmdkit.Uint64Option("lookback", "Number of previous tipsets to be checked before waiting").WithDefault(msg.DefaultMessageWaitLookback),
+		cmdkit.Uint64Option("confidence", "Number of epochs the including tipset must be below the head").WithDefault(uint64(0)),
 		cmdkit.StringOption("timeout", "Maximum time to wait for message. e.g., 300ms, 1.5h, 2h45m.").WithDefault("10m"),
 	},
 	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
@@ -198,40 +486,34 @@ var msgWaitCmd = &cmds.Command{
 
 		fmt.Printf("waiting for: %s\n", req.Arguments[0])
 
-		found := false
-
 		timeoutDuration, err := time.ParseDuration(req.Options["timeout"].(string))
 		if err != nil {
 			return errors.Wrap(err, "Invalid timeout string")
 		}
 
 		lookback, _ := req.Options["lookback"].(uint64)
+		confidence, _ := req.Options["confidence"].(uint64)
 
 		ctx, cancel := context.WithTimeout(req.Context, timeoutDuration)
 		defer cancel()
 
-		err = GetPorcelainAPI(env).MessageWait(ctx, msgCid, lookback, func(blk *block.Block, msg *types.SignedMessage, receipt *vm.MessageReceipt) error {
-			found = true
-			sig, err := GetPorcelainAPI(env).ActorGetSignature(req.Context, msg.Message.To, msg.Message.Method)
-			if err != nil && err != cst.ErrNoMethod && err != cst.ErrNoActorImpl {
-				return errors.Wrap(err, "Couldn't get signature for message")
-			}
+		found, err := GetPorcelainAPI(env).MessageWaitConfidence(ctx, msgCid, lookback, confidence)
+		if err != nil {
+			return err
+		}
 
-			res := WaitResult{
-				Message: msg,
-				Receipt: receipt,
-				// Signature is required to decode the output.
-				Signature: sig,
-			}
-			re.Emit(&res) // nolint: errcheck
+		sig, err := GetPorcelainAPI(env).ActorGetSignature(req.Context, found.Message.Message.To, found.Message.Message.Method)
+		if err != nil && err != cst.ErrNoMethod && err != cst.ErrNoActorImpl {
+			return errors.Wrap(err, "Couldn't get signature for message")
+		}
 
-			return nil
+		return re.Emit(&WaitResult{
+			Message: found.Message,
+			Receipt: found.Receipt,
+			// Signature is required to decode the output.
+			Signature: sig,
+			TipSet:    found.TipSet,
 		})
-
-		if err != nil && !found {
-			return err
-		}
-		return nil
 	},
 	Type: WaitResult{},
 }
@@ -245,6 +527,89 @@ type MessageStatusResult struct {
 	ChainMsg  *msg.ChainMessage
 }
 
+var msgWatchCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Stream the status of a message",
+		ShortDescription: `
+Streams lifecycle events for a message as it is queued in the outbox, added to the message
+pool, included in a tipset, reverted and finalized. The first events report its current
+status. The stream ends when the message is finalized.
+`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("cid", true, false, "CID of the message to watch"),
+	},
+	Options: []cmdkit.Option{
+		cmdkit.UintOption("lookback", "Number of recent tipsets to search for the message").WithDefault(uint(msg.DefaultMessageWaitLookback)),
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		msgCid, err := cid.Parse(req.Arguments[0])
+		if err != nil {
+			return errors.Wrap(err, "invalid cid "+req.Arguments[0])
+		}
+		lookback, _ := req.Options["lookback"].(uint)
+
+		events, err := GetPorcelainAPI(env).MessageStatusWatch(req.Context, msgCid, lookback)
+		if err != nil {
+			return err
+		}
+		for ev := range events {
+			if err := re.Emit(ev); err != nil {
+				return err
+			}
+		}
+		return req.Context.Err()
+	},
+	Type: message.StatusEvent{},
+}
+
+var msgListCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "List the messages on chain from or to an address",
+		ShortDescription: `
+Lists the messages on chain sent from the address given by --from and/or to the address
+given by --to, in order of epoch. Requires the message history index, which is enabled by
+setting message.indexHistory in the config and covers tipsets from the chain head at the time
+the index was enabled onwards.
+`,
+	},
+	Options: []cmdkit.Option{
+		cmdkit.StringOption("from", "Address of the sender"),
+		cmdkit.StringOption("to", "Address of the recipient"),
+		cmdkit.Uint64Option("since", "Epoch from which to list messages"),
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		var from, to address.Address
+		var err error
+		if o, ok := req.Options["from"]; ok {
+			if from, err = address.NewFromString(o.(string)); err != nil {
+				return errors.Wrap(err, "invalid from address")
+			}
+		}
+		if o, ok := req.Options["to"]; ok {
+			if to, err = address.NewFromString(o.(string)); err != nil {
+				return errors.Wrap(err, "invalid to address")
+			}
+		}
+		if from.Empty() && to.Empty() {
+			return errors.New("at least one of --from and --to is required")
+		}
+		since, _ := req.Options["since"].(uint64)
+
+		msgs, err := GetPorcelainAPI(env).MessageList(req.Context, from, to, abi.ChainEpoch(since))
+		if err != nil {
+			return err
+		}
+		for _, m := range msgs {
+			if err := re.Emit(m); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	Type: &message.IndexedMessage{},
+}
+
 var msgStatusCmd = &cmds.Command{
 	Helptext: cmdkit.HelpText{
 		Tagline: "Show status of a message",
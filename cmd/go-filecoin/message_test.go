@@ -0,0 +1,108 @@
+package commands
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/specs-actors/actors/abi"
+	"github.com/filecoin-project/specs-actors/actors/builtin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	tf "github.com/filecoin-project/go-filecoin/internal/pkg/testhelpers/testflags"
+	"github.com/filecoin-project/go-filecoin/internal/pkg/types"
+	"github.com/filecoin-project/go-filecoin/internal/pkg/vm/gas"
+)
+
+func TestParseBatchManifest(t *testing.T) {
+	tf.UnitTest(t)
+
+	to1, err := address.NewIDAddress(100)
+	require.NoError(t, err)
+	to2, err := address.NewIDAddress(101)
+	require.NoError(t, err)
+
+	manifest := strings.Join([]string{
+		"# recipients",
+		to1.String() + ",1.5",
+		"",
+		"not-an-address,1",
+		to2.String() + ", 2, 3",
+		to2.String() + ",2,3,4",
+	}, "\n")
+
+	lines, entries, results, err := parseBatchManifest(strings.NewReader(manifest), "", gas.NewGas(1000))
+	require.NoError(t, err)
+
+	require.Len(t, results, 4)
+	assert.Equal(t, []int{2, 4, 5, 6}, []int{results[0].Line, results[1].Line, results[2].Line, results[3].Line})
+	assert.Empty(t, results[0].Error)
+	assert.NotEmpty(t, results[1].Error)
+	assert.Empty(t, results[2].Error)
+	assert.NotEmpty(t, results[3].Error)
+
+	require.Len(t, entries, 2)
+	assert.Equal(t, []int{0, 2}, lines)
+
+	val, ok := types.NewAttoFILFromFILString("1.5")
+	require.True(t, ok)
+	assert.Equal(t, to1, entries[0].To)
+	assert.True(t, val.Equals(entries[0].Value))
+	assert.Equal(t, builtin.MethodSend, entries[0].Method)
+	assert.Equal(t, gas.NewGas(1000), entries[0].GasLimit)
+
+	assert.Equal(t, to2, entries[1].To)
+	assert.True(t, types.NewAttoFILFromFIL(2).Equals(entries[1].Value))
+	assert.Equal(t, abi.MethodNum(3), entries[1].Method)
+}
+
+func TestParseBatchManifestJSON(t *testing.T) {
+	tf.UnitTest(t)
+
+	to1, err := address.NewIDAddress(100)
+	require.NoError(t, err)
+	to2, err := address.NewIDAddress(101)
+	require.NoError(t, err)
+
+	manifest := `
+[
+	{"to": "` + to1.String() + `", "value": "1.5"},
+	{"to": "not-an-address", "value": "1"},
+	{"to": "` + to2.String() + `", "value": "2", "method": 3},
+	{"to": "` + to2.String() + `", "value": 2}
+]`
+
+	// The format is detected from the content.
+	lines, entries, results, err := parseBatchManifest(strings.NewReader(manifest), "", gas.NewGas(1000))
+	require.NoError(t, err)
+
+	require.Len(t, results, 4)
+	assert.Equal(t, []int{1, 2, 3, 4}, []int{results[0].Line, results[1].Line, results[2].Line, results[3].Line})
+	assert.Empty(t, results[0].Error)
+	assert.NotEmpty(t, results[1].Error)
+	assert.Empty(t, results[2].Error)
+	assert.NotEmpty(t, results[3].Error)
+
+	require.Len(t, entries, 2)
+	assert.Equal(t, []int{0, 2}, lines)
+
+	val, ok := types.NewAttoFILFromFILString("1.5")
+	require.True(t, ok)
+	assert.Equal(t, to1, entries[0].To)
+	assert.True(t, val.Equals(entries[0].Value))
+	assert.Equal(t, builtin.MethodSend, entries[0].Method)
+	assert.Equal(t, gas.NewGas(1000), entries[0].GasLimit)
+
+	assert.Equal(t, to2, entries[1].To)
+	assert.True(t, types.NewAttoFILFromFIL(2).Equals(entries[1].Value))
+	assert.Equal(t, abi.MethodNum(3), entries[1].Method)
+
+	// An explicit format overrides detection.
+	_, _, _, err = parseBatchManifest(strings.NewReader(manifest), "csv", gas.NewGas(1000))
+	require.NoError(t, err)
+	_, _, _, err = parseBatchManifest(strings.NewReader(to1.String()+",1"), "json", gas.NewGas(1000))
+	assert.Error(t, err)
+	_, _, _, err = parseBatchManifest(strings.NewReader(manifest), "yaml", gas.NewGas(1000))
+	assert.Error(t, err)
+}
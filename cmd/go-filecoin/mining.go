@@ -1,10 +1,18 @@
 package commands
 
 import (
+	"encoding/json"
+	"fmt"
+
 	"github.com/filecoin-project/go-address"
 	"github.com/ipfs/go-cid"
 	cmdkit "github.com/ipfs/go-ipfs-cmdkit"
 	cmds "github.com/ipfs/go-ipfs-cmds"
+	files "github.com/ipfs/go-ipfs-files"
+	"github.com/pkg/errors"
+
+	"github.com/filecoin-project/go-filecoin/internal/pkg/block"
+	"github.com/filecoin-project/go-filecoin/internal/pkg/mining"
 )
 
 var miningCmd = &cmds.Command{
@@ -12,13 +20,17 @@ var miningCmd = &cmds.Command{
 		Tagline: "Manage all mining operations for a node",
 	},
 	Subcommands: map[string]*cmds.Command{
-		"address":       miningAddrCmd,
-		"once":          miningOnceCmd,
-		"start":         miningStartCmd,
-		"status":        miningStatusCmd,
-		"stop":          miningStopCmd,
-		"setup":         miningSetupCmd,
-		"pledge-sector": miningPledgeSectorCmd,
+		"address":        miningAddrCmd,
+		"block-template": miningBlockTemplateCmd,
+		"dry-run":        miningDryRunCmd,
+		"history":        miningHistoryCmd,
+		"once":           miningOnceCmd,
+		"start":          miningStartCmd,
+		"status":         miningStatusCmd,
+		"stop":           miningStopCmd,
+		"submit-block":   miningSubmitBlockCmd,
+		"setup":          miningSetupCmd,
+		"pledge-sector":  miningPledgeSectorCmd,
 	},
 }
 
@@ -50,6 +62,127 @@ var miningOnceCmd = &cmds.Command{
 	Type: cid.Cid{},
 }
 
+var miningBlockTemplateCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Get a template for a block to be mined by an external producer",
+		ShortDescription: `
+Returns the contents of a block for the node's miner on the given base tipset, or the chain
+head, with messages selected from the message pool. An external producer completes the block
+with the miner, ticket, election proof and winning PoSts, signs it with the miner's worker key
+and submits it with submit-block.
+`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("base", false, true, "CIDs of the blocks of the base tipset"),
+	},
+	Options: []cmdkit.Option{
+		cmdkit.Uint64Option("null-rounds", "Number of null rounds after the base tipset"),
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		baseCids, err := cidsFromSlice(req.Arguments)
+		if err != nil {
+			return err
+		}
+		nullRounds, _ := req.Options["null-rounds"].(uint64)
+
+		tmpl, err := GetBlockAPI(env).MiningBlockTemplate(req.Context, block.NewTipSetKey(baseCids...), nullRounds)
+		if err != nil {
+			return err
+		}
+		return re.Emit(tmpl)
+	},
+	Type: &mining.BlockTemplate{},
+}
+
+var miningSubmitBlockCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Submit a signed block built by an external producer",
+		ShortDescription: `
+Validates a signed block header, in JSON, and propagates it to the network. The block's
+messages must be those of a template from block-template. Returns the block's CID once the
+block has been synced.
+`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.FileArg("header", true, false, "File containing the block header in JSON").EnableStdin(),
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		iter := req.Files.Entries()
+		if !iter.Next() {
+			return fmt.Errorf("no file given: %s", iter.Err())
+		}
+		fi, ok := iter.Node().(files.File)
+		if !ok {
+			return fmt.Errorf("given file was not a files.File")
+		}
+
+		var header block.Block
+		if err := json.NewDecoder(fi).Decode(&header); err != nil {
+			return errors.Wrap(err, "invalid block header")
+		}
+
+		blkCid, err := GetBlockAPI(env).MiningSubmitBlock(req.Context, &header)
+		if err != nil {
+			return err
+		}
+		return re.Emit(blkCid)
+	},
+	Type: cid.Cid{},
+}
+
+var miningDryRunCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Evaluate elections on each new head without mining blocks",
+		ShortDescription: `
+Runs the election and winning PoSt for each new chain head as if mining, but never generates
+or publishes a block. Streams whether each election was won, with the miner's expected win
+rate and the totals so far, and records them in the mining journal. Runs until interrupted.
+`,
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		outcomes, err := GetBlockAPI(env).MiningDryRun(req.Context)
+		if err != nil {
+			return err
+		}
+		for outcome := range outcomes {
+			if err := re.Emit(outcome); err != nil {
+				return err
+			}
+		}
+		return req.Context.Err()
+	},
+	Type: &mining.DryRunOutcome{},
+}
+
+var miningHistoryCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Show the outcomes of recent mining attempts",
+		ShortDescription: `
+Shows the outcome of each of the most recent epochs the node attempted to mine, most recent
+first: the base tipset, null rounds, drand round, ticket, whether the election was won, the
+miner's power ratio, the block and its message count, the duration and any error. Outcomes
+are kept in memory since the node started and are also recorded in the mining journal.
+`,
+	},
+	Options: []cmdkit.Option{
+		cmdkit.UintOption("count", "Number of epochs to show, or 0 for all retained").WithDefault(uint(10)),
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		count, _ := req.Options["count"].(uint)
+		outcomes, err := GetBlockAPI(env).MiningHistory(req.Context, count)
+		if err != nil {
+			return err
+		}
+		for _, outcome := range outcomes {
+			if err := re.Emit(outcome); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	Type: &mining.EpochOutcome{},
+}
+
 var miningSetupCmd = &cmds.Command{
 	Helptext: cmdkit.HelpText{
 		Tagline: "Prepare node to receive storage deals without starting the mining scheduler",
@@ -63,12 +196,43 @@ var miningSetupCmd = &cmds.Command{
 	Type: "",
 }
 
+var minerOption = cmdkit.StringOption("miner", "Address of one of the node's miners")
+
+// optionalMiner returns the address given by the miner option, if any.
+func optionalMiner(req *cmds.Request) (address.Address, error) {
+	o, ok := req.Options["miner"]
+	if !ok {
+		return address.Undef, nil
+	}
+	minerAddr, err := address.NewFromString(o.(string))
+	if err != nil {
+		return address.Undef, errors.Wrap(err, "invalid miner address")
+	}
+	return minerAddr, nil
+}
+
 var miningStartCmd = &cmds.Command{
 	Helptext: cmdkit.HelpText{
 		Tagline: "Start mining blocks and other mining related operations",
+		ShortDescription: `
+Starts mining for the node's primary miner and each of its additional miners, or only for the
+miner given by --miner.
+`,
+	},
+	Options: []cmdkit.Option{
+		minerOption,
 	},
 	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
-		if err := GetBlockAPI(env).MiningStart(req.Context); err != nil {
+		minerAddr, err := optionalMiner(req)
+		if err != nil {
+			return err
+		}
+		if minerAddr.Empty() {
+			err = GetBlockAPI(env).MiningStart(req.Context)
+		} else {
+			err = GetBlockAPI(env).MinerStart(req.Context, minerAddr)
+		}
+		if err != nil {
 			return err
 		}
 		return re.Emit("Started mining")
@@ -85,8 +249,29 @@ type MiningStatusResult struct {
 var miningStatusCmd = &cmds.Command{
 	Helptext: cmdkit.HelpText{
 		Tagline: "Report on mining status",
+		ShortDescription: `
+Reports whether the node is mining for its primary miner, or for the miner given by --miner.
+`,
+	},
+	Options: []cmdkit.Option{
+		minerOption,
 	},
 	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		minerAddr, err := optionalMiner(req)
+		if err != nil {
+			return err
+		}
+		if !minerAddr.Empty() {
+			active, err := GetBlockAPI(env).MinerIsActive(minerAddr)
+			if err != nil {
+				return err
+			}
+			return re.Emit(&MiningStatusResult{
+				Miner:  minerAddr,
+				Active: active,
+			})
+		}
+
 		isMining := GetBlockAPI(env).MiningIsActive()
 
 		// Get the Miner Address
@@ -106,9 +291,23 @@ var miningStatusCmd = &cmds.Command{
 var miningStopCmd = &cmds.Command{
 	Helptext: cmdkit.HelpText{
 		Tagline: "Stop block mining",
+		ShortDescription: `
+Stops mining for all of the node's miners, or only for the miner given by --miner.
+`,
+	},
+	Options: []cmdkit.Option{
+		minerOption,
 	},
 	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
-		GetBlockAPI(env).MiningStop(req.Context)
+		minerAddr, err := optionalMiner(req)
+		if err != nil {
+			return err
+		}
+		if minerAddr.Empty() {
+			GetBlockAPI(env).MiningStop(req.Context)
+		} else if err := GetBlockAPI(env).MinerStop(req.Context, minerAddr); err != nil {
+			return err
+		}
 		return re.Emit("Stopped mining")
 	},
 }
@@ -21,12 +21,23 @@ var outboxCmd = &cmds.Command{
 // OutboxLsResult is a listing of the outbox for a single address.
 type OutboxLsResult struct {
 	Address  address.Address
-	Messages []*message.Queued
+	Messages []*OutboxLsMessage
+}
+
+// OutboxLsMessage is a queued message and its age, the number of rounds since it was enqueued.
+type OutboxLsMessage struct {
+	*message.Queued
+	Age uint64
 }
 
 var outboxLsCmd = &cmds.Command{
 	Helptext: cmdkit.HelpText{
 		Tagline: "List the queue(s) of sent but un-mined messages",
+		ShortDescription: `
+Lists the messages sent from this node that have not yet been mined. Each message
+is listed with its age, the number of rounds since it was sent, and the round at
+which it was last rebroadcast, if it has been.
+`,
 	},
 	Arguments: []cmdkit.Argument{
 		cmdkit.StringArg("address", false, false, "Address of the queue to list (otherwise lists all)"),
@@ -37,8 +48,24 @@ var outboxLsCmd = &cmds.Command{
 			return err
 		}
 
+		head, err := GetPorcelainAPI(env).ChainHead()
+		if err != nil {
+			return err
+		}
+		height, err := head.Height()
+		if err != nil {
+			return err
+		}
+
 		for _, addr := range addresses {
-			msgs := GetPorcelainAPI(env).OutboxQueueLs(addr)
+			var msgs []*OutboxLsMessage
+			for _, qm := range GetPorcelainAPI(env).OutboxQueueLs(addr) {
+				var age uint64
+				if uint64(height) > qm.Stamp {
+					age = uint64(height) - qm.Stamp
+				}
+				msgs = append(msgs, &OutboxLsMessage{Queued: qm, Age: age})
+			}
 			err := re.Emit(OutboxLsResult{addr, msgs})
 			if err != nil {
 				return err
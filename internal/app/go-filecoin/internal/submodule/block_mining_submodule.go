@@ -4,6 +4,9 @@ import (
 	"context"
 	"sync"
 
+	"github.com/filecoin-project/go-address"
+
+	"github.com/filecoin-project/go-filecoin/internal/pkg/journal"
 	"github.com/filecoin-project/go-filecoin/internal/pkg/mining"
 	"github.com/filecoin-project/go-filecoin/internal/pkg/postgenerator"
 	mining_protocol "github.com/filecoin-project/go-filecoin/internal/pkg/protocol/mining"
@@ -25,14 +28,41 @@ type BlockMiningSubmodule struct {
 	}
 	MiningDoneWg *sync.WaitGroup
 
+	// Miners the node mines blocks for in addition to the primary miner, by address.
+	AdditionalMiners struct {
+		sync.Mutex
+		Miners map[address.Address]*AdditionalMiner
+	}
+
 	// Inject non-default post generator here or leave nil for default
 	PoStGenerator postgenerator.PoStGenerator
+
+	// Records mining events.
+	Journal journal.Writer
+}
+
+// AdditionalMiner holds the state for mining blocks for one of the node's additional miner
+// actors. Each has its own storage mining submodule, which seals its sectors and submits its
+// window PoSts, and its own worker and scheduler.
+type AdditionalMiner struct {
+	Address       address.Address
+	StorageMining *StorageMiningSubmodule
+	Worker        *mining.DefaultWorker
+	Scheduler     mining.Scheduler
+	// Cancel cancels the context for block production.
+	Cancel   context.CancelFunc
+	DoneWg   *sync.WaitGroup
+	IsMining bool
 }
 
 type newBlockFunc func(context.Context, mining.FullBlock)
 
+type blockMiningConfig interface {
+	Journal() journal.Journal
+}
+
 // NewBlockMiningSubmodule creates a new block mining submodule.
-func NewBlockMiningSubmodule(ctx context.Context, gen postgenerator.PoStGenerator) (BlockMiningSubmodule, error) {
+func NewBlockMiningSubmodule(ctx context.Context, config blockMiningConfig, gen postgenerator.PoStGenerator) (BlockMiningSubmodule, error) {
 	return BlockMiningSubmodule{
 		// BlockMiningAPI:     nil,
 		// AddNewlyMinedBlock: nil,
@@ -43,5 +73,6 @@ func NewBlockMiningSubmodule(ctx context.Context, gen postgenerator.PoStGenerato
 		// miningDoneWg: nil,
 		// MessageSub:   nil,
 		PoStGenerator: gen,
+		Journal:       config.Journal().Topic("mining"),
 	}, nil
 }
@@ -3,14 +3,17 @@ package submodule
 import (
 	"context"
 
+	"github.com/filecoin-project/specs-actors/actors/abi"
 	"github.com/ipfs/go-cid"
 
 	"github.com/filecoin-project/go-filecoin/internal/app/go-filecoin/plumbing/cst"
 	"github.com/filecoin-project/go-filecoin/internal/pkg/chain"
+	"github.com/filecoin-project/go-filecoin/internal/pkg/config"
 	"github.com/filecoin-project/go-filecoin/internal/pkg/consensus"
 	"github.com/filecoin-project/go-filecoin/internal/pkg/repo"
 	"github.com/filecoin-project/go-filecoin/internal/pkg/slashing"
 	appstate "github.com/filecoin-project/go-filecoin/internal/pkg/state"
+	"github.com/filecoin-project/go-filecoin/internal/pkg/version"
 	"github.com/filecoin-project/go-filecoin/internal/pkg/vm/actor/builtin"
 	"github.com/filecoin-project/go-filecoin/internal/pkg/vmsupport"
 )
@@ -26,6 +29,10 @@ type ChainSubmodule struct {
 	Processor  *consensus.DefaultProcessor
 
 	StatusReporter *chain.StatusReporter
+
+	// StatePruner removes old state from the blockstore. It is nil when
+	// state pruning is disabled.
+	StatePruner *chain.StatePruner
 }
 
 // xxx go back to using an interface here
@@ -43,6 +50,7 @@ type ChainSubmodule struct {
 */
 type chainRepo interface {
 	ChainDatastore() repo.Datastore
+	Config() *config.Config
 }
 
 type chainConfig interface {
@@ -50,7 +58,7 @@ type chainConfig interface {
 }
 
 // NewChainSubmodule creates a new chain submodule.
-func NewChainSubmodule(config chainConfig, repo chainRepo, blockstore *BlockstoreSubmodule, verifier *ProofVerificationSubmodule) (ChainSubmodule, error) {
+func NewChainSubmodule(config chainConfig, repo chainRepo, blockstore *BlockstoreSubmodule, verifier *ProofVerificationSubmodule, versions *version.ProtocolVersionTable) (ChainSubmodule, error) {
 	// initialize chain store
 	chainStatusReporter := chain.NewStatusReporter()
 	chainStore := chain.NewStore(repo.ChainDatastore(), blockstore.CborStore, chainStatusReporter, config.GenesisCid())
@@ -60,7 +68,17 @@ func NewChainSubmodule(config chainConfig, repo chainRepo, blockstore *Blockstor
 	chainState := cst.NewChainStateReadWriter(chainStore, messageStore, blockstore.Blockstore, builtin.DefaultActors)
 	faultChecker := slashing.NewFaultChecker(chainState)
 	syscalls := vmsupport.NewSyscalls(faultChecker, verifier.ProofVerifier)
-	processor := consensus.NewDefaultProcessor(syscalls, chainState)
+	upgrades := consensus.NewUpgradeSchedule(versions, consensus.DefaultUpgrades)
+	processor := consensus.NewUpgradingProcessor(syscalls, chainState, chainState, upgrades)
+
+	var pruner *chain.StatePruner
+	retention := repo.Config().Chain.StateRetentionEpochs
+	if err := config.ValidateStateRetentionEpochs(retention); err != nil {
+		return ChainSubmodule{}, err
+	}
+	if retention > 0 {
+		pruner = chain.NewStatePruner(chainStore, blockstore.Blockstore, abi.ChainEpoch(retention))
+	}
 
 	return ChainSubmodule{
 		ChainReader:    chainStore,
@@ -69,6 +87,7 @@ func NewChainSubmodule(config chainConfig, repo chainRepo, blockstore *Blockstor
 		State:          chainState,
 		Processor:      processor,
 		StatusReporter: chainStatusReporter,
+		StatePruner:    pruner,
 	}, nil
 }
 
@@ -76,7 +95,13 @@ type chainNode interface {
 	Chain() ChainSubmodule
 }
 
-// Start loads the chain from disk.
+// Start loads the chain from disk and starts pruning old state if enabled.
 func (c *ChainSubmodule) Start(ctx context.Context, node chainNode) error {
-	return node.Chain().ChainReader.Load(ctx)
+	if err := node.Chain().ChainReader.Load(ctx); err != nil {
+		return err
+	}
+	if pruner := node.Chain().StatePruner; pruner != nil {
+		pruner.Start(ctx)
+	}
+	return nil
 }
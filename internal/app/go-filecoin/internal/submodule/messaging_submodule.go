@@ -3,6 +3,8 @@ package submodule
 import (
 	"context"
 
+	"github.com/filecoin-project/specs-actors/actors/builtin/miner"
+	ds "github.com/ipfs/go-datastore"
 	"github.com/pkg/errors"
 
 	"github.com/filecoin-project/go-filecoin/internal/pkg/config"
@@ -27,6 +29,12 @@ type MessagingSubmodule struct {
 
 	MsgPool   *message.Pool
 	MsgSigVal *consensus.MessageSignatureValidator
+
+	// Index of on-chain messages by address, nil unless enabled in config.
+	Indexer *message.Indexer
+
+	// Streams the status of messages as they progress to the chain.
+	StatusTracker *message.StatusTracker
 }
 
 type messagingConfig interface {
@@ -35,6 +43,7 @@ type messagingConfig interface {
 
 type messagingRepo interface {
 	Config() *config.Config
+	Datastore() ds.Batching
 }
 
 // NewMessagingSubmodule creates a new discovery submodule.
@@ -55,11 +64,21 @@ func NewMessagingSubmodule(ctx context.Context, config messagingConfig, repo mes
 		return MessagingSubmodule{}, err
 	}
 
-	msgQueue := message.NewQueue()
-	outboxPolicy := message.NewMessageQueuePolicy(chain.MessageStore, message.OutboxMaxAgeRounds)
+	msgQueue, err := message.NewPersistentQueue(repo.Datastore())
+	if err != nil {
+		return MessagingSubmodule{}, errors.Wrap(err, "failed to load outbound message queue")
+	}
 	msgPublisher := message.NewDefaultPublisher(pubsub.NewTopic(topic), msgPool)
+	outboxPolicy := message.NewRebroadcastingQueuePolicy(chain.MessageStore, message.OutboxMaxAgeRounds, msgPublisher, repo.Config().Message.RebroadcastIntervalRounds)
 	outbox := message.NewOutbox(wallet.Signer, msgSyntaxValidator, msgQueue, msgPublisher, outboxPolicy, chain.ChainReader, chain.State, config.Journal().Topic("outbox"))
 
+	var indexer *message.Indexer
+	if repo.Config().Message.IndexHistory {
+		indexer = message.NewIndexer(chain.ChainReader, chain.MessageStore, repo.Datastore())
+	}
+
+	statusTracker := message.NewStatusTracker(chain.ChainReader, chain.MessageStore, msgPool, msgQueue, miner.ChainFinalityish)
+
 	return MessagingSubmodule{
 		Inbox:        inbox,
 		Outbox:       outbox,
@@ -67,5 +86,8 @@ func NewMessagingSubmodule(ctx context.Context, config messagingConfig, repo mes
 		// MessageSub: nil,
 		MsgPool:   msgPool,
 		MsgSigVal: msgSignatureValidator,
+		Indexer:   indexer,
+
+		StatusTracker: statusTracker,
 	}, nil
 }
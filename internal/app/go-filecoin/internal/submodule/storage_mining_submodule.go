@@ -19,7 +19,7 @@ import (
 	fsmstorage "github.com/filecoin-project/go-filecoin/internal/app/go-filecoin/connectors/fsm_storage"
 	"github.com/filecoin-project/go-filecoin/internal/app/go-filecoin/connectors/sectors"
 	"github.com/filecoin-project/go-filecoin/internal/app/go-filecoin/plumbing/msg"
-	"github.com/filecoin-project/go-filecoin/internal/pkg/block"
+	"github.com/filecoin-project/go-filecoin/internal/pkg/chain"
 	"github.com/filecoin-project/go-filecoin/internal/pkg/chainsampler"
 	"github.com/filecoin-project/go-filecoin/internal/pkg/piecemanager"
 	"github.com/filecoin-project/go-filecoin/internal/pkg/poster"
@@ -56,7 +56,7 @@ func NewStorageMiningSubmodule(
 	r repo.Repo,
 	postGeneratorOverride postgenerator.PoStGenerator,
 ) (*StorageMiningSubmodule, error) {
-	chainThresholdScheduler := chainsampler.NewHeightThresholdScheduler(c.ChainReader)
+	chainThresholdScheduler := chainsampler.NewHeightThresholdScheduler()
 
 	ccn := fsmchain.NewChainConnector(c.ChainReader)
 
@@ -150,8 +150,8 @@ func (s *StorageMiningSubmodule) Stop(ctx context.Context) error {
 	return nil
 }
 
-// HandleNewHead submits a new chain head for possible fallback PoSt.
-func (s *StorageMiningSubmodule) HandleNewHead(ctx context.Context, newHead block.TipSet) error {
+// HandleHeadChange submits a new chain head for possible fallback PoSt.
+func (s *StorageMiningSubmodule) HandleHeadChange(ctx context.Context, change chain.HeadChange) error {
 	s.startedLk.RLock()
 	defer s.startedLk.RUnlock()
 
@@ -159,12 +159,15 @@ func (s *StorageMiningSubmodule) HandleNewHead(ctx context.Context, newHead bloc
 		return nil
 	}
 
-	err := s.hs.HandleNewTipSet(ctx, newHead)
+	err := s.hs.HandleHeadChange(ctx, change)
 	if err != nil {
 		return err
 	}
 
-	return s.poster.HandleNewHead(ctx, newHead)
+	if len(change.Apply) == 0 {
+		return nil
+	}
+	return s.poster.HandleNewHead(ctx, change.Apply[0])
 }
 
 func getMinerProvingPeriod(c *ChainSubmodule, minerAddr address.Address, viewer *appstate.Viewer) (abi.ChainEpoch, error) {
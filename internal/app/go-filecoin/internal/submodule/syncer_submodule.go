@@ -35,6 +35,8 @@ type SyncerSubmodule struct {
 
 	// cancelChainSync cancels the context for chain sync subscriptions and handlers.
 	CancelChainSync context.CancelFunc
+	// FaultReporter reports detected consensus faults. It is nil if reporting is disabled.
+	FaultReporter *slashing.ConsensusFaultReporter
 	// faultCh receives detected consensus faults
 	faultCh chan slashing.ConsensusFault
 }
@@ -131,9 +133,10 @@ func (s *SyncerSubmodule) Start(ctx context.Context, _node syncerNode) error {
 			select {
 			case <-ctx.Done():
 				return
-			case <-s.faultCh:
-				// TODO #3690 connect this up to a slasher that sends messages
-				// to outbound queue to carry out penalization
+			case fault := <-s.faultCh:
+				if s.FaultReporter != nil {
+					s.FaultReporter.HandleFault(ctx, fault)
+				}
 			}
 		}
 	}()
@@ -7,20 +7,31 @@ import (
 	"go.opencensus.io/trace"
 
 	"github.com/filecoin-project/go-filecoin/internal/pkg/block"
+	"github.com/filecoin-project/go-filecoin/internal/pkg/consensus"
 	"github.com/filecoin-project/go-filecoin/internal/pkg/encoding"
 	"github.com/filecoin-project/go-filecoin/internal/pkg/metrics/tracing"
 	"github.com/filecoin-project/go-filecoin/internal/pkg/mining"
 	"github.com/filecoin-project/go-filecoin/internal/pkg/net/blocksub"
 	"github.com/filecoin-project/go-filecoin/internal/pkg/net/pubsub"
+	"github.com/filecoin-project/go-filecoin/internal/pkg/types"
 )
 
-// AddNewBlock receives a newly mined block and stores, validates and propagates it to the network.
+// AddNewBlock receives a newly mined block and validates, stores and propagates it to the network.
+// The block is validated as the syncer validates blocks received from the network, so that a
+// faulty block is never published. Invalid blocks are recorded in the mining journal.
 func (node *Node) AddNewBlock(ctx context.Context, o mining.FullBlock) (err error) {
 	b := o.Header
 	ctx, span := trace.StartSpan(ctx, "Node.AddNewBlock")
 	span.AddAttributes(trace.StringAttribute("block", b.Cid().String()))
 	defer tracing.AddErrorEndSpan(ctx, span, &err)
 
+	log.Debugf("validating new block: %s", b.Cid().String())
+	if err := node.validateOwnBlock(ctx, b); err != nil {
+		node.BlockMining.Journal.Write("InvalidBlock",
+			"block", b.Cid().String(), "height", b.Height, "miner", b.Miner.String(), "error", err.Error())
+		return errors.Wrapf(err, "refusing to publish invalid block %s", b.Cid())
+	}
+
 	// Put block in storage wired to an exchange so this node and other
 	// nodes can fetch it.
 	log.Debugf("putting block in bitswap exchange: %s", b.Cid().String())
@@ -47,6 +58,32 @@ func (node *Node) AddNewBlock(ctx context.Context, o mining.FullBlock) (err erro
 	return node.syncer.ChainSyncManager.BlockProposer().SendOwnBlock(ci)
 }
 
+// SubmitBlock adds a signed block built by an external producer, typically from a block template,
+// to the chain and propagates it to the network as if mined by this node. The block is validated
+// before it is published. The block's messages must be in the node's message store.
+func (node *Node) SubmitBlock(ctx context.Context, header *block.Block) error {
+	secpMsgs, blsMsgs, err := node.chain.MessageStore.LoadMessages(ctx, header.Messages.Cid)
+	if err != nil {
+		return errors.Wrapf(err, "failed to load messages of block %s", header.Cid())
+	}
+	// Only the unsigned BLS messages are needed to propagate the block.
+	wrappedBLSMsgs := make([]*types.SignedMessage, len(blsMsgs))
+	for i, msg := range blsMsgs {
+		wrappedBLSMsgs[i] = &types.SignedMessage{Message: *msg}
+	}
+
+	return node.addMinedBlockSynchronous(ctx, *mining.NewfullBlock(header, wrappedBLSMsgs, secpMsgs))
+}
+
+// validateOwnBlock runs the syntactic, semantic and state transition validation of a block
+// produced by this node.
+func (node *Node) validateOwnBlock(ctx context.Context, b *block.Block) error {
+	if err := consensus.NewDefaultBlockValidator(node.ChainClock).ValidateSyntax(ctx, b); err != nil {
+		return err
+	}
+	return node.syncer.ChainSyncManager.ValidateBlock(ctx, b)
+}
+
 func (node *Node) handleBlockSub(ctx context.Context, msg pubsub.Message) (err error) {
 	sender := msg.GetSender()
 	source := msg.GetSource()
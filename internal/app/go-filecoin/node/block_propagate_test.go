@@ -15,10 +15,13 @@ import (
 
 	. "github.com/filecoin-project/go-filecoin/internal/app/go-filecoin/node"
 	"github.com/filecoin-project/go-filecoin/internal/app/go-filecoin/node/test"
+	"github.com/filecoin-project/go-filecoin/internal/pkg/block"
 	"github.com/filecoin-project/go-filecoin/internal/pkg/clock"
 	"github.com/filecoin-project/go-filecoin/internal/pkg/consensus"
 	"github.com/filecoin-project/go-filecoin/internal/pkg/constants"
 	"github.com/filecoin-project/go-filecoin/internal/pkg/drand"
+	e "github.com/filecoin-project/go-filecoin/internal/pkg/enccid"
+	"github.com/filecoin-project/go-filecoin/internal/pkg/mining"
 	"github.com/filecoin-project/go-filecoin/internal/pkg/proofs"
 	tf "github.com/filecoin-project/go-filecoin/internal/pkg/testhelpers/testflags"
 	"github.com/filecoin-project/go-filecoin/internal/pkg/types"
@@ -102,6 +105,88 @@ func TestChainSyncA(t *testing.T) {
 	assert.True(t, equal, "failed to sync chains")
 }
 
+func TestSubmitBlockFromTemplate(t *testing.T) {
+	tf.IntegrationTest(t)
+
+	ctx := context.Background()
+	_, nodes, fakeClock, blockTime := makeNodesBlockPropTests(t, 2)
+
+	StartNodes(t, nodes)
+	defer StopNodes(nodes)
+
+	ConnectNodes(t, nodes[0], nodes[1])
+	miningAPI := nodes[0].BlockMining.BlockMiningAPI
+
+	// Run the election without adding the block, to take the election outputs an external block
+	// producer would supply.
+	fakeClock.Advance(blockTime)
+	base, err := nodes[0].PorcelainAPI.ChainHead()
+	require.NoError(t, err)
+	worker, err := nodes[0].GetMiningWorker(ctx)
+	require.NoError(t, err)
+	mined, err := mining.MineOnce(ctx, *worker, base)
+	require.NoError(t, err)
+	baseHeight, err := base.Height()
+	require.NoError(t, err)
+	nullBlkCount := uint64(mined.Header.Height - baseHeight - 1)
+
+	tmpl, err := miningAPI.MiningBlockTemplate(ctx, base.Key(), nullBlkCount)
+	require.NoError(t, err)
+	assert.Equal(t, base.Key(), tmpl.Parents)
+	assert.Equal(t, mined.Header.Height, tmpl.Height)
+
+	view, err := nodes[0].PorcelainAPI.PowerStateView(base.Key())
+	require.NoError(t, err)
+	_, workerAddr, err := view.MinerControlAddresses(ctx, mined.Header.Miner)
+	require.NoError(t, err)
+	signerAddr, err := view.AccountSignerAddress(ctx, workerAddr)
+	require.NoError(t, err)
+	fromTemplate := func(weight specsbig.Int) *block.Block {
+		blk := &block.Block{
+			Miner:           mined.Header.Miner,
+			Ticket:          mined.Header.Ticket,
+			ElectionProof:   mined.Header.ElectionProof,
+			PoStProofs:      mined.Header.PoStProofs,
+			Parents:         tmpl.Parents,
+			ParentWeight:    weight,
+			Height:          tmpl.Height,
+			StateRoot:       e.NewCid(tmpl.StateRoot),
+			MessageReceipts: e.NewCid(tmpl.MessageReceipts),
+			Messages:        e.NewCid(tmpl.Messages),
+			BLSAggregateSig: &tmpl.BLSAggregateSig,
+			BeaconEntries:   tmpl.BeaconEntries,
+			Timestamp:       tmpl.Timestamp,
+		}
+		sig, err := nodes[0].Wallet.Wallet.SignBytes(blk.SignatureData(), signerAddr)
+		require.NoError(t, err)
+		blk.BlockSig = &sig
+		return blk
+	}
+
+	// A block failing validation is not published.
+	invalid := fromTemplate(specsbig.Add(tmpl.ParentWeight, specsbig.NewInt(1)))
+	_, err = miningAPI.MiningSubmitBlock(ctx, invalid)
+	assert.Error(t, err)
+	assert.True(t, nodes[0].PorcelainAPI.ChainHeadKey().Equals(base.Key()))
+
+	header := fromTemplate(tmpl.ParentWeight)
+	submitted, err := miningAPI.MiningSubmitBlock(ctx, header)
+	require.NoError(t, err)
+	assert.Equal(t, header.Cid(), submitted)
+
+	equal := false
+	for i := 0; i < 30; i++ {
+		otherHead := nodes[1].PorcelainAPI.ChainHeadKey()
+		assert.NotNil(t, otherHead)
+		equal = otherHead.Has(submitted)
+		if equal {
+			break
+		}
+		time.Sleep(time.Millisecond * 50)
+	}
+	assert.True(t, equal, "failed to sync submitted block")
+}
+
 func TestChainSyncWithMessages(t *testing.T) {
 	tf.IntegrationTest(t)
 	ctx := context.Background()
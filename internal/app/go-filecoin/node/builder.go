@@ -29,6 +29,7 @@ import (
 	drandapi "github.com/filecoin-project/go-filecoin/internal/pkg/protocol/drand"
 	"github.com/filecoin-project/go-filecoin/internal/pkg/protocol/storage"
 	"github.com/filecoin-project/go-filecoin/internal/pkg/repo"
+	"github.com/filecoin-project/go-filecoin/internal/pkg/slashing"
 	"github.com/filecoin-project/go-filecoin/internal/pkg/state"
 	"github.com/filecoin-project/go-filecoin/internal/pkg/version"
 )
@@ -229,7 +230,7 @@ func (b *Builder) build(ctx context.Context) (*Node, error) {
 		return nil, errors.Wrap(err, "failed to build node.Discovery")
 	}
 
-	nd.VersionTable, err = version.ConfigureProtocolVersions(nd.network.NetworkName)
+	nd.VersionTable, err = version.ConfigureProtocolVersions(nd.network.NetworkName, b.repo.Config().NetworkParams.ProtocolUpgrades)
 	if err != nil {
 		return nil, err
 	}
@@ -241,7 +242,7 @@ func (b *Builder) build(ctx context.Context) (*Node, error) {
 
 	nd.ProofVerification = submodule.NewProofVerificationSubmodule(b.verifier)
 
-	nd.chain, err = submodule.NewChainSubmodule((*builder)(b), b.repo, &nd.Blockstore, &nd.ProofVerification)
+	nd.chain, err = submodule.NewChainSubmodule((*builder)(b), b.repo, &nd.Blockstore, &nd.ProofVerification, nd.VersionTable)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to build node.Chain")
 	}
@@ -287,12 +288,13 @@ func (b *Builder) build(ctx context.Context) (*Node, error) {
 		return nil, errors.Wrap(err, "failed to build node.StorageNetworking")
 	}
 
-	nd.BlockMining, err = submodule.NewBlockMiningSubmodule(ctx, b.postGen)
+	nd.BlockMining, err = submodule.NewBlockMiningSubmodule(ctx, (*builder)(b), b.postGen)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to build node.BlockMining")
 	}
 
 	waiter := msg.NewWaiter(nd.chain.ChainReader, nd.chain.MessageStore, nd.Blockstore.Blockstore, nd.Blockstore.CborStore)
+	previewer := msg.NewPreviewer(nd.chain.ChainReader, nd.chain.State, nd.Blockstore.CborStore, nd.Blockstore.Blockstore, nd.chain.Processor)
 
 	nd.PorcelainAPI = porcelain.New(plumbing.New(&plumbing.APIDeps{
 		Chain:        nd.chain.State,
@@ -300,8 +302,11 @@ func (b *Builder) build(ctx context.Context) (*Node, error) {
 		Config:       cfg.NewConfig(b.repo),
 		DAG:          dag.NewDAG(merkledag.NewDAGService(nd.Blockservice.Blockservice)),
 		Expected:     nd.syncer.Consensus,
+		GasEstimator: msg.NewGasEstimator(previewer, nd.chain.ChainReader, nd.chain.MessageStore, b.repo.Config().Message),
+		MsgIndexer:   nd.Messaging.Indexer,
 		MsgPool:      nd.Messaging.MsgPool,
-		MsgPreviewer: msg.NewPreviewer(nd.chain.ChainReader, nd.Blockstore.CborStore, nd.Blockstore.Blockstore, nd.chain.Processor),
+		MsgPreviewer: previewer,
+		MsgStatus:    nd.Messaging.StatusTracker,
 		MsgWaiter:    waiter,
 		Network:      nd.network.Network,
 		Outbox:       nd.Messaging.Outbox,
@@ -309,6 +314,18 @@ func (b *Builder) build(ctx context.Context) (*Node, error) {
 		Wallet:       nd.Wallet.Wallet,
 	}))
 
+	if slashingCfg := b.repo.Config().Slashing; slashingCfg.ReportConsensusFaults {
+		reporterAddr := slashingCfg.ReporterAddress
+		if reporterAddr.Empty() {
+			reporterAddr, err = nd.PorcelainAPI.WalletDefaultAddress()
+			if err != nil {
+				return nil, errors.Wrap(err, "failed to get consensus fault reporter address")
+			}
+		}
+		nd.syncer.FaultReporter = slashing.NewConsensusFaultReporter(reporterAddr, msg.GasPriceAuto, msg.GasLimitAuto,
+			nd.chain.State, nd.PorcelainAPI, waiter, b.journal.Topic("slashing"))
+	}
+
 	nd.StorageProtocol, err = submodule.NewStorageProtocolSubmodule(
 		ctx,
 		nd.PorcelainAPI.WalletDefaultAddress,
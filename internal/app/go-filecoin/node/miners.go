@@ -0,0 +1,245 @@
+package node
+
+import (
+	"context"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/namespace"
+	"github.com/pkg/errors"
+
+	"github.com/filecoin-project/go-filecoin/internal/app/go-filecoin/internal/submodule"
+	"github.com/filecoin-project/go-filecoin/internal/pkg/chain"
+	"github.com/filecoin-project/go-filecoin/internal/pkg/mining"
+)
+
+// Namespace of the datastore in which the state of additional miners is persisted, keyed by
+// miner address.
+var additionalMinersPrefix = datastore.NewKey("/miners")
+
+// MinerAddresses returns the addresses of all the miner actors the node mines for: the primary
+// miner followed by any additional miners.
+func (node *Node) MinerAddresses() []address.Address {
+	var addrs []address.Address
+	if primary, err := node.MiningAddress(); err == nil {
+		addrs = append(addrs, primary)
+	}
+	for _, addr := range node.Repo.Config().Mining.AdditionalMiners {
+		if !containsAddress(addrs, addr) {
+			addrs = append(addrs, addr)
+		}
+	}
+	return addrs
+}
+
+// StartMiner starts mining blocks for one of the node's miner actors.
+func (node *Node) StartMiner(ctx context.Context, minerAddr address.Address) error {
+	if node.isPrimaryMiner(minerAddr) {
+		return node.startPrimaryMining(ctx)
+	}
+
+	m, err := node.setupAdditionalMiner(ctx, minerAddr)
+	if err != nil {
+		return errors.Wrapf(err, "failed to setup mining for %s", minerAddr)
+	}
+
+	node.BlockMining.AdditionalMiners.Lock()
+	if m.IsMining {
+		node.BlockMining.AdditionalMiners.Unlock()
+		return errors.Errorf("already mining for %s", minerAddr)
+	}
+
+	if m.Scheduler == nil {
+		m.Scheduler = mining.NewScheduler(m.Worker, node.PorcelainAPI.ChainHead, node.ChainClock)
+	} else if m.Scheduler.IsStarted() {
+		node.BlockMining.AdditionalMiners.Unlock()
+		return errors.Errorf("miner scheduler for %s already started", minerAddr)
+	}
+
+	var miningCtx context.Context
+	miningCtx, m.Cancel = context.WithCancel(context.Background())
+	outCh, doneWg := m.Scheduler.Start(miningCtx)
+	m.DoneWg = doneWg
+	m.DoneWg.Add(1)
+	go node.handleNewMiningOutput(miningCtx, outCh, doneWg, func() bool {
+		return node.IsMinerMining(minerAddr)
+	}, node.addNewlyMinedBlock, func() {
+		if err := node.StopMiner(context.Background(), minerAddr); err != nil {
+			log.Warnf("error stopping miner %s: %s", minerAddr, err)
+		}
+	})
+	m.IsMining = true
+	node.BlockMining.AdditionalMiners.Unlock()
+
+	if err := m.StorageMining.Start(ctx); err != nil {
+		if stopErr := node.StopMiner(ctx, minerAddr); stopErr != nil {
+			log.Warnf("error stopping miner %s: %s", minerAddr, stopErr)
+		}
+		return errors.Wrapf(err, "failed to start storage mining for %s", minerAddr)
+	}
+	return nil
+}
+
+// StopMiner stops mining blocks for one of the node's miner actors.
+func (node *Node) StopMiner(ctx context.Context, minerAddr address.Address) error {
+	if node.isPrimaryMiner(minerAddr) {
+		node.stopPrimaryMining(ctx)
+		return nil
+	}
+	if !containsAddress(node.Repo.Config().Mining.AdditionalMiners, minerAddr) {
+		return errors.Errorf("%s is not one of the node's miners", minerAddr)
+	}
+
+	node.BlockMining.AdditionalMiners.Lock()
+	m, ok := node.BlockMining.AdditionalMiners.Miners[minerAddr]
+	if !ok || !m.IsMining {
+		node.BlockMining.AdditionalMiners.Unlock()
+		return nil
+	}
+	m.IsMining = false
+	m.Cancel()
+	node.BlockMining.AdditionalMiners.Unlock()
+
+	// Wait without the lock, since block production checks whether the miner is mining.
+	m.DoneWg.Wait()
+	if err := m.StorageMining.Stop(ctx); err != nil {
+		log.Warnf("error stopping storage miner %s: %s", minerAddr, err)
+	}
+	return nil
+}
+
+// IsMinerMining returns whether the node is mining blocks for one of its miner actors.
+func (node *Node) IsMinerMining(minerAddr address.Address) bool {
+	if node.isPrimaryMiner(minerAddr) {
+		return node.IsMining()
+	}
+	node.BlockMining.AdditionalMiners.Lock()
+	defer node.BlockMining.AdditionalMiners.Unlock()
+	m, ok := node.BlockMining.AdditionalMiners.Miners[minerAddr]
+	return ok && m.IsMining
+}
+
+// MinerIsActive returns whether the node is mining blocks for one of its miner actors, or an
+// error if the address is not one of the node's miners.
+func (node *Node) MinerIsActive(minerAddr address.Address) (bool, error) {
+	if !containsAddress(node.MinerAddresses(), minerAddr) {
+		return false, errors.Errorf("%s is not one of the node's miners", minerAddr)
+	}
+	return node.IsMinerMining(minerAddr), nil
+}
+
+// setupAdditionalMiner creates the storage mining submodule and worker for an additional miner
+// actor, if not already created. The setup runs without the additional miners lock, so if a
+// concurrent call sets up the same miner first, its miner is returned instead.
+func (node *Node) setupAdditionalMiner(ctx context.Context, minerAddr address.Address) (*submodule.AdditionalMiner, error) {
+	if !containsAddress(node.Repo.Config().Mining.AdditionalMiners, minerAddr) {
+		return nil, errors.Errorf("%s is not one of the node's miners", minerAddr)
+	}
+	node.BlockMining.AdditionalMiners.Lock()
+	m, ok := node.BlockMining.AdditionalMiners.Miners[minerAddr]
+	node.BlockMining.AdditionalMiners.Unlock()
+	if ok {
+		return m, nil
+	}
+
+	// Check that the miner exists and that the wallet can sign as its worker.
+	view, err := node.PorcelainAPI.PowerStateView(node.PorcelainAPI.ChainHeadKey())
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load state view")
+	}
+	_, workerAddr, err := view.MinerControlAddresses(ctx, minerAddr)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get miner actor")
+	}
+	workerSignerAddr, err := view.AccountSignerAddress(ctx, workerAddr)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to resolve worker address")
+	}
+	if !node.Wallet.Wallet.HasAddress(workerSignerAddr) {
+		return nil, errors.Errorf("worker key %s is not in the wallet", workerSignerAddr)
+	}
+
+	ds := namespace.Wrap(node.Repo.Datastore(), additionalMinersPrefix.ChildString(minerAddr.String()))
+	storageMining, _, err := node.newStorageMining(ctx, minerAddr, ds)
+	if err != nil {
+		return nil, err
+	}
+	poster := node.BlockMining.PoStGenerator
+	if poster == nil {
+		poster = storageMining.PoStGenerator
+	}
+	worker, err := node.createMiningWorker(ctx, minerAddr, poster)
+	if err != nil {
+		return nil, err
+	}
+
+	node.BlockMining.AdditionalMiners.Lock()
+	defer node.BlockMining.AdditionalMiners.Unlock()
+	if existing, ok := node.BlockMining.AdditionalMiners.Miners[minerAddr]; ok {
+		return existing, nil
+	}
+	m = &submodule.AdditionalMiner{
+		Address:       minerAddr,
+		StorageMining: storageMining,
+		Worker:        worker,
+	}
+	if node.BlockMining.AdditionalMiners.Miners == nil {
+		node.BlockMining.AdditionalMiners.Miners = make(map[address.Address]*submodule.AdditionalMiner)
+	}
+	node.BlockMining.AdditionalMiners.Miners[minerAddr] = m
+	return m, nil
+}
+
+func (node *Node) stopAdditionalMiners(ctx context.Context) {
+	for _, minerAddr := range node.Repo.Config().Mining.AdditionalMiners {
+		if err := node.StopMiner(ctx, minerAddr); err != nil {
+			log.Warnf("error stopping miner %s: %s", minerAddr, err)
+		}
+	}
+}
+
+// miningSchedulers returns the schedulers of all the miners which have started mining.
+func (node *Node) miningSchedulers() []mining.Scheduler {
+	var schedulers []mining.Scheduler
+	if node.BlockMining.MiningScheduler != nil {
+		schedulers = append(schedulers, node.BlockMining.MiningScheduler)
+	}
+	node.BlockMining.AdditionalMiners.Lock()
+	defer node.BlockMining.AdditionalMiners.Unlock()
+	for _, m := range node.BlockMining.AdditionalMiners.Miners {
+		if m.Scheduler != nil {
+			schedulers = append(schedulers, m.Scheduler)
+		}
+	}
+	return schedulers
+}
+
+func (node *Node) additionalMinersHandleHeadChange(ctx context.Context, change chain.HeadChange) {
+	// Copy the miners so that the lock is not held during storage I/O.
+	node.BlockMining.AdditionalMiners.Lock()
+	miners := make([]*submodule.AdditionalMiner, 0, len(node.BlockMining.AdditionalMiners.Miners))
+	for _, m := range node.BlockMining.AdditionalMiners.Miners {
+		miners = append(miners, m)
+	}
+	node.BlockMining.AdditionalMiners.Unlock()
+
+	for _, m := range miners {
+		if err := m.StorageMining.HandleHeadChange(ctx, change); err != nil {
+			log.Errorf("storage miner %s failed to handle new head: %s", m.Address, err)
+		}
+	}
+}
+
+func (node *Node) isPrimaryMiner(minerAddr address.Address) bool {
+	primary, err := node.MiningAddress()
+	return err == nil && primary == minerAddr
+}
+
+func containsAddress(addrs []address.Address, addr address.Address) bool {
+	for _, a := range addrs {
+		if a == addr {
+			return true
+		}
+	}
+	return false
+}
@@ -6,11 +6,14 @@ import (
 	"os"
 	"reflect"
 	"runtime"
+	"sync"
 
 	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/specs-actors/actors/abi"
 	fbig "github.com/filecoin-project/specs-actors/actors/abi/big"
 	bserv "github.com/ipfs/go-blockservice"
 	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
 	logging "github.com/ipfs/go-log"
 	"github.com/libp2p/go-libp2p-core/host"
 	"github.com/pkg/errors"
@@ -30,6 +33,7 @@ import (
 	"github.com/filecoin-project/go-filecoin/internal/pkg/mining"
 	"github.com/filecoin-project/go-filecoin/internal/pkg/net/pubsub"
 	"github.com/filecoin-project/go-filecoin/internal/pkg/piecemanager"
+	"github.com/filecoin-project/go-filecoin/internal/pkg/postgenerator"
 	"github.com/filecoin-project/go-filecoin/internal/pkg/protocol/drand"
 	mining_protocol "github.com/filecoin-project/go-filecoin/internal/pkg/protocol/mining"
 	"github.com/filecoin-project/go-filecoin/internal/pkg/protocol/storage"
@@ -132,11 +136,15 @@ func (node *Node) Start(ctx context.Context) error {
 	syncCtx, node.syncer.CancelChainSync = context.WithCancel(context.Background())
 
 	// Wire up propagation of new chain heads from the chain store to other components.
-	head, err := node.PorcelainAPI.ChainHead()
-	if err != nil {
-		return errors.Wrap(err, "failed to get chain head")
+	// Subscribe before anything can change the head so that no change is missed.
+	go node.handleNewChainHeads(syncCtx, node.chain.ChainReader.SubHeadChanges(syncCtx))
+
+	// Index messages in tipsets applied while the node was not running, in the background.
+	if node.Messaging.Indexer != nil {
+		if err := node.Messaging.Indexer.Start(syncCtx); err != nil {
+			return errors.Wrap(err, "failed to update message history index")
+		}
 	}
-	go node.handleNewChainHeads(syncCtx, head)
 
 	if !node.OfflineMode {
 
@@ -173,6 +181,12 @@ func (node *Node) Start(ctx context.Context) error {
 		go node.doMiningPause(syncCtx)
 	}
 
+	// Restore messages sent before a restart that have not yet been mined. This waits for
+	// the syncer and pubsub to start, so that the messages are broadcast to the network.
+	if err := node.Messaging.Outbox.Republish(ctx, !node.OfflineMode); err != nil {
+		return errors.Wrap(err, "failed to republish queued messages")
+	}
+
 	return nil
 }
 
@@ -224,9 +238,10 @@ func (node *Node) setIsMining(isMining bool) {
 	node.BlockMining.Mining.IsMining = isMining
 }
 
-func (node *Node) handleNewMiningOutput(ctx context.Context, miningOutCh <-chan mining.FullBlock) {
+func (node *Node) handleNewMiningOutput(ctx context.Context, miningOutCh <-chan mining.FullBlock, doneWg *sync.WaitGroup,
+	isMining func() bool, addBlock func(context.Context, mining.FullBlock), stopMining func()) {
 	defer func() {
-		node.BlockMining.MiningDoneWg.Done()
+		doneWg.Done()
 	}()
 	for {
 		select {
@@ -235,54 +250,63 @@ func (node *Node) handleNewMiningOutput(ctx context.Context, miningOutCh <-chan
 		case output, ok := <-miningOutCh:
 			if !ok {
 				log.Errorf("scheduler stopped. stopping mining.")
-				node.StopMining(context.Background())
+				stopMining()
 				return
 			}
 
-			node.BlockMining.MiningDoneWg.Add(1)
+			doneWg.Add(1)
 			go func() {
-				if node.IsMining() {
-					node.BlockMining.AddNewlyMinedBlock(ctx, output)
+				if isMining() {
+					addBlock(ctx, output)
 				}
-				node.BlockMining.MiningDoneWg.Done()
+				doneWg.Done()
 			}()
 		}
 	}
 
 }
 
-func (node *Node) handleNewChainHeads(ctx context.Context, firstHead block.TipSet) {
-	newHeadCh := node.chain.ChainReader.HeadEvents().Sub(chain.NewHeadTopic)
+func (node *Node) handleNewChainHeads(ctx context.Context, changes <-chan chain.HeadChange) {
 	defer log.Infof("new head handler exited")
-	defer node.chain.ChainReader.HeadEvents().Unsub(newHeadCh)
 
-	handler := message.NewHeadHandler(node.Messaging.Inbox, node.Messaging.Outbox, node.chain.ChainReader, firstHead)
+	handler := message.NewHeadHandler(node.Messaging.Inbox, node.Messaging.Outbox)
 
 	for {
 		log.Debugf("waiting for new head")
 		select {
-		case ts, ok := <-newHeadCh:
+		case change, ok := <-changes:
 			if !ok {
 				log.Errorf("failed new head channel receive")
 				return
 			}
-			newHead, ok := ts.(block.TipSet)
-			if !ok {
-				log.Errorf("non-tipset published on heaviest tipset channel")
+			if len(change.Apply) == 0 {
+				log.Errorf("head change without new head")
 				continue
 			}
+			newHead := change.Apply[0]
 			height, _ := newHead.Height()
-			log.Debugf("received new head height %s, key %s", height, newHead.Key())
+			log.Debugf("received new head height %s, key %s, reverting %d tipsets", height, newHead.Key(), len(change.Revert))
 
 			if node.StorageMining != nil {
 				log.Debugf("storage mining handling new head")
-				if err := node.StorageMining.HandleNewHead(ctx, newHead); err != nil {
+				if err := node.StorageMining.HandleHeadChange(ctx, change); err != nil {
 					log.Error(err)
 				}
 			}
+			node.additionalMinersHandleHeadChange(ctx, change)
 
 			log.Debugf("message pool handling new head")
-			if err := handler.HandleNewHead(ctx, newHead); err != nil {
+			if err := handler.HandleHeadChange(ctx, change); err != nil {
+				log.Error(err)
+			}
+
+			if node.Messaging.Indexer != nil {
+				if err := node.Messaging.Indexer.HandleHeadChange(ctx, change); err != nil {
+					log.Error(err)
+				}
+			}
+
+			if err := node.Messaging.StatusTracker.HandleHeadChange(ctx, change); err != nil {
 				log.Error(err)
 			}
 		case <-ctx.Done():
@@ -420,31 +444,21 @@ func (node *Node) setupStorageMining(ctx context.Context) error {
 		return err
 	}
 
-	head := node.Chain().ChainReader.GetHead()
-	status, err := node.PorcelainAPI.MinerGetStatus(ctx, minerAddr, head)
+	repoPath, err := node.Repo.Path()
 	if err != nil {
 		return err
 	}
 
-	repoPath, err := node.Repo.Path()
+	var sealProofType abi.RegisteredProof
+	node.StorageMining, sealProofType, err = node.newStorageMining(ctx, minerAddr, node.Repo.Datastore())
 	if err != nil {
 		return err
 	}
 
-	sealProofType := status.SectorConfiguration.SealProofType
-
 	cborStore := node.Blockstore.CborStore
-
 	waiter := msg.NewWaiter(node.chain.ChainReader, node.chain.MessageStore, node.Blockstore.Blockstore, cborStore)
-
-	// TODO: rework these modules so they can be at least partially constructed during the building phase #3738
 	stateViewer := state.NewViewer(cborStore)
 
-	node.StorageMining, err = submodule.NewStorageMiningSubmodule(minerAddr, node.Repo.Datastore(), &node.chain, &node.Messaging, waiter, stateViewer, sealProofType, node.Repo, node.BlockMining.PoStGenerator)
-	if err != nil {
-		return err
-	}
-
 	return node.StorageProtocol.AddStorageProvider(
 		ctx,
 		minerAddr,
@@ -463,6 +477,30 @@ func (node *Node) setupStorageMining(ctx context.Context) error {
 	)
 }
 
+// newStorageMining creates a storage mining submodule for a miner actor, persisting its state in
+// `ds`.
+func (node *Node) newStorageMining(ctx context.Context, minerAddr address.Address, ds datastore.Batching) (*submodule.StorageMiningSubmodule, abi.RegisteredProof, error) {
+	head := node.Chain().ChainReader.GetHead()
+	status, err := node.PorcelainAPI.MinerGetStatus(ctx, minerAddr, head)
+	if err != nil {
+		return nil, 0, err
+	}
+	sealProofType := status.SectorConfiguration.SealProofType
+
+	cborStore := node.Blockstore.CborStore
+
+	waiter := msg.NewWaiter(node.chain.ChainReader, node.chain.MessageStore, node.Blockstore.Blockstore, cborStore)
+
+	// TODO: rework these modules so they can be at least partially constructed during the building phase #3738
+	stateViewer := state.NewViewer(cborStore)
+
+	sm, err := submodule.NewStorageMiningSubmodule(minerAddr, ds, &node.chain, &node.Messaging, waiter, stateViewer, sealProofType, node.Repo, node.BlockMining.PoStGenerator)
+	if err != nil {
+		return nil, 0, err
+	}
+	return sm, sealProofType, nil
+}
+
 func (node *Node) setupRetrievalMining(ctx context.Context) error {
 	providerAddr, err := node.MiningAddress()
 	if err != nil {
@@ -511,22 +549,35 @@ func (node *Node) doMiningPause(ctx context.Context) {
 			if !ok {
 				return
 			}
-			if node.BlockMining.MiningScheduler == nil {
-				// drop syncer transition signals if not mining
-				continue
-			}
-			if toCatchup {
-				node.BlockMining.MiningScheduler.Pause()
-			} else {
-				node.BlockMining.MiningScheduler.Continue()
+			for _, scheduler := range node.miningSchedulers() {
+				if toCatchup {
+					scheduler.Pause()
+				} else {
+					scheduler.Continue()
+				}
 			}
 		}
 	}
 }
 
 // StartMining causes the node to start feeding blocks to the mining worker and initializes
-// the StorageMining for the mining address.
+// the StorageMining for the mining address, then starts mining for each additional miner.
 func (node *Node) StartMining(ctx context.Context) error {
+	if err := node.startPrimaryMining(ctx); err != nil {
+		return err
+	}
+	for _, minerAddr := range node.Repo.Config().Mining.AdditionalMiners {
+		if node.IsMinerMining(minerAddr) {
+			continue
+		}
+		if err := node.StartMiner(ctx, minerAddr); err != nil {
+			return errors.Wrapf(err, "failed to start mining for %s", minerAddr)
+		}
+	}
+	return nil
+}
+
+func (node *Node) startPrimaryMining(ctx context.Context) error {
 	if node.IsMining() {
 		return errors.New("Node is already mining")
 	}
@@ -555,15 +606,22 @@ func (node *Node) StartMining(ctx context.Context) error {
 	node.BlockMining.MiningDoneWg = doneWg
 	node.BlockMining.AddNewlyMinedBlock = node.addNewlyMinedBlock
 	node.BlockMining.MiningDoneWg.Add(1)
-	go node.handleNewMiningOutput(miningCtx, outCh)
+	go node.handleNewMiningOutput(miningCtx, outCh, doneWg, node.IsMining, node.BlockMining.AddNewlyMinedBlock, func() {
+		node.stopPrimaryMining(context.Background())
+	})
 
 	node.setIsMining(true)
 
 	return nil
 }
 
-// StopMining stops mining on new blocks.
+// StopMining stops mining on new blocks, for all miners.
 func (node *Node) StopMining(ctx context.Context) {
+	node.stopPrimaryMining(ctx)
+	node.stopAdditionalMiners(ctx)
+}
+
+func (node *Node) stopPrimaryMining(ctx context.Context) {
 	node.setIsMining(false)
 
 	if node.BlockMining.CancelMining != nil {
@@ -614,6 +672,11 @@ func (node *Node) setupProtocols() error {
 		node.StopMining,
 		node.GetMiningWorker,
 		node.ChainClock,
+		node.MinerAddresses,
+		node.StartMiner,
+		node.StopMiner,
+		node.MinerIsActive,
+		node.SubmitBlock,
 	)
 
 	node.BlockMining.BlockMiningAPI = &blockMiningAPI
@@ -636,6 +699,16 @@ func (node *Node) CreateMiningWorker(ctx context.Context) (*mining.DefaultWorker
 		return nil, errors.Wrap(err, "failed to get mining address")
 	}
 
+	poster := node.BlockMining.PoStGenerator
+	if poster == nil {
+		poster = node.StorageMining.PoStGenerator
+	}
+	return node.createMiningWorker(ctx, minerAddr, poster)
+}
+
+// createMiningWorker creates a mining.Worker for a miner actor, generating winning PoSts with
+// `poster`.
+func (node *Node) createMiningWorker(ctx context.Context, minerAddr address.Address, poster postgenerator.PoStGenerator) (*mining.DefaultWorker, error) {
 	head := node.PorcelainAPI.ChainHeadKey()
 	view, err := node.PorcelainAPI.MinerStateView(head)
 	if err != nil {
@@ -646,15 +719,15 @@ func (node *Node) CreateMiningWorker(ctx context.Context) (*mining.DefaultWorker
 		return nil, errors.Wrapf(err, "failed to read miner control addresses")
 	}
 
-	poster := node.BlockMining.PoStGenerator
-	if poster == nil {
-		poster = node.StorageMining.PoStGenerator
-	}
 	genBlk, err := node.Chain().ChainReader.GetGenesisBlock(ctx)
 	if err != nil {
 		return nil, err
 	}
 	sampler := chain.NewSampler(node.Chain().ChainReader, genBlk.Ticket)
+	selection, err := mining.ParseSelectionPolicy(node.Repo.Config().Mining.MessageSelection)
+	if err != nil {
+		return nil, err
+	}
 
 	return mining.NewDefaultWorker(mining.WorkerParameters{
 		API: node.PorcelainAPI,
@@ -677,6 +750,8 @@ func (node *Node) CreateMiningWorker(ctx context.Context) (*mining.DefaultWorker
 		Poster:           poster,
 		ChainState:       node.chain.ChainReader,
 		Drand:            node.Syncer().Drand,
+		MessageSelection: selection,
+		Journal:          node.BlockMining.Journal,
 	}), nil
 }
 
@@ -7,13 +7,19 @@ import (
 	"testing"
 	"time"
 
+	"github.com/filecoin-project/go-address"
 	"github.com/libp2p/go-libp2p-core/peer"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	"github.com/filecoin-project/go-filecoin/internal/app/go-filecoin/node"
 	"github.com/filecoin-project/go-filecoin/internal/app/go-filecoin/node/test"
+	"github.com/filecoin-project/go-filecoin/internal/pkg/clock"
 	"github.com/filecoin-project/go-filecoin/internal/pkg/config"
+	"github.com/filecoin-project/go-filecoin/internal/pkg/consensus"
+	"github.com/filecoin-project/go-filecoin/internal/pkg/constants"
+	"github.com/filecoin-project/go-filecoin/internal/pkg/drand"
+	"github.com/filecoin-project/go-filecoin/internal/pkg/mining"
 	"github.com/filecoin-project/go-filecoin/internal/pkg/proofs"
 	"github.com/filecoin-project/go-filecoin/internal/pkg/repo"
 	tf "github.com/filecoin-project/go-filecoin/internal/pkg/testhelpers/testflags"
@@ -177,6 +183,97 @@ func TestNodeStartMining(t *testing.T) {
 	})
 }
 
+func TestNodeMinerAddresses(t *testing.T) {
+	tf.UnitTest(t)
+	ctx := context.Background()
+
+	builder := test.NewNodeBuilder(t)
+	builder.WithGenesisInit(gengen.DefaultGenesis)
+	builder.WithBuilderOpt(node.FakeProofVerifierBuilderOpts()...)
+	nd := builder.Build(ctx)
+	defer nd.Stop(ctx)
+
+	primary, err := address.NewIDAddress(1000)
+	require.NoError(t, err)
+	second, err := address.NewIDAddress(1001)
+	require.NoError(t, err)
+	unknown, err := address.NewIDAddress(1002)
+	require.NoError(t, err)
+
+	cfg := nd.Repo.Config()
+	cfg.Mining.MinerAddress = primary
+	cfg.Mining.AdditionalMiners = []address.Address{second, primary}
+	require.NoError(t, nd.Repo.ReplaceConfig(cfg))
+
+	assert.Equal(t, []address.Address{primary, second}, nd.MinerAddresses())
+	assert.False(t, nd.IsMinerMining(second))
+	_, err = nd.MinerIsActive(unknown)
+	assert.Error(t, err)
+	assert.Error(t, nd.StartMiner(ctx, unknown))
+	assert.Error(t, nd.StopMiner(ctx, unknown))
+	assert.NoError(t, nd.StopMiner(ctx, second))
+}
+
+func TestNodeMinesForAdditionalMiner(t *testing.T) {
+	tf.UnitTest(t)
+	ctx := context.Background()
+
+	genCfg := node.MakeTestGenCfg(t, 1)
+	genCfg.Miners = append(genCfg.Miners, &gengen.CreateStorageMinerConfig{
+		Owner:            1,
+		CommittedSectors: genCfg.Miners[0].CommittedSectors,
+		SealProofType:    constants.DevSealProofType,
+	})
+	seed := node.MakeChainSeed(t, genCfg)
+
+	genTime := time.Unix(1234567890, 0)
+	fakeClock := clock.NewFake(genTime)
+	blockTime := 30 * time.Second
+	c := clock.NewChainClockFromClock(uint64(genTime.Unix()), blockTime, 6*time.Second, fakeClock)
+
+	builder := test.NewNodeBuilder(t).
+		WithGenesisInit(seed.GenesisInitFunc).
+		WithBuilderOpt(node.ChainClockConfigOption(c)).
+		WithBuilderOpt(node.VerifierConfigOption(&proofs.FakeVerifier{})).
+		WithBuilderOpt(node.PoStGeneratorOption(&consensus.TestElectionPoster{})).
+		WithBuilderOpt(node.MonkeyPatchSetProofTypeOption(constants.DevRegisteredSealProof)).
+		WithBuilderOpt(node.DrandConfigOption(drand.NewFake(genTime)))
+	nd := builder.Build(ctx)
+	seed.GiveKey(t, nd, 0)
+	seed.GiveKey(t, nd, 1)
+	primary, _ := seed.GiveMiner(t, nd, 0)
+	second := seed.GiveAdditionalMiner(t, nd, 1)
+
+	node.StartNodes(t, []*node.Node{nd})
+	defer node.StopNodes([]*node.Node{nd})
+	assert.Equal(t, []address.Address{primary, second}, nd.MinerAddresses())
+
+	// Starting the miner creates its worker; stop it again so that the test drives mining.
+	require.NoError(t, nd.StartMiner(ctx, second))
+	assert.True(t, nd.IsMinerMining(second))
+	require.NoError(t, nd.StopMiner(ctx, second))
+	assert.False(t, nd.IsMinerMining(second))
+
+	nd.BlockMining.AdditionalMiners.Lock()
+	worker := nd.BlockMining.AdditionalMiners.Miners[second].Worker
+	nd.BlockMining.AdditionalMiners.Unlock()
+	require.NotNil(t, worker)
+
+	head, err := nd.PorcelainAPI.ChainHead()
+	require.NoError(t, err)
+	fakeClock.Advance(blockTime)
+	blk, err := mining.MineOnce(ctx, *worker, head)
+	require.NoError(t, err)
+	assert.Equal(t, second, blk.Header.Miner)
+
+	require.NoError(t, nd.AddNewBlock(ctx, *blk))
+	require.Eventually(t, func() bool {
+		head, err := nd.PorcelainAPI.ChainHead()
+		require.NoError(t, err)
+		return head.Key().Has(blk.Header.Cid())
+	}, 10*time.Second, 10*time.Millisecond)
+}
+
 func TestOptionWithError(t *testing.T) {
 	tf.UnitTest(t)
 
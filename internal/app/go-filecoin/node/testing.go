@@ -102,6 +102,19 @@ func (cs *ChainSeed) GiveMiner(t *testing.T, nd *Node, which int) (address.Addre
 	return m.Address, ownerAddr
 }
 
+// GiveAdditionalMiner adds the specified miner to the node's additional miners. Returns the
+// address of the miner
+func (cs *ChainSeed) GiveAdditionalMiner(t *testing.T, nd *Node, which int) address.Address {
+	t.Helper()
+	cfg := nd.Repo.Config()
+	m := cs.info.Miners[which]
+	cfg.Mining.AdditionalMiners = append(cfg.Mining.AdditionalMiners, m.Address)
+
+	require.NoError(t, nd.Repo.ReplaceConfig(cfg))
+
+	return m.Address
+}
+
 // Addr returns the address for the given key
 func (cs *ChainSeed) Addr(t *testing.T, key int) address.Address {
 	t.Helper()
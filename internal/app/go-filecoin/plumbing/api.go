@@ -15,6 +15,8 @@ import (
 	"github.com/libp2p/go-libp2p-core/peer"
 	"github.com/libp2p/go-libp2p/p2p/protocol/ping"
 	ma "github.com/multiformats/go-multiaddr"
+	"github.com/pkg/errors"
+	typegen "github.com/whyrusleeping/cbor-gen"
 
 	"github.com/filecoin-project/go-filecoin/internal/app/go-filecoin/plumbing/cfg"
 	"github.com/filecoin-project/go-filecoin/internal/app/go-filecoin/plumbing/cst"
@@ -50,8 +52,11 @@ type API struct {
 	config       *cfg.Config
 	dag          *dag.DAG
 	expected     consensus.Protocol
+	gasEstimator *msg.GasEstimator
+	msgIndexer   *message.Indexer
 	msgPool      *message.Pool
 	msgPreviewer *msg.Previewer
+	msgStatus    *message.StatusTracker
 	msgWaiter    *msg.Waiter
 	network      *net.Network
 	outbox       *message.Outbox
@@ -66,8 +71,11 @@ type APIDeps struct {
 	Config       *cfg.Config
 	DAG          *dag.DAG
 	Expected     consensus.Protocol
+	GasEstimator *msg.GasEstimator
+	MsgIndexer   *message.Indexer
 	MsgPool      *message.Pool
 	MsgPreviewer *msg.Previewer
+	MsgStatus    *message.StatusTracker
 	MsgWaiter    *msg.Waiter
 	Network      *net.Network
 	Outbox       *message.Outbox
@@ -84,8 +92,11 @@ func New(deps *APIDeps) *API {
 		config:       deps.Config,
 		dag:          deps.DAG,
 		expected:     deps.Expected,
+		gasEstimator: deps.GasEstimator,
+		msgIndexer:   deps.MsgIndexer,
 		msgPool:      deps.MsgPool,
 		msgPreviewer: deps.MsgPreviewer,
+		msgStatus:    deps.MsgStatus,
 		msgWaiter:    deps.MsgWaiter,
 		network:      deps.Network,
 		outbox:       deps.Outbox,
@@ -157,11 +168,31 @@ func (api *API) ChainSetHead(ctx context.Context, key block.TipSetKey) error {
 	return api.chain.SetHead(ctx, key)
 }
 
+// ChainCheckpoint returns the key of the checkpoint tipset, below which the
+// chain is never reorganized. It is empty if no checkpoint is set.
+func (api *API) ChainCheckpoint() block.TipSetKey {
+	return api.chain.Checkpoint()
+}
+
+// ChainSetCheckpoint sets the tipset with `key`, which must be on the current
+// chain, as the checkpoint. An empty key removes the checkpoint.
+func (api *API) ChainSetCheckpoint(ctx context.Context, key block.TipSetKey) error {
+	return api.chain.SetCheckpoint(ctx, key)
+}
+
 // ChainTipSet returns the tipset at the given key
 func (api *API) ChainTipSet(key block.TipSetKey) (block.TipSet, error) {
 	return api.chain.GetTipSet(key)
 }
 
+// ChainNotify returns a channel on which the current chain head, then each
+// subsequent change of the chain head is delivered, as the tipsets reverted
+// and applied, until ctx is done.
+// The channel is closed early if the reader falls too far behind the head.
+func (api *API) ChainNotify(ctx context.Context) <-chan chain.HeadChange {
+	return api.chain.HeadChanges(ctx)
+}
+
 // ChainLs returns an iterator of tipsets from head to genesis
 func (api *API) ChainLs(ctx context.Context) (*chain.TipsetIterator, error) {
 	return api.chain.Ls(ctx)
@@ -187,11 +218,78 @@ func (api *API) ChainExport(ctx context.Context, head block.TipSetKey, out io.Wr
 	return api.chain.ChainExport(ctx, head, out)
 }
 
+// ChainExportSnapshot exports the chain from `head` up to and including the genesis block to `out`,
+// including state only for the `stateDepth` most recent tipsets and genesis.
+func (api *API) ChainExportSnapshot(ctx context.Context, head block.TipSetKey, stateDepth uint, out io.Writer) error {
+	return api.chain.ChainExportSnapshot(ctx, head, stateDepth, out)
+}
+
 // ChainImport imports a chain from `in`.
 func (api *API) ChainImport(ctx context.Context, in io.Reader) (block.TipSetKey, error) {
 	return api.chain.ChainImport(ctx, in)
 }
 
+// ChainImportValidated imports a chain from `in` and validates it by
+// re-executing every imported tipset above `checkpoint`, or all of them if
+// `checkpoint` is empty. It fails on the first tipset whose state or receipt
+// root does not match the computed result.
+func (api *API) ChainImportValidated(ctx context.Context, in io.Reader, checkpoint block.TipSetKey) (block.TipSetKey, error) {
+	headKey, err := api.chain.ChainImport(ctx, in)
+	if err != nil {
+		return block.UndefTipSet.Key(), err
+	}
+	tipsets := chain.TipSetProviderFromBlocks(ctx, api.chain)
+	if err := api.syncer.ValidateImport(ctx, headKey, checkpoint, tipsets); err != nil {
+		return block.UndefTipSet.Key(), err
+	}
+	return headKey, nil
+}
+
+// fsckFetchTimeout bounds the time spent fetching each object during a
+// refetching chain check.
+const fsckFetchTimeout = 30 * time.Second
+
+// ChainFsck checks that the chain from the current head back to genesis is held
+// in full and reports the objects that are missing or corrupt. If `refetch` is
+// set, corrupt objects are deleted, then missing and corrupt objects are fetched
+// from peers and the check is repeated, since fetched headers and state nodes
+// may link to further missing objects. Objects which could not be read for
+// other reasons are left alone. The returned report lists the problems that
+// remain.
+func (api *API) ChainFsck(ctx context.Context, refetch bool) (*chain.FsckReport, error) {
+	report, err := api.chain.Fsck(ctx)
+	if err != nil || !refetch {
+		return report, err
+	}
+
+	attempted := cid.NewSet()
+	for {
+		fetched := 0
+		for _, problem := range report.Problems {
+			if !(problem.Missing || problem.Corrupt) || !attempted.Visit(problem.Cid) {
+				continue
+			}
+			if problem.Corrupt {
+				if err := api.chain.DeleteBlock(problem.Cid); err != nil {
+					return nil, errors.Wrapf(err, "failed to delete corrupt block %s", problem.Cid)
+				}
+			}
+			fetchCtx, cancel := context.WithTimeout(ctx, fsckFetchTimeout)
+			err := api.dag.Fetch(fetchCtx, problem.Cid)
+			cancel()
+			if err == nil {
+				fetched++
+			}
+		}
+		if fetched == 0 {
+			return report, nil
+		}
+		if report, err = api.chain.Fsck(ctx); err != nil {
+			return nil, err
+		}
+	}
+}
+
 // OutboxQueues lists addresses with non-empty outbox queues (in no particular order).
 func (api *API) OutboxQueues() []address.Address {
 	return api.outbox.Queue().Queues()
@@ -233,21 +331,95 @@ func (api *API) StateView(baseKey block.TipSetKey) (*appstate.View, error) {
 	return api.chain.StateView(baseKey)
 }
 
+// MessageEstimateGasLimit estimates the gas limit for a message by running it against the head
+// state and adding a safety margin.
+func (api *API) MessageEstimateGasLimit(ctx context.Context, from, to address.Address, value types.AttoFIL, method abi.MethodNum, params interface{}) (gas.Unit, error) {
+	return api.gasEstimator.EstimateGasLimit(ctx, from, to, value, method, params)
+}
+
+// MessageSuggestGasPrice suggests a gas price for a message based on the messages in recently
+// mined blocks.
+func (api *API) MessageSuggestGasPrice(ctx context.Context) (types.AttoFIL, error) {
+	return api.gasEstimator.SuggestGasPrice(ctx)
+}
+
 // MessageSend sends a message. It uses the default from address if none is given and signs the
 // message using the wallet. This call "sends" in the sense that it enqueues the
 // message in the msg pool and broadcasts it to the network; it does not wait for the
 // message to go on chain. Note that no default from address is provided.  The error
 // channel returned receives either nil or an error and is immediately closed after
 // the message is published to the network to signal that the publish is complete.
+// If gasLimit is msg.GasLimitAuto the gas limit is estimated, and if gasPrice is
+// msg.GasPriceAuto the suggested gas price is used.
 func (api *API) MessageSend(ctx context.Context, from, to address.Address, value types.AttoFIL, gasPrice types.AttoFIL, gasLimit gas.Unit, method abi.MethodNum, params interface{}) (cid.Cid, chan error, error) {
+	var err error
+	if gasLimit == msg.GasLimitAuto {
+		gasLimit, err = api.MessageEstimateGasLimit(ctx, from, to, value, method, params)
+		if err != nil {
+			return cid.Undef, nil, err
+		}
+	}
+	if gasPrice.Equals(msg.GasPriceAuto) {
+		gasPrice, err = api.MessageSuggestGasPrice(ctx)
+		if err != nil {
+			return cid.Undef, nil, err
+		}
+	}
 	return api.outbox.Send(ctx, from, to, value, gasPrice, gasLimit, true, method, params)
 }
 
+// MessageSendBatch sends a sequence of messages from one actor with consecutive nonces, and
+// broadcasts them to the network. Each entry's gas limit may be msg.GasLimitAuto to have it
+// estimated, and the gas price may be msg.GasPriceAuto to use the suggested price for all of them.
+// Entries that fail, including those whose gas limit cannot be estimated, consume no nonce. The
+// results are in the order of the entries.
+func (api *API) MessageSendBatch(ctx context.Context, from address.Address, gasPrice types.AttoFIL, entries []message.BatchEntry) ([]message.BatchResult, error) {
+	var err error
+	if gasPrice.Equals(msg.GasPriceAuto) {
+		gasPrice, err = api.MessageSuggestGasPrice(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	results := make([]message.BatchResult, len(entries))
+	var toSend []message.BatchEntry
+	var sendIdx []int
+	for i, entry := range entries {
+		if entry.GasLimit == msg.GasLimitAuto {
+			params := &typegen.Deferred{Raw: entry.EncodedParams}
+			entry.GasLimit, err = api.MessageEstimateGasLimit(ctx, from, entry.To, entry.Value, entry.Method, params)
+			if err != nil {
+				results[i].Err = err
+				continue
+			}
+		}
+		toSend = append(toSend, entry)
+		sendIdx = append(sendIdx, i)
+	}
+
+	sent, err := api.outbox.SendBatch(ctx, from, gasPrice, toSend, true)
+	if err != nil {
+		return nil, err
+	}
+	for j, result := range sent {
+		results[sendIdx[j]] = result
+	}
+	return results, nil
+}
+
 //SignedMessageSend sends a siged message.
 func (api *API) SignedMessageSend(ctx context.Context, smsg *types.SignedMessage) (cid.Cid, chan error, error) {
 	return api.outbox.SignedSend(ctx, smsg, true)
 }
 
+// MessageReplace replaces a message in the outbound queue with a copy paying a higher gas price,
+// and broadcasts the replacement to the network. The replacement is rejected unless its gas price
+// is sufficiently higher than the original's. It returns the CID of the replacement.
+func (api *API) MessageReplace(ctx context.Context, msgCid cid.Cid, gasPrice types.AttoFIL) (cid.Cid, error) {
+	return api.outbox.Replace(ctx, msgCid, gasPrice, true)
+}
+
 // MessageWait invokes the callback when a message with the given cid appears on chain.
 // It will find the message in both the case that it is already on chain and
 // the case that it appears in a newly mined block. An error is returned if one is
@@ -257,6 +429,32 @@ func (api *API) MessageWait(ctx context.Context, msgCid cid.Cid, lookback uint64
 	return api.msgWaiter.Wait(ctx, msgCid, lookback, cb)
 }
 
+// MessageList lists the messages on chain from `from` and to `to` included at or after epoch
+// `since`, in order of epoch. Either address may be empty to match any address, but not both.
+// It requires the message history index to be enabled in the node's config.
+func (api *API) MessageList(ctx context.Context, from, to address.Address, since abi.ChainEpoch) ([]*message.IndexedMessage, error) {
+	if api.msgIndexer == nil {
+		return nil, errors.New("message history index is disabled, set message.indexHistory in the config to enable it")
+	}
+	return api.msgIndexer.List(ctx, from, to, since)
+}
+
+// MessageWaitConfidence waits for a message to appear on chain in a tipset at least `confidence`
+// epochs below the head, waiting again if its tipset is reverted before then. It returns the
+// message with its receipt and the key of the tipset including it.
+func (api *API) MessageWaitConfidence(ctx context.Context, msgCid cid.Cid, lookback, confidence uint64) (*msg.ChainMessage, error) {
+	return api.msgWaiter.WaitConfidence(ctx, msgCid, lookback, confidence)
+}
+
+// MessageStatusWatch streams the lifecycle events of a message as it is queued in the outbox,
+// added to the message pool, included in a tipset, reverted and finalized. The first events
+// report its current status, searching `lookback` tipsets for its inclusion. The channel is
+// closed when the message is finalized or ctx is done. The message is identified by the CID
+// returned when it was sent, which for BLS senders is that of the unsigned message.
+func (api *API) MessageStatusWatch(ctx context.Context, msgCid cid.Cid, lookback uint) (<-chan message.StatusEvent, error) {
+	return api.msgStatus.Watch(ctx, msgCid, lookback)
+}
+
 // NetworkGetBandwidthStats gets stats on the current bandwidth usage of the network
 func (api *API) NetworkGetBandwidthStats() metrics.Stats {
 	return api.network.GetBandwidthStats()
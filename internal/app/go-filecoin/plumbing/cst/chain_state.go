@@ -43,6 +43,11 @@ type chainReadWriter interface {
 	GetTipSetState(context.Context, block.TipSetKey) (vmstate.Tree, error)
 	GetTipSetStateRoot(block.TipSetKey) (cid.Cid, error)
 	SetHead(context.Context, block.TipSet) error
+	SubHeadChangesBounded(context.Context, int) <-chan chain.HeadChange
+	PrunedHeight() abi.ChainEpoch
+	Checkpoint() block.TipSet
+	SetCheckpoint(context.Context, block.TipSetKey) error
+	CheckCheckpoint(context.Context, block.TipSet) error
 	ReadOnlyStateStore() cborutil.ReadOnlyIpldStore
 }
 
@@ -119,6 +124,17 @@ func (chn *ChainStateReadWriter) GetTipSet(key block.TipSetKey) (block.TipSet, e
 	return chn.readWriter.GetTipSet(key)
 }
 
+// headChangeBacklog is the number of head changes queued for a HeadChanges
+// subscriber before it is disconnected.
+const headChangeBacklog = 64
+
+// HeadChanges returns a channel on which the current head, then each
+// subsequent change of head is delivered until ctx is done. The channel is also closed if the reader falls
+// too far behind the head.
+func (chn *ChainStateReadWriter) HeadChanges(ctx context.Context) <-chan chain.HeadChange {
+	return chn.readWriter.SubHeadChangesBounded(ctx, headChangeBacklog)
+}
+
 // Ls returns an iterator over tipsets from head to genesis.
 func (chn *ChainStateReadWriter) Ls(ctx context.Context) (*chain.TipsetIterator, error) {
 	ts, err := chn.readWriter.GetTipSet(chn.readWriter.GetHead())
@@ -291,9 +307,25 @@ func (chn *ChainStateReadWriter) SetHead(ctx context.Context, key block.TipSetKe
 	if err != nil {
 		return err
 	}
+	if err := chn.readWriter.CheckCheckpoint(ctx, headTs); err != nil {
+		return err
+	}
 	return chn.readWriter.SetHead(ctx, headTs)
 }
 
+// Checkpoint returns the key of the checkpoint tipset, which is empty if no
+// checkpoint is set.
+func (chn *ChainStateReadWriter) Checkpoint() block.TipSetKey {
+	return chn.readWriter.Checkpoint().Key()
+}
+
+// SetCheckpoint pins the tipset with `key`, which must be on the current
+// chain, so that the chain is never reorganized below it. An empty key
+// removes the checkpoint.
+func (chn *ChainStateReadWriter) SetCheckpoint(ctx context.Context, key block.TipSetKey) error {
+	return chn.readWriter.SetCheckpoint(ctx, key)
+}
+
 // ReadOnlyStateStore returns a read-only state store.
 func (chn *ChainStateReadWriter) ReadOnlyStateStore() cborutil.ReadOnlyIpldStore {
 	return chn.readWriter.ReadOnlyStateStore()
@@ -313,6 +345,21 @@ func (chn *ChainStateReadWriter) ChainExport(ctx context.Context, head block.Tip
 	return nil
 }
 
+// ChainExportSnapshot exports the chain from `head` up to and including the genesis block to `out`,
+// including state trees and message receipts only for the `stateDepth` most recent tipsets and genesis.
+func (chn *ChainStateReadWriter) ChainExportSnapshot(ctx context.Context, head block.TipSetKey, stateDepth uint, out io.Writer) error {
+	headTS, err := chn.GetTipSet(head)
+	if err != nil {
+		return err
+	}
+	logStore.Infof("starting CAR file snapshot export: %s, state depth: %d", head.String(), stateDepth)
+	if err := chain.ExportSnapshot(ctx, headTS, chn.readWriter, chn.messageProvider, chn, out, stateDepth); err != nil {
+		return err
+	}
+	logStore.Infof("exported CAR file snapshot with head: %s", head.String())
+	return nil
+}
+
 // ChainImport imports a chain from `in`.
 func (chn *ChainStateReadWriter) ChainImport(ctx context.Context, in io.Reader) (block.TipSetKey, error) {
 	logStore.Info("starting CAR file import")
@@ -324,6 +371,18 @@ func (chn *ChainStateReadWriter) ChainImport(ctx context.Context, in io.Reader)
 	return headKey, nil
 }
 
+// Fsck checks that the chain from the current head back to genesis is held in
+// full by the blockstore. State that has been pruned is not checked.
+func (chn *ChainStateReadWriter) Fsck(ctx context.Context) (*chain.FsckReport, error) {
+	return chain.Fsck(ctx, chn.bstore, chn.readWriter.GetHead(), chn.readWriter.PrunedHeight())
+}
+
+// DeleteBlock removes the block with CID `c` from the blockstore, so that a
+// corrupt copy can be replaced.
+func (chn *ChainStateReadWriter) DeleteBlock(c cid.Cid) error {
+	return chn.bstore.DeleteBlock(c)
+}
+
 // ChainStateTree returns the state tree as a slice of IPLD nodes at the passed stateroot cid `c`.
 func (chn *ChainStateReadWriter) ChainStateTree(ctx context.Context, c cid.Cid) ([]format.Node, error) {
 	offl := offline.Exchange(chn.bstore)
@@ -1,7 +1,10 @@
 package cst
 
 import (
+	"context"
+
 	"github.com/filecoin-project/go-filecoin/internal/pkg/block"
+	"github.com/filecoin-project/go-filecoin/internal/pkg/chain"
 	"github.com/filecoin-project/go-filecoin/internal/pkg/chainsync"
 	"github.com/filecoin-project/go-filecoin/internal/pkg/chainsync/status"
 )
@@ -9,6 +12,7 @@ import (
 type chainSync interface {
 	BlockProposer() chainsync.BlockProposer
 	Status() status.Status
+	ValidateImport(ctx context.Context, head, checkpoint block.TipSetKey, tipsets chain.TipSetProvider) error
 }
 
 // ChainSyncProvider provides access to chain sync operations and their status.
@@ -36,3 +40,10 @@ func (chs *ChainSyncProvider) Status() status.Status {
 func (chs *ChainSyncProvider) HandleNewTipSet(ci *block.ChainInfo) error {
 	return chs.sync.BlockProposer().SendOwnBlock(ci)
 }
+
+// ValidateImport re-executes the imported chain ending at `head` from
+// `checkpoint` onward and adds it to the chain store. Tipsets are read from
+// `tipsets` as they need not be in the chain store yet.
+func (chs *ChainSyncProvider) ValidateImport(ctx context.Context, head, checkpoint block.TipSetKey, tipsets chain.TipSetProvider) error {
+	return chs.sync.ValidateImport(ctx, head, checkpoint, tipsets)
+}
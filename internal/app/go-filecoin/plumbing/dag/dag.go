@@ -62,6 +62,13 @@ func (dag *DAG) GetNode(ctx context.Context, ref string) (interface{}, error) {
 	return out, nil
 }
 
+// Fetch ensures the block with CID `c` is held locally, retrieving it from the
+// network if it is not.
+func (dag *DAG) Fetch(ctx context.Context, c cid.Cid) error {
+	_, err := dag.dserv.Get(ctx, c)
+	return err
+}
+
 // GetFileSize returns the file size for a given Cid
 func (dag *DAG) GetFileSize(ctx context.Context, c cid.Cid) (uint64, error) {
 	fnode, err := dag.dserv.Get(ctx, c)
@@ -0,0 +1,116 @@
+package msg
+
+import (
+	"context"
+	"sort"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/specs-actors/actors/abi"
+	"github.com/ipfs/go-cid"
+	"github.com/pkg/errors"
+
+	"github.com/filecoin-project/go-filecoin/internal/pkg/block"
+	"github.com/filecoin-project/go-filecoin/internal/pkg/chain"
+	"github.com/filecoin-project/go-filecoin/internal/pkg/config"
+	"github.com/filecoin-project/go-filecoin/internal/pkg/types"
+	"github.com/filecoin-project/go-filecoin/internal/pkg/vm/gas"
+)
+
+// GasLimitAuto may be given as the gas limit of a message to be sent to have it estimated.
+var GasLimitAuto = gas.NewGas(-1)
+
+// GasPriceAuto may be given as the gas price of a message to be sent to use the suggested price.
+var GasPriceAuto = types.NewGasPrice(-1)
+
+// Abstracts over a store of blockchain state.
+type estimatorChainReader interface {
+	GetHead() block.TipSetKey
+	GetTipSet(block.TipSetKey) (block.TipSet, error)
+}
+
+// Provides the messages of a block.
+type estimatorMessageProvider interface {
+	LoadMessages(context.Context, cid.Cid) ([]*types.SignedMessage, []*types.UnsignedMessage, error)
+}
+
+// GasEstimator estimates the gas limit and gas price for outgoing messages.
+type GasEstimator struct {
+	previewer *Previewer
+	chain     estimatorChainReader
+	messages  estimatorMessageProvider
+	cfg       *config.MessageConfig
+}
+
+// NewGasEstimator constructs a GasEstimator.
+func NewGasEstimator(previewer *Previewer, chain estimatorChainReader, messages estimatorMessageProvider, cfg *config.MessageConfig) *GasEstimator {
+	return &GasEstimator{
+		previewer: previewer,
+		chain:     chain,
+		messages:  messages,
+		cfg:       cfg,
+	}
+}
+
+// EstimateGasLimit previews a message against the head state and returns the gas it uses plus
+// the configured safety margin, which also covers the size of the message's signature. The
+// estimate never exceeds the block gas limit.
+func (e *GasEstimator) EstimateGasLimit(ctx context.Context, from, to address.Address, value types.AttoFIL, method abi.MethodNum, params interface{}) (gas.Unit, error) {
+	used, err := e.previewer.PreviewMessage(ctx, from, to, value, method, params)
+	if err != nil {
+		return gas.NewGas(0), errors.Wrap(err, "failed to estimate gas limit")
+	}
+	limit := used + used*gas.Unit(e.cfg.GasLimitMarginPercent)/100
+	if limit > types.BlockGasLimit {
+		limit = types.BlockGasLimit
+	}
+	return limit, nil
+}
+
+// SuggestGasPrice returns the median gas price of the messages in the blocks of the most recent
+// tipsets, as configured by GasPriceLookback, or zero if they contain no messages.
+func (e *GasEstimator) SuggestGasPrice(ctx context.Context) (types.AttoFIL, error) {
+	head, err := e.chain.GetTipSet(e.chain.GetHead())
+	if err != nil {
+		return types.ZeroAttoFIL, errors.Wrap(err, "failed to get head tipset")
+	}
+
+	var prices []types.AttoFIL
+	seen := make(map[cid.Cid]struct{})
+	it := chain.IterAncestors(ctx, e.chain, head)
+	for i := uint(0); i < e.cfg.GasPriceLookback && !it.Complete(); i++ {
+		ts := it.Value()
+		for j := 0; j < ts.Len(); j++ {
+			secpMsgs, blsMsgs, err := e.messages.LoadMessages(ctx, ts.At(j).Messages.Cid)
+			if err != nil {
+				return types.ZeroAttoFIL, errors.Wrapf(err, "failed to load messages of block %s", ts.At(j).Cid())
+			}
+			msgs := make([]*types.UnsignedMessage, 0, len(secpMsgs)+len(blsMsgs))
+			for _, smsg := range secpMsgs {
+				msgs = append(msgs, &smsg.Message)
+			}
+			msgs = append(msgs, blsMsgs...)
+			for _, msg := range msgs {
+				c, err := msg.Cid()
+				if err != nil {
+					return types.ZeroAttoFIL, err
+				}
+				if _, ok := seen[c]; ok {
+					continue
+				}
+				seen[c] = struct{}{}
+				prices = append(prices, msg.GasPrice)
+			}
+		}
+		if err := it.Next(); err != nil {
+			return types.ZeroAttoFIL, err
+		}
+	}
+
+	if len(prices) == 0 {
+		return types.ZeroAttoFIL, nil
+	}
+	sort.Slice(prices, func(i, j int) bool {
+		return prices[i].LessThan(prices[j])
+	})
+	return prices[len(prices)/2], nil
+}
@@ -0,0 +1,68 @@
+package msg
+
+import (
+	"context"
+	"testing"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/internal/pkg/block"
+	"github.com/filecoin-project/go-filecoin/internal/pkg/chain"
+	"github.com/filecoin-project/go-filecoin/internal/pkg/config"
+	tf "github.com/filecoin-project/go-filecoin/internal/pkg/testhelpers/testflags"
+	"github.com/filecoin-project/go-filecoin/internal/pkg/types"
+)
+
+// builderWithHead is a chain builder with a settable head.
+type builderWithHead struct {
+	*chain.Builder
+	head block.TipSetKey
+}
+
+func (b *builderWithHead) GetHead() block.TipSetKey {
+	return b.head
+}
+
+func TestSuggestGasPrice(t *testing.T) {
+	tf.UnitTest(t)
+
+	ctx := context.Background()
+	builder := &builderWithHead{Builder: chain.NewBuilder(t, address.Undef)}
+	cfg := config.NewDefaultConfig().Message
+	estimator := NewGasEstimator(nil, builder, builder, cfg)
+
+	withPrices := func(parent block.TipSet, prices ...int64) block.TipSet {
+		var msgs []*types.SignedMessage
+		for _, price := range prices {
+			unsigned := newSignedMessage().Message
+			unsigned.GasPrice = types.NewGasPrice(price)
+			smsg, err := types.NewSignedMessage(ctx, unsigned, mockSigner)
+			require.NoError(t, err)
+			msgs = append(msgs, smsg)
+		}
+		return builder.BuildOneOn(parent, func(b *chain.BlockBuilder) {
+			b.AddMessages(msgs, []*types.UnsignedMessage{})
+		})
+	}
+
+	genesis := builder.NewGenesis()
+	builder.head = genesis.Key()
+	price, err := estimator.SuggestGasPrice(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, types.ZeroAttoFIL, price)
+
+	link1 := withPrices(genesis, 5, 1)
+	link2 := withPrices(link1, 3)
+	link3 := withPrices(link2, 100)
+	builder.head = link3.Key()
+	price, err = estimator.SuggestGasPrice(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, types.NewGasPrice(5), price)
+
+	cfg.GasPriceLookback = 2
+	price, err = estimator.SuggestGasPrice(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, types.NewGasPrice(100), price)
+}
@@ -5,10 +5,17 @@ import (
 
 	"github.com/filecoin-project/go-address"
 	"github.com/filecoin-project/specs-actors/actors/abi"
+	"github.com/filecoin-project/specs-actors/actors/runtime/exitcode"
+	"github.com/filecoin-project/specs-actors/actors/util/adt"
 	bstore "github.com/ipfs/go-ipfs-blockstore"
 	cbor "github.com/ipfs/go-ipld-cbor"
+	"github.com/pkg/errors"
 
 	"github.com/filecoin-project/go-filecoin/internal/pkg/block"
+	"github.com/filecoin-project/go-filecoin/internal/pkg/encoding"
+	"github.com/filecoin-project/go-filecoin/internal/pkg/types"
+	"github.com/filecoin-project/go-filecoin/internal/pkg/vm"
+	"github.com/filecoin-project/go-filecoin/internal/pkg/vm/actor"
 	"github.com/filecoin-project/go-filecoin/internal/pkg/vm/gas"
 	"github.com/filecoin-project/go-filecoin/internal/pkg/vm/state"
 )
@@ -20,14 +27,22 @@ type previewerChainReader interface {
 	GetTipSet(block.TipSetKey) (block.TipSet, error)
 }
 
-// Dragons: delete
+// Provides actors at a tipset, resolving their addresses.
+type previewerActorProvider interface {
+	GetActorAt(ctx context.Context, tipset block.TipSetKey, addr address.Address) (*actor.Actor, error)
+}
+
+// Applies a single message to a state tree.
 type messagePreviewer interface {
+	PreviewMessage(ctx context.Context, st state.Tree, vms vm.Storage, head block.TipSet, msg *types.UnsignedMessage) (vm.MessageReceipt, error)
 }
 
 // Previewer calculates the amount of Gas needed for a command
 type Previewer struct {
 	// To get the head tipset state root.
 	chainReader previewerChainReader
+	// To get the nonce of the sender.
+	actors previewerActorProvider
 	// To load the tree for the head tipset state root.
 	cst cbor.IpldStore
 	// For vm storage.
@@ -37,38 +52,57 @@ type Previewer struct {
 }
 
 // NewPreviewer constructs a Previewer.
-func NewPreviewer(chainReader previewerChainReader, cst cbor.IpldStore, bs bstore.Blockstore, processor messagePreviewer) *Previewer {
-	return &Previewer{chainReader, cst, bs, processor}
+func NewPreviewer(chainReader previewerChainReader, actors previewerActorProvider, cst cbor.IpldStore, bs bstore.Blockstore, processor messagePreviewer) *Previewer {
+	return &Previewer{chainReader, actors, cst, bs, processor}
 }
 
-// Preview sends a read-only message to an actor.
+// Preview computes the gas used by a message sending no value, see PreviewMessage.
+// At most one parameter may be given, which is the message's params.
 func (p *Previewer) Preview(ctx context.Context, optFrom, to address.Address, method abi.MethodNum, params ...interface{}) (gas.Unit, error) {
-	// Dragons: delete
+	var msgParams interface{} = adt.Empty
+	if len(params) > 1 {
+		return gas.NewGas(0), errors.Errorf("cannot preview a message with %d parameters", len(params))
+	} else if len(params) == 1 {
+		msgParams = params[0]
+	}
+	return p.PreviewMessage(ctx, optFrom, to, types.ZeroAttoFIL, method, msgParams)
+}
 
-	// encodedParams, err := abi.ToEncodedValues(params...)
-	// if err != nil {
-	// 	return gas.Unit(0), errors.Wrap(err, "failed to encode message params")
-	// }
+// PreviewMessage computes the gas used by a message by applying it to the state of the head
+// tipset, without committing the result. The message is given the sender's next nonce on chain,
+// a zero gas price and the block gas limit. It returns an error if the message fails.
+func (p *Previewer) PreviewMessage(ctx context.Context, from, to address.Address, value types.AttoFIL, method abi.MethodNum, params interface{}) (gas.Unit, error) {
+	encodedParams, err := encoding.Encode(params)
+	if err != nil {
+		return gas.NewGas(0), errors.Wrap(err, "failed to encode message params")
+	}
 
-	// st, err := p.chainReader.GetTipSetState(ctx, p.chainReader.GetHead())
-	// if err != nil {
-	// 	return gas.Unit(0), errors.Wrap(err, "failed to load tree for latest state root")
-	// }
-	// head, err := p.chainReader.GetTipSet(p.chainReader.GetHead())
-	// if err != nil {
-	// 	return gas.Unit(0), errors.Wrap(err, "failed to get head tipset ")
-	// }
-	// h, err := head.Height()
-	// if err != nil {
-	// 	return gas.Unit(0), errors.Wrap(err, "failed to get head tipset height")
-	// }
+	headKey := p.chainReader.GetHead()
+	head, err := p.chainReader.GetTipSet(headKey)
+	if err != nil {
+		return gas.NewGas(0), errors.Wrap(err, "failed to get head tipset")
+	}
+	st, err := p.chainReader.GetTipSetState(ctx, headKey)
+	if err != nil {
+		return gas.NewGas(0), errors.Wrap(err, "failed to load tree for latest state root")
+	}
 
-	// vms := vm.NewStorageMap(p.bs)
-	// usedGas, err := p.processor.PreviewQueryMethod(ctx, st, vms, to, method, encodedParams, optFrom, abi.ChainEpoch(h))
-	// if err != nil {
-	// 	return gas.Unit(0), errors.Wrap(err, "query method returned an error")
-	// }
-	// return usedGas, nil
+	fromActor, err := p.actors.GetActorAt(ctx, headKey, from)
+	if err != nil {
+		return gas.NewGas(0), errors.Wrapf(err, "no actor at address %s", from)
+	}
+	nonce, err := actor.NextNonce(fromActor)
+	if err != nil {
+		return gas.NewGas(0), errors.Wrapf(err, "failed calculating nonce for actor at %s", from)
+	}
 
-	return gas.NewGas(0), nil
+	msg := types.NewMeteredMessage(from, to, nonce, value, method, encodedParams, types.ZeroAttoFIL, types.BlockGasLimit)
+	receipt, err := p.processor.PreviewMessage(ctx, st, vm.NewStorage(p.bs), head, msg)
+	if err != nil {
+		return gas.NewGas(0), errors.Wrap(err, "failed to apply message")
+	}
+	if receipt.ExitCode != exitcode.Ok {
+		return gas.NewGas(0), errors.Errorf("message failed with exit code %d", receipt.ExitCode)
+	}
+	return receipt.GasUsed, nil
 }
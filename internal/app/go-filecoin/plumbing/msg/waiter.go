@@ -29,6 +29,7 @@ type waiterChainReader interface {
 	GetTipSetState(context.Context, block.TipSetKey) (state.Tree, error)
 	GetTipSetReceiptsRoot(block.TipSetKey) (cid.Cid, error)
 	HeadEvents() *pubsub.PubSub
+	SubHeadChanges(context.Context) <-chan chain.HeadChange
 }
 
 // Waiter waits for a message to appear on chain.
@@ -44,6 +45,8 @@ type ChainMessage struct {
 	Message *types.SignedMessage
 	Block   *block.Block
 	Receipt *vm.MessageReceipt
+	// Key of the tipset including the block
+	TipSet block.TipSetKey
 }
 
 // WaitPredicate is a function that identifies a message and returns true when found.
@@ -119,6 +122,78 @@ func (w *Waiter) Wait(ctx context.Context, msgCid cid.Cid, lookback uint64, cb f
 	return w.WaitPredicate(ctx, lookback, pred, cb)
 }
 
+// WaitConfidence waits for a message with the given cid to appear on chain in a tipset at least
+// `confidence` epochs below the head, and returns it with its receipt and inclusion tipset. If the
+// inclusion tipset is reverted before reaching that depth, it waits for the message to appear
+// again. With zero confidence it returns as soon as the message is found, like Wait.
+func (w *Waiter) WaitConfidence(ctx context.Context, msgCid cid.Cid, lookback, confidence uint64) (*ChainMessage, error) {
+	pred := func(msg *types.SignedMessage, c cid.Cid) bool {
+		return c.Equals(msgCid)
+	}
+
+	// The subscription delivers the current head first, then every change of head.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	changes := w.chainReader.SubHeadChanges(ctx)
+
+	var head block.TipSet
+	var found *ChainMessage
+	for {
+		if found != nil {
+			height, err := head.Height()
+			if err != nil {
+				return nil, err
+			}
+			if uint64(height-found.Block.Height) >= confidence {
+				return found, nil
+			}
+		}
+
+		var change chain.HeadChange
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case c, more := <-changes:
+			if !more {
+				if ctx.Err() != nil {
+					return nil, ctx.Err()
+				}
+				return nil, errors.New("head change subscription closed")
+			}
+			change = c
+		}
+		if len(change.Apply) == 0 {
+			continue
+		}
+
+		if !head.Defined() {
+			var err error
+			head = change.Apply[0]
+			if found, _, err = w.findMessage(ctx, head, lookback, pred); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if found != nil {
+			for _, ts := range change.Revert {
+				if ts.Key().Equals(found.TipSet) {
+					log.Infof("tipset %s including message %s reverted, waiting again", ts.Key(), msgCid)
+					found = nil
+					break
+				}
+			}
+		}
+		// Applied tipsets are in descending height order.
+		for i := len(change.Apply) - 1; found == nil && i >= 0; i-- {
+			var err error
+			if found, _, err = w.receiptForTipset(ctx, change.Apply[i], pred); err != nil {
+				return nil, err
+			}
+		}
+		head = change.Apply[0]
+	}
+}
+
 // findMessage looks for a matching in the chain and returns the message,
 // block and receipt, when it is found. Returns the found message/block or nil
 // if now block with the given CID exists in the chain.
@@ -258,7 +333,7 @@ func (w *Waiter) receiptForTipset(ctx context.Context, ts block.TipSet, pred Wai
 				if err != nil {
 					return nil, false, errors.Wrap(err, "error retrieving receipt from tipset")
 				}
-				return &ChainMessage{wrappedMsgs[k], blk, recpt}, true, nil
+				return &ChainMessage{Message: wrappedMsgs[k], Block: blk, Receipt: recpt, TipSet: ts.Key()}, true, nil
 			}
 		}
 	}
@@ -161,6 +161,109 @@ func TestWaitRespectsContextCancel(t *testing.T) {
 	}
 }
 
+func TestWaitConfidence(t *testing.T) {
+	tf.UnitTest(t)
+
+	ctx := context.Background()
+	cst, chainStore, msgStore, waiter := setupTest(t)
+
+	m1 := newSignedMessage()
+	m1Cid, err := m1.Cid()
+	require.NoError(t, err)
+	root, err := chainStore.GetTipSet(chainStore.GetHead())
+	require.NoError(t, err)
+
+	setHead := func(ts block.TipSet) {
+		require.NoError(t, chainStore.PutTipSetMetadata(ctx, &chain.TipSetMetadata{
+			TipSet:          ts,
+			TipSetStateRoot: ts.ToSlice()[0].StateRoot.Cid,
+			TipSetReceipts:  ts.ToSlice()[0].MessageReceipts.Cid,
+		}))
+		require.NoError(t, chainStore.SetHead(ctx, ts))
+	}
+
+	// The waiter's head changes are delivered through a reader that reports each head delivered.
+	delivered := make(chan block.TipSet, 16)
+	waiter = NewWaiter(&deliveryReportingReader{chainStore, delivered}, msgStore, waiter.bs, cst)
+	awaitDelivered := func(expected block.TipSet) {
+		for {
+			select {
+			case head := <-delivered:
+				if head.Equals(expected) {
+					return
+				}
+			case <-time.After(2 * time.Second):
+				require.Fail(t, "head not delivered to waiter", "%s", expected.Key())
+			}
+		}
+	}
+
+	type waitResult struct {
+		msg *ChainMessage
+		err error
+	}
+	resultCh := make(chan waitResult, 1)
+	go func() {
+		found, err := waiter.WaitConfidence(ctx, m1Cid, DefaultMessageWaitLookback, 2)
+		resultCh <- waitResult{found, err}
+	}()
+	// Wait until the waiter has subscribed to head changes and received the current head.
+	awaitDelivered(root)
+
+	// The message is included in a tipset that is then reverted.
+	left := newChainWithMessages(cst, msgStore, root, smsgsSet{smsgs{m1}})
+	setHead(left[1])
+
+	// The message is included again on the other fork, and buried.
+	filler := func() smsgsSet { return smsgsSet{smsgs{newSignedMessage()}} }
+	right := newChainWithMessages(cst, msgStore, root, filler(), smsgsSet{smsgs{m1}}, filler(), filler())
+	for _, ts := range right[1:4] {
+		setHead(ts)
+	}
+	awaitDelivered(right[3])
+	select {
+	case res := <-resultCh:
+		assert.Fail(t, "wait returned before confidence reached", "%v", res)
+	default:
+	}
+
+	// The waiter is still reading head changes once the message is only one epoch deep.
+	setHead(right[4])
+	awaitDelivered(right[4])
+	select {
+	case res := <-resultCh:
+		require.NoError(t, res.err)
+		assert.True(t, types.SmsgCidsEqual(m1, res.msg.Message))
+		assert.Equal(t, right[2].Key(), res.msg.TipSet)
+		assert.NotNil(t, res.msg.Receipt)
+	case <-time.After(2 * time.Second):
+		assert.Fail(t, "wait should have returned when confidence was reached")
+	}
+}
+
+// deliveryReportingReader reports the new head of each head change once it is delivered.
+type deliveryReportingReader struct {
+	waiterChainReader
+	delivered chan<- block.TipSet
+}
+
+func (r *deliveryReportingReader) SubHeadChanges(ctx context.Context) <-chan chain.HeadChange {
+	changes := r.waiterChainReader.SubHeadChanges(ctx)
+	out := make(chan chain.HeadChange)
+	go func() {
+		defer close(out)
+		for change := range changes {
+			select {
+			case out <- change:
+				r.delivered <- change.Apply[0]
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
+
 // NewChainWithMessages creates a chain of tipsets containing the given messages
 // and stores them in the given store.  Note the msg arguments are slices of
 // slices of messages -- each slice of slices goes into a successive tipset,
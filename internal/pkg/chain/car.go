@@ -38,7 +38,20 @@ type carHeader struct {
 }
 
 // Export will export a chain (all blocks and their messages) to the writer `out`.
+// Message receipts are exported for every tipset, state only for genesis.
 func Export(ctx context.Context, headTS block.TipSet, cr carChainReader, mr carMessageReader, sr carStateReader, out io.Writer) error {
+	return export(ctx, headTS, cr, mr, sr, out, 0, true)
+}
+
+// ExportSnapshot will export a lightweight snapshot of a chain to the writer `out`.
+// All blocks and their messages are exported, but the parent state trees and
+// message receipts referenced by block headers are only exported for the
+// `stateDepth` tipsets counted back from and including `headTS`, and for genesis.
+func ExportSnapshot(ctx context.Context, headTS block.TipSet, cr carChainReader, mr carMessageReader, sr carStateReader, out io.Writer, stateDepth uint) error {
+	return export(ctx, headTS, cr, mr, sr, out, stateDepth, false)
+}
+
+func export(ctx context.Context, headTS block.TipSet, cr carChainReader, mr carMessageReader, sr carStateReader, out io.Writer, stateDepth uint, allReceipts bool) error {
 	// ensure we don't duplicate writes to the car file. // e.g. only write EmptyMessageCID once.
 	filter := make(map[cid.Cid]bool)
 
@@ -64,11 +77,13 @@ func Export(ctx context.Context, headTS block.TipSet, cr carChainReader, mr carM
 
 	iter := IterAncestors(ctx, cr, headTS)
 	// accumulate TipSets in descending order.
-	for ; !iter.Complete(); err = iter.Next() {
+	for depth := uint(0); !iter.Complete(); err = iter.Next() {
 		if err != nil {
 			return err
 		}
 		tip := iter.Value()
+		withState := depth < stateDepth
+		depth++
 		// write blocks
 		for i := 0; i < tip.Len(); i++ {
 			hdr := tip.At(i)
@@ -115,13 +130,15 @@ func Export(ctx context.Context, headTS block.TipSet, cr carChainReader, mr carM
 				filter[meta.BLSRoot.Cid] = true
 			}
 
+			isGenesis := hdr.Height == 0
+
 			// TODO(#3473) we can remove MessageReceipts from the exported file once addressed.
-			rect, err := mr.LoadReceipts(ctx, hdr.MessageReceipts.Cid)
-			if err != nil {
-				return err
-			}
+			if (allReceipts || withState || isGenesis) && !filter[hdr.MessageReceipts.Cid] {
+				rect, err := mr.LoadReceipts(ctx, hdr.MessageReceipts.Cid)
+				if err != nil {
+					return err
+				}
 
-			if !filter[hdr.MessageReceipts.Cid] {
 				logCar.Debugf("writing message-receipt collection: %s", hdr.Messages)
 				if err := exportAMTReceipts(ctx, out, rect); err != nil {
 					return err
@@ -129,17 +146,22 @@ func Export(ctx context.Context, headTS block.TipSet, cr carChainReader, mr carM
 				filter[hdr.MessageReceipts.Cid] = true
 			}
 
-			if hdr.Height == 0 {
+			if (withState || isGenesis) && !filter[hdr.StateRoot.Cid] {
 				logCar.Debugf("writing state tree: %s", hdr.StateRoot)
 				stateRoots, err := sr.ChainStateTree(ctx, hdr.StateRoot.Cid)
 				if err != nil {
 					return err
 				}
 				for _, r := range stateRoots {
+					if filter[r.Cid()] {
+						continue
+					}
 					if err := carutil.LdWrite(out, r.Cid().Bytes(), r.RawData()); err != nil {
 						return err
 					}
+					filter[r.Cid()] = true
 				}
+				filter[hdr.StateRoot.Cid] = true
 			}
 		}
 	}
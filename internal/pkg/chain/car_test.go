@@ -219,6 +219,38 @@ func TestChainImportExportMultiTipSetWithMessages(t *testing.T) {
 	validateBlockstoreImport(ctx, t, ts3.Key(), gene.Key(), bstore)
 }
 
+func TestChainExportSnapshotBoundsStateDepth(t *testing.T) {
+	tf.UnitTest(t)
+
+	ctx, gene, cb, carW, carR, bstore := setupDeps(t)
+
+	keys := types.MustGenerateKeyInfo(1, 42)
+	mm := vm.NewMessageMaker(t, keys)
+	alice := mm.Addresses()[0]
+
+	ts1 := cb.BuildOneOn(gene, func(b *chain.BlockBuilder) {
+		b.AddMessages([]*types.SignedMessage{mm.NewSignedMessage(alice, 1)}, []*types.UnsignedMessage{})
+	})
+	ts2 := cb.BuildOneOn(ts1, func(b *chain.BlockBuilder) {
+		b.AddMessages([]*types.SignedMessage{mm.NewSignedMessage(alice, 2)}, []*types.UnsignedMessage{})
+	})
+	ts3 := cb.AppendOn(ts2, 1)
+
+	// export a snapshot with state for the head only
+	sr := &recordingStateReader{}
+	require.NoError(t, chain.ExportSnapshot(ctx, ts3, cb, cb, sr, carW, 1))
+	require.NoError(t, carW.Flush())
+
+	assert.Contains(t, sr.roots, ts3.At(0).StateRoot.Cid)
+	assert.Contains(t, sr.roots, gene.At(0).StateRoot.Cid)
+	assert.NotContains(t, sr.roots, ts1.At(0).StateRoot.Cid)
+
+	// all headers and messages are still exported
+	importedKey := mustImportFromBuffer(ctx, t, bstore, carR)
+	assert.Equal(t, ts3.Key(), importedKey)
+	validateBlockstoreImport(ctx, t, ts3.Key(), gene.Key(), bstore)
+}
+
 func mustExportToBuffer(ctx context.Context, t *testing.T, head block.TipSet, cb *chain.Builder, msr *mockStateReader, carW *bufio.Writer) {
 	err := chain.Export(ctx, head, cb, cb, msr, carW)
 	assert.NoError(t, err)
@@ -319,6 +351,15 @@ func requireAMTDecoding(ctx context.Context, t *testing.T, bstore blockstore.Blo
 
 }
 
+type recordingStateReader struct {
+	roots []cid.Cid
+}
+
+func (r *recordingStateReader) ChainStateTree(ctx context.Context, c cid.Cid) ([]format.Node, error) {
+	r.roots = append(r.roots, c)
+	return nil, nil
+}
+
 type mockStateReader struct{}
 
 func (mr *mockStateReader) ChainStateTree(ctx context.Context, c cid.Cid) ([]format.Node, error) {
@@ -0,0 +1,123 @@
+package chain
+
+import (
+	"context"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/pkg/errors"
+
+	"github.com/filecoin-project/go-filecoin/internal/pkg/block"
+	"github.com/filecoin-project/go-filecoin/internal/pkg/encoding"
+)
+
+// CheckpointKey is the key at which the key of the checkpoint tipset is
+// written in the datastore.
+var CheckpointKey = datastore.NewKey("/chain/checkpoint")
+
+// ErrForkBeforeCheckpoint is returned when a chain does not include the
+// checkpoint tipset.
+var ErrForkBeforeCheckpoint = errors.New("chain forks before the checkpoint")
+
+// Checkpoint returns the checkpoint tipset, or an undefined tipset if none
+// has been set.
+func (store *Store) Checkpoint() block.TipSet {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	return store.checkpoint
+}
+
+// SetCheckpoint pins the tipset with `key` so that the chain never reorgs
+// below it: heads whose chain does not include it are rejected by
+// CheckCheckpoint. The tipset must be in the store and on the chain of the
+// current head. An empty key removes the checkpoint.
+func (store *Store) SetCheckpoint(ctx context.Context, key block.TipSetKey) error {
+	if key.Empty() {
+		store.mu.Lock()
+		defer store.mu.Unlock()
+		if err := store.ds.Delete(CheckpointKey); err != nil && err != datastore.ErrNotFound {
+			return errors.Wrap(err, "failed to delete checkpoint")
+		}
+		store.checkpoint = block.UndefTipSet
+		return nil
+	}
+
+	ts, err := store.GetTipSet(key)
+	if err != nil {
+		return errors.Wrapf(err, "failed to load checkpoint tipset %s", key)
+	}
+	head, err := store.GetTipSet(store.GetHead())
+	if err != nil {
+		return err
+	}
+	if err := descendsFrom(ctx, store, head, ts); err != nil {
+		return errors.Wrapf(err, "checkpoint %s is not on the chain of head %s", key, head.Key())
+	}
+
+	val, err := encoding.Encode(key)
+	if err != nil {
+		return err
+	}
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if err := store.ds.Put(CheckpointKey, val); err != nil {
+		return errors.Wrap(err, "failed to write checkpoint to datastore")
+	}
+	store.checkpoint = ts
+	return nil
+}
+
+// CheckCheckpoint returns an error wrapping ErrForkBeforeCheckpoint if the
+// chain ending at `ts` does not include the checkpoint. The ancestors of `ts`
+// down to the checkpoint's height must be in the store.
+func (store *Store) CheckCheckpoint(ctx context.Context, ts block.TipSet) error {
+	checkpoint := store.Checkpoint()
+	if !checkpoint.Defined() {
+		return nil
+	}
+	return descendsFrom(ctx, store, ts, checkpoint)
+}
+
+// descendsFrom returns an error wrapping ErrForkBeforeCheckpoint unless
+// `ancestor` is `ts` or one of its ancestors.
+func descendsFrom(ctx context.Context, store *Store, ts, ancestor block.TipSet) error {
+	h, err := ts.Height()
+	if err != nil {
+		return err
+	}
+	ancestorHeight, err := ancestor.Height()
+	if err != nil {
+		return err
+	}
+	if h >= ancestorHeight {
+		atHeight, err := FindTipsetAtEpoch(ctx, ts, ancestorHeight, store)
+		if err != nil {
+			return err
+		}
+		if atHeight.Equals(ancestor) {
+			return nil
+		}
+	}
+	return errors.Wrapf(ErrForkBeforeCheckpoint, "tipset %s at height %d does not descend from %s at height %d", ts.Key(), h, ancestor.Key(), ancestorHeight)
+}
+
+// loadCheckpoint reads the checkpoint from disk, returning an undefined
+// tipset if none is set.
+func (store *Store) loadCheckpoint() (block.TipSet, error) {
+	bb, err := store.ds.Get(CheckpointKey)
+	if err == datastore.ErrNotFound {
+		return block.UndefTipSet, nil
+	}
+	if err != nil {
+		return block.UndefTipSet, errors.Wrap(err, "failed to read CheckpointKey")
+	}
+
+	var key block.TipSetKey
+	if err := encoding.Decode(bb, &key); err != nil {
+		return block.UndefTipSet, errors.Wrap(err, "failed to decode checkpoint")
+	}
+	ts, err := store.GetTipSet(key)
+	if err != nil {
+		return block.UndefTipSet, errors.Wrapf(err, "failed to load checkpoint tipset %s", key)
+	}
+	return ts, nil
+}
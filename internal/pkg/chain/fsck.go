@@ -0,0 +1,236 @@
+package chain
+
+import (
+	"context"
+
+	"github.com/filecoin-project/specs-actors/actors/abi"
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	cbor "github.com/ipfs/go-ipld-cbor"
+	format "github.com/ipfs/go-ipld-format"
+	"github.com/ipfs/go-merkledag"
+	"github.com/pkg/errors"
+
+	"github.com/filecoin-project/go-filecoin/internal/pkg/block"
+)
+
+// Kinds of object checked by Fsck.
+const (
+	FsckHeader   = "header"
+	FsckMessages = "messages"
+	FsckReceipts = "receipts"
+	FsckState    = "state"
+)
+
+// FsckProblem describes an object that is missing from the blockstore,
+// whose stored bytes do not decode or do not match its CID, or which could
+// not be read or checked.
+type FsckProblem struct {
+	Cid cid.Cid
+	// Kind is the kind of chain data the object belongs to.
+	Kind string
+	// Height is the height of the tipset the object belongs to, or -1 for
+	// headers, whose height can't be known if they are unusable.
+	Height abi.ChainEpoch
+	// Missing is set if the object is not in the blockstore.
+	Missing bool
+	// Corrupt is set if the stored bytes do not match the CID or do not
+	// decode. Problems which are neither missing nor corrupt, such as read
+	// errors, may be transient.
+	Corrupt bool
+	Err     string
+}
+
+// FsckReport is the result of a chain check.
+type FsckReport struct {
+	Head block.TipSetKey
+	// Tipsets is the number of tipsets walked.
+	Tipsets int
+	// Objects is the number of distinct objects checked.
+	Objects  int
+	Problems []FsckProblem
+}
+
+// Fsck walks the chain in `bs` back from `head` to genesis and checks that
+// every block header, message collection, receipt collection and state tree
+// on the way is present in full and decodable.
+//
+// State and receipts are only checked for tipsets at or above `stateFloor`
+// (and genesis), since those below it may have been pruned. The state computed
+// for the head tipset itself is not referenced by any header and so is not
+// checked.
+//
+// Problems are reported rather than returned as errors. The walk stops early
+// only if a header is unusable, since the chain beyond it can't be found.
+func Fsck(ctx context.Context, bs blockstore.Blockstore, head block.TipSetKey, stateFloor abi.ChainEpoch) (*FsckReport, error) {
+	if head.Empty() {
+		return nil, errors.New("no head to check")
+	}
+	f := &fsck{
+		bs:     bs,
+		seen:   cid.NewSet(),
+		report: &FsckReport{Head: head},
+	}
+	headTs := f.checkTipSet(head)
+	if !headTs.Defined() {
+		return f.done(), nil
+	}
+
+	// The state root and receipts in a tipset's headers are those of its
+	// parent, so they are checked once the parent's height is known.
+	var child block.TipSet
+	var err error
+	for it := IterAncestors(ctx, tipSetChecker{f}, headTs); !it.Complete(); err = it.Next() {
+		if err != nil {
+			// The checker records a problem for each unusable parent.
+			logStore.Warnf("fsck stopped at parents of tipset %s: %s", child.Key(), err)
+			return f.done(), nil
+		}
+		ts := it.Value()
+		f.report.Tipsets++
+		h, err := ts.Height()
+		if err != nil {
+			return nil, err
+		}
+		for i := 0; i < ts.Len(); i++ {
+			if err := f.checkDAG(ctx, ts.At(i).Messages.Cid, FsckMessages, h); err != nil {
+				return nil, err
+			}
+		}
+		if child.Defined() && (h >= stateFloor || h == 0) {
+			if err := f.checkStateOf(ctx, child, h); err != nil {
+				return nil, err
+			}
+		}
+		if h == 0 {
+			// Genesis' headers hold its own state.
+			if err := f.checkStateOf(ctx, ts, h); err != nil {
+				return nil, err
+			}
+		}
+		child = ts
+	}
+	return f.done(), nil
+}
+
+type fsck struct {
+	bs     blockstore.Blockstore
+	seen   *cid.Set
+	report *FsckReport
+}
+
+func (f *fsck) done() *FsckReport {
+	f.report.Objects = f.seen.Len()
+	return f.report
+}
+
+// checkStateOf checks the state and receipts referenced by the headers of
+// `ts`, which belong to the tipset at height `h`.
+func (f *fsck) checkStateOf(ctx context.Context, ts block.TipSet, h abi.ChainEpoch) error {
+	for i := 0; i < ts.Len(); i++ {
+		if err := f.checkDAG(ctx, ts.At(i).StateRoot.Cid, FsckState, h); err != nil {
+			return err
+		}
+		if err := f.checkDAG(ctx, ts.At(i).MessageReceipts.Cid, FsckReceipts, h); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkTipSet loads the headers of the tipset with `key`, recording a problem
+// for each one that is unusable. It returns an undefined tipset if any is.
+func (f *fsck) checkTipSet(key block.TipSetKey) block.TipSet {
+	var blks []*block.Block
+	ok := true
+	for it := key.Iter(); !it.Complete(); it.Next() {
+		c := it.Value()
+		f.seen.Add(c)
+		raw, problem := f.get(c)
+		if problem != nil {
+			problem.Kind, problem.Height = FsckHeader, -1
+			f.report.Problems = append(f.report.Problems, *problem)
+			ok = false
+			continue
+		}
+		blk, err := block.DecodeBlock(raw.RawData())
+		if err != nil {
+			f.report.Problems = append(f.report.Problems, FsckProblem{Cid: c, Kind: FsckHeader, Height: -1, Corrupt: true, Err: err.Error()})
+			ok = false
+			continue
+		}
+		blks = append(blks, blk)
+	}
+	if !ok {
+		return block.UndefTipSet
+	}
+	ts, err := block.NewTipSet(blks...)
+	if err != nil {
+		for it := key.Iter(); !it.Complete(); it.Next() {
+			f.report.Problems = append(f.report.Problems, FsckProblem{Cid: it.Value(), Kind: FsckHeader, Height: -1, Err: err.Error()})
+		}
+		return block.UndefTipSet
+	}
+	return ts
+}
+
+// checkDAG checks every object reachable from `root` that has not already
+// been checked.
+func (f *fsck) checkDAG(ctx context.Context, root cid.Cid, kind string, h abi.ChainEpoch) error {
+	getLinks := func(ctx context.Context, c cid.Cid) ([]*format.Link, error) {
+		raw, problem := f.get(c)
+		if problem != nil {
+			problem.Kind, problem.Height = kind, h
+			f.report.Problems = append(f.report.Problems, *problem)
+			return nil, nil
+		}
+		if c.Prefix().Codec != cid.DagCBOR {
+			return nil, nil
+		}
+		nd, err := cbor.DecodeBlock(raw)
+		if err != nil {
+			f.report.Problems = append(f.report.Problems, FsckProblem{Cid: c, Kind: kind, Height: h, Corrupt: true, Err: err.Error()})
+			return nil, nil
+		}
+		return nd.Links(), nil
+	}
+	if err := merkledag.Walk(ctx, getLinks, root, f.seen.Visit); err != nil {
+		return errors.Wrapf(err, "failed to walk %s root %s", kind, root)
+	}
+	return nil
+}
+
+// get reads the object with CID `c` and checks that its bytes hash to `c`.
+// The returned problem's kind and height are left for the caller to set.
+func (f *fsck) get(c cid.Cid) (blocks.Block, *FsckProblem) {
+	raw, err := f.bs.Get(c)
+	if err == blockstore.ErrNotFound {
+		return nil, &FsckProblem{Cid: c, Missing: true, Err: err.Error()}
+	}
+	if err != nil {
+		return nil, &FsckProblem{Cid: c, Err: err.Error()}
+	}
+	sum, err := c.Prefix().Sum(raw.RawData())
+	if err != nil {
+		return nil, &FsckProblem{Cid: c, Err: err.Error()}
+	}
+	if !sum.Equals(c) {
+		return nil, &FsckProblem{Cid: c, Corrupt: true, Err: "stored bytes do not match cid"}
+	}
+	return raw, nil
+}
+
+// tipSetChecker adapts a fsck to the TipSetProvider used for the walk, so
+// that the headers of each tipset are checked as they are loaded.
+type tipSetChecker struct {
+	f *fsck
+}
+
+func (tc tipSetChecker) GetTipSet(key block.TipSetKey) (block.TipSet, error) {
+	ts := tc.f.checkTipSet(key)
+	if !ts.Defined() {
+		return block.UndefTipSet, errors.Errorf("tipset %s is unusable", key)
+	}
+	return ts, nil
+}
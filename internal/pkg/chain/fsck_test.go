@@ -0,0 +1,142 @@
+package chain_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/specs-actors/actors/abi"
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/internal/pkg/cborutil"
+	"github.com/filecoin-project/go-filecoin/internal/pkg/chain"
+	"github.com/filecoin-project/go-filecoin/internal/pkg/repo"
+	tf "github.com/filecoin-project/go-filecoin/internal/pkg/testhelpers/testflags"
+	"github.com/filecoin-project/go-filecoin/internal/pkg/types"
+	"github.com/filecoin-project/go-filecoin/internal/pkg/vm"
+	"github.com/filecoin-project/go-filecoin/internal/pkg/vm/actor"
+	vmaddr "github.com/filecoin-project/go-filecoin/internal/pkg/vm/address"
+	"github.com/filecoin-project/go-filecoin/internal/pkg/vm/state"
+)
+
+// fixedStateBuilder gives every tipset the same, real, state root.
+type fixedStateBuilder struct {
+	chain.FakeStateBuilder
+	root cid.Cid
+}
+
+func (sb *fixedStateBuilder) ComputeState(prev cid.Cid, blsMessages [][]*types.UnsignedMessage, secpMessages [][]*types.SignedMessage) (cid.Cid, []vm.MessageReceipt, error) {
+	return sb.root, []vm.MessageReceipt{}, nil
+}
+
+func TestFsck(t *testing.T) {
+	tf.UnitTest(t)
+
+	ctx := context.Background()
+	bs := bstore.NewBlockstore(repo.NewInMemoryRepo().Datastore())
+	cst := cborutil.NewIpldStore(bs)
+
+	st := state.NewState(cst)
+	act := actor.NewActor(types.CidFromString(t, "somecid"), abi.NewTokenAmount(0), cid.Undef)
+	require.NoError(t, st.SetActor(ctx, vmaddr.NewForTestGetter()(), act))
+	root, err := st.Commit(ctx)
+	require.NoError(t, err)
+
+	// The builder's blocks reference empty message and receipt collections.
+	messages := chain.NewMessageStore(bs)
+	_, err = messages.StoreMessages(ctx, []*types.SignedMessage{}, []*types.UnsignedMessage{})
+	require.NoError(t, err)
+	_, err = messages.StoreReceipts(ctx, []vm.MessageReceipt{})
+	require.NoError(t, err)
+
+	builder := chain.NewBuilderWithDeps(t, address.Undef, &fixedStateBuilder{root: root}, &chain.ZeroTimestamper{})
+	genTS := builder.NewGenesis()
+	link1 := builder.AppendOn(genTS, 1)
+	link2 := builder.AppendOn(link1, 2)
+	link3 := builder.AppendOn(link2, 1)
+	requirePutBlocksToCborStore(t, cst, genTS.ToSlice()...)
+	requirePutBlocksToCborStore(t, cst, link1.ToSlice()...)
+	requirePutBlocksToCborStore(t, cst, link2.ToSlice()...)
+	requirePutBlocksToCborStore(t, cst, link3.ToSlice()...)
+
+	t.Run("complete chain has no problems", func(t *testing.T) {
+		report, err := chain.Fsck(ctx, bs, link3.Key(), 0)
+		require.NoError(t, err)
+		assert.Empty(t, report.Problems)
+		assert.Equal(t, 4, report.Tipsets)
+		assert.Equal(t, link3.Key(), report.Head)
+	})
+
+	t.Run("missing header stops the walk", func(t *testing.T) {
+		missing := link2.At(1)
+		require.NoError(t, bs.DeleteBlock(missing.Cid()))
+		defer requirePutBlocksToCborStore(t, cst, missing)
+
+		report, err := chain.Fsck(ctx, bs, link3.Key(), 0)
+		require.NoError(t, err)
+		assert.Equal(t, 1, report.Tipsets)
+		require.Len(t, report.Problems, 1)
+		assert.Equal(t, missing.Cid(), report.Problems[0].Cid)
+		assert.Equal(t, chain.FsckHeader, report.Problems[0].Kind)
+		assert.True(t, report.Problems[0].Missing)
+		assert.False(t, report.Problems[0].Corrupt)
+	})
+
+	t.Run("corrupt state is reported once", func(t *testing.T) {
+		good, err := bs.Get(root)
+		require.NoError(t, err)
+		require.NoError(t, bs.DeleteBlock(root))
+		junk, err := blocks.NewBlockWithCid([]byte("junk"), root)
+		require.NoError(t, err)
+		require.NoError(t, bs.Put(junk))
+		defer func() {
+			require.NoError(t, bs.DeleteBlock(root))
+			require.NoError(t, bs.Put(good))
+		}()
+
+		report, err := chain.Fsck(ctx, bs, link3.Key(), 0)
+		require.NoError(t, err)
+		assert.Equal(t, 4, report.Tipsets)
+		require.Len(t, report.Problems, 1)
+		assert.Equal(t, root, report.Problems[0].Cid)
+		assert.Equal(t, chain.FsckState, report.Problems[0].Kind)
+		assert.Equal(t, abi.ChainEpoch(2), report.Problems[0].Height)
+		assert.False(t, report.Problems[0].Missing)
+		assert.True(t, report.Problems[0].Corrupt)
+
+		// State below the floor is not checked, except genesis'.
+		report, err = chain.Fsck(ctx, bs, link3.Key(), 10)
+		require.NoError(t, err)
+		require.Len(t, report.Problems, 1)
+		assert.Equal(t, abi.ChainEpoch(0), report.Problems[0].Height)
+	})
+
+	t.Run("read errors are neither missing nor corrupt", func(t *testing.T) {
+		failing := &failingBlockstore{Blockstore: bs, fail: root}
+		report, err := chain.Fsck(ctx, failing, link3.Key(), 0)
+		require.NoError(t, err)
+		require.Len(t, report.Problems, 1)
+		assert.Equal(t, root, report.Problems[0].Cid)
+		assert.False(t, report.Problems[0].Missing)
+		assert.False(t, report.Problems[0].Corrupt)
+		assert.Contains(t, report.Problems[0].Err, "disk on fire")
+	})
+}
+
+// failingBlockstore fails to read one block.
+type failingBlockstore struct {
+	bstore.Blockstore
+	fail cid.Cid
+}
+
+func (bs *failingBlockstore) Get(c cid.Cid) (blocks.Block, error) {
+	if c.Equals(bs.fail) {
+		return nil, errors.New("disk on fire")
+	}
+	return bs.Blockstore.Get(c)
+}
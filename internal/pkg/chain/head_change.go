@@ -0,0 +1,181 @@
+package chain
+
+import (
+	"context"
+	"sync"
+
+	"github.com/filecoin-project/go-filecoin/internal/pkg/block"
+)
+
+// HeadChange describes a change of the store's head as the tipsets leaving and
+// joining the canonical chain. Consumers should undo the tipsets in Revert
+// before handling those in Apply.
+//
+// Both lists are ordered by decreasing height, as for
+// CollectTipsToCommonAncestor: Revert starts at the previous head and Apply
+// starts at the new head. Neither includes the common ancestor of the two
+// heads. The lists are shared between subscribers and must not be modified.
+type HeadChange struct {
+	Revert []block.TipSet
+	Apply  []block.TipSet
+}
+
+// SubHeadChanges returns a channel on which the store's current head is
+// delivered first, as a change applying only the head, followed by every
+// subsequent change of the head, in order. The channel is closed when ctx is done
+// or the store is stopped. Changes are queued for the subscriber without
+// limit, so that publishing never waits on a slow subscriber, and the channel
+// must be read promptly.
+func (store *Store) SubHeadChanges(ctx context.Context) <-chan HeadChange {
+	return store.subHeadChanges(ctx, 0)
+}
+
+// SubHeadChangesBounded is like SubHeadChanges, for subscribers which may
+// fall behind the head, such as remote clients. A subscriber with more than
+// `limit` changes queued is disconnected: the changes queued are delivered,
+// then the channel is closed.
+func (store *Store) SubHeadChangesBounded(ctx context.Context, limit int) <-chan HeadChange {
+	return store.subHeadChanges(ctx, limit)
+}
+
+// headChangeSub queues the head changes for one subscriber.
+type headChangeSub struct {
+	// limit is the maximum number of changes queued, or 0 for no limit.
+	limit int
+	// ready is signalled when changes are queued or the subscription closes.
+	ready chan struct{}
+
+	mu      sync.Mutex
+	pending []HeadChange
+	closed  bool
+}
+
+// push queues a change, or closes the subscription if the queue is full. It
+// never blocks.
+func (sub *headChangeSub) push(change HeadChange) bool {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	if sub.limit > 0 && len(sub.pending) >= sub.limit {
+		sub.closed = true
+	} else {
+		sub.pending = append(sub.pending, change)
+	}
+	sub.signal()
+	return !sub.closed
+}
+
+func (sub *headChangeSub) close() {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	sub.closed = true
+	sub.signal()
+}
+
+// take removes the queued changes, and returns whether the subscription is
+// closed.
+func (sub *headChangeSub) take() ([]HeadChange, bool) {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	pending := sub.pending
+	sub.pending = nil
+	return pending, sub.closed
+}
+
+func (sub *headChangeSub) signal() {
+	select {
+	case sub.ready <- struct{}{}:
+	default:
+	}
+}
+
+func (store *Store) subHeadChanges(ctx context.Context, limit int) <-chan HeadChange {
+	sub := &headChangeSub{limit: limit, ready: make(chan struct{}, 1)}
+	out := make(chan HeadChange)
+
+	// Holding the head lock, the current head is captured and the subscriber
+	// registered before any other change of head is published.
+	store.setHeadMu.Lock()
+	store.headChangeMu.Lock()
+	if store.headChangeSubs == nil {
+		// The store is stopped.
+		sub.closed = true
+	} else {
+		store.headChangeSubs[sub] = struct{}{}
+		store.mu.RLock()
+		head := store.head
+		store.mu.RUnlock()
+		if head.Defined() {
+			sub.pending = append(sub.pending, HeadChange{Apply: []block.TipSet{head}})
+		}
+	}
+	store.headChangeMu.Unlock()
+	store.setHeadMu.Unlock()
+
+	go func() {
+		defer close(out)
+		defer store.unsubHeadChanges(sub)
+		for {
+			changes, closed := sub.take()
+			for _, change := range changes {
+				select {
+				case out <- change:
+				case <-ctx.Done():
+					return
+				}
+			}
+			if closed {
+				return
+			}
+			select {
+			case <-sub.ready:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
+
+func (store *Store) unsubHeadChanges(sub *headChangeSub) {
+	store.headChangeMu.Lock()
+	defer store.headChangeMu.Unlock()
+	delete(store.headChangeSubs, sub)
+}
+
+// publishHeadChange queues a change for every subscriber, without waiting on
+// any of them.
+func (store *Store) publishHeadChange(change HeadChange) {
+	store.headChangeMu.Lock()
+	defer store.headChangeMu.Unlock()
+	for sub := range store.headChangeSubs {
+		if !sub.push(change) {
+			logStore.Warnf("disconnecting head change subscriber more than %d changes behind", sub.limit)
+			delete(store.headChangeSubs, sub)
+		}
+	}
+}
+
+// closeHeadChangeSubs closes all subscriptions and refuses new ones.
+func (store *Store) closeHeadChangeSubs() {
+	store.headChangeMu.Lock()
+	defer store.headChangeMu.Unlock()
+	for sub := range store.headChangeSubs {
+		sub.close()
+	}
+	store.headChangeSubs = nil
+}
+
+// headChange computes the change of head from `prev` to `next`.
+func (store *Store) headChange(ctx context.Context, prev, next block.TipSet) HeadChange {
+	if !prev.Defined() {
+		return HeadChange{Apply: []block.TipSet{next}}
+	}
+	revert, apply, err := CollectTipsToCommonAncestor(ctx, store, prev, next)
+	if err != nil {
+		// Without a known common ancestor subscribers can only be told to
+		// replace one head with the other.
+		logStore.Warnf("failed to collect tipsets between heads %s and %s: %s", prev.Key(), next.Key(), err)
+		return HeadChange{Revert: []block.TipSet{prev}, Apply: []block.TipSet{next}}
+	}
+	return HeadChange{Revert: revert, Apply: apply}
+}
@@ -0,0 +1,202 @@
+package chain
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/filecoin-project/specs-actors/actors/abi"
+	"github.com/ipfs/go-datastore"
+	"github.com/pkg/errors"
+
+	"github.com/filecoin-project/go-filecoin/internal/pkg/block"
+	"github.com/filecoin-project/go-filecoin/internal/pkg/encoding"
+	"github.com/filecoin-project/go-filecoin/internal/pkg/repo"
+)
+
+// HeightIndexPrefix is the datastore namespace under which the key of the
+// canonical tipset at each height is written.
+var HeightIndexPrefix = datastore.NewKey("/chain/height")
+
+// HeightIndexBaseKey is the datastore key under which the lowest trusted
+// height of the height index is written.
+var HeightIndexBaseKey = datastore.NewKey("/chain/heightBase")
+
+// heightIndex maps each epoch of the canonical chain to the key of the tipset
+// at that height. It is maintained by the store as the head changes and
+// persisted so that it need not be rebuilt by traversal on every start.
+// Entries are read from the datastore on demand.
+//
+// heightIndex is not safe for concurrent use, the store's lock protects it.
+type heightIndex struct {
+	ds repo.Datastore
+	// top is the height of the indexed head, or -1 if nothing is indexed.
+	top abi.ChainEpoch
+	// base is the lowest height that is indexed. It is above zero only when
+	// the ancestors of the head are not all known to the store.
+	base abi.ChainEpoch
+}
+
+func newHeightIndex(ds repo.Datastore) *heightIndex {
+	return &heightIndex{ds: ds, top: -1}
+}
+
+// load makes the persisted index, from its persisted base up to height `top`,
+// available.
+func (hi *heightIndex) load(top abi.ChainEpoch) error {
+	base := abi.ChainEpoch(0)
+	val, err := hi.ds.Get(HeightIndexBaseKey)
+	if err != nil && err != datastore.ErrNotFound {
+		return errors.Wrap(err, "failed to read height index base")
+	}
+	if err == nil {
+		if err := encoding.Decode(val, &base); err != nil {
+			return errors.Wrap(err, "failed to decode height index base")
+		}
+	}
+	hi.top = top
+	hi.base = base
+	return nil
+}
+
+// update makes `head` the tip of the indexed chain. It walks back from head
+// until reaching a tipset that is already indexed, so that the cost is
+// proportional to the depth of the reorg rather than the length of the chain.
+func (hi *heightIndex) update(ctx context.Context, tipsets TipSetProvider, head block.TipSet) error {
+	headHeight, err := head.Height()
+	if err != nil {
+		return err
+	}
+
+	var added []block.TipSet
+	commonHeight := abi.ChainEpoch(-1)
+	base := abi.ChainEpoch(0)
+	for it := IterAncestors(ctx, tipsets, head); !it.Complete(); err = it.Next() {
+		if err != nil {
+			break
+		}
+		h, err := it.Value().Height()
+		if err != nil {
+			return err
+		}
+		indexed, err := hi.has(h, it.Value().Key())
+		if err != nil {
+			return err
+		}
+		if indexed {
+			commonHeight = h
+			break
+		}
+		added = append(added, it.Value())
+	}
+	if err != nil {
+		// The chain below the last tipset walked is unknown, so only the
+		// walked tipsets can be indexed. Entries below them are deleted
+		// and so are not trusted when the index is next loaded.
+		logStore.Debugf("height index truncated at %s: %s", added[len(added)-1].Key(), err)
+		base = added[len(added)-1].At(0).Height
+	} else if commonHeight >= 0 {
+		base = hi.base
+	}
+
+	keys := make(map[abi.ChainEpoch]block.TipSetKey, len(added))
+	for _, ts := range added {
+		keys[ts.At(0).Height] = ts.Key()
+	}
+
+	// A raised base is written before the entries and a lowered one after
+	// them, so that an interrupted update never leaves entries trusted that
+	// it has not written.
+	if base > hi.base {
+		if err := hi.writeBase(base); err != nil {
+			return err
+		}
+	}
+
+	// Write from the highest height down so that an interrupted update
+	// leaves a consistent prefix of the index for the next update to repair.
+	// Entries below the base are not trusted, so are left alone.
+	top := hi.top
+	if headHeight > top {
+		top = headHeight
+	}
+	for h := top; h > commonHeight && h >= base; h-- {
+		dsKey := heightIndexKey(h)
+		if key, ok := keys[h]; ok {
+			val, err := encoding.Encode(key)
+			if err != nil {
+				return err
+			}
+			if err := hi.ds.Put(dsKey, val); err != nil {
+				return errors.Wrap(err, "failed to write height index")
+			}
+		} else if err := hi.ds.Delete(dsKey); err != nil && err != datastore.ErrNotFound {
+			return errors.Wrap(err, "failed to delete height index entry")
+		}
+	}
+	if base < hi.base {
+		if err := hi.writeBase(base); err != nil {
+			return err
+		}
+	}
+	hi.top = headHeight
+	hi.base = base
+	return nil
+}
+
+// writeBase persists `base` as the lowest trusted height of the index.
+func (hi *heightIndex) writeBase(base abi.ChainEpoch) error {
+	val, err := encoding.Encode(base)
+	if err != nil {
+		return err
+	}
+	return errors.Wrap(hi.ds.Put(HeightIndexBaseKey, val), "failed to write height index base")
+}
+
+// has returns true if `key` is indexed at height `h`.
+func (hi *heightIndex) has(h abi.ChainEpoch, key block.TipSetKey) (bool, error) {
+	if h < hi.base || h > hi.top {
+		return false, nil
+	}
+	indexed, err := hi.read(h)
+	if err != nil {
+		return false, err
+	}
+	return indexed.Equals(key), nil
+}
+
+// get returns the key of the highest indexed tipset with height <= `epoch`.
+func (hi *heightIndex) get(epoch abi.ChainEpoch) (block.TipSetKey, bool, error) {
+	if epoch > hi.top {
+		epoch = hi.top
+	}
+	for h := epoch; h >= hi.base; h-- {
+		key, err := hi.read(h)
+		if err != nil {
+			return block.TipSetKey{}, false, err
+		}
+		if !key.Empty() {
+			return key, true, nil
+		}
+	}
+	return block.TipSetKey{}, false, nil
+}
+
+// read returns the key indexed at height `h`, which is empty for null rounds.
+func (hi *heightIndex) read(h abi.ChainEpoch) (block.TipSetKey, error) {
+	val, err := hi.ds.Get(heightIndexKey(h))
+	if err == datastore.ErrNotFound {
+		return block.TipSetKey{}, nil
+	}
+	if err != nil {
+		return block.TipSetKey{}, errors.Wrap(err, "failed to read height index")
+	}
+	var key block.TipSetKey
+	if err := encoding.Decode(val, &key); err != nil {
+		return block.TipSetKey{}, errors.Wrapf(err, "failed to decode height index entry at %d", h)
+	}
+	return key, nil
+}
+
+func heightIndexKey(h abi.ChainEpoch) datastore.Key {
+	return HeightIndexPrefix.ChildString(strconv.FormatInt(int64(h), 10))
+}
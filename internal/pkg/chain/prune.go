@@ -0,0 +1,268 @@
+package chain
+
+import (
+	"context"
+	"sync"
+
+	"github.com/filecoin-project/specs-actors/actors/abi"
+	"github.com/ipfs/go-cid"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	cbor "github.com/ipfs/go-ipld-cbor"
+	format "github.com/ipfs/go-ipld-format"
+	logging "github.com/ipfs/go-log"
+	"github.com/ipfs/go-merkledag"
+	"github.com/pkg/errors"
+
+	"github.com/filecoin-project/go-filecoin/internal/pkg/block"
+)
+
+var logPrune = logging.Logger("chain.prune")
+
+// statePruneBatch is the number of epochs the retention window must advance
+// before the pruner runs again. Every pass walks the retained state trees, so
+// pruning on every new head would be wasteful.
+const statePruneBatch = abi.ChainEpoch(20)
+
+// StatePruner removes the state trees and message receipts of tipsets that
+// are more than a fixed number of epochs behind the head of the chain store.
+// Block headers and messages are never pruned, nor is the genesis state.
+//
+// Pruning is a mark and sweep over the blockstore: blocks reachable from the
+// retained state roots are marked, then blocks reachable only from the
+// expired state roots are deleted. Blocks in the shared blockstore that are
+// not reachable from any expired root (e.g. piece data) are never touched.
+//
+// The state of every indexed tipset within the retention window is kept,
+// including forks which branched off below it, so that reorgs within the
+// window find their state. Expired state is only reclaimed for tipsets on the
+// canonical chain and their direct siblings, so the state of longer abandoned
+// forks is not reclaimed.
+type StatePruner struct {
+	store     *Store
+	bs        blockstore.Blockstore
+	retention abi.ChainEpoch
+
+	// Serializes prune passes.
+	mu sync.Mutex
+}
+
+// NewStatePruner returns a pruner that keeps the state of the most recent
+// `retention` epochs of the chain in `store`.
+func NewStatePruner(store *Store, bs blockstore.Blockstore, retention abi.ChainEpoch) *StatePruner {
+	return &StatePruner{
+		store:     store,
+		bs:        bs,
+		retention: retention,
+	}
+}
+
+// Start prunes the store in the background each time the head advances far
+// enough. It returns once ctx is done or the store stops publishing heads.
+func (p *StatePruner) Start(ctx context.Context) {
+	headCh := p.store.HeadEvents().Sub(NewHeadTopic)
+	pending := make(chan block.TipSet, 1)
+
+	go func() {
+		for head := range pending {
+			if err := p.handleNewHead(ctx, head); err != nil {
+				logPrune.Errorf("failed to prune state at head %s: %s", head.Key(), err)
+			}
+		}
+	}()
+
+	go func() {
+		defer close(pending)
+		defer p.store.HeadEvents().Unsub(headCh)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case ev, ok := <-headCh:
+				if !ok {
+					return
+				}
+				head, ok := ev.(block.TipSet)
+				if !ok {
+					logPrune.Errorf("non-tipset published on head channel")
+					continue
+				}
+				// Never block the head publisher. If a pass is already
+				// queued this head is dropped; a later one will catch up.
+				select {
+				case pending <- head:
+				default:
+				}
+			}
+		}
+	}()
+}
+
+func (p *StatePruner) handleNewHead(ctx context.Context, head block.TipSet) error {
+	h, err := head.Height()
+	if err != nil {
+		return err
+	}
+	if h-p.retention-p.store.PrunedHeight() < statePruneBatch {
+		return nil
+	}
+	return p.Prune(ctx, head)
+}
+
+// Prune removes the state and receipts of all tipsets more than `retention`
+// epochs below `head`, except genesis.
+func (p *StatePruner) Prune(ctx context.Context, head block.TipSet) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	h, err := head.Height()
+	if err != nil {
+		return err
+	}
+	floor := h - p.retention
+	prunedHeight := p.store.PrunedHeight()
+	if floor <= prunedHeight || floor <= 0 {
+		return nil
+	}
+	logPrune.Infof("pruning state of tipsets in heights [%d, %d)", prunedHeight, floor)
+
+	live, expired, err := p.collectRoots(ctx, head, prunedHeight, floor)
+	if err != nil {
+		return err
+	}
+
+	// Mark everything reachable from retained state.
+	keep := cid.NewSet()
+	for _, root := range live {
+		if err := merkledag.Walk(ctx, p.getLinks, root, keep.Visit); err != nil {
+			return errors.Wrapf(err, "failed to walk retained root %s", root)
+		}
+	}
+
+	// Readers must see the pruned height before any state disappears.
+	if err := p.store.SetPrunedHeight(floor); err != nil {
+		return err
+	}
+
+	// Collect everything reachable only from expired state.
+	seen := cid.NewSet()
+	var garbage []cid.Cid
+	visit := func(c cid.Cid) bool {
+		if keep.Has(c) || !seen.Visit(c) {
+			return false
+		}
+		garbage = append(garbage, c)
+		return true
+	}
+	for _, root := range expired {
+		if err := merkledag.Walk(ctx, p.getLinks, root, visit); err != nil {
+			return errors.Wrapf(err, "failed to walk expired root %s", root)
+		}
+	}
+
+	// State computed while this pass was running may have re-linked blocks
+	// that looked like garbage, so mark from the current head once more.
+	// Only newly written blocks are walked since the keep set is shared.
+	current, err := p.store.GetTipSet(p.store.GetHead())
+	if err != nil {
+		return err
+	}
+	newLive, _, err := p.collectRoots(ctx, current, floor, floor)
+	if err != nil {
+		return err
+	}
+	for _, root := range newLive {
+		if err := merkledag.Walk(ctx, p.getLinks, root, keep.Visit); err != nil {
+			return errors.Wrapf(err, "failed to walk retained root %s", root)
+		}
+	}
+
+	deleted := 0
+	for _, c := range garbage {
+		if keep.Has(c) {
+			continue
+		}
+		has, err := p.bs.Has(c)
+		if err != nil {
+			return err
+		}
+		if !has {
+			continue
+		}
+		if err := p.bs.DeleteBlock(c); err != nil {
+			return errors.Wrapf(err, "failed to delete block %s", c)
+		}
+		deleted++
+	}
+	logPrune.Infof("pruned %d blocks of state below height %d", deleted, floor)
+	return nil
+}
+
+// collectRoots returns the state and receipt roots of all indexed tipsets at
+// or above `floor` (live), and walks the chain back from `head` to `from` to
+// collect those of the tipsets below it (expired). The genesis roots are
+// always live.
+func (p *StatePruner) collectRoots(ctx context.Context, head block.TipSet, from, floor abi.ChainEpoch) (live, expired []cid.Cid, err error) {
+	genesis, err := p.store.tipIndex.Get(block.NewTipSetKey(p.store.GenesisCid()))
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to load genesis metadata")
+	}
+	live = append(live, genesis.TipSetStateRoot, genesis.TipSetReceipts)
+
+	retained, err := p.store.tipIndex.GetAtOrAbove(floor)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to load retained tipsets")
+	}
+	for _, tsm := range retained {
+		live = append(live, tsm.TipSetStateRoot, tsm.TipSetReceipts)
+	}
+
+	for it := IterAncestors(ctx, p.store, head); !it.Complete(); err = it.Next() {
+		if err != nil {
+			return nil, nil, err
+		}
+		ts := it.Value()
+		h, err := ts.Height()
+		if err != nil {
+			return nil, nil, err
+		}
+		if h == 0 || h < from {
+			break
+		}
+		if h >= floor {
+			continue
+		}
+		parents, err := ts.Parents()
+		if err != nil {
+			return nil, nil, err
+		}
+		// Siblings include the tipset itself.
+		siblings, err := p.store.GetTipSetAndStatesByParentsAndHeight(parents, h)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, tsm := range siblings {
+			expired = append(expired, tsm.TipSetStateRoot, tsm.TipSetReceipts)
+		}
+	}
+	return live, expired, nil
+}
+
+// getLinks returns the links of a dag-cbor block in the blockstore. Blocks of
+// other codecs and blocks missing from the store are treated as leaves.
+func (p *StatePruner) getLinks(ctx context.Context, c cid.Cid) ([]*format.Link, error) {
+	if c.Prefix().Codec != cid.DagCBOR {
+		return nil, nil
+	}
+	blk, err := p.bs.Get(c)
+	if err == blockstore.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	nd, err := cbor.DecodeBlock(blk)
+	if err != nil {
+		return nil, err
+	}
+	return nd.Links(), nil
+}
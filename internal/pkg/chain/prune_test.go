@@ -0,0 +1,200 @@
+package chain_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/specs-actors/actors/abi"
+	"github.com/ipfs/go-cid"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/internal/pkg/block"
+	"github.com/filecoin-project/go-filecoin/internal/pkg/cborutil"
+	"github.com/filecoin-project/go-filecoin/internal/pkg/chain"
+	"github.com/filecoin-project/go-filecoin/internal/pkg/repo"
+	tf "github.com/filecoin-project/go-filecoin/internal/pkg/testhelpers/testflags"
+	"github.com/filecoin-project/go-filecoin/internal/pkg/types"
+	"github.com/filecoin-project/go-filecoin/internal/pkg/vm/actor"
+	vmaddr "github.com/filecoin-project/go-filecoin/internal/pkg/vm/address"
+	"github.com/filecoin-project/go-filecoin/internal/pkg/vm/state"
+)
+
+func TestStatePrunerPrune(t *testing.T) {
+	tf.UnitTest(t)
+
+	ctx := context.Background()
+	ds := repo.NewInMemoryRepo().ChainDatastore()
+	bs := bstore.NewBlockstore(ds)
+	cst := cborutil.NewIpldStore(bs)
+
+	// Each state adds an actor to the previous one.
+	addrGetter := vmaddr.NewForTestGetter()
+	st := state.NewState(cst)
+	var roots []cid.Cid
+	for i := 0; i < 3; i++ {
+		act := actor.NewActor(types.CidFromString(t, "somecid"), abi.NewTokenAmount(int64(i)), cid.Undef)
+		require.NoError(t, st.SetActor(ctx, addrGetter(), act))
+		root, err := st.Commit(ctx)
+		require.NoError(t, err)
+		roots = append(roots, root)
+	}
+
+	builder := chain.NewBuilder(t, address.Undef)
+	gen := builder.NewGenesis()
+	store := chain.NewStore(ds, cst, chain.NewStatusReporter(), gen.At(0).Cid())
+	require.NoError(t, store.PutTipSetMetadata(ctx, &chain.TipSetMetadata{
+		TipSet:          gen,
+		TipSetStateRoot: gen.At(0).StateRoot.Cid,
+		TipSetReceipts:  types.EmptyReceiptsCID,
+	}))
+
+	var tipsets []block.TipSet
+	parent := gen
+	for _, root := range roots {
+		ts := builder.AppendOn(parent, 1)
+		require.NoError(t, store.PutTipSetMetadata(ctx, &chain.TipSetMetadata{
+			TipSet:          ts,
+			TipSetStateRoot: root,
+			TipSetReceipts:  types.EmptyReceiptsCID,
+		}))
+		tipsets = append(tipsets, ts)
+		parent = ts
+	}
+	head := tipsets[len(tipsets)-1]
+	require.NoError(t, store.SetHead(ctx, head))
+
+	// Keep the state of the two most recent epochs.
+	pruner := chain.NewStatePruner(store, bs, 1)
+	require.NoError(t, pruner.Prune(ctx, head))
+	assert.Equal(t, abi.ChainEpoch(2), store.PrunedHeight())
+
+	has, err := bs.Has(roots[0])
+	require.NoError(t, err)
+	assert.False(t, has)
+	for _, root := range roots[1:] {
+		has, err := bs.Has(root)
+		require.NoError(t, err)
+		assert.True(t, has)
+	}
+
+	_, err = store.GetTipSetState(ctx, tipsets[0].Key())
+	assert.Equal(t, chain.ErrStatePruned, errors.Cause(err))
+
+	for _, ts := range tipsets[1:] {
+		st, err := store.GetTipSetState(ctx, ts.Key())
+		require.NoError(t, err)
+		for res := range st.GetAllActors(ctx) {
+			assert.NoError(t, res.Error)
+		}
+	}
+
+	_, err = store.GetTipSetStateRoot(tipsets[0].Key())
+	assert.Equal(t, chain.ErrStatePruned, errors.Cause(err))
+	_, err = store.GetTipSetReceiptsRoot(tipsets[0].Key())
+	assert.Equal(t, chain.ErrStatePruned, errors.Cause(err))
+
+	// Pruning again at the same head is a no-op.
+	require.NoError(t, pruner.Prune(ctx, head))
+	assert.Equal(t, abi.ChainEpoch(2), store.PrunedHeight())
+}
+
+func TestStatePrunerKeepsForksWithinRetention(t *testing.T) {
+	tf.UnitTest(t)
+
+	ctx := context.Background()
+	ds := repo.NewInMemoryRepo().ChainDatastore()
+	bs := bstore.NewBlockstore(ds)
+	cst := cborutil.NewIpldStore(bs)
+
+	addrGetter := vmaddr.NewForTestGetter()
+	st := state.NewState(cst)
+	var roots []cid.Cid
+	for i := 0; i < 5; i++ {
+		act := actor.NewActor(types.CidFromString(t, "somecid"), abi.NewTokenAmount(int64(i)), cid.Undef)
+		require.NoError(t, st.SetActor(ctx, addrGetter(), act))
+		root, err := st.Commit(ctx)
+		require.NoError(t, err)
+		roots = append(roots, root)
+	}
+
+	builder := chain.NewBuilder(t, address.Undef)
+	gen := builder.NewGenesis()
+	store := chain.NewStore(ds, cst, chain.NewStatusReporter(), gen.At(0).Cid())
+	put := func(ts block.TipSet, root cid.Cid) {
+		require.NoError(t, store.PutTipSetMetadata(ctx, &chain.TipSetMetadata{
+			TipSet:          ts,
+			TipSetStateRoot: root,
+			TipSetReceipts:  types.EmptyReceiptsCID,
+		}))
+	}
+	put(gen, gen.At(0).StateRoot.Cid)
+
+	// The canonical chain is three tipsets long.
+	var canonical []block.TipSet
+	parent := gen
+	for _, root := range roots[:3] {
+		ts := builder.AppendOn(parent, 1)
+		put(ts, root)
+		canonical = append(canonical, ts)
+		parent = ts
+	}
+	head := canonical[len(canonical)-1]
+	require.NoError(t, store.SetHead(ctx, head))
+
+	// A fork branches off at genesis, below the retention floor, and reaches into the
+	// retention window.
+	forkBase := builder.AppendOn(gen, 1)
+	put(forkBase, roots[3])
+	forkTip := builder.AppendOn(forkBase, 1)
+	put(forkTip, roots[4])
+
+	// Keep the state of the two most recent epochs.
+	pruner := chain.NewStatePruner(store, bs, 1)
+	require.NoError(t, pruner.Prune(ctx, head))
+	assert.Equal(t, abi.ChainEpoch(2), store.PrunedHeight())
+
+	has, err := bs.Has(roots[4])
+	require.NoError(t, err)
+	assert.True(t, has)
+	forkState, err := store.GetTipSetState(ctx, forkTip.Key())
+	require.NoError(t, err)
+	for res := range forkState.GetAllActors(ctx) {
+		assert.NoError(t, res.Error)
+	}
+
+	_, err = store.GetTipSetState(ctx, forkBase.Key())
+	assert.Equal(t, chain.ErrStatePruned, errors.Cause(err))
+}
+
+func TestPrunedHeightSurvivesLoad(t *testing.T) {
+	tf.UnitTest(t)
+
+	ctx := context.Background()
+	builder := chain.NewBuilder(t, address.Undef)
+	genTS := builder.NewGenesis()
+	ds := repo.NewInMemoryRepo().Datastore()
+	cst := cborutil.NewIpldStore(bstore.NewBlockstore(ds))
+
+	link1 := builder.AppendOn(genTS, 1)
+	link2 := builder.AppendOn(link1, 1)
+	requirePutBlocksToCborStore(t, cst, genTS.ToSlice()...)
+	requirePutBlocksToCborStore(t, cst, link1.ToSlice()...)
+	requirePutBlocksToCborStore(t, cst, link2.ToSlice()...)
+
+	chainStore := chain.NewStore(ds, cst, chain.NewStatusReporter(), genTS.At(0).Cid())
+	requirePutTestChain(ctx, t, chainStore, link2.Key(), builder, 3)
+	assertSetHead(t, chainStore, link2)
+	require.NoError(t, chainStore.SetPrunedHeight(2))
+	chainStore.Stop()
+
+	rebootChain := chain.NewStore(ds, cst, chain.NewStatusReporter(), genTS.At(0).Cid())
+	require.NoError(t, rebootChain.Load(ctx))
+	assert.Equal(t, abi.ChainEpoch(2), rebootChain.PrunedHeight())
+
+	_, err := rebootChain.GetTipSetState(ctx, link1.Key())
+	assert.Equal(t, chain.ErrStatePruned, errors.Cause(err))
+}
@@ -19,8 +19,8 @@ func NewRandomnessSamplerAtHead(reader TipSetProvider, genesisTicket block.Ticke
 
 // A sampler draws randomness seeds from the chain.
 //
-// This implementation doesn't do any caching: it traverses the chain each time. A cache that could be directly
-// indexed by epoch could speed up repeated samples from the same chain.
+// Samples from the chain ending at the store's head are looked up in the store's height index when the reader
+// provides one (see EpochIndex). Samples from other chains traverse the chain each time.
 type Sampler struct {
 	reader        TipSetProvider
 	genesisTicket block.Ticket
@@ -8,7 +8,6 @@ import (
 	"github.com/cskr/pubsub"
 	"github.com/filecoin-project/go-filecoin/internal/pkg/block"
 	"github.com/filecoin-project/go-filecoin/internal/pkg/cborutil"
-	e "github.com/filecoin-project/go-filecoin/internal/pkg/enccid"
 	"github.com/filecoin-project/go-filecoin/internal/pkg/encoding"
 	"github.com/filecoin-project/specs-actors/actors/abi"
 	"github.com/ipfs/go-cid"
@@ -34,17 +33,24 @@ var logStore = logging.Logger("chain.store")
 // HeadKey is the key at which the head tipset cid's are written in the datastore.
 var HeadKey = datastore.NewKey("/chain/heaviestTipSet")
 
+// TipIndexPersistedKey is the key written once the tipset index of the chain
+// has been fully persisted to the datastore.
+var TipIndexPersistedKey = datastore.NewKey("/chain/tipIndexPersisted")
+
+// PrunedHeightKey is the key at which the height below which tipset state has
+// been pruned is written in the datastore.
+var PrunedHeightKey = datastore.NewKey("/chain/prunedHeight")
+
+// ErrStatePruned is returned when the state of a tipset has been pruned from
+// the store.
+var ErrStatePruned = errors.New("tipset state has been pruned")
+
 type ipldSource struct {
 	// cst is a store allowing access
 	// (un)marshalling and interop with go-ipld-hamt.
 	cborStore cbor.IpldStore
 }
 
-type tsState struct {
-	StateRoot e.Cid
-	Reciepts  e.Cid
-}
-
 func newSource(cst cbor.IpldStore) *ipldSource {
 	return &ipldSource{
 		cborStore: cst,
@@ -78,8 +84,17 @@ type Store struct {
 	genesis cid.Cid
 	// head is the tipset at the head of the best known chain.
 	head block.TipSet
-	// Protects head and genesisCid.
+	// prunedHeight is the height below which the state trees and receipts
+	// of tipsets (other than genesis) are no longer available.
+	prunedHeight abi.ChainEpoch
+	// checkpoint is the tipset below which the chain may not be reorganized,
+	// if defined.
+	checkpoint block.TipSet
+	// Protects head, prunedHeight, checkpoint and genesisCid.
 	mu sync.RWMutex
+	// Serializes calls to SetHead so that head changes are published in the
+	// order they are made.
+	setHeadMu sync.Mutex
 
 	// headEvents is a pubsub channel that publishes an event every time the head changes.
 	// We operate under the assumption that tipsets published to this channel
@@ -91,58 +106,128 @@ type Store struct {
 	// https://github.com/filecoin-project/go-filecoin/issues/2309
 	headEvents *pubsub.PubSub
 
+	// headChangeSubs are the subscribers to head changes, which are queued
+	// for each subscriber rather than published through headEvents so that
+	// SetHead never waits on a subscriber. Nil once the store is stopped.
+	headChangeSubs map[*headChangeSub]struct{}
+	headChangeMu   sync.Mutex
+
 	// Tracks tipsets by height/parentset for use by expected consensus.
 	tipIndex *TipIndex
 
+	// Maps epochs to the tipsets of the chain ending at head. Protected by mu.
+	heightIndex *heightIndex
+
 	// Reporter is used by the store to update the current status of the chain.
 	reporter Reporter
 }
 
 // NewStore constructs a new default store.
 func NewStore(ds repo.Datastore, cst cbor.IpldStore, sr Reporter, genesisCid cid.Cid) *Store {
+	source := newSource(cst)
 	return &Store{
-		stateAndBlockSource: newSource(cst),
+		stateAndBlockSource: source,
 		ds:                  ds,
 		headEvents:          pubsub.New(12),
-		tipIndex:            NewTipIndex(),
+		headChangeSubs:      make(map[*headChangeSub]struct{}),
+		tipIndex:            NewTipIndex(ds, source),
+		heightIndex:         newHeightIndex(ds),
 		genesis:             genesisCid,
 		reporter:            sr,
 	}
 }
 
-// Load rebuilds the Store's caches by traversing backwards from the
-// most recent best head as stored in its datastore.  Because Load uses a
-// content addressed datastore it guarantees that parent blocks are correctly
-// resolved from the datastore.  Furthermore Load ensures that all tipsets
-// references correctly have the same parent height, weight and parent set.
-// However, Load DOES NOT validate state transitions, it assumes that the
-// tipset were only Put to the Store after checking for valid transitions.
+// Load restores the Store's head from its datastore. The tipset index and
+// height index are persisted, so Load reads only the head tipset and its
+// metadata and does not traverse the chain. Other tipsets are loaded from the
+// datastore as they are needed.
+//
+// The first time Load runs on a datastore written before the tipset index was
+// persisted it instead traverses backwards from the head, rebuilding the
+// index. This traversal relies on the content addressed datastore to resolve
+// parent blocks and errors if the head does not link back to the expected
+// genesis block, or the Store's datastore does not store a link in the chain.
+// Load DOES NOT validate state transitions, it assumes that the tipset were
+// only Put to the Store after checking for valid transitions.
 //
 // Furthermore Load trusts that the Store's backing datastore correctly
 // preserves the cids of the heaviest tipset under the "HeadKey" datastore key.
 // If the HeadKey cids are tampered with and invalid blocks added to the datastore
-// then Load could be tricked into loading an invalid chain. Load will error if the
-// head does not link back to the expected genesis block, or the Store's
-// datastore does not store a link in the chain.  In case of error the caller
-// should not consider the chain useable and propagate the error.
+// then Load could be tricked into loading an invalid chain. In case of error
+// the caller should not consider the chain useable and propagate the error.
 func (store *Store) Load(ctx context.Context) (err error) {
 	ctx, span := trace.StartSpan(ctx, "Store.Load")
 	defer tracing.AddErrorEndSpan(ctx, span, &err)
 
-	// Clear the tipset index.
-	store.tipIndex = NewTipIndex()
+	// Clear the in-memory tipset cache.
+	store.tipIndex = NewTipIndex(store.ds, store.stateAndBlockSource)
 
 	headTsKey, err := store.loadHead()
 	if err != nil {
 		return err
 	}
 
+	prunedHeight, err := store.loadPrunedHeight()
+	if err != nil {
+		return err
+	}
+	store.mu.Lock()
+	store.prunedHeight = prunedHeight
+	store.mu.Unlock()
+
 	headTs, err := LoadTipSetBlocks(ctx, store.stateAndBlockSource, headTsKey)
 	if err != nil {
 		return errors.Wrap(err, "error loading head tipset")
 	}
 	startHeight := headTs.At(0).Height
-	logStore.Infof("start loading chain at tipset: %s, height: %d", headTsKey.String(), startHeight)
+
+	persisted, err := store.ds.Has(TipIndexPersistedKey)
+	if err != nil {
+		return errors.Wrap(err, "failed to read TipIndexPersistedKey")
+	}
+	if !persisted {
+		if err := store.rebuildTipIndex(ctx, headTs); err != nil {
+			return err
+		}
+	}
+
+	if !store.tipIndex.Has(headTsKey) {
+		return errors.Errorf("missing metadata for head tipset %s", headTsKey)
+	}
+	if !store.tipIndex.Has(block.NewTipSetKey(store.genesis)) {
+		return errors.Errorf("missing metadata for genesis block %s", store.genesis)
+	}
+	logStore.Infof("loaded chain at tipset: %s, height: %d", headTsKey.String(), startHeight)
+
+	// Repair any entries of the persisted height index that were not
+	// written before the node last stopped.
+	store.mu.Lock()
+	err = store.heightIndex.load(startHeight)
+	if err == nil {
+		err = store.heightIndex.update(ctx, store, headTs)
+	}
+	store.mu.Unlock()
+	if err != nil {
+		return errors.Wrap(err, "failed to load height index")
+	}
+
+	checkpoint, err := store.loadCheckpoint()
+	if err != nil {
+		return err
+	}
+	store.mu.Lock()
+	store.checkpoint = checkpoint
+	store.mu.Unlock()
+
+	// Set actual head.
+	return store.SetHead(ctx, headTs)
+}
+
+// rebuildTipIndex persists the tipset index of the chain ending at `headTs`
+// from the state roots and receipts written by earlier versions of the store.
+func (store *Store) rebuildTipIndex(ctx context.Context, headTs block.TipSet) (err error) {
+	startHeight := headTs.At(0).Height
+	logStore.Infof("start rebuilding tipset index at tipset: %s, height: %d", headTs.String(), startHeight)
 	// Ensure we only produce 10 log messages regardless of the chain height.
 	logStatusEvery := startHeight / 10
 
@@ -162,16 +247,13 @@ func (store *Store) Load(ctx context.Context) (err error) {
 		if logStatusEvery != 0 && (height%logStatusEvery) == 0 {
 			logStore.Infof("load tipset: %s, height: %v", iterator.Value().String(), height)
 		}
-		stateRoot, receipts, err := store.loadStateRootAndReceipts(iterator.Value())
+		// The state and receipt roots are in the datastore, only the
+		// lookup by parents needs writing.
+		tsm, err := store.tipIndex.Get(iterator.Value().Key())
 		if err != nil {
-			return err
+			return errors.Wrapf(err, "failed to read metadata of tipset %s", iterator.Value().String())
 		}
-		err = store.PutTipSetMetadata(ctx, &TipSetMetadata{
-			TipSet:          iterator.Value(),
-			TipSetStateRoot: stateRoot,
-			TipSetReceipts:  receipts,
-		})
-		if err != nil {
+		if err := store.tipIndex.Put(tsm); err != nil {
 			return err
 		}
 
@@ -187,9 +269,8 @@ func (store *Store) Load(ctx context.Context) (err error) {
 		return errors.Errorf("expected genesis cid: %s, loaded genesis cid: %s", store.genesis, loadCid)
 	}
 
-	logStore.Infof("finished loading %d tipsets from %s", startHeight, headTs.String())
-	// Set actual head.
-	return store.SetHead(ctx, headTs)
+	logStore.Infof("finished rebuilding tipset index of %d tipsets from %s", startHeight, headTs.String())
+	return store.ds.Put(TipIndexPersistedKey, []byte{})
 }
 
 // loadHead loads the latest known head from disk.
@@ -209,39 +290,29 @@ func (store *Store) loadHead() (block.TipSetKey, error) {
 	return cids, nil
 }
 
-func (store *Store) loadStateRootAndReceipts(ts block.TipSet) (cid.Cid, cid.Cid, error) {
-	h, err := ts.Height()
-	if err != nil {
-		return cid.Undef, cid.Undef, err
+// loadPrunedHeight loads the pruned height from disk, returning zero if the
+// chain has never been pruned.
+func (store *Store) loadPrunedHeight() (abi.ChainEpoch, error) {
+	bb, err := store.ds.Get(PrunedHeightKey)
+	if err == datastore.ErrNotFound {
+		return 0, nil
 	}
-	key := datastore.NewKey(makeKey(ts.String(), h))
-	bb, err := store.ds.Get(key)
 	if err != nil {
-		return cid.Undef, cid.Undef, errors.Wrapf(err, "failed to read tipset key %s", ts.String())
+		return 0, errors.Wrap(err, "failed to read PrunedHeightKey")
 	}
 
-	var metadata tsState
-	err = encoding.Decode(bb, &metadata)
+	var h abi.ChainEpoch
+	err = encoding.Decode(bb, &h)
 	if err != nil {
-		return cid.Undef, cid.Undef, errors.Wrapf(err, "failed to decode tip set metadata %s", ts.String())
+		return 0, errors.Wrap(err, "failed to decode pruned height")
 	}
-
-	return metadata.StateRoot.Cid, metadata.Reciepts.Cid, nil
+	return h, nil
 }
 
-// PutTipSetMetadata persists the blocks of a tipset and the tipset index.
+// PutTipSetMetadata persists the state and receipt roots of a tipset to the
+// tipset index.
 func (store *Store) PutTipSetMetadata(ctx context.Context, tsm *TipSetMetadata) error {
-	// Update tipindex.
-	err := store.tipIndex.Put(tsm)
-	if err != nil {
-		return err
-	}
-	// Persist the state mapping.
-	if err = store.writeTipSetMetadata(tsm); err != nil {
-		return err
-	}
-
-	return nil
+	return store.tipIndex.Put(tsm)
 }
 
 // GetTipSet returns the tipset identified by `key`.
@@ -250,12 +321,30 @@ func (store *Store) GetTipSet(key block.TipSetKey) (block.TipSet, error) {
 }
 
 // GetTipSetState returns the aggregate state of the tipset identified by `key`.
+// ErrStatePruned is returned if the state has been pruned from the store.
 func (store *Store) GetTipSetState(ctx context.Context, key block.TipSetKey) (state.Tree, error) {
-	stateCid, err := store.tipIndex.GetTipSetStateRoot(key)
+	tsm, err := store.getUnprunedMetadata(key)
 	if err != nil {
 		return nil, err
 	}
-	return state.LoadState(ctx, store.stateAndBlockSource.cborStore, stateCid)
+	return state.LoadState(ctx, store.stateAndBlockSource.cborStore, tsm.TipSetStateRoot)
+}
+
+// getUnprunedMetadata returns the metadata of the tipset identified by `key`,
+// or ErrStatePruned if its state and receipts have been pruned.
+func (store *Store) getUnprunedMetadata(key block.TipSetKey) (*TipSetMetadata, error) {
+	tsm, err := store.tipIndex.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	h, err := tsm.TipSet.Height()
+	if err != nil {
+		return nil, err
+	}
+	if prunedHeight := store.PrunedHeight(); h > 0 && h < prunedHeight {
+		return nil, errors.Wrapf(ErrStatePruned, "state of tipset %s at height %d is below pruned height %d", key, h, prunedHeight)
+	}
+	return tsm, nil
 }
 
 // GetGenesisState returns the state tree at genesis to retrieve initialization parameters.
@@ -276,13 +365,23 @@ func (store *Store) GetGenesisBlock(ctx context.Context) (*block.Block, error) {
 }
 
 // GetTipSetStateRoot returns the aggregate state root CID of the tipset identified by `key`.
+// ErrStatePruned is returned if the state has been pruned from the store.
 func (store *Store) GetTipSetStateRoot(key block.TipSetKey) (cid.Cid, error) {
-	return store.tipIndex.GetTipSetStateRoot(key)
+	tsm, err := store.getUnprunedMetadata(key)
+	if err != nil {
+		return cid.Undef, err
+	}
+	return tsm.TipSetStateRoot, nil
 }
 
 // GetTipSetReceiptsRoot returns the root CID of the message receipts for the tipset identified by `key`.
+// ErrStatePruned is returned if the receipts have been pruned from the store.
 func (store *Store) GetTipSetReceiptsRoot(key block.TipSetKey) (cid.Cid, error) {
-	return store.tipIndex.GetTipSetReceiptsRoot(key)
+	tsm, err := store.getUnprunedMetadata(key)
+	if err != nil {
+		return cid.Undef, err
+	}
+	return tsm.TipSetReceipts, nil
 }
 
 // HasTipSetAndState returns true iff the default store's tipindex is indexing
@@ -319,7 +418,10 @@ func (store *Store) SetHead(ctx context.Context, ts block.TipSet) error {
 		logStore.Error(debug.Stack())
 	}
 
-	noop, err := store.setHeadPersistent(ctx, ts)
+	store.setHeadMu.Lock()
+	defer store.setHeadMu.Unlock()
+
+	prev, noop, err := store.setHeadPersistent(ctx, ts)
 	if err != nil {
 		return err
 	}
@@ -335,6 +437,7 @@ func (store *Store) SetHead(ctx context.Context, ts block.TipSet) error {
 	store.reporter.UpdateStatus(validateHead(ts.Key()), validateHeight(h))
 	// Publish an event that we have a new head.
 	store.HeadEvents().Pub(ts, NewHeadTopic)
+	store.publishHeadChange(store.headChange(ctx, prev, ts))
 
 	return nil
 }
@@ -344,23 +447,33 @@ func (store *Store) ReadOnlyStateStore() cborutil.ReadOnlyIpldStore {
 	return cborutil.ReadOnlyIpldStore{IpldStore: store.stateAndBlockSource.cborStore}
 }
 
-func (store *Store) setHeadPersistent(ctx context.Context, ts block.TipSet) (bool, error) {
+func (store *Store) setHeadPersistent(ctx context.Context, ts block.TipSet) (block.TipSet, bool, error) {
 	// setHeaadPersistent sets the head in memory and on disk if the head is not
-	// already set to ts.  If it is already set to ts it skips this and returns true
+	// already set to ts.  If it is already set to ts it skips this and returns true.
+	// The previous head is returned.
 	store.mu.Lock()
 	defer store.mu.Unlock()
 
-	// Ensure consistency by storing this new head on disk.
+	noop := ts.Equals(store.head)
+	if !noop {
+		if err := store.heightIndex.update(ctx, store, ts); err != nil {
+			return block.UndefTipSet, false, errors.Wrap(err, "failed to update height index")
+		}
+	}
+
+	// Ensure consistency by storing this new head on disk, only once it is
+	// indexed so that a failed update leaves the previous head in place.
 	if errInner := store.writeHead(ctx, ts.Key()); errInner != nil {
-		return false, errors.Wrap(errInner, "failed to write new Head to datastore")
+		return block.UndefTipSet, false, errors.Wrap(errInner, "failed to write new Head to datastore")
 	}
-	if ts.Equals(store.head) {
-		return true, nil
+	if noop {
+		return store.head, true, nil
 	}
 
+	prev := store.head
 	store.head = ts
 
-	return false, nil
+	return prev, false, nil
 }
 
 // writeHead writes the given cid set as head to disk.
@@ -374,33 +487,67 @@ func (store *Store) writeHead(ctx context.Context, cids block.TipSetKey) error {
 	return store.ds.Put(HeadKey, val)
 }
 
-// writeTipSetMetadata writes the tipset key and the state root id to the
-// datastore.
-func (store *Store) writeTipSetMetadata(tsm *TipSetMetadata) error {
-	if tsm.TipSetStateRoot == cid.Undef {
-		return errors.New("attempting to write state root cid.Undef")
-	}
+// PrunedHeight returns the height below which the state of non-genesis
+// tipsets has been pruned. Zero means no state has been pruned.
+func (store *Store) PrunedHeight() abi.ChainEpoch {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	return store.prunedHeight
+}
 
-	if tsm.TipSetReceipts == cid.Undef {
-		return errors.New("attempting to write receipts cid.Undef")
-	}
+// SetPrunedHeight records that the state of non-genesis tipsets below height
+// `h` is no longer available. It must be called before the state is removed
+// so that readers observe ErrStatePruned rather than missing blocks.
+func (store *Store) SetPrunedHeight(h abi.ChainEpoch) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
 
-	metadata := tsState{
-		StateRoot: e.NewCid(tsm.TipSetStateRoot),
-		Reciepts:  e.NewCid(tsm.TipSetReceipts),
+	if h <= store.prunedHeight {
+		return nil
 	}
-	val, err := encoding.Encode(metadata)
+	val, err := encoding.Encode(h)
 	if err != nil {
 		return err
 	}
+	if err := store.ds.Put(PrunedHeightKey, val); err != nil {
+		return errors.Wrap(err, "failed to write pruned height to datastore")
+	}
+	store.prunedHeight = h
+	return nil
+}
 
-	// datastore keeps key:stateRoot (k,v) pairs.
-	h, err := tsm.TipSet.Height()
+// GetAncestorAtEpoch returns the highest tipset with height <= `epoch` on the
+// chain ending at `start` by looking it up in the height index. It returns
+// false if `start` is not on the chain ending at the current head.
+func (store *Store) GetAncestorAtEpoch(start block.TipSet, epoch abi.ChainEpoch) (block.TipSet, bool, error) {
+	startHeight, err := start.Height()
 	if err != nil {
-		return err
+		return block.UndefTipSet, false, err
+	}
+	if epoch >= startHeight {
+		return start, true, nil
+	}
+	if epoch < 0 {
+		epoch = 0
+	}
+
+	store.mu.RLock()
+	indexed, err := store.heightIndex.has(startHeight, start.Key())
+	if err != nil || !indexed {
+		store.mu.RUnlock()
+		return block.UndefTipSet, false, err
+	}
+	key, found, err := store.heightIndex.get(epoch)
+	store.mu.RUnlock()
+	if err != nil || !found {
+		return block.UndefTipSet, false, err
+	}
+
+	ts, err := store.GetTipSet(key)
+	if err != nil {
+		return block.UndefTipSet, false, err
 	}
-	key := datastore.NewKey(makeKey(tsm.TipSet.String(), h))
-	return store.ds.Put(key, val)
+	return ts, true, nil
 }
 
 // GetHead returns the current head tipset cids.
@@ -425,4 +572,5 @@ func (store *Store) GenesisCid() cid.Cid {
 // Stop stops all activities and cleans up.
 func (store *Store) Stop() {
 	store.headEvents.Shutdown()
+	store.closeHeadChangeSubs()
 }
@@ -8,6 +8,7 @@ import (
 	"github.com/filecoin-project/go-filecoin/internal/pkg/block"
 	"github.com/filecoin-project/specs-actors/actors/abi"
 	"github.com/ipfs/go-cid"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
@@ -361,6 +362,103 @@ func TestHeadEvents(t *testing.T) {
 	assertEmptyCh(t, chB)
 }
 
+// Head changes carry the tipsets reverted and applied by each new head.
+func TestSubHeadChanges(t *testing.T) {
+	tf.UnitTest(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	builder := chain.NewBuilder(t, address.Undef)
+	genTS := builder.NewGenesis()
+	ds := repo.NewInMemoryRepo().Datastore()
+	cst := cborutil.NewIpldStore(bstore.NewBlockstore(ds))
+
+	link1 := builder.AppendOn(genTS, 2)
+	link2 := builder.AppendOn(link1, 3)
+	link3 := builder.AppendOn(link2, 1)
+	fork2 := builder.AppendOn(link1, 1)
+	for _, ts := range []block.TipSet{genTS, link1, link2, link3, fork2} {
+		requirePutBlocksToCborStore(t, cst, ts.ToSlice()...)
+	}
+
+	chainStore := chain.NewStore(ds, cst, chain.NewStatusReporter(), genTS.At(0).Cid())
+	requirePutTestChain(ctx, t, chainStore, link3.Key(), builder, 4)
+	requirePutTestChain(ctx, t, chainStore, fork2.Key(), builder, 1)
+	assertSetHead(t, chainStore, link1)
+
+	changes := chainStore.SubHeadChanges(ctx)
+	assertSetHead(t, chainStore, link3)
+	assertSetHead(t, chainStore, link3)
+	assertSetHead(t, chainStore, fork2)
+
+	// The head when subscribing is delivered first.
+	change := <-changes
+	assert.Empty(t, change.Revert)
+	assert.Equal(t, []block.TipSet{link1}, change.Apply)
+
+	change = <-changes
+	assert.Empty(t, change.Revert)
+	assert.Equal(t, []block.TipSet{link3, link2}, change.Apply)
+
+	// Setting the same head again publishes nothing, so the next change is
+	// the reorg.
+	change = <-changes
+	assert.Equal(t, []block.TipSet{link3, link2}, change.Revert)
+	assert.Equal(t, []block.TipSet{fork2}, change.Apply)
+
+	// The channel closes once the context is done.
+	cancel()
+	assertSetHead(t, chainStore, link3)
+	for range changes {
+	}
+}
+
+// Subscribers which do not read head changes never block SetHead, and bounded
+// subscribers are disconnected once they fall behind.
+func TestSubHeadChangesLaggards(t *testing.T) {
+	tf.UnitTest(t)
+
+	ctx := context.Background()
+	builder := chain.NewBuilder(t, address.Undef)
+	genTS := builder.NewGenesis()
+	ds := repo.NewInMemoryRepo().Datastore()
+	cst := cborutil.NewIpldStore(bstore.NewBlockstore(ds))
+	requirePutBlocksToCborStore(t, cst, genTS.ToSlice()...)
+
+	heads := []block.TipSet{genTS}
+	for i := 0; i < 5; i++ {
+		heads = append(heads, builder.AppendOn(heads[len(heads)-1], 1))
+		requirePutBlocksToCborStore(t, cst, heads[len(heads)-1].ToSlice()...)
+	}
+	chainStore := chain.NewStore(ds, cst, chain.NewStatusReporter(), genTS.At(0).Cid())
+	defer chainStore.Stop()
+	requirePutTestChain(ctx, t, chainStore, heads[len(heads)-1].Key(), builder, len(heads))
+	assertSetHead(t, chainStore, genTS)
+
+	unbounded := chainStore.SubHeadChanges(ctx)
+	bounded := chainStore.SubHeadChangesBounded(ctx, 2)
+	for _, head := range heads[1:] {
+		assertSetHead(t, chainStore, head)
+	}
+
+	// The bounded subscriber receives the head when subscribing and the
+	// changes queued before it fell behind, then is disconnected. One change
+	// may have been taken off the queue for delivery before the queue filled up.
+	var received []block.TipSet
+	for change := range bounded {
+		received = append(received, change.Apply[0])
+	}
+	require.True(t, len(received) == 2 || len(received) == 3)
+	assert.Equal(t, heads[:len(received)], received)
+
+	// The unbounded subscriber receives the head when subscribing and every
+	// change.
+	for _, head := range heads {
+		change := <-unbounded
+		assert.Equal(t, head, change.Apply[0])
+	}
+}
+
 /* Loading  */
 // Load does not error and gives the chain store access to all blocks and
 // tipset indexes along the heaviest chain.
@@ -415,6 +513,251 @@ func TestLoadAndReboot(t *testing.T) {
 	assert.Equal(t, link4.Key(), rebootChain.GetHead())
 }
 
+// Once the tipset index is persisted Load does not traverse the chain, and
+// tipsets are loaded from the datastore on demand.
+func TestLoadIsLazy(t *testing.T) {
+	tf.UnitTest(t)
+
+	ctx := context.Background()
+	builder := chain.NewBuilder(t, address.Undef)
+	genTS := builder.NewGenesis()
+	ds := repo.NewInMemoryRepo().Datastore()
+	bs := bstore.NewBlockstore(ds)
+	cst := cborutil.NewIpldStore(bs)
+
+	link1 := builder.AppendOn(genTS, 2)
+	link2 := builder.AppendOn(link1, 3)
+	link3 := builder.AppendOn(link2, 1)
+	link4 := builder.BuildOn(link3, 2, func(bb *chain.BlockBuilder, i int) { bb.IncHeight(2) })
+	for _, ts := range []block.TipSet{genTS, link1, link2, link3, link4} {
+		requirePutBlocksToCborStore(t, cst, ts.ToSlice()...)
+	}
+
+	chainStore := chain.NewStore(ds, cst, chain.NewStatusReporter(), genTS.At(0).Cid())
+	requirePutTestChain(ctx, t, chainStore, link4.Key(), builder, 5)
+	assertSetHead(t, chainStore, link4)
+	chainStore.Stop()
+
+	// The first load persists the index of a chain written without one.
+	rebootChain := chain.NewStore(ds, cst, chain.NewStatusReporter(), genTS.At(0).Cid())
+	require.NoError(t, rebootChain.Load(ctx))
+	rebootChain.Stop()
+	has, err := ds.Has(chain.TipIndexPersistedKey)
+	require.NoError(t, err)
+	assert.True(t, has)
+
+	// A tipset in the middle of the chain going missing cannot be noticed
+	// without traversing the chain.
+	for _, blk := range link2.ToSlice() {
+		require.NoError(t, bs.DeleteBlock(blk.Cid()))
+	}
+	lazyChain := chain.NewStore(ds, cst, chain.NewStatusReporter(), genTS.At(0).Cid())
+	require.NoError(t, lazyChain.Load(ctx))
+	assert.Equal(t, link4.Key(), lazyChain.GetHead())
+
+	got3 := requireGetTipSet(ctx, t, lazyChain, link3.Key())
+	assert.Equal(t, link3, got3)
+	assert.Equal(t, link3.At(0).StateRoot.Cid, requireGetTipSetStateRoot(ctx, t, lazyChain, link3.Key()))
+	got4 := requireGetTsasByParentAndHeight(t, lazyChain, link3.Key(), 6)
+	require.Equal(t, 1, len(got4))
+	assert.Equal(t, link4, got4[0].TipSet)
+
+	_, err = lazyChain.GetTipSet(link2.Key())
+	assert.Error(t, err)
+}
+
+type failingBlockProvider struct {
+	err error
+}
+
+func (p *failingBlockProvider) GetBlock(_ context.Context, _ cid.Cid) (*block.Block, error) {
+	return nil, p.err
+}
+
+// Only missing blocks are reported as a missing tipset by the tipset index.
+func TestTipIndexLoadErrors(t *testing.T) {
+	tf.UnitTest(t)
+
+	ds := repo.NewInMemoryRepo().Datastore()
+	key := block.NewTipSetKey(types.NewCidForTestGetter()())
+
+	missing := chain.NewTipIndex(ds, &failingBlockProvider{errors.Wrap(bstore.ErrNotFound, "failed to get block")})
+	_, err := missing.Get(key)
+	assert.Equal(t, chain.ErrNotFound, err)
+
+	failing := chain.NewTipIndex(ds, &failingBlockProvider{errors.New("disk on fire")})
+	_, err = failing.Get(key)
+	require.Error(t, err)
+	assert.NotEqual(t, chain.ErrNotFound, err)
+	assert.Contains(t, err.Error(), "disk on fire")
+}
+
+// The store indexes the tipsets of the head's chain by height, across reorgs
+// and reboots.
+func TestGetAncestorAtEpoch(t *testing.T) {
+	tf.UnitTest(t)
+
+	ctx := context.Background()
+	builder := chain.NewBuilder(t, address.Undef)
+	genTS := builder.NewGenesis()
+	ds := repo.NewInMemoryRepo().Datastore()
+	cst := cborutil.NewIpldStore(bstore.NewBlockstore(ds))
+
+	link1 := builder.AppendOn(genTS, 2)
+	link2 := builder.AppendOn(link1, 3)
+	link3 := builder.AppendOn(link2, 1)
+	link4 := builder.BuildOn(link3, 2, func(bb *chain.BlockBuilder, i int) { bb.IncHeight(2) })
+	fork2 := builder.AppendOn(link1, 1)
+	fork3 := builder.AppendOn(fork2, 1)
+	for _, ts := range []block.TipSet{genTS, link1, link2, link3, link4, fork2, fork3} {
+		requirePutBlocksToCborStore(t, cst, ts.ToSlice()...)
+	}
+
+	chainStore := chain.NewStore(ds, cst, chain.NewStatusReporter(), genTS.At(0).Cid())
+	requirePutTestChain(ctx, t, chainStore, link4.Key(), builder, 5)
+	requirePutTestChain(ctx, t, chainStore, fork3.Key(), builder, 2)
+	assertSetHead(t, chainStore, link4)
+
+	assertAncestorAtEpoch := func(store *chain.Store, start block.TipSet, epoch abi.ChainEpoch, expected block.TipSet) {
+		ts, found, err := store.GetAncestorAtEpoch(start, epoch)
+		require.NoError(t, err)
+		require.True(t, found)
+		assert.Equal(t, expected, ts)
+	}
+	assertAncestorAtEpoch(chainStore, link4, 10, link4)
+	assertAncestorAtEpoch(chainStore, link4, 6, link4)
+	assertAncestorAtEpoch(chainStore, link4, 5, link3) // null rounds
+	assertAncestorAtEpoch(chainStore, link4, 2, link2)
+	assertAncestorAtEpoch(chainStore, link3, 1, link1)
+	assertAncestorAtEpoch(chainStore, link4, -1, genTS)
+
+	// Tipsets off the head's chain are not indexed.
+	_, found, err := chainStore.GetAncestorAtEpoch(fork3, 1)
+	require.NoError(t, err)
+	assert.False(t, found)
+
+	// Reorg to the fork.
+	assertSetHead(t, chainStore, fork3)
+	assertAncestorAtEpoch(chainStore, fork3, 2, fork2)
+	assertAncestorAtEpoch(chainStore, fork3, 1, link1)
+	_, found, err = chainStore.GetAncestorAtEpoch(link4, 2)
+	require.NoError(t, err)
+	assert.False(t, found)
+
+	atEpoch, err := chain.FindTipsetAtEpoch(ctx, fork3, 2, chainStore)
+	require.NoError(t, err)
+	assert.Equal(t, fork2, atEpoch)
+
+	oldTips, newTips, err := chain.CollectTipsToCommonAncestor(ctx, chainStore, link4, fork3)
+	require.NoError(t, err)
+	assert.Equal(t, []block.TipSet{link4, link3, link2}, oldTips)
+	assert.Equal(t, []block.TipSet{fork3, fork2}, newTips)
+	chainStore.Stop()
+
+	// The index survives a reboot.
+	rebootChain := chain.NewStore(ds, cst, chain.NewStatusReporter(), genTS.At(0).Cid())
+	require.NoError(t, rebootChain.Load(ctx))
+	assertAncestorAtEpoch(rebootChain, fork3, 2, fork2)
+	assertAncestorAtEpoch(rebootChain, fork3, 0, genTS)
+	_, found, err = rebootChain.GetAncestorAtEpoch(link3, 1)
+	require.NoError(t, err)
+	assert.False(t, found)
+}
+
+// A head whose ancestors are not all known to the store truncates the height
+// index, and the truncation survives a reboot.
+func TestGetAncestorAtEpochTruncated(t *testing.T) {
+	tf.UnitTest(t)
+
+	ctx := context.Background()
+	builder := chain.NewBuilder(t, address.Undef)
+	genTS := builder.NewGenesis()
+	ds := repo.NewInMemoryRepo().Datastore()
+	cst := cborutil.NewIpldStore(bstore.NewBlockstore(ds))
+
+	link1 := builder.AppendOn(genTS, 1)
+	link2 := builder.AppendOn(link1, 1)
+	link3 := builder.AppendOn(link2, 1)
+	fork1 := builder.AppendOn(genTS, 1)
+	fork2 := builder.AppendOn(fork1, 1)
+	fork3 := builder.AppendOn(fork2, 1)
+	for _, ts := range []block.TipSet{genTS, link1, link2, link3, fork1, fork2, fork3} {
+		requirePutBlocksToCborStore(t, cst, ts.ToSlice()...)
+	}
+
+	chainStore := chain.NewStore(ds, cst, chain.NewStatusReporter(), genTS.At(0).Cid())
+	requirePutTestChain(ctx, t, chainStore, link3.Key(), builder, 4)
+	assertSetHead(t, chainStore, link3)
+
+	// The fork's first tipset is unknown to the store.
+	requirePutTestChain(ctx, t, chainStore, fork3.Key(), builder, 2)
+	assertSetHead(t, chainStore, fork3)
+
+	assertTruncated := func(store *chain.Store) {
+		ts, found, err := store.GetAncestorAtEpoch(fork3, 2)
+		require.NoError(t, err)
+		require.True(t, found)
+		assert.Equal(t, fork2, ts)
+
+		_, found, err = store.GetAncestorAtEpoch(fork3, 1)
+		require.NoError(t, err)
+		assert.False(t, found)
+	}
+	assertTruncated(chainStore)
+	chainStore.Stop()
+
+	rebootChain := chain.NewStore(ds, cst, chain.NewStatusReporter(), genTS.At(0).Cid())
+	require.NoError(t, rebootChain.Load(ctx))
+	assertTruncated(rebootChain)
+}
+
+func TestCheckpoint(t *testing.T) {
+	tf.UnitTest(t)
+
+	ctx := context.Background()
+	builder := chain.NewBuilder(t, address.Undef)
+	genTS := builder.NewGenesis()
+	ds := repo.NewInMemoryRepo().Datastore()
+	cst := cborutil.NewIpldStore(bstore.NewBlockstore(ds))
+
+	link1 := builder.AppendOn(genTS, 1)
+	link2 := builder.AppendOn(link1, 1)
+	fork2 := builder.AppendOn(link1, 2)
+	fork1 := builder.AppendOn(genTS, 2)
+	for _, ts := range []block.TipSet{genTS, link1, link2, fork2, fork1} {
+		requirePutBlocksToCborStore(t, cst, ts.ToSlice()...)
+	}
+
+	chainStore := chain.NewStore(ds, cst, chain.NewStatusReporter(), genTS.At(0).Cid())
+	requirePutTestChain(ctx, t, chainStore, link2.Key(), builder, 3)
+	requirePutTestChain(ctx, t, chainStore, fork2.Key(), builder, 1)
+	requirePutTestChain(ctx, t, chainStore, fork1.Key(), builder, 1)
+	assertSetHead(t, chainStore, link2)
+	assert.False(t, chainStore.Checkpoint().Defined())
+	assert.NoError(t, chainStore.CheckCheckpoint(ctx, fork1))
+
+	// Only tipsets on the current chain can be checkpointed.
+	err := chainStore.SetCheckpoint(ctx, fork2.Key())
+	assert.Equal(t, chain.ErrForkBeforeCheckpoint, errors.Cause(err))
+	require.NoError(t, chainStore.SetCheckpoint(ctx, link1.Key()))
+	assert.Equal(t, link1, chainStore.Checkpoint())
+
+	assert.NoError(t, chainStore.CheckCheckpoint(ctx, link1))
+	assert.NoError(t, chainStore.CheckCheckpoint(ctx, link2))
+	assert.NoError(t, chainStore.CheckCheckpoint(ctx, fork2))
+	assert.Equal(t, chain.ErrForkBeforeCheckpoint, errors.Cause(chainStore.CheckCheckpoint(ctx, fork1)))
+	assert.Equal(t, chain.ErrForkBeforeCheckpoint, errors.Cause(chainStore.CheckCheckpoint(ctx, genTS)))
+	chainStore.Stop()
+
+	// The checkpoint survives a reboot and can be cleared.
+	rebootChain := chain.NewStore(ds, cst, chain.NewStatusReporter(), genTS.At(0).Cid())
+	require.NoError(t, rebootChain.Load(ctx))
+	assert.Equal(t, link1, rebootChain.Checkpoint())
+	require.NoError(t, rebootChain.SetCheckpoint(ctx, block.TipSetKey{}))
+	assert.False(t, rebootChain.Checkpoint().Defined())
+	assert.NoError(t, rebootChain.CheckCheckpoint(ctx, fork1))
+}
+
 type tipSetGetter interface {
 	GetTipSet(block.TipSetKey) (block.TipSet, error)
 }
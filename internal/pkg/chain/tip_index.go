@@ -1,12 +1,22 @@
 package chain
 
 import (
+	"container/list"
+	"context"
 	"fmt"
+	"strconv"
+	"strings"
 	"sync"
 
 	"github.com/filecoin-project/go-filecoin/internal/pkg/block"
+	e "github.com/filecoin-project/go-filecoin/internal/pkg/enccid"
+	"github.com/filecoin-project/go-filecoin/internal/pkg/encoding"
+	"github.com/filecoin-project/go-filecoin/internal/pkg/repo"
 	"github.com/filecoin-project/specs-actors/actors/abi"
 	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
 	"github.com/pkg/errors"
 )
 
@@ -15,6 +25,14 @@ var (
 	ErrNotFound = errors.New("Key not found in tipindex")
 )
 
+// ChildrenKeyPrefix is the datastore namespace under which the keys of the
+// tipsets with each parent set and height are written.
+var ChildrenKeyPrefix = datastore.NewKey("/chain/children")
+
+// tipIndexCacheSize is the number of TipSetMetadata entries kept in memory.
+// It comfortably covers the tipsets consulted by consensus lookbacks.
+const tipIndexCacheSize = 2048
+
 // TipSetMetadata is the type stored at the leaves of the TipIndex.  It contains
 // a tipset pointing to blocks, the root cid of the chain's state after
 // applying the messages in this tipset to it's parent state, and the cid of the receipts
@@ -30,24 +48,39 @@ type TipSetMetadata struct {
 	TipSetReceipts cid.Cid
 }
 
-type tsmByTipSetID map[string]*TipSetMetadata
+// tsState is the persisted form of a TipSetMetadata. The tipset itself is
+// read from the block store.
+type tsState struct {
+	StateRoot e.Cid
+	Reciepts  e.Cid
+}
 
 // TipIndex tracks tipsets and their states by tipset block ids and parent
 // block ids.  All methods are threadsafe as shared data is guarded by a
 // mutex.
+//
+// Entries are persisted to the chain datastore when they are put and loaded
+// from it on demand, so the index need not be rebuilt when the node starts.
+// Only the most recently used entries are kept in memory.
 type TipIndex struct {
+	ds     repo.Datastore
+	blocks BlockProvider
+
 	mu sync.Mutex
-	// tsasByParents allows lookup of all TipSetAndStates with the same parent IDs.
-	tsasByParentsAndHeight map[string]tsmByTipSetID
-	// tsasByID allows lookup of recorded TipSetAndStates by TipSet ID.
-	tsasByID tsmByTipSetID
+	// cache holds recently used entries, most recent first.
+	cache *list.List
+	// cacheByID maps tipset IDs to their elements in cache.
+	cacheByID map[string]*list.Element
 }
 
-// NewTipIndex is the TipIndex constructor.
-func NewTipIndex() *TipIndex {
+// NewTipIndex is the TipIndex constructor. Entries are persisted to `ds` and
+// the blocks of their tipsets are read from `blocks`.
+func NewTipIndex(ds repo.Datastore, blocks BlockProvider) *TipIndex {
 	return &TipIndex{
-		tsasByParentsAndHeight: make(map[string]tsmByTipSetID),
-		tsasByID:               make(map[string]*TipSetMetadata),
+		ds:        ds,
+		blocks:    blocks,
+		cache:     list.New(),
+		cacheByID: make(map[string]*list.Element),
 	}
 }
 
@@ -57,38 +90,64 @@ func NewTipIndex() *TipIndex {
 func (ti *TipIndex) Put(tsas *TipSetMetadata) error {
 	ti.mu.Lock()
 	defer ti.mu.Unlock()
-	tsKey := tsas.TipSet.String()
-	// Update tsasByID
-	ti.tsasByID[tsKey] = tsas
 
-	// Update tsasByParents
+	if err := ti.writeMetadata(tsas); err != nil {
+		return err
+	}
+
+	// Update the tipsets by parents.
 	pSet, err := tsas.TipSet.Parents()
 	if err != nil {
 		return err
 	}
-	pKey := pSet.String()
 	h, err := tsas.TipSet.Height()
 	if err != nil {
 		return err
 	}
-	key := makeKey(pKey, h)
-	tsasByID, ok := ti.tsasByParentsAndHeight[key]
-	if !ok {
-		tsasByID = make(map[string]*TipSetMetadata)
-		ti.tsasByParentsAndHeight[key] = tsasByID
+	children, err := ti.readChildren(pSet, h)
+	if err != nil && err != ErrNotFound {
+		return err
+	}
+	tsKey := tsas.TipSet.Key()
+	found := false
+	for _, child := range children {
+		if child.Equals(tsKey) {
+			found = true
+			break
+		}
 	}
-	tsasByID[tsKey] = tsas
+	if !found {
+		val, err := encoding.Encode(append(children, tsKey))
+		if err != nil {
+			return err
+		}
+		if err := ti.ds.Put(childrenKey(pSet, h), val); err != nil {
+			return errors.Wrap(err, "failed to write tipset children")
+		}
+	}
+
+	ti.cachePut(tsas)
 	return nil
 }
 
 // Get returns the tipset given by the input ID and its state.
 func (ti *TipIndex) Get(tsKey block.TipSetKey) (*TipSetMetadata, error) {
 	ti.mu.Lock()
-	defer ti.mu.Unlock()
-	tsas, ok := ti.tsasByID[tsKey.String()]
-	if !ok {
-		return nil, ErrNotFound
+	if elem, ok := ti.cacheByID[tsKey.String()]; ok {
+		ti.cache.MoveToFront(elem)
+		ti.mu.Unlock()
+		return elem.Value.(*TipSetMetadata), nil
+	}
+	ti.mu.Unlock()
+
+	tsas, err := ti.load(tsKey)
+	if err != nil {
+		return nil, err
 	}
+
+	ti.mu.Lock()
+	defer ti.mu.Unlock()
+	ti.cachePut(tsas)
 	return tsas, nil
 }
 
@@ -122,41 +181,187 @@ func (ti *TipIndex) GetTipSetReceiptsRoot(tsKey block.TipSetKey) (cid.Cid, error
 // Has returns true iff the tipset with the input ID is stored in
 // the TipIndex.
 func (ti *TipIndex) Has(tsKey block.TipSetKey) bool {
-	ti.mu.Lock()
-	defer ti.mu.Unlock()
-	_, ok := ti.tsasByID[tsKey.String()]
-	return ok
+	_, err := ti.Get(tsKey)
+	return err == nil
 }
 
 // GetByParentsAndHeight returns the all tipsets and states stored in the TipIndex
 // such that the parent ID of these tipsets equals the input.
 func (ti *TipIndex) GetByParentsAndHeight(pKey block.TipSetKey, h abi.ChainEpoch) ([]*TipSetMetadata, error) {
-	key := makeKey(pKey.String(), h)
-	ti.mu.Lock()
-	defer ti.mu.Unlock()
-	tsasByID, ok := ti.tsasByParentsAndHeight[key]
-	if !ok {
-		return nil, ErrNotFound
+	children, err := ti.readChildren(pKey, h)
+	if err != nil {
+		return nil, err
 	}
 	var ret []*TipSetMetadata
-	for _, tsas := range tsasByID {
+	for _, child := range children {
+		tsas, err := ti.Get(child)
+		if err != nil {
+			return nil, err
+		}
 		ret = append(ret, tsas)
 	}
 	return ret, nil
 }
 
+// GetAtOrAbove returns all tipsets and states stored in the TipIndex at height
+// `h` or above, whichever chain they are on.
+func (ti *TipIndex) GetAtOrAbove(h abi.ChainEpoch) ([]*TipSetMetadata, error) {
+	res, err := ti.ds.Query(query.Query{Prefix: ChildrenKeyPrefix.String()})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to query tipset children")
+	}
+	entries, err := res.Rest()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read tipset children")
+	}
+	var ret []*TipSetMetadata
+	for _, entry := range entries {
+		childHeight, err := heightOfKey(datastore.RawKey(entry.Key).BaseNamespace())
+		if err != nil {
+			return nil, err
+		}
+		if childHeight < h {
+			continue
+		}
+		var children []block.TipSetKey
+		if err := encoding.Decode(entry.Value, &children); err != nil {
+			return nil, errors.Wrap(err, "failed to decode tipset children")
+		}
+		for _, child := range children {
+			tsas, err := ti.Get(child)
+			if err != nil {
+				return nil, err
+			}
+			ret = append(ret, tsas)
+		}
+	}
+	return ret, nil
+}
+
 // HasByParentsAndHeight returns true iff there exist tipsets, and states,
 // tracked in the TipIndex such that the parent ID of these tipsets equals the
 // input.
 func (ti *TipIndex) HasByParentsAndHeight(pKey block.TipSetKey, h abi.ChainEpoch) bool {
-	key := makeKey(pKey.String(), h)
-	ti.mu.Lock()
-	defer ti.mu.Unlock()
-	_, ok := ti.tsasByParentsAndHeight[key]
-	return ok
+	has, err := ti.ds.Has(childrenKey(pKey, h))
+	return err == nil && has
+}
+
+// cachePut adds an entry to the in-memory cache, evicting the least recently
+// used entry if the cache is full. The caller must hold ti.mu.
+func (ti *TipIndex) cachePut(tsas *TipSetMetadata) {
+	id := tsas.TipSet.String()
+	if elem, ok := ti.cacheByID[id]; ok {
+		elem.Value = tsas
+		ti.cache.MoveToFront(elem)
+		return
+	}
+	ti.cacheByID[id] = ti.cache.PushFront(tsas)
+	if ti.cache.Len() > tipIndexCacheSize {
+		oldest := ti.cache.Back()
+		ti.cache.Remove(oldest)
+		delete(ti.cacheByID, oldest.Value.(*TipSetMetadata).TipSet.String())
+	}
+}
+
+// load reads an entry from the datastore. It returns ErrNotFound if either
+// the tipset's blocks or its metadata are missing.
+func (ti *TipIndex) load(tsKey block.TipSetKey) (*TipSetMetadata, error) {
+	// GetTipSet does not take a context, blocks are loaded without one.
+	ts, err := LoadTipSetBlocks(context.Background(), ti.blocks, tsKey)
+	if err != nil {
+		if cause := errors.Cause(err); cause == blockstore.ErrNotFound || cause == datastore.ErrNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, errors.Wrapf(err, "failed to load blocks of tipset %s", tsKey)
+	}
+	h, err := ts.Height()
+	if err != nil {
+		return nil, err
+	}
+	bb, err := ti.ds.Get(datastore.NewKey(makeKey(ts.String(), h)))
+	if err == datastore.ErrNotFound {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read tipset key %s", ts.String())
+	}
+
+	var metadata tsState
+	err = encoding.Decode(bb, &metadata)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to decode tip set metadata %s", ts.String())
+	}
+	return &TipSetMetadata{
+		TipSet:          ts,
+		TipSetStateRoot: metadata.StateRoot.Cid,
+		TipSetReceipts:  metadata.Reciepts.Cid,
+	}, nil
+}
+
+// writeMetadata writes the tipset key and the state root id to the
+// datastore.
+func (ti *TipIndex) writeMetadata(tsm *TipSetMetadata) error {
+	if tsm.TipSetStateRoot == cid.Undef {
+		return errors.New("attempting to write state root cid.Undef")
+	}
+
+	if tsm.TipSetReceipts == cid.Undef {
+		return errors.New("attempting to write receipts cid.Undef")
+	}
+
+	metadata := tsState{
+		StateRoot: e.NewCid(tsm.TipSetStateRoot),
+		Reciepts:  e.NewCid(tsm.TipSetReceipts),
+	}
+	val, err := encoding.Encode(metadata)
+	if err != nil {
+		return err
+	}
+
+	// datastore keeps key:stateRoot (k,v) pairs.
+	h, err := tsm.TipSet.Height()
+	if err != nil {
+		return err
+	}
+	key := datastore.NewKey(makeKey(tsm.TipSet.String(), h))
+	return ti.ds.Put(key, val)
+}
+
+// readChildren returns the keys of the tipsets with parents `pKey` at height
+// `h`, or ErrNotFound if there are none.
+func (ti *TipIndex) readChildren(pKey block.TipSetKey, h abi.ChainEpoch) ([]block.TipSetKey, error) {
+	bb, err := ti.ds.Get(childrenKey(pKey, h))
+	if err == datastore.ErrNotFound {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read tipset children")
+	}
+	var children []block.TipSetKey
+	if err := encoding.Decode(bb, &children); err != nil {
+		return nil, errors.Wrap(err, "failed to decode tipset children")
+	}
+	return children, nil
+}
+
+func childrenKey(pKey block.TipSetKey, h abi.ChainEpoch) datastore.Key {
+	return ChildrenKeyPrefix.ChildString(makeKey(pKey.String(), h))
 }
 
 // makeKey returns a unique string for every parent set key and height input
 func makeKey(pKey string, h abi.ChainEpoch) string {
 	return fmt.Sprintf("p-%s h-%d", pKey, h)
 }
+
+// heightOfKey returns the height of a key made by makeKey.
+func heightOfKey(key string) (abi.ChainEpoch, error) {
+	idx := strings.LastIndex(key, " h-")
+	if idx < 0 {
+		return 0, errors.Errorf("malformed tipset index key %s", key)
+	}
+	h, err := strconv.ParseInt(key[idx+len(" h-"):], 10, 64)
+	if err != nil {
+		return 0, errors.Wrapf(err, "malformed tipset index key %s", key)
+	}
+	return abi.ChainEpoch(h), nil
+}
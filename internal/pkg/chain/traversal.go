@@ -95,6 +95,14 @@ func (p *tipsetFromBlockProvider) GetTipSet(tsKey block.TipSetKey) (block.TipSet
 // ancestor, collecting all tipsets that are in one chain but not the other.
 // The resulting lists of tipsets are ordered by decreasing height.
 func CollectTipsToCommonAncestor(ctx context.Context, store TipSetProvider, oldHead, newHead block.TipSet) (oldTips, newTips []block.TipSet, err error) {
+	if index, ok := store.(EpochIndex); ok {
+		var found bool
+		oldTips, newTips, found, err = collectTipsToIndexedAncestor(ctx, store, index, oldHead, newHead)
+		if err != nil || found {
+			return
+		}
+	}
+
 	oldIter := IterAncestors(ctx, store, oldHead)
 	newIter := IterAncestors(ctx, store, newHead)
 
@@ -121,6 +129,47 @@ func CollectTipsToCommonAncestor(ctx context.Context, store TipSetProvider, oldH
 	return
 }
 
+// collectTipsToIndexedAncestor is CollectTipsToCommonAncestor for the case
+// that newHead is on the indexed chain, so that only the old chain needs to be
+// traversed to find the common ancestor. It returns false if newHead is not
+// on the indexed chain.
+func collectTipsToIndexedAncestor(ctx context.Context, store TipSetProvider, index EpochIndex, oldHead, newHead block.TipSet) (oldTips, newTips []block.TipSet, found bool, err error) {
+	var common block.TipSet
+	for it := IterAncestors(ctx, store, oldHead); !it.Complete(); err = it.Next() {
+		if err != nil {
+			return nil, nil, false, err
+		}
+		h, err := it.Value().Height()
+		if err != nil {
+			return nil, nil, false, err
+		}
+		ancestor, indexed, err := index.GetAncestorAtEpoch(newHead, h)
+		if err != nil || !indexed {
+			return nil, nil, false, err
+		}
+		if ancestor.Equals(it.Value()) {
+			common = ancestor
+			break
+		}
+		oldTips = append(oldTips, it.Value())
+	}
+	if err != nil {
+		return nil, nil, false, err
+	}
+	if !common.Defined() {
+		return nil, nil, false, ErrNoCommonAncestor
+	}
+	commonHeight, err := common.Height()
+	if err != nil {
+		return nil, nil, false, err
+	}
+	newTips, err = CollectTipSetsOfHeightAtLeast(ctx, IterAncestors(ctx, store, newHead), commonHeight+1)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	return oldTips, newTips, true, nil
+}
+
 // ErrNoCommonAncestor is returned when two chains assumed to have a common ancestor do not.
 var ErrNoCommonAncestor = errors.New("no common ancestor")
 
@@ -186,9 +235,27 @@ func CollectTipSetsOfHeightAtLeast(ctx context.Context, iterator *TipsetIterator
 	return ret, nil
 }
 
+// EpochIndex is implemented by tipset providers that index the tipsets of a
+// chain by epoch.
+type EpochIndex interface {
+	// GetAncestorAtEpoch returns the highest tipset with height <= epoch on
+	// the chain ending at start. It returns false if start is not on the
+	// indexed chain.
+	GetAncestorAtEpoch(start block.TipSet, epoch abi.ChainEpoch) (block.TipSet, bool, error)
+}
+
 // FindTipSetAtEpoch finds the highest tipset with height <= the input epoch
-// by traversing backwards from start
+// by traversing backwards from start. If the reader is an EpochIndex and start
+// is on its indexed chain the tipset is looked up without traversal.
 func FindTipsetAtEpoch(ctx context.Context, start block.TipSet, epoch abi.ChainEpoch, reader TipSetProvider) (ts block.TipSet, err error) {
+	if index, ok := reader.(EpochIndex); ok {
+		var found bool
+		ts, found, err = index.GetAncestorAtEpoch(start, epoch)
+		if err != nil || found {
+			return
+		}
+	}
+
 	iterator := IterAncestors(ctx, reader, start)
 	var h abi.ChainEpoch
 	for ; !iterator.Complete(); err = iterator.Next() {
@@ -6,7 +6,6 @@ import (
 
 	"github.com/filecoin-project/specs-actors/actors/abi"
 	logging "github.com/ipfs/go-log"
-	"github.com/pkg/errors"
 
 	"github.com/filecoin-project/go-filecoin/internal/pkg/block"
 	"github.com/filecoin-project/go-filecoin/internal/pkg/chain"
@@ -18,15 +17,11 @@ var log = logging.Logger("chainsampler") // nolint: deadcode
 type HeightThresholdScheduler struct {
 	mtx             sync.Mutex
 	heightListeners []*HeightThresholdListener
-	chainStore      *chain.Store
-	prevHead        block.TipSet
 }
 
 // NewHeightThresholdScheduler creates a new scheduler
-func NewHeightThresholdScheduler(chainStore *chain.Store) *HeightThresholdScheduler {
-	return &HeightThresholdScheduler{
-		chainStore: chainStore,
-	}
+func NewHeightThresholdScheduler() *HeightThresholdScheduler {
+	return &HeightThresholdScheduler{}
 }
 
 // AddListener adds a new listener for the target height
@@ -57,26 +52,14 @@ func (hts *HeightThresholdScheduler) CancelListener(cancelledListener *HeightThr
 	cancelledListener.DoneCh <- struct{}{}
 }
 
-// HandleNewTipSet must be called when the chain head changes.
-func (hts *HeightThresholdScheduler) HandleNewTipSet(ctx context.Context, newHead block.TipSet) error {
-	var err error
-	var newTips []block.TipSet
-
+// HandleHeadChange must be called when the chain head changes.
+func (hts *HeightThresholdScheduler) HandleHeadChange(ctx context.Context, change chain.HeadChange) error {
 	hts.mtx.Lock()
 	defer hts.mtx.Unlock()
-	if hts.prevHead.Defined() {
-		_, newTips, err = chain.CollectTipsToCommonAncestor(ctx, hts.chainStore, hts.prevHead, newHead)
-		if err != nil {
-			return errors.Wrapf(err, "failed to collect tips between %s and %s", hts.prevHead, newHead)
-		}
-	} else {
-		newTips = []block.TipSet{newHead}
-	}
-	hts.prevHead = newHead
 
 	var newListeners []*HeightThresholdListener
 	for _, listener := range hts.heightListeners {
-		valid, err := listener.Handle(newTips)
+		valid, err := listener.Handle(change.Apply)
 		if err != nil {
 			log.Error("Error checking storage miner chainStore listener", err)
 		}
@@ -58,6 +58,18 @@ func (m *Manager) TransitionChannel() chan bool {
 	return m.transitionCh
 }
 
+// ValidateImport validates and stores the imported chain ending at `head`,
+// re-executing every tipset above `checkpoint`.
+func (m *Manager) ValidateImport(ctx context.Context, head, checkpoint block.TipSetKey, tipsets chain.TipSetProvider) error {
+	return m.syncer.ValidateImport(ctx, head, checkpoint, tipsets)
+}
+
+// ValidateBlock validates a block on a parent tipset in the chain store, including its state
+// transition, without adding it to the store.
+func (m *Manager) ValidateBlock(ctx context.Context, blk *block.Block) error {
+	return m.syncer.ValidateBlock(ctx, blk)
+}
+
 // Status returns the block proposer.
 func (m *Manager) Status() status.Status {
 	return m.syncer.Status()
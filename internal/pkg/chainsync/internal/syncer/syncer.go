@@ -2,6 +2,7 @@ package syncer
 
 import (
 	"context"
+	"sync"
 
 	"github.com/filecoin-project/specs-actors/actors/abi"
 	"github.com/filecoin-project/specs-actors/actors/builtin/miner"
@@ -55,6 +56,9 @@ type Syncer struct {
 	messageProvider messageStore
 
 	clock clock.Clock
+	// stagedMu protects staged, which is written both by the dispatcher and by
+	// chain imports running on API goroutines.
+	stagedMu sync.Mutex
 	// staged is the heaviest tipset seen by the syncer so far
 	staged block.TipSet
 
@@ -88,6 +92,7 @@ type ChainReaderWriter interface {
 	SetHead(ctx context.Context, ts block.TipSet) error
 	HasTipSetAndStatesWithParentsAndHeight(pTsKey block.TipSetKey, h abi.ChainEpoch) bool
 	GetTipSetAndStatesByParentsAndHeight(pTsKey block.TipSetKey, h abi.ChainEpoch) ([]*chain.TipSetMetadata, error)
+	CheckCheckpoint(ctx context.Context, ts block.TipSet) error
 }
 
 type messageStore interface {
@@ -174,13 +179,18 @@ func (syncer *Syncer) InitStaged() error {
 	if err != nil {
 		return err
 	}
+	syncer.stagedMu.Lock()
+	defer syncer.stagedMu.Unlock()
 	syncer.staged = staged
 	return nil
 }
 
 // SetStagedHead sets the syncer's internal staged tipset to the chain's head.
 func (syncer *Syncer) SetStagedHead(ctx context.Context) error {
-	return syncer.chainStore.SetHead(ctx, syncer.staged)
+	syncer.stagedMu.Lock()
+	staged := syncer.staged
+	syncer.stagedMu.Unlock()
+	return syncer.chainStore.SetHead(ctx, staged)
 }
 
 // fetchAndValidateHeaders fetches headers and runs semantic block validation
@@ -219,6 +229,11 @@ func (syncer *Syncer) fetchAndValidateHeaders(ctx context.Context, ci *block.Cha
 	if err != nil {
 		return nil, err
 	}
+	// The fetched chain joins the store at parent, so it includes the
+	// checkpoint only if parent does.
+	if err := syncer.chainStore.CheckCheckpoint(ctx, parent); err != nil {
+		return nil, errors.Wrapf(err, "chain with head %s from peer %s rejected", ci.Head, ci.Sender)
+	}
 	for i, ts := range headers {
 		for i := 0; i < ts.Len(); i++ {
 			err = syncer.headerValidator.ValidateSemantic(ctx, ts.At(i), parent)
@@ -236,9 +251,6 @@ func (syncer *Syncer) fetchAndValidateHeaders(ctx context.Context, ci *block.Cha
 // in order to validate the tipset.  In the case the input tipset is valid,
 // syncOne calls into consensus to check its weight, and then updates the head
 // of the store if this tipset is the heaviest.
-//
-// Precondition: the caller of syncOne must hold the syncer's lock (syncer.mu) to
-// ensure head is not modified by another goroutine during run.
 func (syncer *Syncer) syncOne(ctx context.Context, grandParent, parent, next block.TipSet) error {
 	priorHeadKey := syncer.chainStore.GetHead()
 
@@ -314,6 +326,44 @@ func (syncer *Syncer) syncOne(ctx context.Context, grandParent, parent, next blo
 	return nil
 }
 
+// ValidateBlock validates a single block on a parent tipset in the chain store as syncOne
+// validates the tipsets it syncs, without storing the result: the header semantics against
+// its parents and the state transition of its messages. It is used to check the blocks mined by
+// this node before they are published. The block's messages must be available.
+func (syncer *Syncer) ValidateBlock(ctx context.Context, blk *block.Block) error {
+	ts, err := block.NewTipSet(blk)
+	if err != nil {
+		return err
+	}
+	parent, grandParent, err := syncer.ancestorsFromStore(ts)
+	if err != nil {
+		return errors.Wrapf(err, "failed to load parents of block %s", blk.Cid())
+	}
+	if err := syncer.headerValidator.ValidateSemantic(ctx, blk, parent); err != nil {
+		return err
+	}
+
+	secpMsgs, blsMsgs, err := syncer.messageProvider.LoadMessages(ctx, blk.Messages.Cid)
+	if err != nil {
+		return errors.Wrapf(err, "failed loading message list %s for block %s", blk.Messages, blk.Cid())
+	}
+	parentWeight, err := syncer.calculateParentWeight(ctx, parent, grandParent)
+	if err != nil {
+		return err
+	}
+	stateRoot, err := syncer.chainStore.GetTipSetStateRoot(parent.Key())
+	if err != nil {
+		return err
+	}
+	parentReceiptRoot, err := syncer.chainStore.GetTipSetReceiptsRoot(parent.Key())
+	if err != nil {
+		return err
+	}
+
+	_, _, err = syncer.fullValidator.RunStateTransition(ctx, ts, [][]*types.UnsignedMessage{blsMsgs}, [][]*types.SignedMessage{secpMsgs}, parentWeight, stateRoot, parentReceiptRoot)
+	return err
+}
+
 // TODO #3537 this should be stored the first time it is computed and retrieved
 // from disk just like aggregate state roots.
 func (syncer *Syncer) calculateParentWeight(ctx context.Context, parent, grandParent block.TipSet) (fbig.Int, error) {
@@ -564,6 +614,9 @@ func (syncer *Syncer) handleNewTipSet(ctx context.Context, ci *block.ChainInfo)
 func (syncer *Syncer) stageIfHeaviest(ctx context.Context, candidate block.TipSet) error {
 	// stageIfHeaviest sets the provided candidates to the staging head of the chain if they
 	// are heavier. Precondtion: candidates are validated and added to the store.
+	if err := syncer.chainStore.CheckCheckpoint(ctx, candidate); err != nil {
+		return err
+	}
 	parentKey, err := candidate.Parents()
 	if err != nil {
 		return err
@@ -573,6 +626,8 @@ func (syncer *Syncer) stageIfHeaviest(ctx context.Context, candidate block.TipSe
 		return err
 	}
 
+	syncer.stagedMu.Lock()
+	defer syncer.stagedMu.Unlock()
 	stagedParentKey, err := syncer.staged.Parents()
 	if err != nil {
 		return err
@@ -606,3 +661,99 @@ func (syncer *Syncer) stageIfHeaviest(ctx context.Context, candidate block.TipSe
 func (syncer *Syncer) Status() status.Status {
 	return syncer.reporter.Status()
 }
+
+// ValidateImport validates the chain ending at `headKey` whose blocks and
+// messages have been imported to the node's block store, e.g. from a CAR
+// file, and adds it to the chain store. `tipsets` provides the imported
+// tipsets. Header linkage is checked all the way back to a tipset already in
+// the chain store, and every tipset above `checkpoint` is re-executed. The
+// state and receipt roots of the checkpoint and its ancestors are trusted from
+// the headers of their children. An empty checkpoint re-executes the whole
+// imported chain.
+//
+// Headers at or below the checkpoint are only checked semantically against
+// their parents: their syntax, signatures, tickets and elections are not
+// validated, so the checkpoint must be trusted to be on a valid chain.
+//
+// ValidateImport returns an error on the first tipset that fails validation,
+// leaving the tipsets below it in the chain store. It does not change the head.
+func (syncer *Syncer) ValidateImport(ctx context.Context, headKey, checkpoint block.TipSetKey, tipsets chain.TipSetProvider) error {
+	head, err := tipsets.GetTipSet(headKey)
+	if err != nil {
+		return errors.Wrapf(err, "failed to load imported head %s", headKey)
+	}
+
+	// Collect imported tipsets down to one already known to the store.
+	var imported []block.TipSet
+	var base block.TipSet
+	for it := chain.IterAncestors(ctx, tipsets, head); !it.Complete(); err = it.Next() {
+		if err != nil {
+			return err
+		}
+		if syncer.chainStore.HasTipSetAndState(ctx, it.Value().Key()) {
+			base = it.Value()
+			break
+		}
+		imported = append(imported, it.Value())
+	}
+	if !base.Defined() {
+		return errors.New("imported chain does not link to the genesis block of the chain store")
+	}
+	chain.Reverse(imported)
+
+	trusted := -1
+	if !checkpoint.Empty() {
+		for i, ts := range imported {
+			if ts.Key().Equals(checkpoint) {
+				trusted = i
+				break
+			}
+		}
+		if trusted < 0 {
+			if !checkpoint.Equals(base.Key()) {
+				return errors.Errorf("checkpoint %s is not in the imported chain", checkpoint)
+			}
+		} else if trusted == len(imported)-1 {
+			return errors.Errorf("checkpoint %s must be below the imported head", checkpoint)
+		}
+	}
+	if len(imported) == 0 {
+		return nil
+	}
+
+	parent := base
+	for i, ts := range imported {
+		for j := 0; j < ts.Len(); j++ {
+			if err := syncer.headerValidator.ValidateSemantic(ctx, ts.At(j), parent); err != nil {
+				return errors.Wrapf(err, "invalid header in imported tipset %s", ts.Key())
+			}
+		}
+
+		if i <= trusted {
+			// The state of a trusted tipset is the state its child claims.
+			child := imported[i+1].At(0)
+			err = syncer.chainStore.PutTipSetMetadata(ctx, &chain.TipSetMetadata{
+				TipSet:          ts,
+				TipSetStateRoot: child.StateRoot.Cid,
+				TipSetReceipts:  child.MessageReceipts.Cid,
+			})
+			if err != nil {
+				return err
+			}
+		} else {
+			_, grandParent, err := syncer.ancestorsFromStore(ts)
+			if err != nil {
+				return err
+			}
+			if err := syncer.syncOne(ctx, grandParent, parent, ts); err != nil {
+				return errors.Wrapf(err, "imported tipset %s at height %d failed validation", ts.Key(), ts.At(0).Height)
+			}
+		}
+
+		if i%500 == 0 {
+			logSyncer.Infof("validated imported tipset %d of %d", i, len(imported))
+		}
+		parent = ts
+	}
+	return nil
+}
@@ -225,6 +225,34 @@ func TestRejectFinalityFork(t *testing.T) {
 	assert.Error(t, s.HandleNewTipSet(ctx, block.NewChainInfo(peer.ID(""), "", forkFinalityHead.Key(), heightFromTip(t, forkFinalityHead)), false))
 }
 
+func TestRejectForkBeforeCheckpoint(t *testing.T) {
+	tf.UnitTest(t)
+	ctx := context.Background()
+	builder, store, syncer := setup(ctx, t)
+	genesis := builder.RequireTipSet(store.GetHead())
+
+	forkbase := builder.AppendOn(genesis, 1)
+	main1 := builder.AppendOn(forkbase, 1)
+	main2 := builder.AppendOn(main1, 1)
+	require.NoError(t, syncer.HandleNewTipSet(ctx, block.NewChainInfo(peer.ID(""), "", main2.Key(), heightFromTip(t, main2)), false))
+	require.NoError(t, syncer.SetStagedHead(ctx))
+	require.NoError(t, store.SetCheckpoint(ctx, main1.Key()))
+
+	// A heavier fork below the checkpoint is rejected.
+	fork1 := builder.AppendOn(forkbase, 3)
+	fork2 := builder.AppendOn(fork1, 1)
+	err := syncer.HandleNewTipSet(ctx, block.NewChainInfo(peer.ID(""), "", fork2.Key(), heightFromTip(t, fork2)), false)
+	assert.Equal(t, chain.ErrForkBeforeCheckpoint, errors.Cause(err))
+	require.NoError(t, syncer.SetStagedHead(ctx))
+	verifyHead(t, store, main2)
+
+	// A heavier fork above it is accepted.
+	above := builder.AppendOn(main1, 3)
+	assert.NoError(t, syncer.HandleNewTipSet(ctx, block.NewChainInfo(peer.ID(""), "", above.Key(), heightFromTip(t, above)), false))
+	require.NoError(t, syncer.SetStagedHead(ctx))
+	verifyHead(t, store, above)
+}
+
 func TestNoUncessesaryFetch(t *testing.T) {
 	tf.UnitTest(t)
 	ctx := context.Background()
@@ -537,6 +565,98 @@ func TestStoresMessageReceipts(t *testing.T) {
 	assert.Len(t, receipts, 4)
 }
 
+func TestValidateImport(t *testing.T) {
+	tf.UnitTest(t)
+	ctx := context.Background()
+	builder, store, syncer := setup(ctx, t)
+	genesis := builder.RequireTipSet(store.GetHead())
+
+	link1 := builder.AppendOn(genesis, 1)
+	link2 := builder.AppendOn(link1, 2)
+	link3 := builder.AppendOn(link2, 1)
+
+	require.NoError(t, syncer.ValidateImport(ctx, link3.Key(), block.TipSetKey{}, builder))
+	verifyTip(t, store, link1, builder.StateForKey(link1.Key()))
+	verifyTip(t, store, link2, builder.StateForKey(link2.Key()))
+	verifyTip(t, store, link3, builder.StateForKey(link3.Key()))
+
+	// Importing does not move the head.
+	verifyHead(t, store, genesis)
+}
+
+func TestValidateImportTrustsCheckpoint(t *testing.T) {
+	tf.UnitTest(t)
+	ctx := context.Background()
+	builder, store, syncer := setup(ctx, t)
+	genesis := builder.RequireTipSet(store.GetHead())
+
+	link1 := builder.AppendOn(genesis, 1)
+	link2 := builder.AppendOn(link1, 1)
+	link3 := builder.AppendOn(link2, 1)
+
+	require.NoError(t, syncer.ValidateImport(ctx, link3.Key(), link2.Key(), builder))
+	verifyTip(t, store, link1, link2.At(0).StateRoot.Cid)
+	verifyTip(t, store, link2, link3.At(0).StateRoot.Cid)
+	verifyTip(t, store, link3, builder.StateForKey(link3.Key()))
+
+	// The checkpoint must be part of the imported chain, below its head.
+	other := builder.AppendOn(genesis, 1)
+	assert.Error(t, syncer.ValidateImport(ctx, link3.Key(), other.Key(), builder))
+	link4 := builder.AppendOn(link3, 1)
+	assert.Error(t, syncer.ValidateImport(ctx, link4.Key(), link4.Key(), builder))
+}
+
+func TestValidateImportFailsOnBadTipSet(t *testing.T) {
+	tf.UnitTest(t)
+	ctx := context.Background()
+	eval := newPoisonValidator(t, 98, 99)
+	builder, store, syncer := setupWithValidator(ctx, t, eval, eval)
+	genesis := builder.RequireTipSet(store.GetHead())
+
+	link1 := builder.BuildOneOn(genesis, func(bb *chain.BlockBuilder) {
+		bb.SetTimestamp(99) // poison state transition
+	})
+	link2 := builder.AppendOn(link1, 1)
+
+	err := syncer.ValidateImport(ctx, link2.Key(), block.TipSetKey{}, builder)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), link1.Key().String())
+	assert.Contains(t, err.Error(), "run state transition fails")
+	assert.False(t, store.HasTipSetAndState(ctx, link1.Key()))
+	assert.False(t, store.HasTipSetAndState(ctx, link2.Key()))
+}
+
+func TestValidateBlock(t *testing.T) {
+	tf.UnitTest(t)
+	ctx := context.Background()
+	eval := newPoisonValidator(t, 98, 99)
+	builder, store, syncer := setupWithValidator(ctx, t, eval, eval)
+	genesis := builder.RequireTipSet(store.GetHead())
+
+	good := builder.AppendOn(genesis, 1)
+	require.NoError(t, syncer.ValidateBlock(ctx, good.At(0)))
+	// Validation does not store the block.
+	assert.False(t, store.HasTipSetAndState(ctx, good.Key()))
+
+	badHeader := builder.BuildOneOn(genesis, func(bb *chain.BlockBuilder) {
+		bb.SetTimestamp(98) // poison header val
+	})
+	err := syncer.ValidateBlock(ctx, badHeader.At(0))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "val semantic fails")
+
+	badState := builder.BuildOneOn(genesis, func(bb *chain.BlockBuilder) {
+		bb.SetTimestamp(99) // poison state transition
+	})
+	err = syncer.ValidateBlock(ctx, badState.At(0))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "run state transition fails")
+
+	// The parent must be in the store.
+	orphan := builder.AppendOn(good, 1)
+	assert.Error(t, syncer.ValidateBlock(ctx, orphan.At(0)))
+}
+
 ///// Set-up /////
 
 // Initializes a chain builder, store and syncer.
@@ -11,6 +11,7 @@ import (
 
 	"github.com/filecoin-project/go-address"
 	"github.com/filecoin-project/specs-actors/actors/abi"
+	"github.com/filecoin-project/specs-actors/actors/builtin/miner"
 	"github.com/pkg/errors"
 
 	"github.com/filecoin-project/go-filecoin/internal/pkg/types"
@@ -20,14 +21,17 @@ import (
 type Config struct {
 	API           *APIConfig           `json:"api"`
 	Bootstrap     *BootstrapConfig     `json:"bootstrap"`
+	Chain         *ChainConfig         `json:"chain"`
 	Datastore     *DatastoreConfig     `json:"datastore"`
 	Drand         *DrandConfig         `json:"drand"`
 	Heartbeat     *HeartbeatConfig     `json:"heartbeat"`
+	Message       *MessageConfig       `json:"message"`
 	Mining        *MiningConfig        `json:"mining"`
 	Mpool         *MessagePoolConfig   `json:"mpool"`
 	NetworkParams *NetworkParamsConfig `json:"parameters"`
 	Observability *ObservabilityConfig `json:"observability"`
 	SectorBase    *SectorBaseConfig    `json:"sectorbase"`
+	Slashing      *SlashingConfig      `json:"slashing"`
 	Swarm         *SwarmConfig         `json:"swarm"`
 	Wallet        *WalletConfig        `json:"wallet"`
 }
@@ -66,7 +70,9 @@ type DatastoreConfig struct {
 // the given key and value are valid. Validators will only be run if a property
 // being set matches the name given in this map.
 var Validators = map[string]func(string, string) error{
-	"heartbeat.nickname": validateLettersOnly,
+	"heartbeat.nickname":         validateLettersOnly,
+	"mining.messageSelection":    validateMessageSelection,
+	"chain.stateRetentionEpochs": validateStateRetention,
 }
 
 func newDefaultDatastoreConfig() *DatastoreConfig {
@@ -104,11 +110,32 @@ func newDefaultBootstrapConfig() *BootstrapConfig {
 	}
 }
 
+// ChainConfig holds all configuration options related to the chain store.
+type ChainConfig struct {
+	// StateRetentionEpochs is the number of most recent epochs for which the
+	// chain store keeps full state trees and message receipts. Older state is
+	// pruned while block headers and messages are kept. Zero disables pruning,
+	// and otherwise it must be at least the chain finality.
+	StateRetentionEpochs uint64 `json:"stateRetentionEpochs"`
+}
+
+func newDefaultChainConfig() *ChainConfig {
+	return &ChainConfig{
+		StateRetentionEpochs: 0,
+	}
+}
+
 // MiningConfig holds all configuration options related to mining.
 type MiningConfig struct {
 	MinerAddress            address.Address `json:"minerAddress"`
 	AutoSealIntervalSeconds uint            `json:"autoSealIntervalSeconds"`
 	StoragePrice            types.AttoFIL   `json:"storagePrice"`
+	// AdditionalMiners are miner actors the node mines blocks for alongside MinerAddress. Their
+	// worker keys must be in the node's wallet. Storage deals are served only by MinerAddress.
+	AdditionalMiners []address.Address `json:"additionalMiners"`
+	// MessageSelection is the policy for selecting messages to include in mined blocks, either
+	// "gas-reward" or "gas-price"
+	MessageSelection string `json:"messageSelection"`
 }
 
 func newDefaultMiningConfig() *MiningConfig {
@@ -116,6 +143,8 @@ func newDefaultMiningConfig() *MiningConfig {
 		MinerAddress:            address.Undef,
 		AutoSealIntervalSeconds: 120,
 		StoragePrice:            types.ZeroAttoFIL,
+		AdditionalMiners:        []address.Address{},
+		MessageSelection:        "gas-reward",
 	}
 }
 
@@ -231,24 +260,65 @@ func newDefaultTraceConfig() *TraceConfig {
 	}
 }
 
+// MessageConfig holds all configuration options related to sending messages.
+type MessageConfig struct {
+	// GasLimitMarginPercent is the margin, in percent, added to the gas used by a message when
+	// previewed to obtain an automatically estimated gas limit
+	GasLimitMarginPercent uint `json:"gasLimitMarginPercent"`
+	// GasPriceLookback is the number of recent tipsets whose messages are used to suggest a gas price
+	GasPriceLookback uint `json:"gasPriceLookback"`
+	// RebroadcastIntervalRounds is the number of rounds after which a message sent from this node
+	// that has not been mined is broadcast again, or zero to disable rebroadcasting
+	RebroadcastIntervalRounds uint `json:"rebroadcastIntervalRounds"`
+	// IndexHistory enables an index of the messages on chain by sender and recipient, maintained
+	// from the chain head at the time it is enabled onwards
+	IndexHistory bool `json:"indexHistory"`
+}
+
+func newDefaultMessageConfig() *MessageConfig {
+	return &MessageConfig{
+		GasLimitMarginPercent:     25,
+		GasPriceLookback:          20,
+		RebroadcastIntervalRounds: 3,
+		IndexHistory:              false,
+	}
+}
+
 // MessagePoolConfig holds all configuration options related to nodes message pool (mpool).
 type MessagePoolConfig struct {
 	// MaxPoolSize is the maximum number of pending messages will will allow in the message pool at any time
 	MaxPoolSize uint `json:"maxPoolSize"`
 	// MaxNonceGap is the maximum nonce of a message past the last received on chain
 	MaxNonceGap uint64 `json:"maxNonceGap"`
+	// MaxPendingPerSender is the maximum number of pending messages from a single sender
+	// received from the network that will be allowed in the message pool at any time
+	MaxPendingPerSender uint `json:"maxPendingPerSender"`
+	// ReplaceByFeePercent is how much higher, in percent, the gas price of a message must be
+	// than that of a pending message with the same sender and nonce in order to replace it
+	ReplaceByFeePercent uint `json:"replaceByFeePercent"`
 }
 
 func newDefaultMessagePoolConfig() *MessagePoolConfig {
 	return &MessagePoolConfig{
-		MaxPoolSize: 1000000,
-		MaxNonceGap: 100,
+		MaxPoolSize:         1000000,
+		MaxNonceGap:         100,
+		MaxPendingPerSender: 1000,
+		ReplaceByFeePercent: 25,
 	}
 }
 
 type NetworkParamsConfig struct {
 	ConsensusMinerMinPower uint64 // uint64 goes up to 18 EiB
 	ReplaceProofTypes      []int64
+	// ProtocolUpgrades schedules protocol versions in addition to those built in for the network,
+	// e.g. to exercise network upgrades. Only permitted on devnets and local networks.
+	ProtocolUpgrades []ProtocolUpgradeConfig
+}
+
+// ProtocolUpgradeConfig schedules a protocol version to come into effect at an epoch.
+type ProtocolUpgradeConfig struct {
+	Version     uint64
+	EffectiveAt abi.ChainEpoch
 }
 
 func newDefaultNetworkParamsConfig() *NetworkParamsConfig {
@@ -283,20 +353,40 @@ func newDefaultSectorbaseConfig() *SectorBaseConfig {
 	}
 }
 
+// SlashingConfig holds all configuration options related to reporting consensus faults.
+type SlashingConfig struct {
+	// ReportConsensusFaults enables reporting the consensus faults detected while syncing the
+	// chain, for which the reporter is rewarded.
+	ReportConsensusFaults bool `json:"reportConsensusFaults"`
+	// ReporterAddress is the address reports are sent from. If undefined, the wallet's default
+	// address is used.
+	ReporterAddress address.Address `json:"reporterAddress"`
+}
+
+func newDefaultSlashingConfig() *SlashingConfig {
+	return &SlashingConfig{
+		ReportConsensusFaults: false,
+		ReporterAddress:       address.Undef,
+	}
+}
+
 // NewDefaultConfig returns a config object with all the fields filled out to
 // their default values
 func NewDefaultConfig() *Config {
 	return &Config{
 		API:           newDefaultAPIConfig(),
 		Bootstrap:     newDefaultBootstrapConfig(),
+		Chain:         newDefaultChainConfig(),
 		Datastore:     newDefaultDatastoreConfig(),
 		Drand:         newDefaultDrandConfig(),
 		Heartbeat:     newDefaultHeartbeatConfig(),
+		Message:       newDefaultMessageConfig(),
 		Mining:        newDefaultMiningConfig(),
 		Mpool:         newDefaultMessagePoolConfig(),
 		NetworkParams: newDefaultNetworkParamsConfig(),
 		Observability: newDefaultObservabilityConfig(),
 		SectorBase:    newDefaultSectorbaseConfig(),
+		Slashing:      newDefaultSlashingConfig(),
 		Swarm:         newDefaultSwarmConfig(),
 		Wallet:        newDefaultWalletConfig(),
 	}
@@ -431,3 +521,30 @@ func validateLettersOnly(key string, value string) error {
 	}
 	return nil
 }
+
+// validateMessageSelection validates that a given value names a message selection policy.
+func validateMessageSelection(key string, value string) error {
+	if value != `"gas-reward"` && value != `"gas-price"` {
+		return errors.Errorf(`"%s" must be "gas-reward" or "gas-price"`, key)
+	}
+	return nil
+}
+
+// validateStateRetention validates that a given value disables state pruning or retains the
+// state of at least the epochs within chain finality.
+func validateStateRetention(key string, value string) error {
+	var epochs uint64
+	if err := json.Unmarshal([]byte(value), &epochs); err != nil {
+		return errors.Wrapf(err, `"%s" must be a number of epochs`, key)
+	}
+	return ValidateStateRetentionEpochs(epochs)
+}
+
+// ValidateStateRetentionEpochs returns an error unless `epochs` is zero, disabling state
+// pruning, or at least the chain finality, so that reorgs never need pruned state.
+func ValidateStateRetentionEpochs(epochs uint64) error {
+	if epochs > 0 && epochs < uint64(miner.ChainFinalityish) {
+		return errors.Errorf("state retention of %d epochs is less than the chain finality of %d epochs", epochs, miner.ChainFinalityish)
+	}
+	return nil
+}
@@ -65,6 +65,19 @@ func TestSetRejectsInvalidNicks(t *testing.T) {
 	assert.Error(t, err)
 }
 
+func TestSetRejectsShortStateRetention(t *testing.T) {
+	tf.UnitTest(t)
+
+	cfg := NewDefaultConfig()
+
+	assert.NoError(t, cfg.Set("chain.stateRetentionEpochs", "0"))
+	assert.NoError(t, cfg.Set("chain.stateRetentionEpochs", "2000"))
+	assert.Error(t, cfg.Set("chain.stateRetentionEpochs", "10"))
+	assert.Error(t, cfg.Set("chain", `{"stateRetentionEpochs": 10}`))
+	assert.Error(t, cfg.Set("chain.stateRetentionEpochs", `"many"`))
+	assert.Equal(t, uint64(2000), cfg.Chain.StateRetentionEpochs)
+}
+
 func TestConfigRoundtrip(t *testing.T) {
 	tf.UnitTest(t)
 
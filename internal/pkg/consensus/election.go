@@ -3,6 +3,7 @@ package consensus
 import (
 	"context"
 	"fmt"
+	gobig "math/big"
 
 	address "github.com/filecoin-project/go-address"
 	"github.com/filecoin-project/go-bitfield"
@@ -114,6 +115,22 @@ func (em ElectionMachine) IsWinner(challengeTicket []byte, minerPower, networkPo
 	return big.Cmp(lhs, rhs) < 0
 }
 
+// PowerShare returns the share of the `networkPower` held by a miner with `minerPower`, or zero
+// if the network has no power.
+func PowerShare(minerPower, networkPower abi.StoragePower) float64 {
+	if networkPower.LessThanEqual(big.Zero()) {
+		return 0
+	}
+	share, _ := new(gobig.Float).Quo(new(gobig.Float).SetInt(minerPower.Int), new(gobig.Float).SetInt(networkPower.Int)).Float64()
+	return share
+}
+
+// ExpectedWinRate returns the expected number of elections won per epoch by a miner with
+// `minerPower` of the `networkPower`.
+func ExpectedWinRate(minerPower, networkPower abi.StoragePower) float64 {
+	return PowerShare(minerPower, networkPower) * expectedLeadersPerEpoch
+}
+
 // VerifyWinningPoSt verifies a Winning PoSt proof.
 func (em ElectionMachine) VerifyWinningPoSt(ctx context.Context, ep EPoStVerifier, seedEntry *drand.Entry, epoch abi.ChainEpoch, proofs []block.PoStProof, mIDAddr address.Address, sectors SectorsStateView) (bool, error) {
 	if len(proofs) == 0 {
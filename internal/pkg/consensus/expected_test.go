@@ -297,3 +297,11 @@ func setTree(ctx context.Context, t *testing.T, kis []crypto.KeyInfo, cstore cbo
 	require.NoError(t, err)
 	return root, miners, m2w
 }
+
+func TestPowerShare(t *testing.T) {
+	tf.UnitTest(t)
+
+	assert.Equal(t, 0.25, consensus.PowerShare(fbig.NewInt(1), fbig.NewInt(4)))
+	assert.Equal(t, 0.0, consensus.PowerShare(fbig.NewInt(1), fbig.NewInt(0)))
+	assert.Equal(t, 1.25, consensus.ExpectedWinRate(fbig.NewInt(1), fbig.NewInt(4)))
+}
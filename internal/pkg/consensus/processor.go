@@ -9,6 +9,7 @@ import (
 
 	"github.com/filecoin-project/go-filecoin/internal/pkg/block"
 	"github.com/filecoin-project/go-filecoin/internal/pkg/metrics/tracing"
+	"github.com/filecoin-project/go-filecoin/internal/pkg/types"
 	"github.com/filecoin-project/go-filecoin/internal/pkg/vm"
 	"github.com/filecoin-project/go-filecoin/internal/pkg/vm/state"
 )
@@ -32,11 +33,19 @@ type ChainRandomness interface {
 	SampleChainRandomness(ctx context.Context, head block.TipSetKey, tag crypto.DomainSeparationTag, epoch abi.ChainEpoch, entropy []byte) (abi.Randomness, error)
 }
 
+// tipSetLoader loads tipsets, to find the epoch of a tipset's parent.
+type tipSetLoader interface {
+	GetTipSet(block.TipSetKey) (block.TipSet, error)
+}
+
 // DefaultProcessor handles all block processing.
 type DefaultProcessor struct {
 	actors   vm.ActorCodeLoader
 	syscalls vm.SyscallsImpl
 	rnd      ChainRandomness
+	// upgrades and the chain they are applied to, nil if the processor does not upgrade
+	upgrades *UpgradeSchedule
+	chain    tipSetLoader
 }
 
 var _ Processor = (*DefaultProcessor)(nil)
@@ -55,6 +64,15 @@ func NewConfiguredProcessor(actors vm.ActorCodeLoader, syscalls vm.SyscallsImpl,
 	}
 }
 
+// NewUpgradingProcessor creates a default processor applying the protocol upgrades in `upgrades`
+// as their versions come into effect in the tipsets it processes.
+func NewUpgradingProcessor(syscalls vm.SyscallsImpl, rnd ChainRandomness, chain tipSetLoader, upgrades *UpgradeSchedule) *DefaultProcessor {
+	p := NewDefaultProcessor(syscalls, rnd)
+	p.upgrades = upgrades
+	p.chain = chain
+	return p
+}
+
 // ProcessTipSet computes the state transition specified by the messages in all blocks in a TipSet.
 func (p *DefaultProcessor) ProcessTipSet(ctx context.Context, st state.Tree, vms vm.Storage, ts block.TipSet, msgs []vm.BlockMessagesInfo) (results []vm.MessageReceipt, err error) {
 	ctx, span := trace.StartSpan(ctx, "DefaultProcessor.ProcessTipSet")
@@ -71,17 +89,75 @@ func (p *DefaultProcessor) ProcessTipSet(ctx context.Context, st state.Tree, vms
 		return nil, err
 	}
 
+	if p.upgrades != nil {
+		parentTs, err := p.chain.GetTipSet(parent)
+		if err != nil {
+			return nil, err
+		}
+		parentEpoch, err := parentTs.Height()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.upgrades.Migrate(ctx, st, vms, parentEpoch, epoch); err != nil {
+			return nil, err
+		}
+	}
+
 	// Note: since the parent tipset key is now passed explicitly to ApplyTipSetMessages we can refactor to skip
 	// currying it in to the randomness call here.
 	rnd := headRandomness{
 		chain: p.rnd,
 		head:  parent,
 	}
-	v := vm.NewVM(st, &vms, p.syscalls)
+	v, err := p.newVM(st, vms, epoch)
+	if err != nil {
+		return nil, err
+	}
 
 	return v.ApplyTipSetMessages(msgs, parent, epoch, &rnd)
 }
 
+// PreviewMessage applies a single message to the state `st` as if included in a block on top of
+// `head`, after any upgrade migration scheduled for that block's epoch, and returns its receipt.
+// The resulting state is not committed.
+func (p *DefaultProcessor) PreviewMessage(ctx context.Context, st state.Tree, vms vm.Storage, head block.TipSet, msg *types.UnsignedMessage) (receipt vm.MessageReceipt, err error) {
+	ctx, span := trace.StartSpan(ctx, "DefaultProcessor.PreviewMessage")
+	defer tracing.AddErrorEndSpan(ctx, span, &err)
+
+	height, err := head.Height()
+	if err != nil {
+		return vm.MessageReceipt{}, err
+	}
+	if p.upgrades != nil {
+		if err := p.upgrades.Migrate(ctx, st, vms, height, height+1); err != nil {
+			return vm.MessageReceipt{}, err
+		}
+	}
+
+	rnd := headRandomness{
+		chain: p.rnd,
+		head:  head.Key(),
+	}
+	v, err := p.newVM(st, vms, height+1)
+	if err != nil {
+		return vm.MessageReceipt{}, err
+	}
+
+	return v.ApplyMessage(msg, msg.OnChainLen(), head.Key(), height+1, &rnd), nil
+}
+
+// newVM creates a VM executing the actor code and charging the gas prices in effect at `epoch`.
+func (p *DefaultProcessor) newVM(st state.Tree, vms vm.Storage, epoch abi.ChainEpoch) (vm.Interpreter, error) {
+	if p.upgrades == nil {
+		return vm.NewConfiguredVM(p.actors, vm.PricelistByEpoch, st, &vms, p.syscalls), nil
+	}
+	actors, err := p.upgrades.Actors(p.actors, epoch)
+	if err != nil {
+		return nil, err
+	}
+	return vm.NewConfiguredVM(actors, p.upgrades.Pricelists, st, &vms, p.syscalls), nil
+}
+
 // A chain randomness source with a fixed head tipset key.
 type headRandomness struct {
 	chain ChainRandomness
@@ -0,0 +1,114 @@
+package consensus
+
+import (
+	"context"
+	"sort"
+
+	"github.com/filecoin-project/specs-actors/actors/abi"
+	"github.com/ipfs/go-cid"
+	"github.com/pkg/errors"
+
+	"github.com/filecoin-project/go-filecoin/internal/pkg/version"
+	"github.com/filecoin-project/go-filecoin/internal/pkg/vm"
+	"github.com/filecoin-project/go-filecoin/internal/pkg/vm/state"
+)
+
+// StateMigration transforms the state tree when a protocol version comes into effect, before
+// the messages of the first tipset at or after the version's activation epoch are applied.
+type StateMigration func(ctx context.Context, st state.Tree, vms vm.Storage, epoch abi.ChainEpoch) error
+
+// ProtocolUpgrade describes the changes to the protocol that come into effect with a protocol
+// version. All fields are optional.
+type ProtocolUpgrade struct {
+	// Migration is run once, at the version's activation.
+	Migration StateMigration
+	// Actors replaces or adds actor code, by code cid, from the version on.
+	Actors map[cid.Cid]vm.ActorImpl
+	// Pricelist replaces the gas prices from the version on.
+	Pricelist vm.Pricelist
+}
+
+// DefaultUpgrades are the protocol upgrades that ship with Filecoin, indexed by the protocol
+// version bringing them into effect. The epoch at which each version comes into effect on a
+// network is configured in the network's protocol version table.
+var DefaultUpgrades = map[uint64]ProtocolUpgrade{}
+
+// UpgradeSchedule applies protocol upgrades at the epochs their versions come into effect.
+type UpgradeSchedule struct {
+	versions *version.ProtocolVersionTable
+	upgrades map[uint64]ProtocolUpgrade
+	// upgraded versions, in increasing order
+	ordered []uint64
+}
+
+// NewUpgradeSchedule creates a schedule applying `upgrades` when their versions come into effect
+// according to `versions`.
+func NewUpgradeSchedule(versions *version.ProtocolVersionTable, upgrades map[uint64]ProtocolUpgrade) *UpgradeSchedule {
+	ordered := make([]uint64, 0, len(upgrades))
+	for v := range upgrades {
+		ordered = append(ordered, v)
+	}
+	sort.Slice(ordered, func(i, j int) bool { return ordered[i] < ordered[j] })
+
+	return &UpgradeSchedule{
+		versions: versions,
+		upgrades: upgrades,
+		ordered:  ordered,
+	}
+}
+
+// Migrate runs the state migrations of the versions which come into effect after the parent
+// epoch and at or before the epoch of a tipset, in version order.
+func (s *UpgradeSchedule) Migrate(ctx context.Context, st state.Tree, vms vm.Storage, parentEpoch, epoch abi.ChainEpoch) error {
+	for _, v := range s.versions.VersionsActivatedBetween(parentEpoch, epoch) {
+		upgrade, ok := s.upgrades[v]
+		if !ok || upgrade.Migration == nil {
+			continue
+		}
+		if err := upgrade.Migration(ctx, st, vms, epoch); err != nil {
+			return errors.Wrapf(err, "failed to migrate state to protocol version %d", v)
+		}
+	}
+	return nil
+}
+
+// Actors returns the actor code in effect at an epoch: `base` with the actor code swapped in by
+// each version in effect.
+func (s *UpgradeSchedule) Actors(base vm.ActorCodeLoader, epoch abi.ChainEpoch) (vm.ActorCodeLoader, error) {
+	current, err := s.versions.VersionAt(epoch)
+	if err != nil {
+		return vm.ActorCodeLoader{}, err
+	}
+	actors := base
+	for _, v := range s.ordered {
+		if v > current {
+			break
+		}
+		for code, impl := range s.upgrades[v].Actors {
+			actors = actors.With(code, impl)
+		}
+	}
+	return actors, nil
+}
+
+// Pricelists selects the gas prices in effect at an epoch: those of the latest version in
+// effect that changes prices, or the built-in prices if none does.
+func (s *UpgradeSchedule) Pricelists(epoch abi.ChainEpoch) vm.Pricelist {
+	current, err := s.versions.VersionAt(epoch)
+	if err != nil {
+		return vm.PricelistByEpoch(epoch)
+	}
+	var prices vm.Pricelist
+	for _, v := range s.ordered {
+		if v > current {
+			break
+		}
+		if upgrade := s.upgrades[v]; upgrade.Pricelist != nil {
+			prices = upgrade.Pricelist
+		}
+	}
+	if prices == nil {
+		return vm.PricelistByEpoch(epoch)
+	}
+	return prices
+}
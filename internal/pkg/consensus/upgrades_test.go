@@ -0,0 +1,253 @@
+package consensus_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/specs-actors/actors/abi"
+	"github.com/filecoin-project/specs-actors/actors/builtin"
+	"github.com/filecoin-project/specs-actors/actors/builtin/reward"
+	"github.com/filecoin-project/specs-actors/actors/runtime"
+	"github.com/filecoin-project/specs-actors/actors/util/adt"
+	"github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/internal/pkg/block"
+	"github.com/filecoin-project/go-filecoin/internal/pkg/consensus"
+	tf "github.com/filecoin-project/go-filecoin/internal/pkg/testhelpers/testflags"
+	"github.com/filecoin-project/go-filecoin/internal/pkg/types"
+	"github.com/filecoin-project/go-filecoin/internal/pkg/version"
+	"github.com/filecoin-project/go-filecoin/internal/pkg/vm"
+	"github.com/filecoin-project/go-filecoin/internal/pkg/vm/gas"
+	"github.com/filecoin-project/go-filecoin/internal/pkg/vm/state"
+	gengen "github.com/filecoin-project/go-filecoin/tools/gengen/util"
+)
+
+type fakeActor struct{}
+
+func (fakeActor) Exports() []interface{} { return nil }
+
+type fakePricelist struct {
+	vm.Pricelist
+}
+
+// countingPricelist counts the method invocations it prices.
+type countingPricelist struct {
+	vm.Pricelist
+	invocations *int
+}
+
+func (p *countingPricelist) OnMethodInvocation(value abi.TokenAmount, methodNum abi.MethodNum) gas.Unit {
+	*p.invocations++
+	return p.Pricelist.OnMethodInvocation(value, methodNum)
+}
+
+// epochTickActor replaces the cron actor, recording the epochs it is ticked at.
+type epochTickActor struct {
+	ticks *[]abi.ChainEpoch
+}
+
+func (a epochTickActor) Exports() []interface{} {
+	exports := make([]interface{}, builtin.MethodsCron.EpochTick+1)
+	exports[builtin.MethodsCron.EpochTick] = a.EpochTick
+	return exports
+}
+
+func (a epochTickActor) EpochTick(rt runtime.Runtime, _ *adt.EmptyValue) *adt.EmptyValue {
+	rt.ValidateImmediateCallerAcceptAny()
+	*a.ticks = append(*a.ticks, rt.CurrEpoch())
+	return nil
+}
+
+// blockRewardActor replaces the reward actor, paying no rewards.
+type blockRewardActor struct{}
+
+func (a blockRewardActor) Exports() []interface{} {
+	exports := make([]interface{}, builtin.MethodsReward.AwardBlockReward+1)
+	exports[builtin.MethodsReward.AwardBlockReward] = a.AwardBlockReward
+	return exports
+}
+
+func (blockRewardActor) AwardBlockReward(rt runtime.Runtime, _ *reward.AwardBlockRewardParams) *adt.EmptyValue {
+	rt.ValidateImmediateCallerAcceptAny()
+	return nil
+}
+
+type fakeTipSetLoader []block.TipSet
+
+func (l fakeTipSetLoader) GetTipSet(key block.TipSetKey) (block.TipSet, error) {
+	for _, ts := range l {
+		if ts.Key().Equals(key) {
+			return ts, nil
+		}
+	}
+	return block.UndefTipSet, errors.New("tipset not found")
+}
+
+func TestUpgradeSchedule(t *testing.T) {
+	tf.UnitTest(t)
+	ctx := context.Background()
+
+	versions, err := version.NewProtocolVersionTableBuilder(version.TEST).
+		Add(version.TEST, 0, abi.ChainEpoch(0)).
+		Add(version.TEST, 1, abi.ChainEpoch(10)).
+		Add(version.TEST, 2, abi.ChainEpoch(20)).
+		Build()
+	require.NoError(t, err)
+
+	var migrated []abi.ChainEpoch
+	newCode := types.NewCidForTestGetter()()
+	prices := &fakePricelist{vm.PricelistByEpoch(0)}
+	schedule := consensus.NewUpgradeSchedule(versions, map[uint64]consensus.ProtocolUpgrade{
+		1: {
+			Migration: func(_ context.Context, _ state.Tree, _ vm.Storage, epoch abi.ChainEpoch) error {
+				migrated = append(migrated, epoch)
+				return nil
+			},
+			Actors: map[cid.Cid]vm.ActorImpl{newCode: fakeActor{}},
+		},
+		2: {Pricelist: prices},
+	})
+
+	t.Run("migrates state once at activation", func(t *testing.T) {
+		require.NoError(t, schedule.Migrate(ctx, nil, vm.Storage{}, 5, 9))
+		assert.Empty(t, migrated)
+
+		// The activation epoch is a null round.
+		require.NoError(t, schedule.Migrate(ctx, nil, vm.Storage{}, 8, 12))
+		assert.Equal(t, []abi.ChainEpoch{12}, migrated)
+
+		require.NoError(t, schedule.Migrate(ctx, nil, vm.Storage{}, 12, 13))
+		assert.Len(t, migrated, 1)
+	})
+
+	t.Run("swaps actor code", func(t *testing.T) {
+		actors, err := schedule.Actors(vm.DefaultActors, 9)
+		require.NoError(t, err)
+		_, err = actors.GetActorImpl(newCode)
+		assert.Error(t, err)
+
+		actors, err = schedule.Actors(vm.DefaultActors, 10)
+		require.NoError(t, err)
+		_, err = actors.GetActorImpl(newCode)
+		assert.NoError(t, err)
+
+		// The base code is not changed.
+		_, err = vm.DefaultActors.GetActorImpl(newCode)
+		assert.Error(t, err)
+	})
+
+	t.Run("changes prices", func(t *testing.T) {
+		assert.Equal(t, vm.PricelistByEpoch(19), schedule.Pricelists(19))
+		assert.Equal(t, prices, schedule.Pricelists(20))
+		assert.Equal(t, prices, schedule.Pricelists(100))
+	})
+}
+
+func TestProcessTipSetUpgrades(t *testing.T) {
+	tf.UnitTest(t)
+	ctx := context.Background()
+
+	cst, bs := setupCborBlockstore()
+	genesis, err := gengen.DefaultGenesis(cst, bs)
+	require.NoError(t, err)
+	genTs := block.RequireNewTipSet(t, genesis)
+
+	versions, err := version.NewProtocolVersionTableBuilder(version.TEST).
+		Add(version.TEST, 0, abi.ChainEpoch(0)).
+		Add(version.TEST, 1, abi.ChainEpoch(10)).
+		Build()
+	require.NoError(t, err)
+
+	var migrated, ticks []abi.ChainEpoch
+	invocations := 0
+	schedule := consensus.NewUpgradeSchedule(versions, map[uint64]consensus.ProtocolUpgrade{
+		1: {
+			Migration: func(_ context.Context, _ state.Tree, _ vm.Storage, epoch abi.ChainEpoch) error {
+				migrated = append(migrated, epoch)
+				return nil
+			},
+			Actors: map[cid.Cid]vm.ActorImpl{
+				builtin.CronActorCodeID:   epochTickActor{ticks: &ticks},
+				builtin.RewardActorCodeID: blockRewardActor{},
+			},
+			Pricelist: &countingPricelist{Pricelist: vm.PricelistByEpoch(0), invocations: &invocations},
+		},
+	})
+
+	miner, err := address.NewIDAddress(1000)
+	require.NoError(t, err)
+	// The activation epoch follows null rounds.
+	activationTs := block.RequireNewTipSet(t, &block.Block{Miner: miner, Height: 10, Parents: genTs.Key()})
+	nextTs := block.RequireNewTipSet(t, &block.Block{Miner: miner, Height: 11, Parents: activationTs.Key()})
+	chain := fakeTipSetLoader{genTs, activationTs}
+	processor := consensus.NewUpgradingProcessor(&vm.FakeSyscalls{}, &consensus.FakeChainRandomness{}, chain, schedule)
+
+	st, err := state.LoadState(ctx, cst, genesis.StateRoot.Cid)
+	require.NoError(t, err)
+	vms := vm.NewStorage(bs)
+	msgs := []vm.BlockMessagesInfo{{Miner: miner}}
+
+	_, err = processor.ProcessTipSet(ctx, st, vms, activationTs, msgs)
+	require.NoError(t, err)
+	assert.Equal(t, []abi.ChainEpoch{10}, migrated)
+	assert.Equal(t, []abi.ChainEpoch{10}, ticks)
+	assert.NotZero(t, invocations)
+
+	invocations = 0
+	_, err = processor.ProcessTipSet(ctx, st, vms, nextTs, msgs)
+	require.NoError(t, err)
+	assert.Equal(t, []abi.ChainEpoch{10}, migrated)
+	assert.Equal(t, []abi.ChainEpoch{10, 11}, ticks)
+	assert.NotZero(t, invocations)
+}
+
+func TestPreviewMessageUpgrades(t *testing.T) {
+	tf.UnitTest(t)
+	ctx := context.Background()
+
+	cst, bs := setupCborBlockstore()
+	genesis, err := gengen.DefaultGenesis(cst, bs)
+	require.NoError(t, err)
+	genTs := block.RequireNewTipSet(t, genesis)
+
+	versions, err := version.NewProtocolVersionTableBuilder(version.TEST).
+		Add(version.TEST, 0, abi.ChainEpoch(0)).
+		Add(version.TEST, 1, abi.ChainEpoch(10)).
+		Build()
+	require.NoError(t, err)
+
+	var migrated []abi.ChainEpoch
+	schedule := consensus.NewUpgradeSchedule(versions, map[uint64]consensus.ProtocolUpgrade{
+		1: {
+			Migration: func(_ context.Context, _ state.Tree, _ vm.Storage, epoch abi.ChainEpoch) error {
+				migrated = append(migrated, epoch)
+				return nil
+			},
+		},
+	})
+
+	miner, err := address.NewIDAddress(1000)
+	require.NoError(t, err)
+	preActivationTs := block.RequireNewTipSet(t, &block.Block{Miner: miner, Height: 9, Parents: genTs.Key()})
+	activationTs := block.RequireNewTipSet(t, &block.Block{Miner: miner, Height: 10, Parents: preActivationTs.Key()})
+	chain := fakeTipSetLoader{genTs, preActivationTs, activationTs}
+	processor := consensus.NewUpgradingProcessor(&vm.FakeSyscalls{}, &consensus.FakeChainRandomness{}, chain, schedule)
+
+	st, err := state.LoadState(ctx, cst, genesis.StateRoot.Cid)
+	require.NoError(t, err)
+	vms := vm.NewStorage(bs)
+	msg := types.NewMeteredMessage(miner, miner, 0, types.ZeroAttoFIL, builtin.MethodSend, nil, types.NewGasPrice(1), gas.NewGas(1000))
+
+	// A message previewed on the tipset before the activation epoch runs after the migration.
+	_, err = processor.PreviewMessage(ctx, st, vms, preActivationTs, msg)
+	require.NoError(t, err)
+	assert.Equal(t, []abi.ChainEpoch{10}, migrated)
+
+	_, err = processor.PreviewMessage(ctx, st, vms, activationTs, msg)
+	require.NoError(t, err)
+	assert.Equal(t, []abi.ChainEpoch{10}, migrated)
+}
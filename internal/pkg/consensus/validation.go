@@ -77,48 +77,88 @@ func NewMessagePenaltyChecker(api penaltyCheckerAPI) *MessagePenaltyChecker {
 // PenaltyCheck checks that a message is semantically valid for processing without
 // causing miner penality.  It treats any miner penalty condition as an error.
 func (v *MessagePenaltyChecker) PenaltyCheck(ctx context.Context, msg *types.UnsignedMessage) error {
-	fromActor, err := v.api.GetActorAt(ctx, v.api.Head(), msg.From)
+	return v.PenaltyCheckBlock(ctx, v.api.Head(), []*types.UnsignedMessage{msg})[0]
+}
+
+// PenaltyCheckBlock checks messages to be included together in a block on `base`, against the
+// state of that tipset, in the order they will be processed. Each sender's messages must have consecutive nonces starting at the sender's
+// nonce, and are checked against the balance left after the gas and value of its earlier
+// messages. It returns an error for each message, nil if the message passes. Once a message
+// fails, the later messages from its sender fail too, except that messages with nonces lower
+// than the sender's are obsolete and skipped.
+func (v *MessagePenaltyChecker) PenaltyCheckBlock(ctx context.Context, base block.TipSetKey, msgs []*types.UnsignedMessage) []error {
+	senders := make(map[address.Address]*penaltySender)
+	errs := make([]error, len(msgs))
+	for i, msg := range msgs {
+		sender, ok := senders[msg.From]
+		if !ok {
+			sender = v.loadSender(ctx, base, msg)
+			senders[msg.From] = sender
+		}
+		if sender.err != nil {
+			errs[i] = sender.err
+			continue
+		}
+
+		if msg.CallSeqNum < sender.nonce {
+			dropNonceTooLowCt.Inc(ctx, 1)
+			errs[i] = fmt.Errorf("nonce %d lower than expected %d: %s", msg.CallSeqNum, sender.nonce, msg)
+			continue
+		}
+		if msg.CallSeqNum > sender.nonce {
+			dropNonceTooHighCt.Inc(ctx, 1)
+			errs[i] = fmt.Errorf("nonce %d greater than expected: %d: %s", msg.CallSeqNum, sender.nonce, msg)
+			sender.err = errors.Wrapf(errs[i], "earlier message from %s excluded", msg.From)
+			continue
+		}
+
+		// Avoid processing messages for actors that cannot pay.
+		expense := messageExpense(msg)
+		if sender.balance.LessThan(expense) {
+			dropInsufficientGasCt.Inc(ctx, 1)
+			errs[i] = fmt.Errorf("insufficient funds from sender %s to cover value and gas cost: %s ", msg.From, msg)
+			sender.err = errors.Wrapf(errs[i], "earlier message from %s excluded", msg.From)
+			continue
+		}
+		sender.nonce++
+		sender.balance = big.Sub(sender.balance, expense)
+	}
+	return errs
+}
+
+// penaltySender tracks the nonce and balance of a sender through its messages in a block.
+type penaltySender struct {
+	nonce   uint64
+	balance abi.TokenAmount
+	// err is the reason the sender's remaining messages are excluded, if any
+	err error
+}
+
+func (v *MessagePenaltyChecker) loadSender(ctx context.Context, head block.TipSetKey, msg *types.UnsignedMessage) *penaltySender {
+	fromActor, err := v.api.GetActorAt(ctx, head, msg.From)
 	if err != nil {
-		return err
+		return &penaltySender{err: err}
 	}
 	// Sender should not be an empty actor
 	if fromActor == nil || fromActor.Empty() {
-		return fmt.Errorf("sender %s is missing/empty: %s", msg.From, msg)
+		return &penaltySender{err: fmt.Errorf("sender %s is missing/empty: %s", msg.From, msg)}
 	}
 
 	// Sender must be an account actor.
 	if !(builtin.AccountActorCodeID.Equals(fromActor.Code.Cid)) {
 		dropNonAccountCt.Inc(ctx, 1)
-		return fmt.Errorf("sender %s is non-account actor with code %s: %s", msg.From, fromActor.Code.Cid, msg)
+		return &penaltySender{err: fmt.Errorf("sender %s is non-account actor with code %s: %s", msg.From, fromActor.Code.Cid, msg)}
 	}
-
-	// Avoid processing messages for actors that cannot pay.
-	if !canCoverGasLimit(msg, fromActor) {
-		dropInsufficientGasCt.Inc(ctx, 1)
-		return fmt.Errorf("insufficient funds from sender %s to cover value and gas cost: %s ", msg.From, msg)
-	}
-
-	if msg.CallSeqNum < fromActor.CallSeqNum {
-		dropNonceTooLowCt.Inc(ctx, 1)
-		return fmt.Errorf("nonce %d lower than expected %d: %s", msg.CallSeqNum, fromActor.CallSeqNum, msg)
-	}
-
-	if msg.CallSeqNum > fromActor.CallSeqNum {
-		dropNonceTooHighCt.Inc(ctx, 1)
-		return fmt.Errorf("nonce %d greater than expected: %d: %s", msg.CallSeqNum, fromActor.CallSeqNum, msg)
-	}
-
-	return nil
+	return &penaltySender{nonce: fromActor.CallSeqNum, balance: fromActor.Balance}
 }
 
-// Check's whether the maximum gas charge + message value is within the actor's balance.
-// Note that this is an imperfect test, since nested messages invoked by this one may transfer
-// more value from the actor's balance.
-func canCoverGasLimit(msg *types.UnsignedMessage, actor *actor.Actor) bool {
-	// balance >= (gasprice*gasLimit + value)
+// messageExpense is the maximum gas charge plus the value of a message.
+// Note that this is an imperfect measure of the cost to the sender, since nested messages
+// invoked by this one may transfer more value from the actor's balance.
+func messageExpense(msg *types.UnsignedMessage) abi.TokenAmount {
+	// gasprice*gasLimit + value
 	gascost := big.Mul(abi.NewTokenAmount(msg.GasPrice.Int.Int64()), abi.NewTokenAmount(int64(msg.GasLimit)))
-	expense := big.Add(gascost, abi.NewTokenAmount(msg.Value.Int.Int64()))
-	return actor.Balance.GreaterThanEqual(expense)
+	return big.Add(gascost, abi.NewTokenAmount(msg.Value.Int.Int64()))
 }
 
 // DefaultMessageSyntaxValidator checks basic conditions independent of current state
@@ -82,6 +82,32 @@ func TestMessagePenaltyChecker(t *testing.T) {
 		msg := newMessage(t, alice, bob, 101, 5, 1, 0)
 		assert.Errorf(t, checker.PenaltyCheck(ctx, msg), "too high")
 	})
+
+	t.Run("chained nonces in block", func(t *testing.T) {
+		errs := checker.PenaltyCheckBlock(ctx, api.Head(), []*types.UnsignedMessage{
+			newMessage(t, alice, bob, 99, 5, 1, 0),
+			newMessage(t, alice, bob, 100, 5, 1, 0),
+			newMessage(t, alice, bob, 101, 5, 1, 0),
+			newMessage(t, alice, bob, 103, 5, 1, 0),
+			newMessage(t, alice, bob, 104, 5, 1, 0),
+		})
+		require.Len(t, errs, 5)
+		assert.Error(t, errs[0])
+		assert.NoError(t, errs[1])
+		assert.NoError(t, errs[2])
+		assert.Error(t, errs[3])
+		// Messages following an excluded one are excluded too.
+		assert.Error(t, errs[4])
+	})
+
+	t.Run("chained messages spend balance", func(t *testing.T) {
+		errs := checker.PenaltyCheckBlock(ctx, api.Head(), []*types.UnsignedMessage{
+			newMessage(t, alice, bob, 100, 600, 1, 0),
+			newMessage(t, alice, bob, 101, 600, 1, 0),
+		})
+		assert.NoError(t, errs[0])
+		assert.Error(t, errs[1])
+	})
 }
 
 func TestBLSSignatureValidationConfiguration(t *testing.T) {
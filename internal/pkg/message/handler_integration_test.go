@@ -41,7 +41,7 @@ func TestNewHeadHandlerIntegration(t *testing.T) {
 	gasPrice := types.NewGasPrice(1)
 	gasUnits := gas.NewGas(1000)
 
-	makeHandler := func(provider *message.FakeProvider, root block.TipSet) *message.HeadHandler {
+	makeHandler := func(provider *message.FakeProvider) *message.HeadHandler {
 		mpool := message.NewPool(config.NewDefaultConfig().Mpool, th.NewMockMessagePoolValidator())
 		inbox := message.NewInbox(mpool, maxAge, provider, provider)
 		queue := message.NewQueue()
@@ -50,7 +50,7 @@ func TestNewHeadHandlerIntegration(t *testing.T) {
 		outbox := message.NewOutbox(signer, &message.FakeValidator{}, queue, publisher, policy,
 			provider, provider, objournal)
 
-		return message.NewHeadHandler(inbox, outbox, provider, root)
+		return message.NewHeadHandler(inbox, outbox)
 	}
 
 	t.Run("test send after reverted message", func(t *testing.T) {
@@ -60,7 +60,7 @@ func TestNewHeadHandlerIntegration(t *testing.T) {
 		actr.CallSeqNum = 42
 		provider.SetHeadAndActor(t, root.Key(), sender, actr)
 
-		handler := makeHandler(provider, root)
+		handler := makeHandler(provider)
 		outbox := handler.Outbox
 		inbox := handler.Inbox
 
@@ -79,7 +79,7 @@ func TestNewHeadHandlerIntegration(t *testing.T) {
 		left := provider.BuildOneOn(root, func(b *chain.BlockBuilder) {
 			b.AddMessages([]*types.SignedMessage{msg1}, []*types.UnsignedMessage{})
 		})
-		require.NoError(t, handler.HandleNewHead(ctx, left))
+		require.NoError(t, handler.HandleHeadChange(ctx, chain.HeadChange{Apply: []block.TipSet{left}}))
 		assert.Equal(t, 0, len(outbox.Queue().List(sender))) // Gone from queue.
 		_, found = inbox.Pool().Get(mid1)
 		assert.False(t, found) // Gone from pool.
@@ -88,7 +88,10 @@ func TestNewHeadHandlerIntegration(t *testing.T) {
 		right := provider.BuildOneOn(root, func(b *chain.BlockBuilder) {
 			// No messages.
 		})
-		require.NoError(t, handler.HandleNewHead(ctx, right))
+		require.NoError(t, handler.HandleHeadChange(ctx, chain.HeadChange{
+			Revert: []block.TipSet{left},
+			Apply:  []block.TipSet{right},
+		}))
 		assert.Equal(t, 1, len(outbox.Queue().List(sender))) // Message returns to queue.
 		_, found = inbox.Pool().Get(mid1)
 		assert.True(t, found) // Message returns to pool to be mined again.
@@ -116,23 +119,13 @@ func TestNewHeadHandlerIntegration(t *testing.T) {
 		assert.True(t, msg2.Equals(restoredQueue[1].Msg))
 	})
 
-	t.Run("ignores empty tipset", func(t *testing.T) {
+	t.Run("ignores empty change", func(t *testing.T) {
 		provider := message.NewFakeProvider(t)
 		root := provider.NewGenesis()
 		provider.SetHead(root.Key())
 
-		handler := makeHandler(provider, root)
-		err := handler.HandleNewHead(ctx, block.UndefTipSet)
-		assert.NoError(t, err)
-	})
-
-	t.Run("ignores duplicate tipset", func(t *testing.T) {
-		provider := message.NewFakeProvider(t)
-		root := provider.NewGenesis()
-		provider.SetHead(root.Key())
-
-		handler := makeHandler(provider, root)
-		err := handler.HandleNewHead(ctx, root)
+		handler := makeHandler(provider)
+		err := handler.HandleHeadChange(ctx, chain.HeadChange{})
 		assert.NoError(t, err)
 	})
 }
@@ -0,0 +1,492 @@
+package message
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/specs-actors/actors/abi"
+	"github.com/filecoin-project/specs-actors/actors/runtime/exitcode"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	"github.com/pkg/errors"
+
+	"github.com/filecoin-project/go-filecoin/internal/pkg/block"
+	"github.com/filecoin-project/go-filecoin/internal/pkg/chain"
+	e "github.com/filecoin-project/go-filecoin/internal/pkg/enccid"
+	"github.com/filecoin-project/go-filecoin/internal/pkg/encoding"
+)
+
+// IndexPrefix is the datastore namespace under which an Indexer writes its index.
+var IndexPrefix = datastore.NewKey("/message/index")
+
+// indexHeadKey is the key at which the key of the last indexed tipset is written.
+var indexHeadKey = IndexPrefix.ChildString("head")
+
+var (
+	indexFromPrefix = IndexPrefix.ChildString("from")
+	indexToPrefix   = IndexPrefix.ChildString("to")
+)
+
+// indexBatchSize is the maximum number of tipsets indexed or removed from the index in one
+// datastore batch.
+const indexBatchSize = 100
+
+// Abstracts over a store of blockchain state.
+type indexChainReader interface {
+	GetHead() block.TipSetKey
+	GetTipSet(block.TipSetKey) (block.TipSet, error)
+	GetTipSetReceiptsRoot(block.TipSetKey) (cid.Cid, error)
+}
+
+// IndexedMessage is a message on chain, as recorded by an Indexer.
+type IndexedMessage struct {
+	// CID of the message as included in a block: the signed message for secp messages and the
+	// unsigned message for BLS messages
+	Cid   cid.Cid
+	From  address.Address
+	To    address.Address
+	Epoch abi.ChainEpoch
+	// Exit code of the message's receipt
+	ExitCode exitcode.ExitCode
+}
+
+// indexRecord is the persisted form of an indexed message.
+type indexRecord struct {
+	// control field for encoding struct as an array
+	_        struct{} `cbor:",toarray"`
+	Cid      e.Cid
+	From     address.Address
+	To       address.Address
+	Epoch    abi.ChainEpoch
+	ExitCode exitcode.ExitCode
+}
+
+// Indexer maintains an index of the messages on chain by sender and recipient.
+// The index follows the chain head, removing the messages of reverted tipsets and adding those of
+// applied tipsets. Indexing starts at the head when the indexer is first started; messages in
+// earlier tipsets are not indexed.
+//
+// The index is updated in the background, in batches of at most indexBatchSize tipsets, so it may
+// lag behind the chain head.
+type Indexer struct {
+	chain    indexChainReader
+	messages chain.MessageProvider
+	ds       datastore.Batching
+
+	// wake is signalled when the target changes.
+	wake chan struct{}
+
+	// Protects target, done, err and updated.
+	lk sync.Mutex
+	// target is the latest head to index.
+	target block.TipSet
+	// done is the last head the index was updated to, or failed to be.
+	done block.TipSet
+	// err is the error of the last update, if it failed.
+	err error
+	// updated is closed, and replaced, when an update finishes.
+	updated chan struct{}
+}
+
+// NewIndexer constructs an indexer persisting its index in `ds`.
+func NewIndexer(chainReader indexChainReader, messages chain.MessageProvider, ds datastore.Batching) *Indexer {
+	return &Indexer{
+		chain:    chainReader,
+		messages: messages,
+		ds:       ds,
+		wake:     make(chan struct{}, 1),
+		updated:  make(chan struct{}),
+	}
+}
+
+// Start starts indexing in the background until ctx is done, first bringing the index up to date
+// with the current chain head by indexing any tipsets applied while the node was not running.
+func (ix *Indexer) Start(ctx context.Context) error {
+	head, err := ix.chain.GetTipSet(ix.chain.GetHead())
+	if err != nil {
+		return errors.Wrap(err, "failed to load chain head")
+	}
+	ix.setTarget(head)
+	go ix.run(ctx)
+	return nil
+}
+
+// HandleHeadChange schedules the index to be updated to the new head of a chain head change. It
+// does not wait for the update.
+func (ix *Indexer) HandleHeadChange(ctx context.Context, change chain.HeadChange) error {
+	if len(change.Apply) == 0 || !change.Apply[0].Defined() {
+		log.Warn("received head change without new head, ignoring")
+		return nil
+	}
+	ix.setTarget(change.Apply[0])
+	return nil
+}
+
+// Flush waits until the index is up to date with the last head it was given, and returns the
+// error of the update to that head, if any.
+func (ix *Indexer) Flush(ctx context.Context) error {
+	for {
+		ix.lk.Lock()
+		if ix.done.Equals(ix.target) {
+			err := ix.err
+			ix.lk.Unlock()
+			return err
+		}
+		updated := ix.updated
+		ix.lk.Unlock()
+
+		select {
+		case <-updated:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (ix *Indexer) setTarget(head block.TipSet) {
+	ix.lk.Lock()
+	ix.target = head
+	ix.lk.Unlock()
+
+	select {
+	case ix.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run updates the index to the latest target whenever it changes, until ctx is done.
+func (ix *Indexer) run(ctx context.Context) {
+	for {
+		select {
+		case <-ix.wake:
+		case <-ctx.Done():
+			return
+		}
+
+		ix.lk.Lock()
+		target := ix.target
+		ix.lk.Unlock()
+
+		err := ix.update(ctx, target)
+		if err != nil {
+			err = errors.Wrapf(err, "failed to index messages of tipset %s", target.Key())
+			log.Error(err)
+		}
+
+		ix.lk.Lock()
+		ix.done = target
+		ix.err = err
+		close(ix.updated)
+		ix.updated = make(chan struct{})
+		ix.lk.Unlock()
+	}
+}
+
+// List returns the indexed messages from `from` and to `to` included at or after epoch `since`,
+// in order of epoch. Either address may be empty to match any address, but not both.
+func (ix *Indexer) List(ctx context.Context, from, to address.Address, since abi.ChainEpoch) ([]*IndexedMessage, error) {
+	var prefix datastore.Key
+	switch {
+	case !from.Empty():
+		prefix = indexFromPrefix.ChildString(from.String())
+	case !to.Empty():
+		prefix = indexToPrefix.ChildString(to.String())
+	default:
+		return nil, errors.New("a sender or recipient address is required")
+	}
+
+	res, err := ix.ds.Query(query.Query{Prefix: prefix.String()})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to query message index")
+	}
+	entries, err := res.Rest()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read message index")
+	}
+
+	var found []*IndexedMessage
+	for _, entry := range entries {
+		var rec indexRecord
+		if err := encoding.Decode(entry.Value, &rec); err != nil {
+			return nil, errors.Wrapf(err, "failed to decode indexed message %s", entry.Key)
+		}
+		// A key prefix may also match longer addresses.
+		if (!from.Empty() && rec.From != from) || (!to.Empty() && rec.To != to) || rec.Epoch < since {
+			continue
+		}
+		found = append(found, &IndexedMessage{
+			Cid:      rec.Cid.Cid,
+			From:     rec.From,
+			To:       rec.To,
+			Epoch:    rec.Epoch,
+			ExitCode: rec.ExitCode,
+		})
+	}
+	sort.SliceStable(found, func(i, j int) bool {
+		return found[i].Epoch < found[j].Epoch
+	})
+	return found, nil
+}
+
+// update moves the index from the last indexed tipset to `head`. Tipsets are reverted from the
+// previous head down, then applied up to the new head, in batches which each record the tipset the
+// index then represents, so that an interrupted update resumes from the last batch. Only the
+// tipsets of one batch are held in memory at a time.
+func (ix *Indexer) update(ctx context.Context, head block.TipSet) error {
+	indexed, err := ix.loadHead()
+	if err != nil {
+		return err
+	}
+	if indexed.Equals(head) {
+		return nil
+	}
+	if !indexed.Defined() {
+		return ix.commit(ctx, nil, []block.TipSet{head}, head.Key())
+	}
+
+	common, err := chain.FindCommonAncestor(chain.IterAncestors(ctx, ix.chain, indexed), chain.IterAncestors(ctx, ix.chain, head))
+	if err != nil {
+		return errors.Wrapf(err, "failed to find common ancestor of %s and %s", indexed.Key(), head.Key())
+	}
+
+	// Revert from the previous head down to the common ancestor.
+	var reverted []block.TipSet
+	for it := chain.IterAncestors(ctx, ix.chain, indexed); !it.Value().Equals(common); {
+		reverted = append(reverted, it.Value())
+		if err := it.Next(); err != nil {
+			return err
+		}
+		if it.Complete() {
+			return errors.Errorf("tipset %s is not an ancestor of %s", common.Key(), indexed.Key())
+		}
+		if len(reverted) == indexBatchSize || it.Value().Equals(common) {
+			if err := ix.commit(ctx, reverted, nil, it.Value().Key()); err != nil {
+				return err
+			}
+			reverted = nil
+		}
+	}
+
+	// Apply up to the new head, each batch covering the tipsets in the next indexBatchSize epochs.
+	from, err := common.Height()
+	if err != nil {
+		return err
+	}
+	headHeight, err := head.Height()
+	if err != nil {
+		return err
+	}
+	for from < headHeight {
+		to := from + indexBatchSize
+		top, err := chain.FindTipsetAtEpoch(ctx, head, to, ix.chain)
+		if err != nil {
+			return err
+		}
+		// Applied tipsets are in descending height order.
+		applied, err := chain.CollectTipSetsOfHeightAtLeast(ctx, chain.IterAncestors(ctx, ix.chain, top), from+1)
+		if err != nil {
+			return err
+		}
+		if len(applied) > 0 {
+			if err := ix.commit(ctx, nil, applied, top.Key()); err != nil {
+				return err
+			}
+		}
+		from = to
+	}
+	return nil
+}
+
+// commit reverts and applies tipsets in one datastore batch, recording the key of the tipset the
+// index then represents.
+func (ix *Indexer) commit(ctx context.Context, reverted, applied []block.TipSet, indexed block.TipSetKey) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	batch, err := ix.ds.Batch()
+	if err != nil {
+		return err
+	}
+	for _, ts := range reverted {
+		if err := ix.revert(ctx, batch, ts); err != nil {
+			return err
+		}
+	}
+	for i := len(applied) - 1; i >= 0; i-- {
+		if err := ix.apply(ctx, batch, applied[i]); err != nil {
+			return err
+		}
+	}
+
+	val, err := encoding.Encode(indexed)
+	if err != nil {
+		return err
+	}
+	if err := batch.Put(indexHeadKey, val); err != nil {
+		return errors.Wrap(err, "failed to write indexed head")
+	}
+	if err := batch.Commit(); err != nil {
+		return errors.Wrap(err, "failed to write message index")
+	}
+	return nil
+}
+
+// apply adds the messages of a tipset, with their receipts, to the index.
+func (ix *Indexer) apply(ctx context.Context, batch datastore.Batch, ts block.TipSet) error {
+	records, err := ix.tipSetRecords(ctx, ts)
+	if err != nil || len(records) == 0 {
+		return err
+	}
+
+	receiptsRoot, err := ix.chain.GetTipSetReceiptsRoot(ts.Key())
+	if err != nil {
+		return errors.Wrapf(err, "failed to find receipts of tipset %s", ts.Key())
+	}
+	receipts, err := ix.messages.LoadReceipts(ctx, receiptsRoot)
+	if err != nil {
+		return errors.Wrapf(err, "failed to load receipts of tipset %s", ts.Key())
+	}
+	if len(receipts) < len(records) {
+		return errors.Errorf("tipset %s has %d receipts for %d messages", ts.Key(), len(receipts), len(records))
+	}
+
+	for i, rec := range records {
+		rec.ExitCode = receipts[i].ExitCode
+		val, err := encoding.Encode(rec)
+		if err != nil {
+			return errors.Wrap(err, "failed to encode indexed message")
+		}
+		for _, key := range indexKeys(rec) {
+			if err := batch.Put(key, val); err != nil {
+				return errors.Wrap(err, "failed to write indexed message")
+			}
+		}
+	}
+	return nil
+}
+
+// revert removes the messages of a tipset from the index.
+func (ix *Indexer) revert(ctx context.Context, batch datastore.Batch, ts block.TipSet) error {
+	records, err := ix.tipSetRecords(ctx, ts)
+	if err != nil {
+		return err
+	}
+	for _, rec := range records {
+		for _, key := range indexKeys(rec) {
+			if err := batch.Delete(key); err != nil && err != datastore.ErrNotFound {
+				return errors.Wrap(err, "failed to delete indexed message")
+			}
+		}
+	}
+	return nil
+}
+
+// tipSetRecords returns records, without exit codes, for the distinct messages of a tipset in the
+// order of their receipts.
+func (ix *Indexer) tipSetRecords(ctx context.Context, ts block.TipSet) ([]*indexRecord, error) {
+	epoch, err := ts.Height()
+	if err != nil {
+		return nil, err
+	}
+
+	// Messages are de-duplicated by the CID of the unsigned message, as for receipts.
+	seen := make(map[cid.Cid]struct{})
+	var records []*indexRecord
+	add := func(c, unwrapped cid.Cid, from, to address.Address) {
+		if _, ok := seen[unwrapped]; ok {
+			return
+		}
+		seen[unwrapped] = struct{}{}
+		records = append(records, &indexRecord{Cid: e.NewCid(c), From: from, To: to, Epoch: epoch})
+	}
+
+	for i := 0; i < ts.Len(); i++ {
+		secpMsgs, blsMsgs, err := ix.messages.LoadMessages(ctx, ts.At(i).Messages.Cid)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to load messages of block %s", ts.At(i).Cid())
+		}
+		for _, msg := range blsMsgs {
+			c, err := msg.Cid()
+			if err != nil {
+				return nil, err
+			}
+			add(c, c, msg.From, msg.To)
+		}
+		for _, msg := range secpMsgs {
+			c, err := msg.Cid()
+			if err != nil {
+				return nil, err
+			}
+			unwrapped, err := msg.Message.Cid()
+			if err != nil {
+				return nil, err
+			}
+			add(c, unwrapped, msg.Message.From, msg.Message.To)
+		}
+	}
+	return records, nil
+}
+
+// loadHead returns the last indexed tipset, or an undefined tipset if there is none or it is no
+// longer in the store, in which case the index is cleared.
+func (ix *Indexer) loadHead() (block.TipSet, error) {
+	bb, err := ix.ds.Get(indexHeadKey)
+	if err == datastore.ErrNotFound {
+		return block.UndefTipSet, nil
+	}
+	if err != nil {
+		return block.UndefTipSet, errors.Wrap(err, "failed to read indexed head")
+	}
+
+	var key block.TipSetKey
+	if err := encoding.Decode(bb, &key); err != nil {
+		return block.UndefTipSet, errors.Wrap(err, "failed to decode indexed head")
+	}
+	ts, err := ix.chain.GetTipSet(key)
+	if err != nil {
+		// The indexed messages can't be reverted without the tipsets they are in, so the index is
+		// rebuilt from the current head.
+		log.Warnf("indexed head %s not found, indexing from the current head: %s", key, err)
+		if err := ix.clear(); err != nil {
+			return block.UndefTipSet, err
+		}
+		return block.UndefTipSet, nil
+	}
+	return ts, nil
+}
+
+// clear removes the whole index, including the indexed head.
+func (ix *Indexer) clear() error {
+	res, err := ix.ds.Query(query.Query{Prefix: IndexPrefix.String(), KeysOnly: true})
+	if err != nil {
+		return errors.Wrap(err, "failed to query message index")
+	}
+	defer res.Close() // nolint: errcheck
+
+	batch, err := ix.ds.Batch()
+	if err != nil {
+		return err
+	}
+	for entry := range res.Next() {
+		if entry.Error != nil {
+			return errors.Wrap(entry.Error, "failed to read message index")
+		}
+		if err := batch.Delete(datastore.RawKey(entry.Key)); err != nil {
+			return errors.Wrap(err, "failed to delete indexed message")
+		}
+	}
+	return errors.Wrap(batch.Commit(), "failed to clear message index")
+}
+
+func indexKeys(rec *indexRecord) []datastore.Key {
+	epoch := strconv.FormatInt(int64(rec.Epoch), 10)
+	return []datastore.Key{
+		indexFromPrefix.ChildString(rec.From.String()).ChildString(epoch).ChildString(rec.Cid.String()),
+		indexToPrefix.ChildString(rec.To.String()).ChildString(epoch).ChildString(rec.Cid.String()),
+	}
+}
@@ -0,0 +1,158 @@
+package message_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/specs-actors/actors/abi"
+	"github.com/filecoin-project/specs-actors/actors/runtime/exitcode"
+	"github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/internal/pkg/block"
+	"github.com/filecoin-project/go-filecoin/internal/pkg/chain"
+	"github.com/filecoin-project/go-filecoin/internal/pkg/message"
+	"github.com/filecoin-project/go-filecoin/internal/pkg/repo"
+	tf "github.com/filecoin-project/go-filecoin/internal/pkg/testhelpers/testflags"
+	"github.com/filecoin-project/go-filecoin/internal/pkg/types"
+	"github.com/filecoin-project/go-filecoin/internal/pkg/vm"
+)
+
+func TestIndexer(t *testing.T) {
+	tf.UnitTest(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	keys := types.MustGenerateKeyInfo(2, 42)
+	mm := vm.NewMessageMaker(t, keys)
+	alice := mm.Addresses()[0]
+	bob := mm.Addresses()[1]
+
+	provider := message.NewFakeProvider(t)
+	root := provider.NewGenesis()
+	provider.SetHead(root.Key())
+
+	ds := repo.NewInMemoryRepo().Datastore()
+	ix := message.NewIndexer(provider, provider, ds)
+	require.NoError(t, ix.Start(ctx))
+	require.NoError(t, ix.Flush(ctx))
+
+	// Builds a tipset including messages with receipts having the given exit codes.
+	buildOn := func(parent block.TipSet, msgs []*types.SignedMessage, codes ...exitcode.ExitCode) block.TipSet {
+		ts := provider.BuildOneOn(parent, func(b *chain.BlockBuilder) {
+			b.AddMessages(msgs, []*types.UnsignedMessage{})
+		})
+		receipts := make([]vm.MessageReceipt, len(codes))
+		for i, code := range codes {
+			receipts[i].ExitCode = code
+		}
+		provider.SetReceipts(ts.Key(), receipts)
+		return ts
+	}
+	msgCid := func(msg *types.SignedMessage) cid.Cid {
+		c, err := msg.Cid()
+		require.NoError(t, err)
+		return c
+	}
+	list := func(ix *message.Indexer, from, to address.Address, since int64) []*message.IndexedMessage {
+		found, err := ix.List(ctx, from, to, abi.ChainEpoch(since))
+		require.NoError(t, err)
+		return found
+	}
+	cids := func(found []*message.IndexedMessage) []cid.Cid {
+		out := []cid.Cid{}
+		for _, m := range found {
+			out = append(out, m.Cid)
+		}
+		return out
+	}
+
+	m1 := mm.NewSignedMessage(alice, 0)
+	m2 := mm.NewSignedMessage(bob, 0)
+	m3 := mm.NewSignedMessage(alice, 1)
+	m4 := mm.NewSignedMessage(bob, 1)
+	dest := m1.Message.To
+
+	t1 := buildOn(root, []*types.SignedMessage{m1, m2}, exitcode.Ok, exitcode.SysErrSenderInvalid)
+	require.NoError(t, ix.HandleHeadChange(ctx, chain.HeadChange{Apply: []block.TipSet{t1}}))
+	t2 := buildOn(t1, []*types.SignedMessage{m3}, exitcode.Ok)
+	require.NoError(t, ix.HandleHeadChange(ctx, chain.HeadChange{Apply: []block.TipSet{t2}}))
+	require.NoError(t, ix.Flush(ctx))
+
+	t.Run("lists by sender and recipient", func(t *testing.T) {
+		found := list(ix, alice, address.Undef, 0)
+		assert.Equal(t, []cid.Cid{msgCid(m1), msgCid(m3)}, cids(found))
+		assert.Equal(t, alice, found[0].From)
+		assert.Equal(t, dest, found[0].To)
+		assert.Equal(t, abi.ChainEpoch(1), found[0].Epoch)
+		assert.Equal(t, exitcode.Ok, found[0].ExitCode)
+
+		found = list(ix, bob, address.Undef, 0)
+		assert.Equal(t, []cid.Cid{msgCid(m2)}, cids(found))
+		assert.Equal(t, exitcode.SysErrSenderInvalid, found[0].ExitCode)
+
+		assert.ElementsMatch(t, []cid.Cid{msgCid(m1), msgCid(m2), msgCid(m3)}, cids(list(ix, address.Undef, dest, 0)))
+		assert.Equal(t, []cid.Cid{msgCid(m3)}, cids(list(ix, alice, dest, 2)))
+		assert.Empty(t, list(ix, alice, bob, 0))
+
+		_, err := ix.List(ctx, address.Undef, address.Undef, 0)
+		assert.Error(t, err)
+	})
+
+	// A fork from t1.
+	f2 := buildOn(t1, []*types.SignedMessage{m4}, exitcode.Ok)
+	f3 := provider.AppendOn(f2, 1)
+
+	t.Run("removes reverted messages", func(t *testing.T) {
+		require.NoError(t, ix.HandleHeadChange(ctx, chain.HeadChange{
+			Revert: []block.TipSet{t2},
+			Apply:  []block.TipSet{f3, f2},
+		}))
+		require.NoError(t, ix.Flush(ctx))
+
+		assert.Equal(t, []cid.Cid{msgCid(m1)}, cids(list(ix, alice, address.Undef, 0)))
+		assert.Equal(t, []cid.Cid{msgCid(m2), msgCid(m4)}, cids(list(ix, bob, address.Undef, 0)))
+	})
+
+	t.Run("catches up on start", func(t *testing.T) {
+		// The head moves on from f3 while the indexer is not running.
+		m5 := mm.NewSignedMessage(alice, 1)
+		f4 := buildOn(f3, []*types.SignedMessage{m5}, exitcode.Ok)
+		provider.SetHead(f4.Key())
+
+		restarted := message.NewIndexer(provider, provider, ds)
+		require.NoError(t, restarted.Start(ctx))
+		require.NoError(t, restarted.Flush(ctx))
+		assert.Equal(t, []cid.Cid{msgCid(m1), msgCid(m5)}, cids(list(restarted, alice, address.Undef, 0)))
+
+		// Catching up across many tipsets takes several batches.
+		m6 := mm.NewSignedMessage(alice, 2)
+		long := provider.AppendManyOn(250, f4)
+		f5 := buildOn(long, []*types.SignedMessage{m6}, exitcode.Ok)
+		provider.SetHead(f5.Key())
+
+		restarted = message.NewIndexer(provider, provider, ds)
+		require.NoError(t, restarted.Start(ctx))
+		require.NoError(t, restarted.Flush(ctx))
+		assert.Equal(t, []cid.Cid{msgCid(m1), msgCid(m5), msgCid(m6)}, cids(list(restarted, alice, address.Undef, 0)))
+	})
+
+	t.Run("clears the index if the indexed head is unknown", func(t *testing.T) {
+		other := message.NewFakeProvider(t)
+		otherRoot := other.NewGenesis()
+		m7 := mm.NewSignedMessage(bob, 2)
+		otherHead := other.BuildOneOn(otherRoot, func(b *chain.BlockBuilder) {
+			b.AddMessages([]*types.SignedMessage{m7}, []*types.UnsignedMessage{})
+		})
+		other.SetReceipts(otherHead.Key(), []vm.MessageReceipt{{ExitCode: exitcode.Ok}})
+		other.SetHead(otherHead.Key())
+
+		restarted := message.NewIndexer(other, other, ds)
+		require.NoError(t, restarted.Start(ctx))
+		require.NoError(t, restarted.Flush(ctx))
+		assert.Empty(t, list(restarted, alice, address.Undef, 0))
+		assert.Equal(t, []cid.Cid{msgCid(m7)}, cids(list(restarted, bob, address.Undef, 0)))
+	})
+}
@@ -124,6 +124,68 @@ func (ob *Outbox) SendEncoded(ctx context.Context, from, to address.Address, val
 		return cid.Undef, nil, errors.Wrapf(err, "no actor at address %s", from)
 	}
 
+	return ob.signAndSend(ctx, fromActor, from, to, value, gasPrice, gasLimit, bcast, method, encodedParams)
+}
+
+// BatchEntry is a message to be sent in a batch by SendBatch.
+type BatchEntry struct {
+	To            address.Address
+	Value         types.AttoFIL
+	Method        abi.MethodNum
+	EncodedParams []byte
+	GasLimit      gas.Unit
+}
+
+// BatchResult is the outcome of sending one message of a batch: the message's CID, or the error
+// that prevented sending it.
+type BatchResult struct {
+	Cid cid.Cid
+	Err error
+}
+
+// SendBatch sends a sequence of messages from a single actor, retaining them in the outbound message
+// queue. The messages are given consecutive nonces in the order of `entries`; a message that fails to
+// be signed or validated does not consume a nonce, so its failure leaves no gap for those following it.
+// Messages are published one at a time, in nonce order. The result for each entry is returned in the
+// same order; an error publishing a message is reported in its result, but the message remains queued.
+func (ob *Outbox) SendBatch(ctx context.Context, from address.Address, gasPrice types.AttoFIL, entries []BatchEntry,
+	bcast bool) ([]BatchResult, error) {
+	// Hold the lock for the whole batch so that no other message takes a nonce in its midst.
+	ob.nonceLock.Lock()
+	defer ob.nonceLock.Unlock()
+
+	fromActor, err := ob.actors.GetActorAt(ctx, ob.chains.GetHead(), from)
+	if err != nil {
+		return nil, errors.Wrapf(err, "no actor at address %s", from)
+	}
+
+	results := make([]BatchResult, len(entries))
+	for i, entry := range entries {
+		encodedParams := entry.EncodedParams
+		if encodedParams == nil {
+			encodedParams = []byte{}
+		}
+		c, pubErrCh, err := ob.signAndSend(ctx, fromActor, from, entry.To, entry.Value, gasPrice, entry.GasLimit, bcast, entry.Method, encodedParams)
+		if err != nil {
+			msgSendErrCt.Inc(ctx, 1)
+		} else if pubErr := <-pubErrCh; pubErr != nil {
+			// The message remains queued, so its nonce is not reused.
+			err = errors.Wrap(pubErr, "failed to publish message")
+		}
+		results[i] = BatchResult{Cid: c, Err: err}
+		ob.journal.Write("SendBatch",
+			"to", entry.To.String(), "from", from.String(), "value", entry.Value.Int.Uint64(), "method", entry.Method,
+			"gasPrice", gasPrice.Int.Uint64(), "gasLimit", uint64(entry.GasLimit), "bcast", bcast,
+			"encodedParams", encodedParams, "error", err, "cid", c.String())
+	}
+
+	return results, nil
+}
+
+// signAndSend builds a message with the next nonce for the sending actor, signs and validates it, and
+// sends it. The caller must hold the nonce lock.
+func (ob *Outbox) signAndSend(ctx context.Context, fromActor *actor.Actor, from, to address.Address, value types.AttoFIL,
+	gasPrice types.AttoFIL, gasLimit gas.Unit, bcast bool, method abi.MethodNum, encodedParams []byte) (cid.Cid, chan error, error) {
 	nonce, err := nextNonce(fromActor, ob.queue, from)
 	if err != nil {
 		return cid.Undef, nil, errors.Wrapf(err, "failed calculating nonce for actor at %s", from)
@@ -172,13 +234,7 @@ func sendSignedMsg(ctx context.Context, ob *Outbox, signed *types.SignedMessage,
 		return cid.Undef, nil, errors.Wrap(err, "failed to add message to outbound queue")
 	}
 
-	var c cid.Cid
-	if signed.Message.From.Protocol() == address.BLS {
-		// drop signature before generating Cid to match cid of message retrieved from block.
-		c, err = signed.Message.Cid()
-	} else {
-		c, err = signed.Cid()
-	}
+	c, err := outboxCid(signed)
 	if err != nil {
 		return cid.Undef, nil, err
 	}
@@ -196,6 +252,116 @@ func sendSignedMsg(ctx context.Context, ob *Outbox, signed *types.SignedMessage,
 	return c, pubErrCh, nil
 }
 
+// Replace re-signs the queued message with CID `c` with a new gas price, and replaces the original
+// in the outbound message queue and the message pool. If bcast is true, the publisher broadcasts the
+// replacement to the network. The message pool rejects the replacement unless its gas price is
+// sufficiently higher than the original's, in which case the queue is left unchanged.
+func (ob *Outbox) Replace(ctx context.Context, c cid.Cid, gasPrice types.AttoFIL, bcast bool) (out cid.Cid, err error) {
+	defer func() {
+		if err != nil {
+			msgSendErrCt.Inc(ctx, 1)
+		}
+		ob.journal.Write("Replace",
+			"replaced", c.String(), "gasPrice", gasPrice.Int.Uint64(), "bcast", bcast,
+			"error", err, "cid", out.String())
+	}()
+
+	// Lock to avoid racing with a send from the same actor.
+	ob.nonceLock.Lock()
+	defer ob.nonceLock.Unlock()
+
+	original, err := ob.findQueued(c)
+	if err != nil {
+		return cid.Undef, err
+	}
+
+	rawMsg := original.Message
+	rawMsg.GasPrice = gasPrice
+	signed, err := types.NewSignedMessage(ctx, rawMsg, ob.signer)
+	if err != nil {
+		return cid.Undef, errors.Wrap(err, "failed to sign message")
+	}
+	err = ob.validator.ValidateSignedMessageSyntax(ctx, signed)
+	if err != nil {
+		return cid.Undef, errors.Wrap(err, "invalid message")
+	}
+
+	height, err := tipsetHeight(ob.chains, ob.chains.GetHead())
+	if err != nil {
+		return cid.Undef, errors.Wrap(err, "failed to get block height")
+	}
+
+	if _, err := ob.queue.Replace(ctx, signed); err != nil {
+		return cid.Undef, errors.Wrap(err, "failed to replace message in outbound queue")
+	}
+	if err := ob.publisher.Publish(ctx, signed, height, bcast); err != nil {
+		if _, rerr := ob.queue.Replace(ctx, original); rerr != nil {
+			log.Errorf("failed to restore message %s in outbound queue: %s", c, rerr)
+		}
+		return cid.Undef, errors.Wrap(err, "failed to publish replacement message")
+	}
+	return outboxCid(signed)
+}
+
+// Republish reconciles the outbound queue with the chain and publishes the messages remaining in it.
+// It is intended to be called on startup, with the queue restored from a previous run: queued
+// messages with nonces below their sender's on-chain nonce have been mined meanwhile and are
+// dropped. The others are added back to the message pool and, if bcast is true, broadcast.
+func (ob *Outbox) Republish(ctx context.Context, bcast bool) error {
+	ob.nonceLock.Lock()
+	defer ob.nonceLock.Unlock()
+
+	head := ob.chains.GetHead()
+	height, err := tipsetHeight(ob.chains, head)
+	if err != nil {
+		return errors.Wrap(err, "failed to get block height")
+	}
+
+	for _, sender := range ob.queue.Queues() {
+		queued := ob.queue.List(sender)
+		fromActor, err := ob.actors.GetActorAt(ctx, head, sender)
+		if err != nil {
+			log.Warnf("not republishing %d queued messages from %s: %s", len(queued), sender, err)
+			continue
+		}
+		nonce, err := actor.NextNonce(fromActor)
+		if err != nil {
+			log.Warnf("not republishing %d queued messages from %s: %s", len(queued), sender, err)
+			continue
+		}
+
+		for _, qm := range queued {
+			msg := qm.Msg
+			if msg.Message.CallSeqNum < nonce {
+				if _, _, err := ob.queue.RemoveNext(ctx, sender, msg.Message.CallSeqNum); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := ob.publisher.Publish(ctx, msg, height, bcast); err != nil {
+				log.Errorf("error: %s republishing message from %s with nonce %d", err, sender, msg.Message.CallSeqNum)
+			}
+		}
+	}
+	return nil
+}
+
+// findQueued returns the queued message with CID `c`.
+func (ob *Outbox) findQueued(c cid.Cid) (*types.SignedMessage, error) {
+	for _, addr := range ob.queue.Queues() {
+		for _, qm := range ob.queue.List(addr) {
+			qc, err := outboxCid(qm.Msg)
+			if err != nil {
+				return nil, err
+			}
+			if qc.Equals(c) {
+				return qm.Msg, nil
+			}
+		}
+	}
+	return nil, errors.Errorf("message %s not found in outbound queue", c)
+}
+
 // HandleNewHead maintains the message queue in response to a new head tipset.
 func (ob *Outbox) HandleNewHead(ctx context.Context, oldTips, newTips []block.TipSet) error {
 	return ob.policy.HandleNewHead(ctx, ob.queue, oldTips, newTips)
@@ -223,3 +389,13 @@ func tipsetHeight(provider chainProvider, key block.TipSetKey) (abi.ChainEpoch,
 	}
 	return head.Height()
 }
+
+// outboxCid returns the CID by which the outbox identifies a message: that of the signed message
+// for secp senders and that of the unsigned message for BLS senders, matching the CID of the
+// message when retrieved from a block.
+func outboxCid(signed *types.SignedMessage) (cid.Cid, error) {
+	if signed.Message.From.Protocol() == address.BLS {
+		return signed.Message.Cid()
+	}
+	return signed.Cid()
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/filecoin-project/specs-actors/actors/builtin"
 	"github.com/filecoin-project/specs-actors/actors/util/adt"
 	"github.com/ipfs/go-cid"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
@@ -144,6 +145,140 @@ func TestOutbox(t *testing.T) {
 		}
 	})
 
+	t.Run("replace re-signs and publishes queued message", func(t *testing.T) {
+		ctx := context.Background()
+		w, _ := types.NewMockSignersAndKeyInfo(1)
+		sender := w.Addresses[0]
+		toAddr := vmaddr.NewForTestGetter()()
+		queue := message.NewQueue()
+		publisher := &message.MockPublisher{}
+		provider := message.NewFakeProvider(t)
+
+		head := provider.BuildOneOn(block.UndefTipSet, func(b *chain.BlockBuilder) {
+			b.IncHeight(1000)
+		})
+		actr := actor.NewActor(builtin.AccountActorCodeID, abi.NewTokenAmount(0), cid.Undef)
+		provider.SetHeadAndActor(t, head.Key(), sender, actr)
+
+		ob := message.NewOutbox(w, message.FakeValidator{}, queue, publisher, message.NullPolicy{}, provider, provider, newOutboxTestJournal(t))
+		c, pubDone, err := ob.Send(ctx, sender, toAddr, types.ZeroAttoFIL, types.NewGasPrice(1), gas.NewGas(0), true, builtin.MethodSend, adt.Empty)
+		require.NoError(t, err)
+		require.NoError(t, <-pubDone)
+		original := publisher.Message
+
+		replaced, err := ob.Replace(ctx, c, types.NewGasPrice(2), true)
+		require.NoError(t, err)
+		assert.NotEqual(t, c, replaced)
+		require.Len(t, queue.List(sender), 1)
+		queued := queue.List(sender)[0]
+		assert.Equal(t, publisher.Message, queued.Msg)
+		assert.Equal(t, uint64(1000), queued.Stamp)
+		assert.Equal(t, types.NewGasPrice(2), queued.Msg.Message.GasPrice)
+		assert.Equal(t, original.Message.CallSeqNum, queued.Msg.Message.CallSeqNum)
+
+		// The original is no longer queued.
+		_, err = ob.Replace(ctx, c, types.NewGasPrice(3), true)
+		assert.Error(t, err)
+
+		// A rejected replacement leaves the queue unchanged.
+		publisher.ReturnError = errors.New("rejected")
+		_, err = ob.Replace(ctx, replaced, types.NewGasPrice(3), true)
+		assert.Error(t, err)
+		assert.Equal(t, types.NewGasPrice(2), queue.List(sender)[0].Msg.Message.GasPrice)
+	})
+
+	t.Run("republish drops mined messages and publishes the rest", func(t *testing.T) {
+		ctx := context.Background()
+		w, _ := types.NewMockSignersAndKeyInfo(1)
+		sender := w.Addresses[0]
+		toAddr := vmaddr.NewForTestGetter()()
+		queue := message.NewQueue()
+		publisher := &message.MockPublisher{}
+		provider := message.NewFakeProvider(t)
+
+		head := provider.BuildOneOn(block.UndefTipSet, func(b *chain.BlockBuilder) {
+			b.IncHeight(1000)
+		})
+		actr := actor.NewActor(builtin.AccountActorCodeID, abi.NewTokenAmount(0), cid.Undef)
+		provider.SetHeadAndActor(t, head.Key(), sender, actr)
+
+		ob := message.NewOutbox(w, message.FakeValidator{}, queue, publisher, message.NullPolicy{}, provider, provider, newOutboxTestJournal(t))
+		for i := 0; i < 3; i++ {
+			_, pubDone, err := ob.Send(ctx, sender, toAddr, types.ZeroAttoFIL, types.NewGasPrice(0), gas.NewGas(0), true, builtin.MethodSend, adt.Empty)
+			require.NoError(t, err)
+			require.NoError(t, <-pubDone)
+		}
+		publisher.Message = nil
+
+		// The first message was mined while the node was down.
+		actr.CallSeqNum = 1
+		provider.SetHeadAndActor(t, head.Key(), sender, actr)
+
+		require.NoError(t, ob.Republish(ctx, false))
+		queued := queue.List(sender)
+		require.Len(t, queued, 2)
+		assert.Equal(t, uint64(1), queued[0].Msg.Message.CallSeqNum)
+		require.NotNil(t, publisher.Message)
+		assert.Equal(t, uint64(2), publisher.Message.Message.CallSeqNum)
+		assert.False(t, publisher.Bcast)
+	})
+
+	t.Run("send batch assigns consecutive nonces", func(t *testing.T) {
+		ctx := context.Background()
+		w, _ := types.NewMockSignersAndKeyInfo(1)
+		sender := w.Addresses[0]
+		toAddr := vmaddr.NewForTestGetter()()
+		queue := message.NewQueue()
+		publisher := &message.MockPublisher{}
+		provider := message.NewFakeProvider(t)
+
+		head := provider.BuildOneOn(block.UndefTipSet, func(b *chain.BlockBuilder) {
+			b.IncHeight(1000)
+		})
+		actr := actor.NewActor(builtin.AccountActorCodeID, abi.NewTokenAmount(0), cid.Undef)
+		actr.CallSeqNum = 42
+		provider.SetHeadAndActor(t, head.Key(), sender, actr)
+
+		ob := message.NewOutbox(w, message.FakeValidator{}, queue, publisher, message.NullPolicy{}, provider, provider, newOutboxTestJournal(t))
+		entries := []message.BatchEntry{
+			{To: toAddr, Value: types.NewAttoFILFromFIL(1), Method: builtin.MethodSend, GasLimit: gas.NewGas(100)},
+			{To: toAddr, Value: types.NewAttoFILFromFIL(2), Method: builtin.MethodSend, GasLimit: gas.NewGas(200)},
+			{To: toAddr, Value: types.NewAttoFILFromFIL(3), Method: builtin.MethodSend, GasLimit: gas.NewGas(300)},
+		}
+		results, err := ob.SendBatch(ctx, sender, types.NewGasPrice(1), entries, true)
+		require.NoError(t, err)
+		require.Len(t, results, 3)
+
+		queued := queue.List(sender)
+		require.Len(t, queued, 3)
+		for i, result := range results {
+			require.NoError(t, result.Err)
+			assert.Equal(t, actr.CallSeqNum+uint64(i), queued[i].Msg.Message.CallSeqNum)
+			assert.Equal(t, entries[i].Value, queued[i].Msg.Message.Value)
+			assert.Equal(t, entries[i].GasLimit, queued[i].Msg.Message.GasLimit)
+			c, err := queued[i].Msg.Cid()
+			require.NoError(t, err)
+			assert.Equal(t, c, result.Cid)
+		}
+		assert.Equal(t, uint64(44), publisher.Message.Message.CallSeqNum)
+
+		// Messages that fail to publish remain queued, so following messages leave no gap.
+		publisher.ReturnError = errors.New("failed")
+		results, err = ob.SendBatch(ctx, sender, types.NewGasPrice(1), entries[:2], true)
+		require.NoError(t, err)
+		for _, result := range results {
+			assert.Error(t, result.Err)
+			assert.True(t, result.Cid.Defined())
+		}
+		queued = queue.List(sender)
+		require.Len(t, queued, 5)
+		assert.Equal(t, uint64(46), queued[4].Msg.Message.CallSeqNum)
+
+		// A sender without an actor fails the whole batch.
+		_, err = ob.SendBatch(ctx, toAddr, types.NewGasPrice(1), entries, true)
+		assert.Error(t, err)
+	})
+
 	t.Run("fails with non-account actor", func(t *testing.T) {
 		w, _ := types.NewMockSignersAndKeyInfo(1)
 		sender := w.Addresses[0]
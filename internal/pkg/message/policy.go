@@ -34,6 +34,7 @@ type PolicyTarget interface {
 	RemoveNext(ctx context.Context, sender address.Address, expectedNonce uint64) (msg *types.SignedMessage, found bool, err error)
 	Requeue(ctx context.Context, msg *types.SignedMessage, stamp uint64) error
 	ExpireBefore(ctx context.Context, stamp uint64) map[address.Address][]*types.SignedMessage
+	RebroadcastBefore(ctx context.Context, stamp, now uint64) map[address.Address][]*types.SignedMessage
 }
 
 // DefaultQueuePolicy manages a target message queue state in response to changes on the blockchain.
@@ -42,17 +43,36 @@ type PolicyTarget interface {
 // even if the block ends up as an abandoned fork.
 // There is no special handling for re-orgs and messages do not revert to the queue if the block
 // ends up childless (in contrast to the message pool).
+// If configured with a publisher, the policy also rebroadcasts messages that remain un-mined some
+// rounds after they were last published, in case they were dropped by the network.
 type DefaultQueuePolicy struct {
 	// Provides messages collections from cids.
 	messageProvider messageProvider
 	// Maximum difference in message stamp from current block height before expiring an address's queue
 	maxAgeRounds uint64
+	// Republishes un-mined messages, if not nil
+	publisher publisher
+	// Number of rounds after a message was last published before rebroadcasting it
+	rebroadcastRounds uint64
 }
 
 // NewMessageQueuePolicy returns a new policy which removes mined messages from the queue and expires
 // messages older than `maxAgeTipsets` rounds.
 func NewMessageQueuePolicy(messages messageProvider, maxAge uint) *DefaultQueuePolicy {
-	return &DefaultQueuePolicy{messages, uint64(maxAge)}
+	return &DefaultQueuePolicy{messageProvider: messages, maxAgeRounds: uint64(maxAge)}
+}
+
+// NewRebroadcastingQueuePolicy returns a new policy which removes mined messages from the queue,
+// expires messages older than `maxAge` rounds and rebroadcasts messages with `publisher` when more
+// than `rebroadcastRounds` rounds have passed since they were last published. Rebroadcasting is
+// disabled if `rebroadcastRounds` is zero.
+func NewRebroadcastingQueuePolicy(messages messageProvider, maxAge uint, publisher publisher, rebroadcastRounds uint) *DefaultQueuePolicy {
+	policy := NewMessageQueuePolicy(messages, maxAge)
+	if rebroadcastRounds > 0 {
+		policy.publisher = publisher
+		policy.rebroadcastRounds = uint64(rebroadcastRounds)
+	}
+	return policy
 }
 
 // HandleNewHead removes from the queue all messages that have now been mined in new blocks.
@@ -64,8 +84,10 @@ func (p *DefaultQueuePolicy) HandleNewHead(ctx context.Context, target PolicyTar
 
 	// Remove all messages in the new chain from the queue since they have been mined into blocks.
 	// Rearrange the tipsets into ascending height order so messages are discovered in nonce order.
-	chain.Reverse(newTips)
-	for _, tipset := range newTips {
+	// The input is left untouched since it may be shared with other head change handlers.
+	ascending := append([]block.TipSet(nil), newTips...)
+	chain.Reverse(ascending)
+	for _, tipset := range ascending {
 		for i := 0; i < tipset.Len(); i++ {
 			secpMsgs, _, err := p.messageProvider.LoadMessages(ctx, tipset.At(i).Messages.Cid)
 			if err != nil {
@@ -115,6 +137,20 @@ func (p *DefaultQueuePolicy) HandleNewHead(ctx context.Context, target PolicyTar
 			log.Warnf("Outbound message %v expired un-mined after %d rounds", msg, p.maxAgeRounds)
 		}
 	}
+
+	// Rebroadcast messages that have not been mined some time after they were last published; they
+	// may have been dropped by the network.
+	if p.publisher != nil && uint64(chainHeight) >= p.rebroadcastRounds {
+		due := target.RebroadcastBefore(ctx, uint64(chainHeight)-p.rebroadcastRounds, uint64(chainHeight))
+		for sender, msgs := range due {
+			for _, msg := range msgs {
+				if err := p.publisher.Publish(ctx, msg, chainHeight, true); err != nil {
+					log.Warnf("failed to rebroadcast message from %s with nonce %d: %s", sender, msg.Message.CallSeqNum, err)
+				}
+			}
+			mqRebroadcastCt.Inc(ctx, int64(len(msgs)))
+		}
+	}
 	return nil
 }
 
@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/filecoin-project/go-filecoin/internal/pkg/block"
+	"github.com/filecoin-project/specs-actors/actors/abi"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
@@ -173,6 +174,41 @@ func TestMessageQueuePolicy(t *testing.T) {
 		assert.Equal(t, qm(msgs[3], 200), q.List(bob)[0]) // Bob's remain
 	})
 
+	t.Run("rebroadcasts un-mined messages", func(t *testing.T) {
+		blocks := chain.NewBuilder(t, alice)
+		q := message.NewQueue()
+		publisher := &message.MockPublisher{}
+		policy := message.NewRebroadcastingQueuePolicy(blocks, 10, publisher, 3)
+
+		msg := requireEnqueue(q, mm.NewSignedMessage(alice, 1), 100)
+
+		root := blocks.BuildOneOn(block.UndefTipSet, func(b *chain.BlockBuilder) {
+			b.IncHeight(100)
+		})
+		b1 := blocks.AppendOn(root, 1) // Height = 101
+		require.NoError(t, policy.HandleNewHead(ctx, q, nil, []block.TipSet{b1}))
+		assert.Nil(t, publisher.Message)
+
+		b2 := blocks.AppendManyOn(3, b1) // Height = 104
+		require.NoError(t, policy.HandleNewHead(ctx, q, nil, []block.TipSet{b2}))
+		require.NotNil(t, publisher.Message)
+		assert.Equal(t, msg, publisher.Message)
+		assert.Equal(t, abi.ChainEpoch(104), publisher.Height)
+		assert.True(t, publisher.Bcast)
+		assert.Equal(t, uint64(104), q.List(alice)[0].Rebroadcast)
+
+		// Not rebroadcast again until the interval has passed since the rebroadcast.
+		publisher.Message = nil
+		b3 := blocks.AppendManyOn(3, b2) // Height = 107
+		require.NoError(t, policy.HandleNewHead(ctx, q, nil, []block.TipSet{b3}))
+		assert.Nil(t, publisher.Message)
+
+		b4 := blocks.AppendOn(b3, 1) // Height = 108
+		require.NoError(t, policy.HandleNewHead(ctx, q, nil, []block.TipSet{b4}))
+		assert.Equal(t, msg, publisher.Message)
+		assert.Equal(t, uint64(108), q.List(alice)[0].Rebroadcast)
+	})
+
 	t.Run("fails when messages out of nonce order", func(t *testing.T) {
 		blocks := chain.NewBuilder(t, alice)
 		messages := blocks
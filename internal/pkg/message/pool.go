@@ -1,11 +1,13 @@
 package message
 
 import (
+	"container/heap"
 	"context"
 	"sync"
 
 	"github.com/filecoin-project/go-address"
 	"github.com/filecoin-project/specs-actors/actors/abi"
+	"github.com/filecoin-project/specs-actors/actors/abi/big"
 	"github.com/ipfs/go-cid"
 	"github.com/pkg/errors"
 
@@ -15,6 +17,7 @@ import (
 )
 
 var mpSize = metrics.NewInt64Gauge("message_pool_size", "The size of the message pool")
+var mpEvictCt = metrics.NewInt64Counter("message_pool_evict", "The number of messages evicted from the message pool to make room for others")
 
 // PoolValidator defines a validator that ensures a message can go through the pool.
 type PoolValidator interface {
@@ -27,6 +30,17 @@ type PoolValidator interface {
 // via network or directly created via user command that have yet to be included
 // in a block. Messages are removed as they are processed.
 //
+// The pool holds at most one message per sender and nonce. A message with the same
+// sender and nonce as a pending one replaces it only if its gas price is at least
+// MessagePoolConfig.ReplaceByFeePercent higher (replace-by-fee).
+//
+// When the pool is full, a new message evicts the pending message with the lowest gas
+// price, if that is lower than its own. Only a sender's highest-nonce message is eligible
+// for eviction, so as not to leave gaps in its nonce sequence. Messages received from the
+// network are also limited to MessagePoolConfig.MaxPendingPerSender per sender. Locally
+// originated messages, added with AddLocal, are never evicted and not subject to the
+// per-sender limit, so that peers cannot crowd out this node's own messages.
+//
 // Pool is safe for concurrent access.
 type Pool struct {
 	lk sync.RWMutex
@@ -34,12 +48,19 @@ type Pool struct {
 	cfg           *config.MessagePoolConfig
 	validator     PoolValidator
 	pending       map[cid.Cid]*timedmessage // all pending messages
-	addressNonces map[addressNonce]bool     // set of address nonce pairs used to efficiently validate duplicate nonces
+	addressNonces map[addressNonce]cid.Cid  // CIDs of pending messages by address nonce pair, used to efficiently find duplicate nonces
+	senderCounts  map[address.Address]uint  // number of pending messages from each sender
+	evictable     evictionQueue             // messages eligible for eviction, by increasing gas price
+
+	observer statusObserver // notified of added messages, if not nil
 }
 
 type timedmessage struct {
 	message *types.SignedMessage
+	cid     cid.Cid
 	addedAt abi.ChainEpoch
+	local   bool // originated by this node
+	index   int  // position in the eviction queue, or -1 if not eligible for eviction
 }
 
 type addressNonce struct {
@@ -57,13 +78,36 @@ func NewPool(cfg *config.MessagePoolConfig, validator PoolValidator) *Pool {
 		cfg:           cfg,
 		validator:     validator,
 		pending:       make(map[cid.Cid]*timedmessage),
-		addressNonces: make(map[addressNonce]bool),
+		addressNonces: make(map[addressNonce]cid.Cid),
+		senderCounts:  make(map[address.Address]uint),
 	}
 }
 
-// Add adds a message to the pool, tagged with the block height at which it was received.
-// Does nothing if the message is already in the pool.
+// Add adds a message received from the network to the pool, tagged with the block height at
+// which it was received.
+// Does nothing if the message is already in the pool. If the pool holds a different message
+// with the same sender and nonce, the new message replaces it if it pays a sufficiently higher
+// gas price, and is rejected otherwise.
 func (pool *Pool) Add(ctx context.Context, msg *types.SignedMessage, height abi.ChainEpoch) (cid.Cid, error) {
+	return pool.add(ctx, msg, height, false)
+}
+
+// AddLocal adds a message originated by this node to the pool, tagged with the block height at
+// which it was sent. It behaves as Add, except that the message is protected from eviction and
+// from the per-sender limit.
+func (pool *Pool) AddLocal(ctx context.Context, msg *types.SignedMessage, height abi.ChainEpoch) (cid.Cid, error) {
+	return pool.add(ctx, msg, height, true)
+}
+
+func (pool *Pool) add(ctx context.Context, msg *types.SignedMessage, height abi.ChainEpoch, local bool) (cid.Cid, error) {
+	// The observer is notified of an added message once the lock is released.
+	var added *types.SignedMessage
+	defer func() {
+		if added != nil {
+			pool.notify(added)
+		}
+	}()
+
 	pool.lk.Lock()
 	defer pool.lk.Unlock()
 
@@ -73,21 +117,84 @@ func (pool *Pool) Add(ctx context.Context, msg *types.SignedMessage, height abi.
 	}
 
 	// ignore message prior to validation if it is already in pool
-	_, found := pool.pending[c]
+	existing, found := pool.pending[c]
 	if found {
+		if local && !existing.local {
+			existing.local = true
+			pool.updateEvictable(existing)
+		}
 		return c, nil
 	}
 
-	if err = pool.validateMessage(ctx, msg); err != nil {
+	replaced, evicted, err := pool.validateMessage(ctx, msg, local)
+	if err != nil {
 		return cid.Undef, errors.Wrap(err, "validation error adding message to pool")
 	}
+	if replaced.Defined() {
+		// A replacement of a local message is a bump of it, presumably by this node.
+		local = local || pool.pending[replaced].local
+		pool.remove(replaced)
+	}
+	if evicted.Defined() {
+		pool.remove(evicted)
+		mpEvictCt.Inc(ctx, 1)
+	}
 
-	pool.pending[c] = &timedmessage{message: msg, addedAt: height}
-	pool.addressNonces[newAddressNonce(msg)] = true
+	tm := &timedmessage{message: msg, cid: c, addedAt: height, local: local, index: -1}
+	pool.pending[c] = tm
+	pool.addressNonces[newAddressNonce(msg)] = c
+	pool.senderCounts[msg.Message.From]++
+	pool.updateEvictable(tm)
+	if predecessor, ok := pool.predecessor(tm); ok {
+		pool.updateEvictable(predecessor)
+	}
 	mpSize.Set(ctx, int64(len(pool.pending)))
+	added = msg
 	return c, nil
 }
 
+func (pool *Pool) setObserver(o statusObserver) {
+	pool.lk.Lock()
+	defer pool.lk.Unlock()
+	pool.observer = o
+}
+
+// notify reports a pooled message to the observer, if any, by its outbox CID. The caller must not
+// hold the lock, as the observer may call back into the pool.
+func (pool *Pool) notify(msg *types.SignedMessage) {
+	pool.lk.RLock()
+	observer := pool.observer
+	pool.lk.RUnlock()
+	if observer == nil {
+		return
+	}
+	c, err := outboxCid(msg)
+	if err != nil {
+		log.Errorf("failed to compute CID of pooled message: %s", err)
+		return
+	}
+	observer.observe(c, StatusPooled)
+}
+
+// has tests whether the pool holds the message with outbox CID `c`.
+func (pool *Pool) has(c cid.Cid) bool {
+	pool.lk.RLock()
+	defer pool.lk.RUnlock()
+	if _, ok := pool.pending[c]; ok {
+		return true
+	}
+	// The outbox CID of a BLS message is that of the unsigned message.
+	for _, tm := range pool.pending {
+		if tm.message.Message.From.Protocol() != address.BLS {
+			continue
+		}
+		if mc, err := tm.message.Message.Cid(); err == nil && mc.Equals(c) {
+			return true
+		}
+	}
+	return false
+}
+
 // Pending returns all pending messages.
 func (pool *Pool) Pending() []*types.SignedMessage {
 	pool.lk.Lock()
@@ -118,13 +225,30 @@ func (pool *Pool) Get(c cid.Cid) (*types.SignedMessage, bool) {
 func (pool *Pool) Remove(c cid.Cid) {
 	pool.lk.Lock()
 	defer pool.lk.Unlock()
+	pool.remove(c)
+	mpSize.Set(context.TODO(), int64(len(pool.pending)))
+}
+
+// remove removes the message by CID, if present. The caller must hold the lock.
+func (pool *Pool) remove(c cid.Cid) {
 	msg, ok := pool.pending[c]
-	if ok {
-		delete(pool.addressNonces, newAddressNonce(msg.message))
-		delete(pool.pending, c)
+	if !ok {
+		return
+	}
+	delete(pool.addressNonces, newAddressNonce(msg.message))
+	delete(pool.pending, c)
+	from := msg.message.Message.From
+	if pool.senderCounts[from] <= 1 {
+		delete(pool.senderCounts, from)
+	} else {
+		pool.senderCounts[from]--
+	}
+	if msg.index >= 0 {
+		heap.Remove(&pool.evictable, msg.index)
+	}
+	if predecessor, ok := pool.predecessor(msg); ok {
+		pool.updateEvictable(predecessor)
 	}
-
-	mpSize.Set(context.TODO(), int64(len(pool.pending)))
 }
 
 // LargestNonce returns the largest nonce used by a message from address in the pool.
@@ -155,19 +279,115 @@ func (pool *Pool) PendingBefore(minimumHeight abi.ChainEpoch) []cid.Cid {
 	return cids
 }
 
-// validateMessage validates that too many messages aren't added to the pool and the ones that are
-// have a high probability of making it through processing.
-func (pool *Pool) validateMessage(ctx context.Context, message *types.SignedMessage) error {
-	if uint(len(pool.pending)) >= pool.cfg.MaxPoolSize {
-		return errors.Errorf("message pool is full (%d messages)", pool.cfg.MaxPoolSize)
+// MinReplacementGasPrice returns the lowest gas price with which a message may replace a pending
+// message with gas price `price`: `percent` percent higher, and at least one attoFIL higher.
+func MinReplacementGasPrice(price types.AttoFIL, percent uint) types.AttoFIL {
+	min := big.Div(big.Mul(price, big.NewInt(int64(100+percent))), big.NewInt(100))
+	if min.LessThanEqual(price) {
+		min = big.Add(price, big.NewInt(1))
 	}
+	return min
+}
 
-	// check that message with this nonce does not already exist
-	_, found := pool.addressNonces[newAddressNonce(message)]
+// validateMessage validates that too many messages aren't added to the pool and the ones that are
+// have a high probability of making it through processing. If the message replaces a pending
+// message with the same nonce, validateMessage returns the CID of the replaced message. If the
+// pool is full and the message outbids a pending message, it returns the CID of the message to
+// evict to make room for it.
+func (pool *Pool) validateMessage(ctx context.Context, message *types.SignedMessage, local bool) (replaced cid.Cid, evicted cid.Cid, err error) {
+	// check that message with this nonce does not already exist, unless it pays enough to replace it
+	replaced, found := pool.addressNonces[newAddressNonce(message)]
 	if found {
-		return errors.Errorf("message pool contains message with same actor and nonce but different cid")
+		existing := pool.pending[replaced].message
+		minPrice := MinReplacementGasPrice(existing.Message.GasPrice, pool.cfg.ReplaceByFeePercent)
+		if message.Message.GasPrice.LessThan(minPrice) {
+			return cid.Undef, cid.Undef, errors.Errorf("message pool contains message with same actor and nonce but different cid, replacement requires a gas price of at least %s", minPrice)
+		}
+	} else {
+		if !local && pool.senderCounts[message.Message.From] >= pool.cfg.MaxPendingPerSender {
+			return cid.Undef, cid.Undef, errors.Errorf("message pool contains too many messages from %s (%d messages)", message.Message.From, pool.cfg.MaxPendingPerSender)
+		}
+		if uint(len(pool.pending)) >= pool.cfg.MaxPoolSize {
+			evicted, found = pool.evictionCandidate()
+			if !found {
+				return cid.Undef, cid.Undef, errors.Errorf("message pool is full (%d messages)", pool.cfg.MaxPoolSize)
+			}
+			if !local && !message.Message.GasPrice.GreaterThan(pool.pending[evicted].message.Message.GasPrice) {
+				return cid.Undef, cid.Undef, errors.Errorf("message pool is full (%d messages) and message gas price is too low", pool.cfg.MaxPoolSize)
+			}
+		}
 	}
 
 	// check that the message is likely to succeed in processing
-	return pool.validator.ValidateSignedMessageSyntax(ctx, message)
+	if err := pool.validator.ValidateSignedMessageSyntax(ctx, message); err != nil {
+		return cid.Undef, cid.Undef, err
+	}
+	return replaced, evicted, nil
+}
+
+// evictionCandidate returns the CID of the non-local message with the lowest gas price among
+// those with no pending successor from the same sender, or false if there is none.
+func (pool *Pool) evictionCandidate() (cid.Cid, bool) {
+	if len(pool.evictable) == 0 {
+		return cid.Undef, false
+	}
+	return pool.evictable[0].cid, true
+}
+
+// updateEvictable adds a pending message to the eviction queue or removes it from it,
+// according to whether it is eligible for eviction. The caller must hold the lock.
+func (pool *Pool) updateEvictable(tm *timedmessage) {
+	successor := addressNonce{addr: tm.message.Message.From, nonce: tm.message.Message.CallSeqNum + 1}
+	_, hasSuccessor := pool.addressNonces[successor]
+	eligible := !tm.local && !hasSuccessor
+	if eligible && tm.index < 0 {
+		heap.Push(&pool.evictable, tm)
+	} else if !eligible && tm.index >= 0 {
+		heap.Remove(&pool.evictable, tm.index)
+	}
+}
+
+// predecessor returns the pending message from the same sender with the previous nonce, if any.
+// The caller must hold the lock.
+func (pool *Pool) predecessor(tm *timedmessage) (*timedmessage, bool) {
+	nonce := tm.message.Message.CallSeqNum
+	if nonce == 0 {
+		return nil, false
+	}
+	c, ok := pool.addressNonces[addressNonce{addr: tm.message.Message.From, nonce: nonce - 1}]
+	if !ok {
+		return nil, false
+	}
+	return pool.pending[c], true
+}
+
+// evictionQueue is a min-heap of pending messages by gas price, implementing heap.Interface.
+type evictionQueue []*timedmessage
+
+func (q evictionQueue) Len() int { return len(q) }
+
+func (q evictionQueue) Less(i, j int) bool {
+	return q[i].message.Message.GasPrice.LessThan(q[j].message.Message.GasPrice)
+}
+
+func (q evictionQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *evictionQueue) Push(x interface{}) {
+	tm := x.(*timedmessage)
+	tm.index = len(*q)
+	*q = append(*q, tm)
+}
+
+func (q *evictionQueue) Pop() interface{} {
+	old := *q
+	n := len(old)
+	tm := old[n-1]
+	old[n-1] = nil
+	tm.index = -1
+	*q = old[:n-1]
+	return tm
 }
@@ -101,6 +101,129 @@ func TestMessagePoolValidate(t *testing.T) {
 		assert.Contains(t, err.Error(), "message with same actor and nonce")
 	})
 
+	t.Run("replaces message with same nonce and sufficiently higher gas price", func(t *testing.T) {
+		ctx := context.Background()
+		mpoolCfg := config.NewDefaultConfig().Mpool
+		mpoolCfg.MaxPoolSize = 1
+		pool := message.NewPool(mpoolCfg, th.NewMockMessagePoolValidator())
+
+		smsg1 := mustResignMessage(mockSigner, newSignedMessage(), func(m *types.UnsignedMessage) {
+			m.GasPrice = types.NewGasPrice(100)
+		})
+		c1, err := pool.Add(ctx, smsg1, 0)
+		require.NoError(t, err)
+
+		minPrice := message.MinReplacementGasPrice(smsg1.Message.GasPrice, mpoolCfg.ReplaceByFeePercent)
+		assert.Equal(t, types.NewGasPrice(125), minPrice)
+
+		cheap := mustResignMessage(mockSigner, smsg1, func(m *types.UnsignedMessage) {
+			m.GasPrice = types.NewGasPrice(124)
+		})
+		_, err = pool.Add(ctx, cheap, 0)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "message with same actor and nonce")
+
+		// Replacement succeeds even though the pool is full.
+		smsg2 := mustResignMessage(mockSigner, smsg1, func(m *types.UnsignedMessage) {
+			m.GasPrice = minPrice
+		})
+		c2, err := pool.Add(ctx, smsg2, 0)
+		require.NoError(t, err)
+		assert.Equal(t, []*types.SignedMessage{smsg2}, pool.Pending())
+		_, found := pool.Get(c1)
+		assert.False(t, found)
+
+		pool.Remove(c2)
+		assert.Empty(t, pool.Pending())
+		_, err = pool.Add(ctx, smsg1, 0)
+		assert.NoError(t, err)
+	})
+
+	t.Run("replacement of free message requires a non-zero gas price", func(t *testing.T) {
+		assert.Equal(t, types.NewGasPrice(1), message.MinReplacementGasPrice(types.NewGasPrice(0), 25))
+		assert.Equal(t, types.NewGasPrice(2), message.MinReplacementGasPrice(types.NewGasPrice(1), 25))
+	})
+
+	t.Run("evicts lowest gas price message when full", func(t *testing.T) {
+		ctx := context.Background()
+		mpoolCfg := config.NewDefaultConfig().Mpool
+		mpoolCfg.MaxPoolSize = 3
+		pool := message.NewPool(mpoolCfg, th.NewMockMessagePoolValidator())
+
+		withPrice := func(from int, nonce uint64, price int64) *types.SignedMessage {
+			return mustResignMessage(mockSigner, newSignedMessage(), func(m *types.UnsignedMessage) {
+				m.From = mockSigner.Addresses[from]
+				m.CallSeqNum = nonce
+				m.GasPrice = types.NewGasPrice(price)
+			})
+		}
+
+		// The cheapest message is not evictable because a later one from the same sender depends on it.
+		cheap := withPrice(1, 0, 1)
+		successor := withPrice(1, 1, 3)
+		other := withPrice(2, 0, 2)
+		reqAdd(t, pool, 0, cheap, successor, other)
+
+		_, err := pool.Add(ctx, withPrice(3, 0, 2), 0)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "message pool is full")
+
+		bidder := withPrice(3, 0, 4)
+		reqAdd(t, pool, 0, bidder)
+		assert.ElementsMatch(t, []*types.SignedMessage{cheap, successor, bidder}, pool.Pending())
+
+		// Once its successor is removed, the cheapest message becomes evictable.
+		successorCid, err := successor.Cid()
+		require.NoError(t, err)
+		pool.Remove(successorCid)
+		filler := withPrice(4, 0, 5)
+		late := withPrice(5, 0, 2)
+		reqAdd(t, pool, 0, filler, late)
+		assert.ElementsMatch(t, []*types.SignedMessage{bidder, filler, late}, pool.Pending())
+	})
+
+	t.Run("local messages are not evicted or limited per sender", func(t *testing.T) {
+		ctx := context.Background()
+		mpoolCfg := config.NewDefaultConfig().Mpool
+		mpoolCfg.MaxPoolSize = 2
+		mpoolCfg.MaxPendingPerSender = 1
+		pool := message.NewPool(mpoolCfg, th.NewMockMessagePoolValidator())
+
+		local0 := mustSetNonce(mockSigner, newSignedMessage(), 0)
+		local1 := mustSetNonce(mockSigner, newSignedMessage(), 1)
+		_, err := pool.AddLocal(ctx, local0, 0)
+		require.NoError(t, err)
+		_, err = pool.AddLocal(ctx, local1, 0)
+		require.NoError(t, err)
+
+		remote := mustResignMessage(mockSigner, newSignedMessage(), func(m *types.UnsignedMessage) {
+			m.From = mockSigner.Addresses[1]
+			m.GasPrice = types.NewGasPrice(1000)
+		})
+		_, err = pool.Add(ctx, remote, 0)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "message pool is full")
+
+		// A local message evicts a remote one regardless of gas price.
+		c1, err := local1.Cid()
+		require.NoError(t, err)
+		pool.Remove(c1)
+		reqAdd(t, pool, 0, remote)
+		local2 := mustResignMessage(mockSigner, local1, func(m *types.UnsignedMessage) {
+			m.From = mockSigner.Addresses[2]
+		})
+		c2, err := pool.AddLocal(ctx, local2, 0)
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []*types.SignedMessage{local0, local2}, pool.Pending())
+
+		// Remote messages are limited per sender.
+		pool.Remove(c2)
+		_, err = pool.Add(ctx, local1, 0)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "too many messages")
+		reqAdd(t, pool, 0, remote)
+	})
+
 	t.Run("validates using supplied validator", func(t *testing.T) {
 		ctx := context.Background()
 		validator := th.NewMockMessagePoolValidator()
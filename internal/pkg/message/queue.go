@@ -4,6 +4,8 @@ import (
 	"context"
 	"sync"
 
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
 	"github.com/pkg/errors"
 
 	"github.com/filecoin-project/go-address"
@@ -13,9 +15,10 @@ import (
 )
 
 var (
-	mqSizeGa   = metrics.NewInt64Gauge("message_queue_size", "The size of the message queue")
-	mqOldestGa = metrics.NewInt64Gauge("message_queue_oldest", "The age of the oldest message in the queue or zero when empty")
-	mqExpireCt = metrics.NewInt64Counter("message_queue_expire", "The number messages expired from the queue")
+	mqSizeGa        = metrics.NewInt64Gauge("message_queue_size", "The size of the message queue")
+	mqOldestGa      = metrics.NewInt64Gauge("message_queue_oldest", "The age of the oldest message in the queue or zero when empty")
+	mqExpireCt      = metrics.NewInt64Counter("message_queue_expire", "The number messages expired from the queue")
+	mqRebroadcastCt = metrics.NewInt64Counter("message_queue_rebroadcast", "The number of messages rebroadcast from the queue")
 )
 
 // Queue stores an ordered list of messages (per actor) and enforces that their nonces form a contiguous sequence.
@@ -24,17 +27,25 @@ var (
 // not enforced.
 // A message queue is intended to record outbound messages that have been transmitted but not yet appeared in a block,
 // where the stamp could be block height.
+// A queue constructed with NewPersistentQueue also writes its messages to a datastore, so that they
+// survive a restart.
 // Queue is safe for concurrent access.
 type Queue struct {
 	lk sync.RWMutex
 	// Message queues keyed by sending actor address, in nonce order
 	queues map[address.Address][]*Queued
+	// Persists queued messages, if not nil
+	ds datastore.Datastore
+	// Notified of queued messages, if not nil
+	observer statusObserver
 }
 
 // Queued is a message an the stamp it was enqueued with.
 type Queued struct {
 	Msg   *types.SignedMessage
 	Stamp uint64
+	// Stamp at which the message was last rebroadcast, or zero if it has not been
+	Rebroadcast uint64 `json:",omitempty"`
 }
 
 // NewQueue constructs a new, empty queue.
@@ -53,6 +64,14 @@ func (mq *Queue) Enqueue(ctx context.Context, msg *types.SignedMessage, stamp ui
 		mqOldestGa.Set(ctx, int64(mq.Oldest()))
 	}()
 
+	// The observer is notified once the lock is released.
+	notify := false
+	defer func() {
+		if notify {
+			mq.notify(msg)
+		}
+	}()
+
 	mq.lk.Lock()
 	defer mq.lk.Unlock()
 
@@ -63,7 +82,12 @@ func (mq *Queue) Enqueue(ctx context.Context, msg *types.SignedMessage, stamp ui
 			return errors.Errorf("Invalid nonce in %d in enqueue, expected %d", msg.Message.CallSeqNum, nextNonce)
 		}
 	}
-	mq.queues[msg.Message.From] = append(q, &Queued{msg, stamp})
+	qm := &Queued{Msg: msg, Stamp: stamp}
+	if err := mq.put(qm); err != nil {
+		return err
+	}
+	mq.queues[msg.Message.From] = append(q, qm)
+	notify = true
 	return nil
 }
 
@@ -75,6 +99,14 @@ func (mq *Queue) Requeue(ctx context.Context, msg *types.SignedMessage, stamp ui
 		mqOldestGa.Set(ctx, int64(mq.Oldest()))
 	}()
 
+	// The observer is notified once the lock is released.
+	notify := false
+	defer func() {
+		if notify {
+			mq.notify(msg)
+		}
+	}()
+
 	mq.lk.Lock()
 	defer mq.lk.Unlock()
 
@@ -85,10 +117,43 @@ func (mq *Queue) Requeue(ctx context.Context, msg *types.SignedMessage, stamp ui
 			return errors.Errorf("Invalid nonce %d in requeue, expected %d", msg.Message.CallSeqNum, prevNonce)
 		}
 	}
-	mq.queues[msg.Message.From] = append([]*Queued{{msg, stamp}}, q...)
+	qm := &Queued{Msg: msg, Stamp: stamp}
+	if err := mq.put(qm); err != nil {
+		return err
+	}
+	mq.queues[msg.Message.From] = append([]*Queued{qm}, q...)
+	notify = true
 	return nil
 }
 
+// Replace swaps the queued message with the same sender and nonce as `msg` for `msg`, retaining
+// the original stamp. Returns the replaced message, or an error if there is no such message.
+func (mq *Queue) Replace(ctx context.Context, msg *types.SignedMessage) (*types.SignedMessage, error) {
+	// The observer is notified once the lock is released.
+	notify := false
+	defer func() {
+		if notify {
+			mq.notify(msg)
+		}
+	}()
+
+	mq.lk.Lock()
+	defer mq.lk.Unlock()
+
+	for _, qm := range mq.queues[msg.Message.From] {
+		if qm.Msg.Message.CallSeqNum == msg.Message.CallSeqNum {
+			if err := mq.put(&Queued{Msg: msg, Stamp: qm.Stamp, Rebroadcast: qm.Rebroadcast}); err != nil {
+				return nil, err
+			}
+			replaced := qm.Msg
+			qm.Msg = msg
+			notify = true
+			return replaced, nil
+		}
+	}
+	return nil, errors.Errorf("no message from %s with nonce %d in queue", msg.Message.From, msg.Message.CallSeqNum)
+}
+
 // RemoveNext removes and returns a single message from the queue, if it bears the expected nonce value, with found = true.
 // Returns found = false if the queue is empty or the expected nonce is less than any in the queue for that address
 // (indicating the message had already been removed).
@@ -107,6 +172,9 @@ func (mq *Queue) RemoveNext(ctx context.Context, sender address.Address, expecte
 	if len(q) > 0 {
 		head := q[0]
 		if expectedNonce == head.Msg.Message.CallSeqNum {
+			if err = mq.delete(head.Msg); err != nil {
+				return
+			}
 			mq.queues[sender] = q[1:] // pop the head
 			msg = head.Msg
 			found = true
@@ -131,6 +199,11 @@ func (mq *Queue) Clear(ctx context.Context, sender address.Address) bool {
 
 	q := mq.queues[sender]
 	delete(mq.queues, sender)
+	for _, qm := range q {
+		if err := mq.delete(qm.Msg); err != nil {
+			log.Errorf("failed to delete cleared message from queue datastore: %s", err)
+		}
+	}
 	return len(q) > 0
 }
 
@@ -154,6 +227,9 @@ func (mq *Queue) ExpireBefore(ctx context.Context, stamp uint64) map[address.Add
 			mqExpireCt.Inc(ctx, int64(len(q)))
 			for _, m := range q {
 				expired[sender] = append(expired[sender], m.Msg)
+				if err := mq.delete(m.Msg); err != nil {
+					log.Errorf("failed to delete expired message from queue datastore: %s", err)
+				}
 			}
 
 			mq.queues[sender] = []*Queued{}
@@ -162,6 +238,32 @@ func (mq *Queue) ExpireBefore(ctx context.Context, stamp uint64) map[address.Add
 	return expired
 }
 
+// RebroadcastBefore selects for rebroadcast the messages that were last published, either when
+// enqueued or rebroadcast, at a stamp less than `stamp`, and records them as rebroadcast at `now`.
+// Returns the selected messages for each sender, in nonce order.
+func (mq *Queue) RebroadcastBefore(ctx context.Context, stamp, now uint64) map[address.Address][]*types.SignedMessage {
+	mq.lk.Lock()
+	defer mq.lk.Unlock()
+
+	due := make(map[address.Address][]*types.SignedMessage)
+	for sender, q := range mq.queues {
+		for _, qm := range q {
+			published := qm.Stamp
+			if qm.Rebroadcast > published {
+				published = qm.Rebroadcast
+			}
+			if published < stamp {
+				qm.Rebroadcast = now
+				if err := mq.put(qm); err != nil {
+					log.Errorf("failed to record rebroadcast message in queue datastore: %s", err)
+				}
+				due[sender] = append(due[sender], qm.Msg)
+			}
+		}
+	}
+	return due
+}
+
 // LargestNonce returns the largest nonce of any message in the queue for an address.
 // If the queue for the address is empty, returns (0, false).
 func (mq *Queue) LargestNonce(sender address.Address) (largest uint64, found bool) {
@@ -236,3 +338,40 @@ func (mq *Queue) List(sender address.Address) []*Queued {
 	}
 	return out
 }
+
+// has tests whether the queue holds the message with outbox CID `c`.
+func (mq *Queue) has(c cid.Cid) bool {
+	mq.lk.RLock()
+	defer mq.lk.RUnlock()
+	for _, q := range mq.queues {
+		for _, qm := range q {
+			if qc, err := outboxCid(qm.Msg); err == nil && qc.Equals(c) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (mq *Queue) setObserver(o statusObserver) {
+	mq.lk.Lock()
+	defer mq.lk.Unlock()
+	mq.observer = o
+}
+
+// notify reports a queued message to the observer, if any, by its outbox CID. The caller must not
+// hold the lock, as the observer may call back into the queue.
+func (mq *Queue) notify(msg *types.SignedMessage) {
+	mq.lk.RLock()
+	observer := mq.observer
+	mq.lk.RUnlock()
+	if observer == nil {
+		return
+	}
+	c, err := outboxCid(msg)
+	if err != nil {
+		log.Errorf("failed to compute CID of queued message: %s", err)
+		return
+	}
+	observer.observe(c, StatusQueued)
+}
@@ -0,0 +1,87 @@
+package message
+
+import (
+	"sort"
+	"strconv"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	"github.com/pkg/errors"
+
+	"github.com/filecoin-project/go-address"
+
+	"github.com/filecoin-project/go-filecoin/internal/pkg/encoding"
+	"github.com/filecoin-project/go-filecoin/internal/pkg/types"
+)
+
+// QueuePrefix is the datastore namespace under which a persistent queue writes its messages.
+var QueuePrefix = datastore.NewKey("/message/queue")
+
+// queuedRecord is the persisted form of a queued message.
+type queuedRecord struct {
+	// control field for encoding struct as an array
+	_           struct{} `cbor:",toarray"`
+	Msg         *types.SignedMessage
+	Stamp       uint64
+	Rebroadcast uint64
+}
+
+// NewPersistentQueue constructs a queue that persists its messages in `ds`, initially holding
+// any messages previously persisted there.
+func NewPersistentQueue(ds datastore.Datastore) (*Queue, error) {
+	mq := NewQueue()
+	mq.ds = ds
+
+	res, err := ds.Query(query.Query{Prefix: QueuePrefix.String()})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to query queued messages")
+	}
+	entries, err := res.Rest()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read queued messages")
+	}
+	for _, entry := range entries {
+		var rec queuedRecord
+		if err := encoding.Decode(entry.Value, &rec); err != nil {
+			return nil, errors.Wrapf(err, "failed to decode queued message %s", entry.Key)
+		}
+		from := rec.Msg.Message.From
+		mq.queues[from] = append(mq.queues[from], &Queued{Msg: rec.Msg, Stamp: rec.Stamp, Rebroadcast: rec.Rebroadcast})
+	}
+	for _, q := range mq.queues {
+		sort.Slice(q, func(i, j int) bool {
+			return q[i].Msg.Message.CallSeqNum < q[j].Msg.Message.CallSeqNum
+		})
+	}
+	return mq, nil
+}
+
+// put writes a queued message to the datastore, if any. The caller must hold the lock.
+func (mq *Queue) put(qm *Queued) error {
+	if mq.ds == nil {
+		return nil
+	}
+	val, err := encoding.Encode(queuedRecord{Msg: qm.Msg, Stamp: qm.Stamp, Rebroadcast: qm.Rebroadcast})
+	if err != nil {
+		return errors.Wrap(err, "failed to encode queued message")
+	}
+	if err := mq.ds.Put(queueKey(qm.Msg.Message.From, qm.Msg.Message.CallSeqNum), val); err != nil {
+		return errors.Wrap(err, "failed to write queued message")
+	}
+	return nil
+}
+
+// delete removes a queued message from the datastore, if any. The caller must hold the lock.
+func (mq *Queue) delete(msg *types.SignedMessage) error {
+	if mq.ds == nil {
+		return nil
+	}
+	if err := mq.ds.Delete(queueKey(msg.Message.From, msg.Message.CallSeqNum)); err != nil && err != datastore.ErrNotFound {
+		return errors.Wrap(err, "failed to delete queued message")
+	}
+	return nil
+}
+
+func queueKey(sender address.Address, nonce uint64) datastore.Key {
+	return QueuePrefix.ChildString(sender.String()).ChildString(strconv.FormatUint(nonce, 10))
+}
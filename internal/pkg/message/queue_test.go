@@ -10,6 +10,7 @@ import (
 	"github.com/stretchr/testify/require"
 
 	"github.com/filecoin-project/go-filecoin/internal/pkg/message"
+	"github.com/filecoin-project/go-filecoin/internal/pkg/repo"
 	tf "github.com/filecoin-project/go-filecoin/internal/pkg/testhelpers/testflags"
 	"github.com/filecoin-project/go-filecoin/internal/pkg/types"
 	"github.com/filecoin-project/go-filecoin/internal/pkg/vm"
@@ -326,6 +327,36 @@ func TestMessageQueue(t *testing.T) {
 		assertNoNonce(q, bob)
 	})
 
+	t.Run("rebroadcast before stamp", func(t *testing.T) {
+		fromAlice := []*types.SignedMessage{
+			mm.NewSignedMessage(alice, 0),
+			mm.NewSignedMessage(alice, 1),
+		}
+		fromBob := mm.NewSignedMessage(bob, 10)
+		q := message.NewQueue()
+
+		requireEnqueue(q, fromAlice[0], 100)
+		requireEnqueue(q, fromAlice[1], 102)
+		requireEnqueue(q, fromBob, 200)
+
+		assert.Empty(t, q.RebroadcastBefore(ctx, 100, 105))
+
+		due := q.RebroadcastBefore(ctx, 103, 105)
+		assert.Equal(t, map[address.Address][]*types.SignedMessage{
+			alice: {fromAlice[0], fromAlice[1]},
+		}, due)
+		assert.Equal(t, &message.Queued{Msg: fromAlice[0], Stamp: 100, Rebroadcast: 105}, q.List(alice)[0])
+		assert.Equal(t, &message.Queued{Msg: fromBob, Stamp: 200}, q.List(bob)[0])
+
+		// Messages are next due relative to when they were rebroadcast.
+		assert.Empty(t, q.RebroadcastBefore(ctx, 105, 110))
+		due = q.RebroadcastBefore(ctx, 106, 110)
+		assert.Equal(t, map[address.Address][]*types.SignedMessage{
+			alice: {fromAlice[0], fromAlice[1]},
+		}, due)
+		assert.Len(t, q.List(alice), 2)
+	})
+
 	t.Run("oldest is correct", func(t *testing.T) {
 		fromAlice := []*types.SignedMessage{
 			mm.NewSignedMessage(alice, 0),
@@ -352,4 +383,40 @@ func TestMessageQueue(t *testing.T) {
 		assert.Equal(t, uint64(1), q.Oldest())
 
 	})
+
+	t.Run("persistent queue survives restart", func(t *testing.T) {
+		ds := repo.NewInMemoryRepo().Datastore()
+		fromAlice := []*types.SignedMessage{
+			mm.NewSignedMessage(alice, 0),
+			mm.NewSignedMessage(alice, 1),
+			mm.NewSignedMessage(alice, 2),
+		}
+		fromBob := mm.NewSignedMessage(bob, 10)
+
+		q, err := message.NewPersistentQueue(ds)
+		require.NoError(t, err)
+		requireEnqueue(q, fromAlice[1], 100)
+		requireEnqueue(q, fromAlice[2], 101)
+		requireRequeue(q, fromAlice[0], 99)
+		requireEnqueue(q, fromBob, 102)
+		assert.Equal(t, fromAlice[0], requireRemoveNext(q, alice, 0))
+		q.Clear(ctx, bob)
+		due := q.RebroadcastBefore(ctx, 101, 104)
+		assert.Equal(t, []*types.SignedMessage{fromAlice[1]}, due[alice])
+
+		restored, err := message.NewPersistentQueue(ds)
+		require.NoError(t, err)
+		restoredAlice := restored.List(alice)
+		require.Len(t, restoredAlice, 2)
+		for i, qm := range q.List(alice) {
+			assert.True(t, qm.Msg.Equals(restoredAlice[i].Msg))
+			assert.Equal(t, qm.Stamp, restoredAlice[i].Stamp)
+			assert.Equal(t, qm.Rebroadcast, restoredAlice[i].Rebroadcast)
+		}
+		assert.Equal(t, uint64(104), restoredAlice[0].Rebroadcast)
+		assert.Equal(t, uint64(0), restoredAlice[1].Rebroadcast)
+		assert.Equal(t, int64(2), restored.Size())
+		assertNoNonce(restored, bob)
+		requireEnqueue(restored, mm.NewSignedMessage(alice, 3), 103)
+	})
 }
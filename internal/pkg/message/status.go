@@ -0,0 +1,342 @@
+package message
+
+import (
+	"context"
+	"sync"
+
+	"github.com/filecoin-project/specs-actors/actors/abi"
+	"github.com/ipfs/go-cid"
+	"github.com/pkg/errors"
+
+	"github.com/filecoin-project/go-filecoin/internal/pkg/block"
+	"github.com/filecoin-project/go-filecoin/internal/pkg/chain"
+)
+
+// Status is a stage in the lifecycle of a message.
+type Status string
+
+const (
+	// StatusQueued is reported when a message is added to this node's outbound queue.
+	StatusQueued Status = "queued"
+	// StatusPooled is reported when a message is added to the message pool.
+	StatusPooled Status = "pooled"
+	// StatusIncluded is reported when a message is included in a tipset on the chain.
+	StatusIncluded Status = "included"
+	// StatusReverted is reported when the tipset including a message is reverted.
+	StatusReverted Status = "reverted"
+	// StatusFinalized is reported when the tipset including a message is buried beyond
+	// the finality depth. No further events follow.
+	StatusFinalized Status = "finalized"
+)
+
+// StatusEvent reports a change in the status of a message.
+type StatusEvent struct {
+	// Outbox CID of the message, as returned when it is sent: the CID of the signed message for
+	// secp senders and of the unsigned message for BLS senders
+	Cid    cid.Cid
+	Status Status
+	// Tipset including the message and its epoch, for included, reverted and finalized events
+	TipSet block.TipSetKey
+	Epoch  abi.ChainEpoch
+}
+
+// Capacity of each subscription's channel. A subscriber falling this far behind is
+// disconnected rather than block the components reporting events.
+const statusSubBuffer = 16
+
+// statusObserver is notified, by outbox CID, as messages enter the outbound queue and message pool.
+type statusObserver interface {
+	observe(c cid.Cid, status Status)
+}
+
+// Abstracts over a store of blockchain state.
+type statusChainReader interface {
+	GetHead() block.TipSetKey
+	GetTipSet(block.TipSetKey) (block.TipSet, error)
+}
+
+// StatusTracker follows the lifecycle of messages through the outbound queue, the message pool
+// and the chain, and streams status events to subscribers.
+// Only messages with subscribers are tracked.
+type StatusTracker struct {
+	chain    statusChainReader
+	messages chain.MessageProvider
+	pool     *Pool
+	queue    *Queue
+	// Number of epochs after which a message's inclusion is considered final
+	finality abi.ChainEpoch
+
+	lk      sync.Mutex
+	watched map[cid.Cid]*watchedMessage
+}
+
+type watchedMessage struct {
+	subs map[*statusSub]struct{}
+	// Tipset including the message, undefined until it is included
+	included block.TipSet
+}
+
+type statusSub struct {
+	ch chan StatusEvent
+	// Status of the last event sent, to suppress repeated events
+	last Status
+}
+
+// NewStatusTracker constructs a tracker observing `pool` and `queue`, and considering inclusion
+// final after `finality` epochs.
+func NewStatusTracker(chainReader statusChainReader, messages chain.MessageProvider, pool *Pool, queue *Queue, finality abi.ChainEpoch) *StatusTracker {
+	t := &StatusTracker{
+		chain:    chainReader,
+		messages: messages,
+		pool:     pool,
+		queue:    queue,
+		finality: finality,
+		watched:  make(map[cid.Cid]*watchedMessage),
+	}
+	pool.setObserver(t)
+	queue.setObserver(t)
+	return t
+}
+
+// Watch streams status events for the message with outbox CID `c` until it is finalized or `ctx` is
+// done, when the channel is closed. The first events report the message's current status: in
+// the outbound queue, in the pool, or included within the `lookback` most recent tipsets.
+// The channel is also closed, without a finalized event, if the subscriber falls more than
+// statusSubBuffer events behind.
+func (t *StatusTracker) Watch(ctx context.Context, c cid.Cid, lookback uint) (<-chan StatusEvent, error) {
+	sub := &statusSub{ch: make(chan StatusEvent, statusSubBuffer)}
+	t.lk.Lock()
+	w, ok := t.watched[c]
+	if !ok {
+		w = &watchedMessage{subs: make(map[*statusSub]struct{}), included: block.UndefTipSet}
+		t.watched[c] = w
+	}
+	w.subs[sub] = struct{}{}
+	t.lk.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		t.unsubscribe(c, sub)
+	}()
+
+	// Report the current status, now that no change can be missed.
+	if t.queue.has(c) {
+		t.observe(c, StatusQueued)
+	}
+	if t.pool.has(c) {
+		t.observe(c, StatusPooled)
+	}
+	if err := t.findIncluded(ctx, c, lookback); err != nil {
+		t.unsubscribe(c, sub)
+		return nil, err
+	}
+	return sub.ch, nil
+}
+
+// HandleHeadChange reports the inclusion, reversion and finality of watched messages in the
+// tipsets of a chain head change.
+func (t *StatusTracker) HandleHeadChange(ctx context.Context, change chain.HeadChange) error {
+	if len(change.Apply) == 0 || !change.Apply[0].Defined() {
+		log.Warn("received head change without new head, ignoring")
+		return nil
+	}
+
+	// Reversions are reported first, and the messages awaiting inclusion noted.
+	t.lk.Lock()
+	for _, ts := range change.Revert {
+		for c, w := range t.watched {
+			if w.included.Defined() && w.included.Equals(ts) {
+				w.included = block.UndefTipSet
+				t.publish(c, w, StatusReverted, ts)
+			}
+		}
+	}
+	pending := make(map[cid.Cid]struct{})
+	for c, w := range t.watched {
+		if !w.included.Defined() {
+			pending[c] = struct{}{}
+		}
+	}
+	t.lk.Unlock()
+
+	// Messages are looked for in the applied tipsets without holding the lock. Messages watched
+	// meanwhile are looked for by Watch itself.
+	var inclusions []inclusion
+	// Applied tipsets are in descending height order.
+	for i := len(change.Apply) - 1; i >= 0 && len(pending) > 0; i-- {
+		ts := change.Apply[i]
+		found, err := t.included(ctx, ts, pending)
+		if err != nil {
+			return errors.Wrapf(err, "failed to find watched messages in tipset %s", ts.Key())
+		}
+		for _, c := range found {
+			inclusions = append(inclusions, inclusion{c, ts})
+		}
+	}
+
+	height, err := change.Apply[0].Height()
+	if err != nil {
+		return err
+	}
+
+	t.lk.Lock()
+	defer t.lk.Unlock()
+	for _, inc := range inclusions {
+		if w, ok := t.watched[inc.cid]; ok && !w.included.Defined() {
+			w.included = inc.ts
+			t.publish(inc.cid, w, StatusIncluded, inc.ts)
+		}
+	}
+	for c, w := range t.watched {
+		if err := t.checkFinality(c, w, height); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// inclusion records a message found in a tipset.
+type inclusion struct {
+	cid cid.Cid
+	ts  block.TipSet
+}
+
+// observe reports a message entering the outbound queue or the pool.
+func (t *StatusTracker) observe(c cid.Cid, status Status) {
+	t.lk.Lock()
+	defer t.lk.Unlock()
+	if w, ok := t.watched[c]; ok {
+		t.publish(c, w, status, block.UndefTipSet)
+	}
+}
+
+// findIncluded searches the `lookback` most recent tipsets for a watched message.
+func (t *StatusTracker) findIncluded(ctx context.Context, c cid.Cid, lookback uint) error {
+	head, err := t.chain.GetTipSet(t.chain.GetHead())
+	if err != nil {
+		return errors.Wrap(err, "failed to load chain head")
+	}
+	headHeight, err := head.Height()
+	if err != nil {
+		return err
+	}
+
+	wanted := map[cid.Cid]struct{}{c: {}}
+	iter := chain.IterAncestors(ctx, t.chain, head)
+	for i := uint(0); i < lookback && !iter.Complete(); i++ {
+		found, err := t.included(ctx, iter.Value(), wanted)
+		if err != nil {
+			return err
+		}
+		if len(found) > 0 {
+			t.lk.Lock()
+			defer t.lk.Unlock()
+			if w, ok := t.watched[c]; ok && !w.included.Defined() {
+				w.included = iter.Value()
+				t.publish(c, w, StatusIncluded, w.included)
+				return t.checkFinality(c, w, headHeight)
+			}
+			return nil
+		}
+		if err := iter.Next(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// included returns the CIDs of those of the `wanted` messages that are included in a tipset.
+func (t *StatusTracker) included(ctx context.Context, ts block.TipSet, wanted map[cid.Cid]struct{}) ([]cid.Cid, error) {
+	var found []cid.Cid
+	check := func(c cid.Cid) {
+		if _, ok := wanted[c]; ok {
+			found = append(found, c)
+			delete(wanted, c)
+		}
+	}
+	for i := 0; i < ts.Len(); i++ {
+		secpMsgs, blsMsgs, err := t.messages.LoadMessages(ctx, ts.At(i).Messages.Cid)
+		if err != nil {
+			return nil, err
+		}
+		for _, msg := range secpMsgs {
+			c, err := msg.Cid()
+			if err != nil {
+				return nil, err
+			}
+			check(c)
+		}
+		for _, msg := range blsMsgs {
+			c, err := msg.Cid()
+			if err != nil {
+				return nil, err
+			}
+			check(c)
+		}
+	}
+	return found, nil
+}
+
+// checkFinality reports a watched message whose inclusion has become final, and stops watching
+// it. The caller must hold the lock.
+func (t *StatusTracker) checkFinality(c cid.Cid, w *watchedMessage, headHeight abi.ChainEpoch) error {
+	if !w.included.Defined() {
+		return nil
+	}
+	height, err := w.included.Height()
+	if err != nil {
+		return err
+	}
+	if headHeight-height < t.finality {
+		return nil
+	}
+	t.publish(c, w, StatusFinalized, w.included)
+	for sub := range w.subs {
+		close(sub.ch)
+	}
+	delete(t.watched, c)
+	return nil
+}
+
+// publish sends an event to the subscribers of a watched message, disconnecting those that are
+// not keeping up. The caller must hold the lock.
+func (t *StatusTracker) publish(c cid.Cid, w *watchedMessage, status Status, ts block.TipSet) {
+	ev := StatusEvent{Cid: c, Status: status}
+	if ts.Defined() {
+		ev.TipSet = ts.Key()
+		ev.Epoch, _ = ts.Height()
+	}
+	for sub := range w.subs {
+		if sub.last == status {
+			continue
+		}
+		select {
+		case sub.ch <- ev:
+			sub.last = status
+		default:
+			log.Warnf("disconnecting slow subscriber to status of message %s", c)
+			delete(w.subs, sub)
+			close(sub.ch)
+		}
+	}
+	if len(w.subs) == 0 {
+		delete(t.watched, c)
+	}
+}
+
+func (t *StatusTracker) unsubscribe(c cid.Cid, sub *statusSub) {
+	t.lk.Lock()
+	defer t.lk.Unlock()
+	w, ok := t.watched[c]
+	if !ok {
+		return
+	}
+	if _, ok := w.subs[sub]; !ok {
+		return
+	}
+	delete(w.subs, sub)
+	close(sub.ch)
+	if len(w.subs) == 0 {
+		delete(t.watched, c)
+	}
+}
@@ -0,0 +1,178 @@
+package message_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/internal/pkg/block"
+	"github.com/filecoin-project/go-filecoin/internal/pkg/chain"
+	"github.com/filecoin-project/go-filecoin/internal/pkg/config"
+	"github.com/filecoin-project/go-filecoin/internal/pkg/message"
+	th "github.com/filecoin-project/go-filecoin/internal/pkg/testhelpers"
+	tf "github.com/filecoin-project/go-filecoin/internal/pkg/testhelpers/testflags"
+	"github.com/filecoin-project/go-filecoin/internal/pkg/types"
+	"github.com/filecoin-project/go-filecoin/internal/pkg/vm"
+)
+
+func TestStatusTracker(t *testing.T) {
+	tf.UnitTest(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	keys := types.MustGenerateKeyInfo(1, 42)
+	mm := vm.NewMessageMaker(t, keys)
+	alice := mm.Addresses()[0]
+
+	provider := message.NewFakeProvider(t)
+	root := provider.NewGenesis()
+	provider.SetHead(root.Key())
+
+	pool := message.NewPool(config.NewDefaultConfig().Mpool, th.NewMockMessagePoolValidator())
+	queue := message.NewQueue()
+	tracker := message.NewStatusTracker(provider, provider, pool, queue, 2)
+
+	msg := mm.NewSignedMessage(alice, 0)
+	msgCid, err := msg.Cid()
+	require.NoError(t, err)
+
+	includeMsg := func(parent block.TipSet) block.TipSet {
+		return provider.BuildOneOn(parent, func(b *chain.BlockBuilder) {
+			b.AddMessages([]*types.SignedMessage{msg}, []*types.UnsignedMessage{})
+		})
+	}
+	requireNext := func(ch <-chan message.StatusEvent, status message.Status, ts block.TipSet) {
+		select {
+		case ev, ok := <-ch:
+			require.True(t, ok, "channel closed awaiting %s", status)
+			assert.Equal(t, msgCid, ev.Cid)
+			assert.Equal(t, status, ev.Status)
+			if ts.Defined() {
+				h, err := ts.Height()
+				require.NoError(t, err)
+				assert.Equal(t, ts.Key(), ev.TipSet)
+				assert.Equal(t, h, ev.Epoch)
+			}
+		default:
+			require.FailNow(t, "no event", "expected %s", status)
+		}
+	}
+	requireNone := func(ch <-chan message.StatusEvent) {
+		select {
+		case ev := <-ch:
+			require.FailNow(t, "unexpected event", "%v", ev)
+		default:
+		}
+	}
+
+	// Fork from the genesis, with the message in t1 on one side and f2 on the other.
+	t1 := includeMsg(root)
+	f1 := provider.AppendOn(root, 1)
+	f2 := includeMsg(f1)
+	f3 := provider.AppendOn(f2, 1)
+	f4 := provider.AppendOn(f3, 1)
+
+	t.Run("streams lifecycle events", func(t *testing.T) {
+		ch, err := tracker.Watch(ctx, msgCid, 1)
+		require.NoError(t, err)
+		requireNone(ch)
+
+		require.NoError(t, queue.Enqueue(ctx, msg, 0))
+		requireNext(ch, message.StatusQueued, block.UndefTipSet)
+		_, err = pool.Add(ctx, msg, 0)
+		require.NoError(t, err)
+		requireNext(ch, message.StatusPooled, block.UndefTipSet)
+
+		require.NoError(t, tracker.HandleHeadChange(ctx, chain.HeadChange{Apply: []block.TipSet{t1}}))
+		requireNext(ch, message.StatusIncluded, t1)
+
+		require.NoError(t, tracker.HandleHeadChange(ctx, chain.HeadChange{
+			Revert: []block.TipSet{t1},
+			Apply:  []block.TipSet{f2, f1},
+		}))
+		requireNext(ch, message.StatusReverted, t1)
+		requireNext(ch, message.StatusIncluded, f2)
+
+		require.NoError(t, tracker.HandleHeadChange(ctx, chain.HeadChange{Apply: []block.TipSet{f3}}))
+		requireNone(ch)
+		require.NoError(t, tracker.HandleHeadChange(ctx, chain.HeadChange{Apply: []block.TipSet{f4}}))
+		requireNext(ch, message.StatusFinalized, f2)
+		_, more := <-ch
+		assert.False(t, more)
+	})
+
+	t.Run("reports current status", func(t *testing.T) {
+		provider.SetHead(f3.Key())
+		watchCtx, watchCancel := context.WithCancel(ctx)
+		ch, err := tracker.Watch(watchCtx, msgCid, 3)
+		require.NoError(t, err)
+		requireNext(ch, message.StatusQueued, block.UndefTipSet)
+		requireNext(ch, message.StatusPooled, block.UndefTipSet)
+		requireNext(ch, message.StatusIncluded, f2)
+
+		watchCancel()
+		for range ch {
+		}
+	})
+
+	t.Run("disconnects slow subscribers", func(t *testing.T) {
+		provider.SetHead(root.Key())
+		other := mm.NewSignedMessage(alice, 1)
+		otherCid, err := other.Cid()
+		require.NoError(t, err)
+		g1 := provider.BuildOneOn(root, func(b *chain.BlockBuilder) {
+			b.AddMessages([]*types.SignedMessage{other}, []*types.UnsignedMessage{})
+		})
+		h1 := provider.AppendOn(root, 1)
+
+		ch, err := tracker.Watch(ctx, otherCid, 1)
+		require.NoError(t, err)
+
+		// Each inclusion and reversion is an event, none of which are read.
+		for i := 0; i < 10; i++ {
+			require.NoError(t, tracker.HandleHeadChange(ctx, chain.HeadChange{Apply: []block.TipSet{g1}}))
+			require.NoError(t, tracker.HandleHeadChange(ctx, chain.HeadChange{
+				Revert: []block.TipSet{g1},
+				Apply:  []block.TipSet{h1},
+			}))
+		}
+
+		// The events sent before the subscriber fell behind are delivered, then the channel closes.
+		received := 0
+		for ev := range ch {
+			assert.NotEqual(t, message.StatusFinalized, ev.Status)
+			received++
+		}
+		assert.Less(t, received, 20)
+	})
+
+	t.Run("identifies BLS messages by unsigned CID", func(t *testing.T) {
+		provider.SetHead(root.Key())
+		blsMaker := vm.NewMessageMaker(t, types.MustGenerateBLSKeyInfo(1, 42))
+		blsMsg := blsMaker.NewSignedMessage(blsMaker.Addresses()[0], 0)
+		blsCid, err := blsMsg.Message.Cid()
+		require.NoError(t, err)
+		b1 := provider.BuildOneOn(root, func(b *chain.BlockBuilder) {
+			b.AddMessages([]*types.SignedMessage{}, []*types.UnsignedMessage{&blsMsg.Message})
+		})
+
+		ch, err := tracker.Watch(ctx, blsCid, 1)
+		require.NoError(t, err)
+		require.NoError(t, queue.Enqueue(ctx, blsMsg, 0))
+		_, err = pool.Add(ctx, blsMsg, 0)
+		require.NoError(t, err)
+		require.NoError(t, tracker.HandleHeadChange(ctx, chain.HeadChange{Apply: []block.TipSet{b1}}))
+
+		for _, status := range []message.Status{message.StatusQueued, message.StatusPooled, message.StatusIncluded} {
+			select {
+			case ev := <-ch:
+				assert.Equal(t, blsCid, ev.Cid)
+				assert.Equal(t, status, ev.Status)
+			default:
+				require.FailNow(t, "no event", "expected %s", status)
+			}
+		}
+	})
+}
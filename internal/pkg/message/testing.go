@@ -6,6 +6,7 @@ import (
 
 	"github.com/filecoin-project/go-address"
 	"github.com/filecoin-project/specs-actors/actors/abi"
+	"github.com/ipfs/go-cid"
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/require"
 	"golang.org/x/xerrors"
@@ -14,6 +15,7 @@ import (
 
 	"github.com/filecoin-project/go-filecoin/internal/pkg/chain"
 	"github.com/filecoin-project/go-filecoin/internal/pkg/types"
+	"github.com/filecoin-project/go-filecoin/internal/pkg/vm"
 	"github.com/filecoin-project/go-filecoin/internal/pkg/vm/actor"
 )
 
@@ -24,8 +26,9 @@ type FakeProvider struct {
 	*chain.Builder
 	t *testing.T
 
-	head   block.TipSetKey // Provided by GetHead and expected by others
-	actors map[address.Address]*actor.Actor
+	head     block.TipSetKey // Provided by GetHead and expected by others
+	actors   map[address.Address]*actor.Actor
+	receipts map[string]cid.Cid // Receipts roots by tipset key
 }
 
 // NewFakeProvider creates a new builder and wraps with a provider.
@@ -33,9 +36,10 @@ type FakeProvider struct {
 func NewFakeProvider(t *testing.T) *FakeProvider {
 	builder := chain.NewBuilder(t, address.Address{})
 	return &FakeProvider{
-		Builder: builder,
-		t:       t,
-		actors:  make(map[address.Address]*actor.Actor)}
+		Builder:  builder,
+		t:        t,
+		actors:   make(map[address.Address]*actor.Actor),
+		receipts: make(map[string]cid.Cid)}
 }
 
 // GetHead returns the head tipset key.
@@ -78,6 +82,22 @@ func (p *FakeProvider) SetHeadAndActor(t *testing.T, head block.TipSetKey, addr
 	p.SetActor(addr, actor)
 }
 
+// SetReceipts stores the receipts of the messages in a tipset.
+func (p *FakeProvider) SetReceipts(key block.TipSetKey, receipts []vm.MessageReceipt) {
+	root, err := p.StoreReceipts(context.Background(), receipts)
+	require.NoError(p.t, err)
+	p.receipts[key.String()] = root
+}
+
+// GetTipSetReceiptsRoot returns the root of the receipts set for a tipset.
+func (p *FakeProvider) GetTipSetReceiptsRoot(key block.TipSetKey) (cid.Cid, error) {
+	root, ok := p.receipts[key.String()]
+	if !ok {
+		return cid.Undef, errors.Errorf("no receipts for tipset %s", key)
+	}
+	return root, nil
+}
+
 // MockPublisher is a publisher which just stores the last message published.
 type MockPublisher struct {
 	ReturnError error                // Error to be returned by Publish()
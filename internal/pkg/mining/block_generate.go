@@ -6,10 +6,13 @@ package mining
 
 import (
 	"context"
+	"sort"
 	"time"
 
 	"github.com/filecoin-project/go-address"
 	"github.com/filecoin-project/specs-actors/actors/abi"
+	fbig "github.com/filecoin-project/specs-actors/actors/abi/big"
+	"github.com/ipfs/go-cid"
 	"github.com/pkg/errors"
 
 	bls "github.com/filecoin-project/filecoin-ffi"
@@ -20,6 +23,38 @@ import (
 	"github.com/filecoin-project/go-filecoin/internal/pkg/types"
 )
 
+// BlockTemplate holds the contents of a block to be mined on a base tipset, except for the
+// miner, ticket, election proof, winning PoSts and signature. The messages are persisted in the
+// message store, so a block built from the template can be submitted to this node.
+type BlockTemplate struct {
+	Parents         block.TipSetKey
+	Height          abi.ChainEpoch
+	ParentWeight    fbig.Int
+	StateRoot       cid.Cid
+	MessageReceipts cid.Cid
+	BeaconEntries   []*drand.Entry
+	Timestamp       uint64
+	// CID of the block's message collection, and the aggregate signature of its BLS messages
+	Messages        cid.Cid
+	BLSAggregateSig crypto.Signature
+	BLSMessages     []*types.SignedMessage
+	SECPMessages    []*types.SignedMessage
+}
+
+// Template returns a template for a block at the epoch following `nullBlkCount` null blocks
+// after `base`, with messages selected from the pool.
+func (w *DefaultWorker) Template(ctx context.Context, base block.TipSet, nullBlkCount uint64) (*BlockTemplate, error) {
+	if !base.Defined() {
+		return nil, errors.New("undefined base tipset")
+	}
+	drandEntries, err := w.drandEntriesForEpoch(ctx, base, nullBlkCount)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to collect drand entries")
+	}
+	tmpl, _, err := w.template(ctx, base, abi.ChainEpoch(nullBlkCount), drandEntries)
+	return tmpl, err
+}
+
 // Generate returns a new block created from the messages in the pool.
 func (w *DefaultWorker) Generate(
 	ctx context.Context,
@@ -36,26 +71,75 @@ func (w *DefaultWorker) Generate(
 		log.Infof("[TIMER] DefaultWorker.Generate baseTipset: %s - elapsed time: %s", baseTipSet.String(), time.Since(generateTimer).Round(time.Millisecond))
 	}()
 
+	tmpl, selection, err := w.template(ctx, baseTipSet, nullBlockCount, drandEntries)
+	if err != nil {
+		return nil, err
+	}
+
+	if posts == nil {
+		posts = []block.PoStProof{}
+	}
+
+	next := &block.Block{
+		Miner:           w.minerAddr,
+		Height:          tmpl.Height,
+		BeaconEntries:   tmpl.BeaconEntries,
+		ElectionProof:   &crypto.ElectionProof{VRFProof: electionProof},
+		Messages:        e.NewCid(tmpl.Messages),
+		MessageReceipts: e.NewCid(tmpl.MessageReceipts),
+		Parents:         tmpl.Parents,
+		ParentWeight:    tmpl.ParentWeight,
+		PoStProofs:      posts,
+		StateRoot:       e.NewCid(tmpl.StateRoot),
+		Ticket:          ticket,
+		Timestamp:       tmpl.Timestamp,
+		BLSAggregateSig: &tmpl.BLSAggregateSig,
+	}
+
+	view, err := w.api.PowerStateView(baseTipSet.Key())
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read state view")
+	}
+	_, workerAddr, err := view.MinerControlAddresses(ctx, w.minerAddr)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read workerAddr during block generation")
+	}
+	workerSigningAddr, err := view.AccountSignerAddress(ctx, workerAddr)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to convert worker address to signing address")
+	}
+	blockSig, err := w.workerSigner.SignBytes(ctx, next.SignatureData(), workerSigningAddr)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to sign block")
+	}
+	next.BlockSig = &blockSig
+
+	w.journal.Write("Generate",
+		"block", next.Cid().String(), "height", tmpl.Height, "policy", string(selection.Policy),
+		"candidates", selection.Candidates, "selected", selection.Selected,
+		"gasLimit", int64(selection.GasLimit), "gasReward", selection.GasReward.String())
+
+	return NewfullBlock(next, tmpl.BLSMessages, tmpl.SECPMessages), nil
+}
+
+// template builds the contents of a block on `baseTipSet`, selecting messages from the pool and
+// persisting them.
+func (w *DefaultWorker) template(ctx context.Context, baseTipSet block.TipSet, nullBlockCount abi.ChainEpoch, drandEntries []*drand.Entry) (*BlockTemplate, SelectionStats, error) {
 	weight, err := w.getWeight(ctx, baseTipSet)
 	if err != nil {
-		return nil, errors.Wrap(err, "get weight")
+		return nil, SelectionStats{}, errors.Wrap(err, "get weight")
 	}
 
 	baseHeight, err := baseTipSet.Height()
 	if err != nil {
-		return nil, errors.Wrap(err, "get base tip set height")
+		return nil, SelectionStats{}, errors.Wrap(err, "get base tip set height")
 	}
 
 	blockHeight := baseHeight + nullBlockCount + 1
 
-	// Construct list of message candidates for inclusion.
-	// These messages will be processed, and those that fail excluded from the block.
-	pending := w.messageSource.Pending()
-	mq := NewMessageQueue(pending)
-	candidateMsgs := orderMessageCandidates(mq.Drain(block.BlockMessageLimit))
-	candidateMsgs = w.filterPenalizableMessages(ctx, candidateMsgs)
+	candidateMsgs, selection := w.selectMessages(ctx, baseTipSet.Key())
 	if len(candidateMsgs) > block.BlockMessageLimit {
-		return nil, errors.Errorf("too many messages returned from mq.Drain: %d", len(candidateMsgs))
+		return nil, SelectionStats{}, errors.Errorf("too many messages selected: %d", len(candidateMsgs))
 	}
 
 	var blsAccepted []*types.SignedMessage
@@ -74,24 +158,24 @@ func (w *DefaultWorker) Generate(
 	// Create an aggregage signature for messages
 	unwrappedBLSMessages, blsAggregateSig, err := aggregateBLS(blsAccepted)
 	if err != nil {
-		return nil, errors.Wrap(err, "could not aggregate bls messages")
+		return nil, SelectionStats{}, errors.Wrap(err, "could not aggregate bls messages")
 	}
 
 	// Persist messages to ipld storage
 	txMetaCid, err := w.messageStore.StoreMessages(ctx, secpAccepted, unwrappedBLSMessages)
 	if err != nil {
-		return nil, errors.Wrap(err, "error persisting messages")
+		return nil, SelectionStats{}, errors.Wrap(err, "error persisting messages")
 	}
 
 	// get tipset state root and receipt root
 	baseStateRoot, err := w.tsMetadata.GetTipSetStateRoot(baseTipSet.Key())
 	if err != nil {
-		return nil, errors.Wrapf(err, "error retrieving state root for tipset %s", baseTipSet.Key().String())
+		return nil, SelectionStats{}, errors.Wrapf(err, "error retrieving state root for tipset %s", baseTipSet.Key().String())
 	}
 
 	baseReceiptRoot, err := w.tsMetadata.GetTipSetReceiptsRoot(baseTipSet.Key())
 	if err != nil {
-		return nil, errors.Wrapf(err, "error retrieving receipt root for tipset %s", baseTipSet.Key().String())
+		return nil, SelectionStats{}, errors.Wrapf(err, "error retrieving receipt root for tipset %s", baseTipSet.Key().String())
 	}
 
 	// Set the block timestamp to be exactly the start of the target epoch, regardless of the current time.
@@ -102,45 +186,19 @@ func (w *DefaultWorker) Generate(
 		drandEntries = []*drand.Entry{}
 	}
 
-	if posts == nil {
-		posts = []block.PoStProof{}
-	}
-
-	next := &block.Block{
-		Miner:           w.minerAddr,
-		Height:          blockHeight,
-		BeaconEntries:   drandEntries,
-		ElectionProof:   &crypto.ElectionProof{VRFProof: electionProof},
-		Messages:        e.NewCid(txMetaCid),
-		MessageReceipts: e.NewCid(baseReceiptRoot),
+	return &BlockTemplate{
 		Parents:         baseTipSet.Key(),
+		Height:          blockHeight,
 		ParentWeight:    weight,
-		PoStProofs:      posts,
-		StateRoot:       e.NewCid(baseStateRoot),
-		Ticket:          ticket,
+		StateRoot:       baseStateRoot,
+		MessageReceipts: baseReceiptRoot,
+		BeaconEntries:   drandEntries,
 		Timestamp:       uint64(epochStartTime.Unix()),
-		BLSAggregateSig: &blsAggregateSig,
-	}
-
-	view, err := w.api.PowerStateView(baseTipSet.Key())
-	if err != nil {
-		return nil, errors.Wrapf(err, "failed to read state view")
-	}
-	_, workerAddr, err := view.MinerControlAddresses(ctx, w.minerAddr)
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to read workerAddr during block generation")
-	}
-	workerSigningAddr, err := view.AccountSignerAddress(ctx, workerAddr)
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to convert worker address to signing address")
-	}
-	blockSig, err := w.workerSigner.SignBytes(ctx, next.SignatureData(), workerSigningAddr)
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to sign block")
-	}
-	next.BlockSig = &blockSig
-
-	return NewfullBlock(next, blsAccepted, secpAccepted), nil
+		Messages:        txMetaCid,
+		BLSAggregateSig: blsAggregateSig,
+		BLSMessages:     blsAccepted,
+		SECPMessages:    secpAccepted,
+	}, selection, nil
 }
 
 // The resulting output is not empty: it has either a block or an error.
@@ -187,11 +245,37 @@ func orderMessageCandidates(messages []*types.SignedMessage) []*types.SignedMess
 	return append(blsMessages, secpMessages...)
 }
 
-func (w *DefaultWorker) filterPenalizableMessages(ctx context.Context, messages []*types.SignedMessage) []*types.SignedMessage {
+// selectMessages selects the pending messages to include in a block on `base`, in the order they
+// will be processed. Messages that would be penalized in the state of `base` are excluded before selecting within the block's
+// message and gas limits, so that they take up none of the block's capacity.
+func (w *DefaultWorker) selectMessages(ctx context.Context, base block.TipSetKey) ([]*types.SignedMessage, SelectionStats) {
+	candidates := w.filterPenalizableMessages(ctx, base, orderByNonce(w.messageSource.Pending()))
+	selected, selection := SelectMessages(w.selection, candidates, types.BlockGasLimit, block.BlockMessageLimit)
+	return orderMessageCandidates(selected), selection
+}
+
+// orderByNonce returns a copy of `messages` with each sender's messages in nonce order.
+func orderByNonce(messages []*types.SignedMessage) []*types.SignedMessage {
+	ordered := make([]*types.SignedMessage, len(messages))
+	copy(ordered, messages)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return ordered[i].Message.CallSeqNum < ordered[j].Message.CallSeqNum
+	})
+	return ordered
+}
+
+// filterPenalizableMessages excludes the messages that would be penalized if processed in order
+// on `base`.
+func (w *DefaultWorker) filterPenalizableMessages(ctx context.Context, base block.TipSetKey, messages []*types.SignedMessage) []*types.SignedMessage {
+	unsigned := make([]*types.UnsignedMessage, len(messages))
+	for i, msg := range messages {
+		unsigned[i] = &msg.Message
+	}
+	errs := w.penaltyChecker.PenaltyCheckBlock(ctx, base, unsigned)
+
 	var goodMessages []*types.SignedMessage
-	for _, msg := range messages {
-		err := w.penaltyChecker.PenaltyCheck(ctx, &msg.Message)
-		if err != nil {
+	for i, msg := range messages {
+		if err := errs[i]; err != nil {
 			mCid, _ := msg.Cid()
 			log.Debugf("Msg: %s excluded in block because penalized with err %s", mCid, err)
 			continue
@@ -0,0 +1,93 @@
+package mining
+
+import (
+	"context"
+	"sync"
+
+	"github.com/filecoin-project/specs-actors/actors/abi"
+
+	"github.com/filecoin-project/go-filecoin/internal/pkg/block"
+	"github.com/filecoin-project/go-filecoin/internal/pkg/consensus"
+	"github.com/filecoin-project/go-filecoin/internal/pkg/journal"
+)
+
+// electionEvaluator runs elections without generating blocks.
+type electionEvaluator interface {
+	Evaluate(ctx context.Context, base block.TipSet, nullBlkCount uint64) (*ElectionResult, error)
+}
+
+// DryRunOutcome is the outcome of an election evaluated by a DryRunner, with the totals over
+// the dry run so far.
+type DryRunOutcome struct {
+	Base  block.TipSetKey
+	Epoch abi.ChainEpoch
+	Won   bool
+	// Expected number of elections won per epoch by the miner's share of power
+	ExpectedWinRate float64
+
+	// Number of elections evaluated, and won, in the dry run
+	Elections uint64
+	Wins      uint64
+	// Sum of the expected win rates of the elections evaluated in the dry run
+	ExpectedWins float64
+}
+
+// DryRunner evaluates the election for a miner on each new head, without generating or
+// publishing blocks, and records the outcomes in a journal. This shows whether a miner would
+// have won each epoch, and how often it wins compared to its expected rate.
+type DryRunner struct {
+	evaluator electionEvaluator
+	journal   journal.Writer
+
+	lk           sync.Mutex
+	elections    uint64
+	wins         uint64
+	expectedWins float64
+}
+
+// NewDryRunner constructs a dry runner evaluating elections with `evaluator`, typically a
+// DefaultWorker.
+func NewDryRunner(evaluator electionEvaluator, jw journal.Writer) *DryRunner {
+	return &DryRunner{
+		evaluator: evaluator,
+		journal:   jw,
+	}
+}
+
+// HandleHead evaluates the election for the epoch following `head`, as if mining on it.
+func (d *DryRunner) HandleHead(ctx context.Context, head block.TipSet) (*DryRunOutcome, error) {
+	result, err := d.evaluator.Evaluate(ctx, head, 0)
+	if err != nil {
+		return nil, err
+	}
+	rate := consensus.ExpectedWinRate(result.MinerPower, result.NetworkPower)
+
+	d.lk.Lock()
+	defer d.lk.Unlock()
+	d.elections++
+	if result.Won {
+		d.wins++
+	}
+	d.expectedWins += rate
+
+	outcome := &DryRunOutcome{
+		Base:            head.Key(),
+		Epoch:           result.Epoch,
+		Won:             result.Won,
+		ExpectedWinRate: rate,
+		Elections:       d.elections,
+		Wins:            d.wins,
+		ExpectedWins:    d.expectedWins,
+	}
+	d.journal.Write("DryRun",
+		"base", head.Key().String(), "epoch", result.Epoch, "won", result.Won,
+		"minerPower", result.MinerPower.String(), "networkPower", result.NetworkPower.String(),
+		"expectedWinRate", rate, "elections", d.elections, "wins", d.wins, "expectedWins", d.expectedWins)
+	return outcome, nil
+}
+
+// DryRunner returns a dry runner evaluating elections with this worker, recording the outcomes
+// in the worker's journal.
+func (w *DefaultWorker) DryRunner() *DryRunner {
+	return NewDryRunner(w, w.journal)
+}
@@ -0,0 +1,89 @@
+package mining_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/specs-actors/actors/abi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/internal/pkg/block"
+	"github.com/filecoin-project/go-filecoin/internal/pkg/chain"
+	"github.com/filecoin-project/go-filecoin/internal/pkg/mining"
+	tf "github.com/filecoin-project/go-filecoin/internal/pkg/testhelpers/testflags"
+)
+
+type fakeEvaluator struct {
+	results []*mining.ElectionResult
+	err     error
+}
+
+func (f *fakeEvaluator) Evaluate(_ context.Context, _ block.TipSet, _ uint64) (*mining.ElectionResult, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	res := f.results[0]
+	f.results = f.results[1:]
+	return res, nil
+}
+
+type journalEntry struct {
+	event string
+	kvs   []interface{}
+}
+
+type recordingJournal struct {
+	entries []journalEntry
+}
+
+func (r *recordingJournal) Write(event string, kvs ...interface{}) {
+	r.entries = append(r.entries, journalEntry{event, kvs})
+}
+
+func TestDryRunner(t *testing.T) {
+	tf.UnitTest(t)
+	ctx := context.Background()
+
+	builder := chain.NewBuilder(t, address.Undef)
+	genesis := builder.NewGenesis()
+	head := builder.AppendOn(genesis, 1)
+
+	// A quarter of the network power, expecting 1.25 wins per epoch.
+	minerPower := abi.NewStoragePower(1)
+	networkPower := abi.NewStoragePower(4)
+	evaluator := &fakeEvaluator{results: []*mining.ElectionResult{
+		{Epoch: 2, Won: true, MinerPower: minerPower, NetworkPower: networkPower},
+		{Epoch: 3, Won: false, MinerPower: minerPower, NetworkPower: networkPower},
+	}}
+	jw := &recordingJournal{}
+	dryRunner := mining.NewDryRunner(evaluator, jw)
+
+	outcome, err := dryRunner.HandleHead(ctx, head)
+	require.NoError(t, err)
+	assert.Equal(t, head.Key(), outcome.Base)
+	assert.Equal(t, abi.ChainEpoch(2), outcome.Epoch)
+	assert.True(t, outcome.Won)
+	assert.Equal(t, 1.25, outcome.ExpectedWinRate)
+	assert.Equal(t, uint64(1), outcome.Elections)
+	assert.Equal(t, uint64(1), outcome.Wins)
+
+	outcome, err = dryRunner.HandleHead(ctx, head)
+	require.NoError(t, err)
+	assert.False(t, outcome.Won)
+	assert.Equal(t, uint64(2), outcome.Elections)
+	assert.Equal(t, uint64(1), outcome.Wins)
+	assert.Equal(t, 2.5, outcome.ExpectedWins)
+
+	require.Len(t, jw.entries, 2)
+	assert.Equal(t, "DryRun", jw.entries[1].event)
+	assert.Contains(t, jw.entries[1].kvs, "expectedWins")
+
+	// A failed evaluation is not counted.
+	evaluator.err = errors.New("no power table")
+	_, err = dryRunner.HandleHead(ctx, head)
+	assert.Error(t, err)
+	assert.Len(t, jw.entries, 2)
+}
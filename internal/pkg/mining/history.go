@@ -0,0 +1,126 @@
+package mining
+
+import (
+	"sync"
+	"time"
+
+	"github.com/filecoin-project/specs-actors/actors/abi"
+	"github.com/ipfs/go-cid"
+
+	"github.com/filecoin-project/go-filecoin/internal/pkg/block"
+	"github.com/filecoin-project/go-filecoin/internal/pkg/consensus"
+	"github.com/filecoin-project/go-filecoin/internal/pkg/drand"
+)
+
+// Number of epoch outcomes retained by a worker, about a day of epochs.
+const miningHistoryLength = 2880
+
+// EpochOutcome records an attempt by a worker to mine a block at an epoch.
+type EpochOutcome struct {
+	Base       block.TipSetKey
+	Epoch      abi.ChainEpoch
+	NullRounds uint64
+	DrandRound drand.Round
+	Ticket     block.Ticket
+	Won        bool
+	// Miner's share of the network power in the election
+	PowerRatio float64
+	// Block generated if the election was won, and the number of messages it includes
+	Block    cid.Cid
+	Messages int
+	Duration time.Duration
+	// Error which ended the attempt, if any
+	Error string
+
+	start time.Time
+}
+
+func newEpochOutcome(base block.TipSet, nullBlkCount uint64) *EpochOutcome {
+	outcome := &EpochOutcome{
+		Base:       base.Key(),
+		NullRounds: nullBlkCount,
+		start:      time.Now(),
+	}
+	if height, err := base.Height(); err == nil {
+		outcome.Epoch = height + abi.ChainEpoch(1+nullBlkCount)
+	}
+	return outcome
+}
+
+// finish completes an outcome with the election result, if the election ran, and the block
+// generated, if any.
+func (o *EpochOutcome) finish(result *ElectionResult, blk *FullBlock, err error) {
+	o.Duration = time.Since(o.start)
+	if err != nil {
+		o.Error = err.Error()
+	}
+	if result != nil {
+		o.DrandRound = result.DrandRound
+		o.Ticket = result.Ticket
+		o.Won = result.Won
+		o.PowerRatio = consensus.PowerShare(result.MinerPower, result.NetworkPower)
+	}
+	if blk != nil {
+		o.Block = blk.Header.Cid()
+		o.Messages = len(blk.BLSMessages) + len(blk.SECPMessages)
+	}
+}
+
+// History returns the outcomes of the `count` most recent epochs this worker attempted to mine,
+// most recent first, or all those retained if `count` is zero.
+func (w *DefaultWorker) History(count int) []*EpochOutcome {
+	return w.history.latest(count)
+}
+
+func (w *DefaultWorker) recordOutcome(outcome *EpochOutcome) {
+	w.history.add(outcome)
+
+	blk := ""
+	if outcome.Block.Defined() {
+		blk = outcome.Block.String()
+	}
+	w.journal.Write("Outcome",
+		"base", outcome.Base.String(), "epoch", outcome.Epoch, "nullRounds", outcome.NullRounds,
+		"drandRound", uint64(outcome.DrandRound), "ticket", outcome.Ticket.String(), "won", outcome.Won,
+		"powerRatio", outcome.PowerRatio, "block", blk, "messages", outcome.Messages,
+		"duration", outcome.Duration.String(), "error", outcome.Error)
+}
+
+// outcomeHistory is a bounded record of epoch outcomes, discarding the oldest when full.
+type outcomeHistory struct {
+	lk       sync.Mutex
+	outcomes []*EpochOutcome
+	next     int
+	full     bool
+}
+
+func newOutcomeHistory(length int) *outcomeHistory {
+	return &outcomeHistory{outcomes: make([]*EpochOutcome, length)}
+}
+
+func (h *outcomeHistory) add(outcome *EpochOutcome) {
+	h.lk.Lock()
+	defer h.lk.Unlock()
+	h.outcomes[h.next] = outcome
+	h.next = (h.next + 1) % len(h.outcomes)
+	if h.next == 0 {
+		h.full = true
+	}
+}
+
+func (h *outcomeHistory) latest(count int) []*EpochOutcome {
+	h.lk.Lock()
+	defer h.lk.Unlock()
+	size := h.next
+	if h.full {
+		size = len(h.outcomes)
+	}
+	if count > size || count <= 0 {
+		count = size
+	}
+	latest := make([]*EpochOutcome, count)
+	for i := range latest {
+		latest[i] = h.outcomes[(h.next-1-i+len(h.outcomes))%len(h.outcomes)]
+	}
+	return latest
+}
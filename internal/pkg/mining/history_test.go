@@ -0,0 +1,48 @@
+package mining
+
+import (
+	"context"
+	"testing"
+
+	"github.com/filecoin-project/specs-actors/actors/abi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/internal/pkg/block"
+	tf "github.com/filecoin-project/go-filecoin/internal/pkg/testhelpers/testflags"
+)
+
+func TestMiningHistory(t *testing.T) {
+	tf.UnitTest(t)
+
+	t.Run("records failed attempts", func(t *testing.T) {
+		worker := NewDefaultWorker(WorkerParameters{})
+		_, err := worker.Mine(context.Background(), block.UndefTipSet, 2)
+		require.Error(t, err)
+
+		history := worker.History(10)
+		require.Len(t, history, 1)
+		assert.Equal(t, uint64(2), history[0].NullRounds)
+		assert.False(t, history[0].Won)
+		assert.Equal(t, err.Error(), history[0].Error)
+	})
+
+	t.Run("retains the latest outcomes", func(t *testing.T) {
+		h := newOutcomeHistory(3)
+		assert.Empty(t, h.latest(5))
+
+		for epoch := abi.ChainEpoch(1); epoch <= 5; epoch++ {
+			h.add(&EpochOutcome{Epoch: epoch})
+		}
+		epochs := func(outcomes []*EpochOutcome) []abi.ChainEpoch {
+			var out []abi.ChainEpoch
+			for _, o := range outcomes {
+				out = append(out, o.Epoch)
+			}
+			return out
+		}
+		assert.Equal(t, []abi.ChainEpoch{5, 4}, epochs(h.latest(2)))
+		assert.Equal(t, []abi.ChainEpoch{5, 4, 3}, epochs(h.latest(5)))
+		assert.Equal(t, []abi.ChainEpoch{5, 4, 3}, epochs(h.latest(0)))
+	})
+}
@@ -16,10 +16,10 @@ import (
 // always in increasing nonce order.
 // All messages for a queue are inserted at construction, after which messages may only
 // be popped.
+// The queue does not account for gas limits; see SelectMessages for selection that packs messages
+// into a block gas limit.
 // Potential improvements include:
 // - deprioritising messages after a gap in nonce value, which can never be mined (see Ethereum)
-// - attempting to pack messages into a fixed gas limit (i.e. 0/1 knapsack subject to nonce ordering),
-//   see https://en.wikipedia.org/wiki/Knapsack_problem
 type MessageQueue struct {
 	// A heap of nonce-ordered queues, one per sender.
 	senderQueues queueHeap
@@ -0,0 +1,208 @@
+package mining
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/filecoin-project/go-address"
+	specsbig "github.com/filecoin-project/specs-actors/actors/abi/big"
+	"github.com/pkg/errors"
+
+	"github.com/filecoin-project/go-filecoin/internal/pkg/types"
+	"github.com/filecoin-project/go-filecoin/internal/pkg/vm/gas"
+)
+
+// SelectionPolicy names a strategy for selecting the messages to include in a block.
+type SelectionPolicy string
+
+const (
+	// SelectByGasReward selects the messages expected to pay the greatest total gas reward, that
+	// is gas price times gas limit, without exceeding the block gas limit.
+	SelectByGasReward SelectionPolicy = "gas-reward"
+	// SelectByGasPrice selects messages in order of decreasing gas price, without regard to their
+	// gas limits (see MessageQueue).
+	SelectByGasPrice SelectionPolicy = "gas-price"
+)
+
+// ParseSelectionPolicy parses the name of a selection policy. The empty string selects the
+// default policy, SelectByGasReward.
+func ParseSelectionPolicy(name string) (SelectionPolicy, error) {
+	switch SelectionPolicy(name) {
+	case "":
+		return SelectByGasReward, nil
+	case SelectByGasReward, SelectByGasPrice:
+		return SelectionPolicy(name), nil
+	default:
+		return "", errors.Errorf("unknown message selection policy %q, expected %q or %q", name, SelectByGasReward, SelectByGasPrice)
+	}
+}
+
+// SelectionStats summarises the messages selected for a block.
+type SelectionStats struct {
+	Policy SelectionPolicy
+	// Number of messages considered
+	Candidates int
+	// Number of messages selected
+	Selected int
+	// Sum of the gas limits of the selected messages
+	GasLimit gas.Unit
+	// Sum of the gas price times gas limit of the selected messages
+	GasReward types.AttoFIL
+}
+
+// SelectMessages selects from `msgs` those to include in a block according to `policy`, selecting
+// at most `maxCount` messages, or any number if `maxCount` is negative. Messages from each sender
+// are selected in nonce order, without gaps. The SelectByGasReward policy also keeps the sum of the
+// selected messages' gas limits within `gasLimit`.
+func SelectMessages(policy SelectionPolicy, msgs []*types.SignedMessage, gasLimit gas.Unit, maxCount int) ([]*types.SignedMessage, SelectionStats) {
+	var selected []*types.SignedMessage
+	switch policy {
+	case SelectByGasPrice:
+		mq := NewMessageQueue(msgs)
+		selected = mq.Drain(maxCount)
+	default:
+		selected = selectByGasReward(msgs, gasLimit, maxCount)
+	}
+
+	return selected, newSelectionStats(policy, len(msgs), selected)
+}
+
+func newSelectionStats(policy SelectionPolicy, candidates int, selected []*types.SignedMessage) SelectionStats {
+	stats := SelectionStats{
+		Policy:     policy,
+		Candidates: candidates,
+		Selected:   len(selected),
+		GasLimit:   gas.Zero,
+		GasReward:  types.ZeroAttoFIL,
+	}
+	for _, msg := range selected {
+		stats.GasLimit += msg.Message.GasLimit
+		stats.GasReward = specsbig.Add(stats.GasReward, gasReward(msg))
+	}
+	return stats
+}
+
+// selectByGasReward approximates the selection of messages maximising total gas reward subject to
+// the gas limit (a 0/1 knapsack problem) with the constraint that each sender's messages are
+// selected in nonce order.
+// Each sender's messages are divided into chains of consecutive nonces such that the reward per unit
+// of gas of the chains decreases with nonce, so that a low-priced message is selected for the sake
+// of high-priced messages following it. Chains from all senders are then selected greedily in order
+// of decreasing reward per unit of gas. When a chain does not fit in the remaining gas, as many of
+// its messages as fit are selected and no further messages are selected from its sender.
+func selectByGasReward(msgs []*types.SignedMessage, gasLimit gas.Unit, maxCount int) []*types.SignedMessage {
+	// Group messages by sender and order each sender's by nonce.
+	bySender := make(map[address.Address][]*types.SignedMessage)
+	for _, m := range msgs {
+		bySender[m.Message.From] = append(bySender[m.Message.From], m)
+	}
+
+	var chains []*msgChain
+	for _, senderMsgs := range bySender {
+		sort.Slice(senderMsgs, func(i, j int) bool {
+			return senderMsgs[i].Message.CallSeqNum < senderMsgs[j].Message.CallSeqNum
+		})
+
+		var senderChains []*msgChain
+		for _, m := range senderMsgs {
+			senderChains = append(senderChains, newMsgChain(m))
+			// Merge a chain into its predecessor while it pays better, so rewards decrease with nonce.
+			for n := len(senderChains); n > 1 && senderChains[n-1].paysBetter(senderChains[n-2]); n-- {
+				senderChains[n-2].merge(senderChains[n-1])
+				senderChains = senderChains[:n-1]
+			}
+		}
+		for i, c := range senderChains {
+			c.index = i
+		}
+		chains = append(chains, senderChains...)
+	}
+
+	// Order by decreasing reward per unit of gas, and secondarily by sender and nonce for stability.
+	// Each sender's chains remain in nonce order.
+	sort.Slice(chains, func(i, j int) bool {
+		if chains[i].paysBetter(chains[j]) {
+			return true
+		} else if chains[j].paysBetter(chains[i]) {
+			return false
+		}
+		if cmp := bytes.Compare(chains[i].sender().Bytes(), chains[j].sender().Bytes()); cmp != 0 {
+			return cmp < 0
+		}
+		return chains[i].index < chains[j].index
+	})
+
+	var selected []*types.SignedMessage
+	full := func() bool { return maxCount >= 0 && len(selected) >= maxCount }
+	remaining := gasLimit
+	blocked := make(map[address.Address]bool)
+	for _, c := range chains {
+		if full() {
+			break
+		}
+		if blocked[c.sender()] {
+			continue
+		}
+		for _, m := range c.msgs {
+			if m.Message.GasLimit > remaining || full() {
+				// Later messages from this sender cannot be included without this one.
+				blocked[c.sender()] = true
+				break
+			}
+			selected = append(selected, m)
+			remaining -= m.Message.GasLimit
+		}
+	}
+	return selected
+}
+
+// A msgChain is a run of messages from a single sender with consecutive nonces.
+type msgChain struct {
+	msgs []*types.SignedMessage
+	// Sum of the gas limits of the messages
+	gasLimit gas.Unit
+	// Sum of the gas rewards of the messages
+	reward specsbig.Int
+	// Position of the chain among its sender's chains
+	index int
+}
+
+func newMsgChain(m *types.SignedMessage) *msgChain {
+	return &msgChain{
+		msgs:     []*types.SignedMessage{m},
+		gasLimit: m.Message.GasLimit,
+		reward:   gasReward(m),
+	}
+}
+
+func (c *msgChain) sender() address.Address {
+	return c.msgs[0].Message.From
+}
+
+// merge appends the messages of `next` to the chain.
+func (c *msgChain) merge(next *msgChain) {
+	c.msgs = append(c.msgs, next.msgs...)
+	c.gasLimit += next.gasLimit
+	c.reward = specsbig.Add(c.reward, next.reward)
+}
+
+// paysBetter tests whether the chain pays a greater reward per unit of gas than `other`.
+// A chain with no gas limit is treated as requiring a single unit.
+func (c *msgChain) paysBetter(other *msgChain) bool {
+	// Compare c.reward / c.gasLimit > other.reward / other.gasLimit without division.
+	lhs := specsbig.Mul(c.reward, specsbig.NewInt(int64(atLeastOne(other.gasLimit))))
+	rhs := specsbig.Mul(other.reward, specsbig.NewInt(int64(atLeastOne(c.gasLimit))))
+	return lhs.GreaterThan(rhs)
+}
+
+func atLeastOne(u gas.Unit) gas.Unit {
+	if u < 1 {
+		return 1
+	}
+	return u
+}
+
+// gasReward returns the maximum gas reward a message may pay, its gas price times its gas limit.
+func gasReward(m *types.SignedMessage) types.AttoFIL {
+	return specsbig.Mul(m.Message.GasPrice, specsbig.NewInt(int64(m.Message.GasLimit)))
+}
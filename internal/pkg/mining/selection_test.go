@@ -0,0 +1,187 @@
+package mining
+
+import (
+	"context"
+	"testing"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/ipfs/go-cid"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/internal/pkg/block"
+	tf "github.com/filecoin-project/go-filecoin/internal/pkg/testhelpers/testflags"
+	"github.com/filecoin-project/go-filecoin/internal/pkg/types"
+	"github.com/filecoin-project/go-filecoin/internal/pkg/vm/gas"
+)
+
+func TestSelectMessages(t *testing.T) {
+	tf.UnitTest(t)
+
+	var ki = types.MustGenerateKeyInfo(10, 42)
+	var mockSigner = types.NewMockSigner(ki)
+
+	a0 := mockSigner.Addresses[0]
+	a1 := mockSigner.Addresses[2]
+	a2 := mockSigner.Addresses[3]
+	to := mockSigner.Addresses[9]
+
+	sign := func(from address.Address, nonce uint64, units int64, price int64) *types.SignedMessage {
+		msg := types.UnsignedMessage{
+			From:       from,
+			To:         to,
+			CallSeqNum: nonce,
+			GasPrice:   types.NewGasPrice(price),
+			GasLimit:   gas.NewGas(units),
+		}
+		s, err := types.NewSignedMessage(context.TODO(), msg, &mockSigner)
+		require.NoError(t, err)
+		return s
+	}
+
+	t.Run("fits within gas limit", func(t *testing.T) {
+		msgs := []*types.SignedMessage{
+			sign(a0, 0, 60, 10),
+			sign(a1, 0, 50, 5),
+			sign(a2, 0, 40, 4),
+		}
+		selected, stats := SelectMessages(SelectByGasReward, msgs, gas.NewGas(100), -1)
+		assert.Equal(t, []*types.SignedMessage{msgs[0], msgs[2]}, selected)
+		assert.Equal(t, SelectByGasReward, stats.Policy)
+		assert.Equal(t, 3, stats.Candidates)
+		assert.Equal(t, 2, stats.Selected)
+		assert.Equal(t, gas.NewGas(100), stats.GasLimit)
+		assert.True(t, types.NewGasPrice(760).Equals(stats.GasReward))
+	})
+
+	t.Run("selects low price message for high price successors", func(t *testing.T) {
+		msgs := []*types.SignedMessage{
+			sign(a0, 1, 10, 100),
+			sign(a0, 0, 10, 1),
+			sign(a1, 0, 10, 20),
+		}
+		selected, _ := SelectMessages(SelectByGasReward, msgs, types.BlockGasLimit, 2)
+		assert.Equal(t, []*types.SignedMessage{msgs[1], msgs[0]}, selected)
+
+		// Ordering by gas price alone prefers the other sender.
+		selected, _ = SelectMessages(SelectByGasPrice, msgs, types.BlockGasLimit, 2)
+		assert.Equal(t, []*types.SignedMessage{msgs[2], msgs[1]}, selected)
+	})
+
+	t.Run("leaves no nonce gaps", func(t *testing.T) {
+		msgs := []*types.SignedMessage{
+			sign(a0, 0, 80, 5),
+			sign(a0, 1, 10, 5),
+			sign(a1, 0, 10, 1),
+			sign(a1, 1, 10, 1),
+		}
+		selected, _ := SelectMessages(SelectByGasReward, msgs, gas.NewGas(50), -1)
+		assert.Equal(t, []*types.SignedMessage{msgs[2], msgs[3]}, selected)
+
+		// Messages following one that does not fit are excluded too.
+		selected, _ = SelectMessages(SelectByGasReward, msgs, gas.NewGas(95), -1)
+		assert.Equal(t, []*types.SignedMessage{msgs[0], msgs[1]}, selected)
+	})
+
+	t.Run("gas price policy ignores gas limit", func(t *testing.T) {
+		msgs := []*types.SignedMessage{
+			sign(a0, 0, 80, 5),
+			sign(a1, 0, 80, 4),
+		}
+		selected, stats := SelectMessages(SelectByGasPrice, msgs, gas.NewGas(100), -1)
+		assert.Equal(t, msgs, selected)
+		assert.Equal(t, gas.NewGas(160), stats.GasLimit)
+	})
+
+	t.Run("parses policy", func(t *testing.T) {
+		policy, err := ParseSelectionPolicy("")
+		require.NoError(t, err)
+		assert.Equal(t, SelectByGasReward, policy)
+
+		policy, err = ParseSelectionPolicy("gas-price")
+		require.NoError(t, err)
+		assert.Equal(t, SelectByGasPrice, policy)
+
+		_, err = ParseSelectionPolicy("fastest")
+		assert.Error(t, err)
+	})
+}
+
+// Messages that would be penalized take up none of the block's capacity.
+func TestWorkerSelectsOnlyUnpenalizedMessages(t *testing.T) {
+	tf.UnitTest(t)
+
+	var ki = types.MustGenerateKeyInfo(10, 42)
+	var mockSigner = types.NewMockSigner(ki)
+
+	good := mockSigner.Addresses[0]
+	bad := mockSigner.Addresses[2]
+	to := mockSigner.Addresses[9]
+
+	sign := func(from address.Address, nonce uint64, units gas.Unit, price int64) *types.SignedMessage {
+		msg := types.UnsignedMessage{
+			From:       from,
+			To:         to,
+			CallSeqNum: nonce,
+			GasPrice:   types.NewGasPrice(price),
+			GasLimit:   units,
+		}
+		s, err := types.NewSignedMessage(context.TODO(), msg, &mockSigner)
+		require.NoError(t, err)
+		return s
+	}
+
+	// The penalized message pays best and would fill the block on its own.
+	goodMsgs := []*types.SignedMessage{
+		sign(good, 1, types.BlockGasLimit/2, 1),
+		sign(good, 0, types.BlockGasLimit/2, 1),
+	}
+	badMsg := sign(bad, 0, types.BlockGasLimit, 100)
+
+	checker := &senderPenaltyChecker{penalized: bad}
+	w := &DefaultWorker{
+		messageSource:  &fakeMessageSource{pending: []*types.SignedMessage{goodMsgs[0], badMsg, goodMsgs[1]}},
+		penaltyChecker: checker,
+		selection:      SelectByGasReward,
+	}
+	base := block.NewTipSetKey(types.CidFromString(t, "base"))
+	selected, stats := w.selectMessages(context.Background(), base)
+	assert.Equal(t, base, checker.checkedAt)
+	assert.Equal(t, []*types.SignedMessage{goodMsgs[1], goodMsgs[0]}, selected)
+	assert.Equal(t, 2, stats.Selected)
+	assert.Equal(t, types.BlockGasLimit, stats.GasLimit)
+}
+
+type fakeMessageSource struct {
+	pending []*types.SignedMessage
+}
+
+func (s *fakeMessageSource) Pending() []*types.SignedMessage {
+	return s.pending
+}
+
+func (s *fakeMessageSource) Remove(cid.Cid) {}
+
+// senderPenaltyChecker penalizes the messages of one sender, and those of other senders out of
+// nonce order, recording the base it last checked messages on.
+type senderPenaltyChecker struct {
+	penalized address.Address
+	checkedAt block.TipSetKey
+}
+
+func (c *senderPenaltyChecker) PenaltyCheckBlock(_ context.Context, base block.TipSetKey, msgs []*types.UnsignedMessage) []error {
+	c.checkedAt = base
+	nonces := make(map[address.Address]uint64)
+	errs := make([]error, len(msgs))
+	for i, msg := range msgs {
+		if msg.From == c.penalized {
+			errs[i] = errors.New("penalized")
+		} else if msg.CallSeqNum != nonces[msg.From] {
+			errs[i] = errors.New("out of order")
+		} else {
+			nonces[msg.From]++
+		}
+	}
+	return errs
+}
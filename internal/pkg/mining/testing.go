@@ -44,6 +44,6 @@ func NthTicket(i uint8) block.Ticket {
 // NoMessageQualifier always returns no error
 type NoMessageQualifier struct{}
 
-func (npc *NoMessageQualifier) PenaltyCheck(_ context.Context, _ *types.UnsignedMessage) error {
-	return nil
+func (npc *NoMessageQualifier) PenaltyCheckBlock(_ context.Context, _ block.TipSetKey, msgs []*types.UnsignedMessage) []error {
+	return make([]error, len(msgs))
 }
@@ -23,6 +23,7 @@ import (
 	"github.com/filecoin-project/go-filecoin/internal/pkg/consensus"
 	"github.com/filecoin-project/go-filecoin/internal/pkg/crypto"
 	"github.com/filecoin-project/go-filecoin/internal/pkg/drand"
+	"github.com/filecoin-project/go-filecoin/internal/pkg/journal"
 	"github.com/filecoin-project/go-filecoin/internal/pkg/postgenerator"
 	"github.com/filecoin-project/go-filecoin/internal/pkg/types"
 	"github.com/filecoin-project/go-filecoin/internal/pkg/vm/state"
@@ -81,7 +82,7 @@ type tipSetMetadata interface {
 }
 
 type messageMessageQualifier interface {
-	PenaltyCheck(ctx context.Context, msg *types.UnsignedMessage) error
+	PenaltyCheckBlock(ctx context.Context, base block.TipSetKey, msgs []*types.UnsignedMessage) []error
 }
 
 // DefaultWorker runs a mining job.
@@ -105,6 +106,9 @@ type DefaultWorker struct {
 	poster         postgenerator.PoStGenerator
 	chainState     chain.TipSetProvider
 	drand          drand.IFace
+	selection      SelectionPolicy
+	journal        journal.Writer
+	history        *outcomeHistory
 }
 
 // WorkerParameters use for NewDefaultWorker parameters
@@ -131,10 +135,24 @@ type WorkerParameters struct {
 	Clock         clock.ChainEpochClock
 	Poster        postgenerator.PoStGenerator
 	ChainState    chain.TipSetProvider
+
+	// MessageSelection is the policy for selecting messages to include in blocks, defaulting
+	// to SelectByGasReward
+	MessageSelection SelectionPolicy
+	// Journal records the blocks generated, defaulting to no journal
+	Journal journal.Writer
 }
 
 // NewDefaultWorker instantiates a new Worker.
 func NewDefaultWorker(parameters WorkerParameters) *DefaultWorker {
+	selection := parameters.MessageSelection
+	if selection == "" {
+		selection = SelectByGasReward
+	}
+	jw := parameters.Journal
+	if jw == nil {
+		jw = journal.NewNoopJournal().Topic("mining")
+	}
 	return &DefaultWorker{
 		api:            parameters.API,
 		getStateTree:   parameters.GetStateTree,
@@ -153,13 +171,52 @@ func NewDefaultWorker(parameters WorkerParameters) *DefaultWorker {
 		poster:         parameters.Poster,
 		chainState:     parameters.ChainState,
 		drand:          parameters.Drand,
+		selection:      selection,
+		journal:        jw,
+		history:        newOutcomeHistory(miningHistoryLength),
 	}
 }
 
+// ElectionResult is the outcome of the election for the worker's miner at an epoch.
+type ElectionResult struct {
+	Epoch        abi.ChainEpoch
+	Won          bool
+	MinerPower   abi.StoragePower
+	NetworkPower abi.StoragePower
+	// Drand round providing the election randomness, and the ticket drawn from it
+	DrandRound drand.Round
+	Ticket     block.Ticket
+
+	// Inputs to the generation of a block, set only if the election was won
+	electionProof crypto.VRFPi
+	posts         []block.PoStProof
+	drandEntries  []*drand.Entry
+}
+
 // Mine implements the DefaultWorkers main mining function..
 // The returned bool indicates if this miner created a new block or not.
+// The outcome of each call is recorded in the worker's history and journal.
 func (w *DefaultWorker) Mine(ctx context.Context, base block.TipSet, nullBlkCount uint64) (*FullBlock, error) {
 	log.Info("Worker.Mine")
+	outcome := newEpochOutcome(base, nullBlkCount)
+	defer w.recordOutcome(outcome)
+
+	result, err := w.Evaluate(ctx, base, nullBlkCount)
+	if err != nil || !result.Won {
+		// no winners we are done
+		outcome.finish(result, nil, err)
+		return nil, err
+	}
+	blk, err := w.Generate(ctx, base, result.Ticket, result.electionProof, abi.ChainEpoch(nullBlkCount), result.posts, result.drandEntries)
+	outcome.finish(result, blk, err)
+	return blk, err
+}
+
+// Evaluate runs the election for the worker's miner in the epoch following `nullBlkCount` null
+// blocks after `base`, generating the winning PoSt if the election is won, but does not
+// generate a block. If generating the PoSt for a won election fails, the election result is
+// returned along with the error.
+func (w *DefaultWorker) Evaluate(ctx context.Context, base block.TipSet, nullBlkCount uint64) (*ElectionResult, error) {
 	if !base.Defined() {
 		log.Warn("Worker.Mine returning because it can't mine on an empty tipset")
 		return nil, errors.New("bad input tipset with no blocks sent to Mine()")
@@ -243,31 +300,40 @@ func (w *DefaultWorker) Mine(ctx context.Context, base block.TipSet, nullBlkCoun
 		log.Errorf("failed to get power claim for miner: %s", err)
 		return nil, err
 	}
-	wins := w.election.IsWinner(electionVRFDigest[:], minerPower, networkPower)
-	if !wins {
-		// no winners we are done
-		return nil, nil
+	result := &ElectionResult{
+		Epoch:        currEpoch,
+		Won:          w.election.IsWinner(electionVRFDigest[:], minerPower, networkPower),
+		MinerPower:   minerPower,
+		NetworkPower: networkPower,
+		DrandRound:   electionEntry.Round,
+		Ticket:       nextTicket,
+	}
+	if !result.Won {
+		return result, nil
 	}
 
 	// we have a winning block
 	sectorSetAncestor, err := w.lookbackTipset(ctx, base, nullBlkCount, consensus.WinningPoStSectorSetLookback)
 	if err != nil {
 		log.Errorf("Worker.Mine couldn't get ancestor tipset: %s", err.Error())
-		return nil, err
+		return result, err
 	}
 	sectorStateView, err := w.api.PowerStateView(sectorSetAncestor.Key())
 	if err != nil {
 		log.Errorf("Worker.Mine couldn't get snapshot for tipset: %s", err.Error())
-		return nil, err
+		return result, err
 	}
 
 	posts, err := w.election.GenerateWinningPoSt(ctx, electionEntry, currEpoch, w.poster, w.minerAddr, sectorStateView)
 	if err != nil {
 		log.Warnf("Worker.Mine failed to generate post")
-		return nil, err
+		return result, err
 	}
 
-	return w.Generate(ctx, base, nextTicket, electionVRFProof, abi.ChainEpoch(nullBlkCount), posts, drandEntries)
+	result.electionProof = electionVRFProof
+	result.posts = posts
+	result.drandEntries = drandEntries
+	return result, nil
 }
 
 func (w *DefaultWorker) getPowerTable(powerKey, faultsKey block.TipSetKey) (consensus.PowerTableView, error) {
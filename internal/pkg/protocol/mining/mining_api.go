@@ -4,8 +4,11 @@ import (
 	"context"
 
 	"github.com/filecoin-project/go-address"
+	"github.com/ipfs/go-cid"
+	logging "github.com/ipfs/go-log"
 
 	"github.com/filecoin-project/go-filecoin/internal/pkg/block"
+	"github.com/filecoin-project/go-filecoin/internal/pkg/chain"
 	"github.com/filecoin-project/go-filecoin/internal/pkg/clock"
 	"github.com/filecoin-project/go-filecoin/internal/pkg/mining"
 	"github.com/pkg/errors"
@@ -14,8 +17,11 @@ import (
 type miningChainReader interface {
 	GetHead() block.TipSetKey
 	GetTipSet(tsKey block.TipSetKey) (block.TipSet, error)
+	SubHeadChanges(ctx context.Context) <-chan chain.HeadChange
 }
 
+var log = logging.Logger("mining_protocol")
+
 // API provides an interface to the block mining protocol.
 type API struct {
 	minerAddress    func() (address.Address, error)
@@ -27,6 +33,12 @@ type API struct {
 	stopMiningFunc  func(context.Context)
 	getWorkerFunc   func(ctx context.Context) (*mining.DefaultWorker, error)
 	chainClock      clock.ChainEpochClock
+
+	minerAddresses    func() []address.Address
+	startMinerFunc    func(context.Context, address.Address) error
+	stopMinerFunc     func(context.Context, address.Address) error
+	minerIsActiveFunc func(address.Address) (bool, error)
+	submitBlockFunc   func(context.Context, *block.Block) error
 }
 
 // New creates a new API instance with the provided deps
@@ -40,6 +52,11 @@ func New(
 	stopMiningfunc func(context.Context),
 	getWorkerFunc func(ctx context.Context) (*mining.DefaultWorker, error),
 	chainClock clock.ChainEpochClock,
+	minerAddresses func() []address.Address,
+	startMinerFunc func(context.Context, address.Address) error,
+	stopMinerFunc func(context.Context, address.Address) error,
+	minerIsActiveFunc func(address.Address) (bool, error),
+	submitBlockFunc func(context.Context, *block.Block) error,
 ) API {
 	return API{
 		minerAddress:    minerAddr,
@@ -51,6 +68,12 @@ func New(
 		stopMiningFunc:  stopMiningfunc,
 		getWorkerFunc:   getWorkerFunc,
 		chainClock:      chainClock,
+
+		minerAddresses:    minerAddresses,
+		startMinerFunc:    startMinerFunc,
+		stopMinerFunc:     stopMinerFunc,
+		minerIsActiveFunc: minerIsActiveFunc,
+		submitBlockFunc:   submitBlockFunc,
 	}
 }
 
@@ -60,11 +83,23 @@ func (a *API) MinerAddress() (address.Address, error) {
 	return a.minerAddress()
 }
 
+// MinerAddresses returns the addresses of all the miner actors the node mines for, the primary
+// miner first.
+func (a *API) MinerAddresses() []address.Address {
+	return a.minerAddresses()
+}
+
 // MiningIsActive calls the node's IsMining function
 func (a *API) MiningIsActive() bool {
 	return a.isMiningFunc()
 }
 
+// MinerIsActive returns whether the node is mining for the miner actor `minerAddr`, which
+// must be one of the node's miners.
+func (a *API) MinerIsActive(minerAddr address.Address) (bool, error) {
+	return a.minerIsActiveFunc(minerAddr)
+}
+
 // MiningOnce mines and returns a single block based on the current chain head.
 // It tries each epoch in turn until it finds a winner.
 func (a *API) MiningOnce(ctx context.Context) (*block.Block, error) {
@@ -108,3 +143,123 @@ func (a *API) MiningStart(ctx context.Context) error {
 func (a *API) MiningStop(ctx context.Context) {
 	a.stopMiningFunc(ctx)
 }
+
+// MinerStart starts mining for the miner actor `minerAddr` only.
+func (a *API) MinerStart(ctx context.Context, minerAddr address.Address) error {
+	return a.startMinerFunc(ctx, minerAddr)
+}
+
+// MinerStop stops mining for the miner actor `minerAddr` only.
+func (a *API) MinerStop(ctx context.Context, minerAddr address.Address) error {
+	return a.stopMinerFunc(ctx, minerAddr)
+}
+
+// MiningDryRun evaluates the election for each new chain head as if mining, without generating
+// or publishing blocks, and streams the outcomes until `ctx` is done.
+func (a *API) MiningDryRun(ctx context.Context) (<-chan *mining.DryRunOutcome, error) {
+	miningWorker, err := a.getWorkerFunc(ctx)
+	if err != nil {
+		return nil, err
+	}
+	dryRunner := miningWorker.DryRunner()
+
+	// The subscription never blocks the chain store, however long an evaluation takes.
+	changes := a.chainReader.SubHeadChanges(ctx)
+	out := make(chan *mining.DryRunOutcome)
+	go func() {
+		defer close(out)
+		for {
+			head, ok := latestHead(ctx, changes)
+			if !ok {
+				return
+			}
+			outcome, err := dryRunner.HandleHead(ctx, head)
+			if err != nil {
+				log.Errorf("failed to evaluate election on head %s: %s", head.Key(), err)
+				continue
+			}
+			select {
+			case out <- outcome:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+// latestHead waits for a head change, and returns the new head of the latest change received by
+// then, skipping heads already superseded. It returns false once the changes end.
+func latestHead(ctx context.Context, changes <-chan chain.HeadChange) (block.TipSet, bool) {
+	var head block.TipSet
+	select {
+	case change, ok := <-changes:
+		if !ok {
+			return block.UndefTipSet, false
+		}
+		head = newHead(change, head)
+	case <-ctx.Done():
+		return block.UndefTipSet, false
+	}
+	for {
+		select {
+		case change, ok := <-changes:
+			if !ok {
+				return head, head.Defined()
+			}
+			head = newHead(change, head)
+		default:
+			if !head.Defined() {
+				// Only changes without a new head were received.
+				return latestHead(ctx, changes)
+			}
+			return head, true
+		}
+	}
+}
+
+// newHead returns the head a change moves to, or `prev` if it has none.
+func newHead(change chain.HeadChange, prev block.TipSet) block.TipSet {
+	if len(change.Apply) == 0 {
+		log.Errorf("head change without new head")
+		return prev
+	}
+	return change.Apply[0]
+}
+
+// MiningHistory returns the outcomes of the `count` most recent epochs the node attempted to
+// mine, most recent first.
+func (a *API) MiningHistory(ctx context.Context, count uint) ([]*mining.EpochOutcome, error) {
+	miningWorker, err := a.getWorkerFunc(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return miningWorker.History(int(count)), nil
+}
+
+// MiningBlockTemplate returns a template for a block mined by the node's miner on the tipset
+// `baseKey`, or the chain head if empty, after `nullBlkCount` null rounds. The template has
+// messages selected from the pool, for an external producer to complete and submit.
+func (a *API) MiningBlockTemplate(ctx context.Context, baseKey block.TipSetKey, nullBlkCount uint64) (*mining.BlockTemplate, error) {
+	if baseKey.Empty() {
+		baseKey = a.chainReader.GetHead()
+	}
+	base, err := a.chainReader.GetTipSet(baseKey)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to load base tipset %s", baseKey)
+	}
+	miningWorker, err := a.getWorkerFunc(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return miningWorker.Template(ctx, base, nullBlkCount)
+}
+
+// MiningSubmitBlock validates a signed block, typically built from a block template, and
+// propagates it to the network. It returns once the block has been synced.
+func (a *API) MiningSubmitBlock(ctx context.Context, header *block.Block) (cid.Cid, error) {
+	if err := a.submitBlockFunc(ctx, header); err != nil {
+		return cid.Undef, err
+	}
+	return header.Cid(), nil
+}
@@ -152,5 +152,10 @@ func newAPI(t *testing.T) (bapi.API, *node.Node) {
 		nd.StopMining,
 		nd.CreateMiningWorker,
 		nd.ChainClock,
+		nd.MinerAddresses,
+		nd.StartMiner,
+		nd.StopMiner,
+		nd.MinerIsActive,
+		nd.SubmitBlock,
 	), nd
 }
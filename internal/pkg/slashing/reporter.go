@@ -0,0 +1,254 @@
+package slashing
+
+import (
+	"bytes"
+	"context"
+	"sync"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/specs-actors/actors/abi"
+	"github.com/filecoin-project/specs-actors/actors/abi/big"
+	"github.com/filecoin-project/specs-actors/actors/builtin"
+	"github.com/filecoin-project/specs-actors/actors/builtin/miner"
+	"github.com/filecoin-project/specs-actors/actors/runtime/exitcode"
+	"github.com/ipfs/go-cid"
+	logging "github.com/ipfs/go-log"
+	"github.com/pkg/errors"
+
+	"github.com/filecoin-project/go-filecoin/internal/pkg/block"
+	"github.com/filecoin-project/go-filecoin/internal/pkg/encoding"
+	"github.com/filecoin-project/go-filecoin/internal/pkg/journal"
+	"github.com/filecoin-project/go-filecoin/internal/pkg/types"
+	"github.com/filecoin-project/go-filecoin/internal/pkg/vm"
+	"github.com/filecoin-project/go-filecoin/internal/pkg/vm/actor"
+	"github.com/filecoin-project/go-filecoin/internal/pkg/vm/gas"
+)
+
+var log = logging.Logger("slashing")
+
+// Number of tipsets behind the head searched for a report message when waiting for it.
+const reportWaitLookback = 2
+
+// Maximum number of reported faults remembered, so as not to report a fault detected again.
+const maxTrackedFaults = 1000
+
+// Statuses of a fault report.
+const (
+	// ReportPending is the status of a report sent but not yet executed.
+	ReportPending = "pending"
+	// ReportSucceeded is the status of a report executed successfully.
+	ReportSucceeded = "succeeded"
+	// ReportFailed is the status of a report which could not be sent or whose execution failed.
+	ReportFailed = "failed"
+	// ReportUnprovable is the status of a fault for which no proof can be built, and which is not
+	// reported.
+	ReportUnprovable = "unprovable"
+)
+
+// FaultReport records the report of a consensus fault and its outcome.
+type FaultReport struct {
+	Miner address.Address
+	Epoch abi.ChainEpoch
+	// Blocks proving the fault, in the order they are reported
+	Block1, Block2 cid.Cid
+	Message        cid.Cid
+	Status         string
+	ExitCode       exitcode.ExitCode
+	// Reward paid to the reporter, estimated from the change in the reporter's balance net of
+	// the gas paid for the report. The estimate is exact only if the reporter's address sends
+	// and receives no other funds while the report executes.
+	Reward abi.TokenAmount
+	Error  string
+}
+
+type reportSender interface {
+	MessageSend(ctx context.Context, from, to address.Address, value types.AttoFIL, gasPrice types.AttoFIL, gasLimit gas.Unit,
+		method abi.MethodNum, params interface{}) (cid.Cid, chan error, error)
+}
+
+type reportWaiter interface {
+	Wait(ctx context.Context, msgCid cid.Cid, lookback uint64, cb func(*block.Block, *types.SignedMessage, *vm.MessageReceipt) error) error
+}
+
+// Chain state required for estimating report rewards.
+type reporterChain interface {
+	Head() block.TipSetKey
+	GetActorAt(ctx context.Context, tipKey block.TipSetKey, addr address.Address) (*actor.Actor, error)
+}
+
+// ConsensusFaultReporter reports the consensus faults found by a ConsensusFaultDetector to the
+// faulty miners' actors, which penalize the miners and reward the reporter. The outcome of each
+// report is recorded in the journal.
+type ConsensusFaultReporter struct {
+	from     address.Address
+	gasPrice types.AttoFIL
+	gasLimit gas.Unit
+	chain    reporterChain
+	sender   reportSender
+	waiter   reportWaiter
+	journal  journal.Writer
+
+	lk sync.Mutex
+	// reported tracks the pairs of blocks most recently reported, as a fault may be detected
+	// more than once, and tracked holds the same pairs oldest first
+	reported map[[2]cid.Cid]struct{}
+	tracked  [][2]cid.Cid
+}
+
+// NewConsensusFaultReporter creates a reporter sending reports from the address `from` with
+// the gas price and limit given, which the sender may estimate.
+func NewConsensusFaultReporter(from address.Address, gasPrice types.AttoFIL, gasLimit gas.Unit, chain reporterChain, sender reportSender, waiter reportWaiter, jw journal.Writer) *ConsensusFaultReporter {
+	return &ConsensusFaultReporter{
+		from:     from,
+		gasPrice: gasPrice,
+		gasLimit: gasLimit,
+		chain:    chain,
+		sender:   sender,
+		waiter:   waiter,
+		journal:  jw,
+		reported: make(map[[2]cid.Cid]struct{}),
+	}
+}
+
+// HandleFault reports a fault in the background, so as not to block fault detection.
+func (r *ConsensusFaultReporter) HandleFault(ctx context.Context, fault ConsensusFault) {
+	go func() {
+		if _, err := r.Report(ctx, fault); err != nil {
+			log.Warnf("failed to report consensus fault of miner %s: %s", fault.Block1.Miner, err)
+		}
+	}()
+}
+
+// Report sends a report of a fault and waits for it to be executed. It returns the report's
+// outcome, or nil if the fault was already reported. The blocks are reported lower first, and
+// in CID order at the same height, so that a fault is reported once whichever order it is
+// detected in.
+func (r *ConsensusFaultReporter) Report(ctx context.Context, fault ConsensusFault) (*FaultReport, error) {
+	b1, b2 := fault.Block1, fault.Block2
+	if b1.Height > b2.Height || (b1.Height == b2.Height && bytes.Compare(b1.Cid().Bytes(), b2.Cid().Bytes()) > 0) {
+		b1, b2 = b2, b1
+	}
+	report := &FaultReport{
+		Miner:  b1.Miner,
+		Epoch:  b2.Height,
+		Block1: b1.Cid(),
+		Block2: b2.Cid(),
+		Reward: big.Zero(),
+	}
+	if !r.track(report) {
+		return nil, nil
+	}
+	defer r.record(report)
+
+	params, err := faultProof(b1, b2)
+	if err != nil {
+		report.Status = ReportUnprovable
+		report.Error = err.Error()
+		return report, err
+	}
+
+	balanceBefore, err := r.balance(ctx)
+	if err != nil {
+		return report, r.fail(report, err)
+	}
+	mcid, errCh, err := r.sender.MessageSend(ctx, r.from, b1.Miner, types.ZeroAttoFIL, r.gasPrice, r.gasLimit,
+		builtin.MethodsMiner.ReportConsensusFault, params)
+	if err != nil {
+		return report, r.fail(report, err)
+	}
+	report.Message = mcid
+	report.Status = ReportPending
+	if err := <-errCh; err != nil {
+		return report, r.fail(report, err)
+	}
+
+	var receipt *vm.MessageReceipt
+	var gasPrice types.AttoFIL
+	err = r.waiter.Wait(ctx, mcid, reportWaitLookback, func(_ *block.Block, smsg *types.SignedMessage, rcpt *vm.MessageReceipt) error {
+		receipt = rcpt
+		gasPrice = smsg.Message.GasPrice
+		return nil
+	})
+	if err != nil {
+		return report, r.fail(report, err)
+	}
+	report.ExitCode = receipt.ExitCode
+	if receipt.ExitCode != exitcode.Ok {
+		report.Status = ReportFailed
+		return report, nil
+	}
+	report.Status = ReportSucceeded
+
+	balanceAfter, err := r.balance(ctx)
+	if err != nil {
+		log.Warnf("failed to estimate reward for consensus fault report %s: %s", mcid, err)
+		return report, nil
+	}
+	report.Reward = big.Add(big.Sub(balanceAfter, balanceBefore), receipt.GasUsed.ToTokens(gasPrice))
+	return report, nil
+}
+
+// faultProof builds the parameters of a report proving a fault by two blocks, the lower first.
+// Faults are provable if the blocks were mined at the same epoch, or on the same parents at
+// different epochs. Proving parent grinding requires a third block, which a fault detected by
+// the ConsensusFaultDetector never provides.
+func faultProof(b1, b2 *block.Block) (*miner.ReportConsensusFaultParams, error) {
+	if b1.Height != b2.Height && !b1.Parents.Equals(b2.Parents) {
+		return nil, errors.Errorf("no provable fault by blocks %s and %s", b1.Cid(), b2.Cid())
+	}
+	h1, err := encoding.Encode(b1)
+	if err != nil {
+		return nil, err
+	}
+	h2, err := encoding.Encode(b2)
+	if err != nil {
+		return nil, err
+	}
+	return &miner.ReportConsensusFaultParams{
+		BlockHeader1: h1,
+		BlockHeader2: h2,
+	}, nil
+}
+
+func (r *ConsensusFaultReporter) balance(ctx context.Context) (abi.TokenAmount, error) {
+	act, err := r.chain.GetActorAt(ctx, r.chain.Head(), r.from)
+	if err != nil {
+		return abi.TokenAmount{}, errors.Wrapf(err, "failed to load reporter actor %s", r.from)
+	}
+	return act.Balance, nil
+}
+
+func (r *ConsensusFaultReporter) fail(report *FaultReport, err error) error {
+	report.Status = ReportFailed
+	report.Error = err.Error()
+	return err
+}
+
+// track returns whether a report is new, and tracks it if so, forgetting the oldest report
+// tracked if there are too many.
+func (r *ConsensusFaultReporter) track(report *FaultReport) bool {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+	key := [2]cid.Cid{report.Block1, report.Block2}
+	if _, ok := r.reported[key]; ok {
+		return false
+	}
+	if len(r.tracked) >= maxTrackedFaults {
+		delete(r.reported, r.tracked[0])
+		r.tracked = r.tracked[1:]
+	}
+	r.reported[key] = struct{}{}
+	r.tracked = append(r.tracked, key)
+	return true
+}
+
+func (r *ConsensusFaultReporter) record(report *FaultReport) {
+	msg := ""
+	if report.Message.Defined() {
+		msg = report.Message.String()
+	}
+	r.journal.Write("ConsensusFaultReport",
+		"miner", report.Miner.String(), "epoch", report.Epoch, "block1", report.Block1.String(),
+		"block2", report.Block2.String(), "message", msg, "status", report.Status,
+		"exitCode", int64(report.ExitCode), "reward", report.Reward.String(), "error", report.Error)
+}
@@ -0,0 +1,179 @@
+package slashing_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/specs-actors/actors/abi"
+	"github.com/filecoin-project/specs-actors/actors/builtin"
+	"github.com/filecoin-project/specs-actors/actors/builtin/miner"
+	"github.com/filecoin-project/specs-actors/actors/runtime/exitcode"
+	"github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/internal/pkg/block"
+	"github.com/filecoin-project/go-filecoin/internal/pkg/encoding"
+	"github.com/filecoin-project/go-filecoin/internal/pkg/journal"
+	. "github.com/filecoin-project/go-filecoin/internal/pkg/slashing"
+	tf "github.com/filecoin-project/go-filecoin/internal/pkg/testhelpers/testflags"
+	"github.com/filecoin-project/go-filecoin/internal/pkg/types"
+	"github.com/filecoin-project/go-filecoin/internal/pkg/vm"
+	"github.com/filecoin-project/go-filecoin/internal/pkg/vm/actor"
+	vmaddr "github.com/filecoin-project/go-filecoin/internal/pkg/vm/address"
+	"github.com/filecoin-project/go-filecoin/internal/pkg/vm/gas"
+)
+
+type sentReport struct {
+	from, to address.Address
+	gasPrice types.AttoFIL
+	gasLimit gas.Unit
+	method   abi.MethodNum
+	params   *miner.ReportConsensusFaultParams
+}
+
+type fakeReportSender struct {
+	sent    []sentReport
+	nextCid func() cid.Cid
+}
+
+func (s *fakeReportSender) MessageSend(_ context.Context, from, to address.Address, _ types.AttoFIL, gasPrice types.AttoFIL, gasLimit gas.Unit,
+	method abi.MethodNum, params interface{}) (cid.Cid, chan error, error) {
+	s.sent = append(s.sent, sentReport{from, to, gasPrice, gasLimit, method, params.(*miner.ReportConsensusFaultParams)})
+	errCh := make(chan error, 1)
+	errCh <- nil
+	return s.nextCid(), errCh, nil
+}
+
+// fakeReportWaiter reports the report executed with the receipt, at the gas price.
+type fakeReportWaiter struct {
+	gasPrice types.AttoFIL
+	receipt  vm.MessageReceipt
+}
+
+func (w *fakeReportWaiter) Wait(_ context.Context, _ cid.Cid, _ uint64, cb func(*block.Block, *types.SignedMessage, *vm.MessageReceipt) error) error {
+	smsg := &types.SignedMessage{Message: types.UnsignedMessage{GasPrice: w.gasPrice}}
+	return cb(nil, smsg, &w.receipt)
+}
+
+// recordingWriter records the events written to the journal.
+type recordingWriter struct {
+	events []string
+}
+
+func (w *recordingWriter) Write(event string, _ ...interface{}) {
+	w.events = append(w.events, event)
+}
+
+// fakeReporterChain returns the balances in order, one per lookup.
+type fakeReporterChain struct {
+	balances []int64
+}
+
+func (c *fakeReporterChain) Head() block.TipSetKey {
+	return block.NewTipSetKey()
+}
+
+func (c *fakeReporterChain) GetActorAt(_ context.Context, _ block.TipSetKey, _ address.Address) (*actor.Actor, error) {
+	balance := c.balances[0]
+	c.balances = c.balances[1:]
+	return actor.NewActor(cid.Undef, abi.NewTokenAmount(balance), cid.Undef), nil
+}
+
+func TestConsensusFaultReporter(t *testing.T) {
+	tf.UnitTest(t)
+	ctx := context.Background()
+	addrGetter := vmaddr.NewForTestGetter()
+	reporterAddr := addrGetter()
+	minerAddr := addrGetter()
+	cidGetter := types.NewCidForTestGetter()
+	gasPrice := types.NewGasPrice(2)
+	gasLimit := gas.NewGas(10000)
+
+	t.Run("reports provable faults once", func(t *testing.T) {
+		sender := &fakeReportSender{nextCid: cidGetter}
+		// The gas price is that of the message executed, which may differ from that requested.
+		waiter := &fakeReportWaiter{gasPrice: types.NewGasPrice(1), receipt: vm.MessageReceipt{ExitCode: exitcode.Ok, GasUsed: gas.NewGas(100)}}
+		chain := &fakeReporterChain{balances: []int64{1000, 1900}}
+		jw := &recordingWriter{}
+		reporter := NewConsensusFaultReporter(reporterAddr, gasPrice, gasLimit, chain, sender, waiter, jw)
+
+		parents := block.NewTipSetKey(cidGetter())
+		block1 := &block.Block{Miner: minerAddr, Height: 43, Parents: parents}
+		block2 := &block.Block{Miner: minerAddr, Height: 43, Parents: block.NewTipSetKey(cidGetter())}
+		// Blocks at the same height are reported in CID order.
+		if bytes.Compare(block1.Cid().Bytes(), block2.Cid().Bytes()) > 0 {
+			block1, block2 = block2, block1
+		}
+
+		report, err := reporter.Report(ctx, ConsensusFault{block2, block1})
+		require.NoError(t, err)
+		assert.Equal(t, ReportSucceeded, report.Status)
+		assert.Equal(t, block1.Cid(), report.Block1)
+		assert.Equal(t, block2.Cid(), report.Block2)
+		assert.Equal(t, minerAddr, report.Miner)
+		assert.Equal(t, abi.ChainEpoch(43), report.Epoch)
+		// 900 gained after paying 100 in gas
+		assert.Equal(t, "1000", report.Reward.String())
+
+		require.Len(t, sender.sent, 1)
+		sent := sender.sent[0]
+		assert.Equal(t, reporterAddr, sent.from)
+		assert.Equal(t, minerAddr, sent.to)
+		assert.Equal(t, gasPrice, sent.gasPrice)
+		assert.Equal(t, gasLimit, sent.gasLimit)
+		assert.Equal(t, builtin.MethodsMiner.ReportConsensusFault, sent.method)
+		h1, err := encoding.Encode(block1)
+		require.NoError(t, err)
+		h2, err := encoding.Encode(block2)
+		require.NoError(t, err)
+		assert.Equal(t, h1, sent.params.BlockHeader1)
+		assert.Equal(t, h2, sent.params.BlockHeader2)
+
+		// The same fault detected again, in either order, is not reported again.
+		report, err = reporter.Report(ctx, ConsensusFault{block1, block2})
+		require.NoError(t, err)
+		assert.Nil(t, report)
+		report, err = reporter.Report(ctx, ConsensusFault{block2, block1})
+		require.NoError(t, err)
+		assert.Nil(t, report)
+		assert.Len(t, sender.sent, 1)
+		assert.Equal(t, []string{"ConsensusFaultReport"}, jw.events)
+	})
+
+	t.Run("orders time offset faults by height", func(t *testing.T) {
+		sender := &fakeReportSender{nextCid: cidGetter}
+		waiter := &fakeReportWaiter{gasPrice: gasPrice, receipt: vm.MessageReceipt{ExitCode: exitcode.ErrIllegalArgument}}
+		chain := &fakeReporterChain{balances: []int64{1000}}
+		reporter := NewConsensusFaultReporter(reporterAddr, gasPrice, gasLimit, chain, sender, waiter, journal.NewNoopJournal().Topic("slashing"))
+
+		parents := block.NewTipSetKey(cidGetter())
+		block1 := &block.Block{Miner: minerAddr, Height: 43, Parents: parents}
+		block2 := &block.Block{Miner: minerAddr, Height: 44, Parents: parents}
+
+		report, err := reporter.Report(ctx, ConsensusFault{block2, block1})
+		require.NoError(t, err)
+		assert.Equal(t, block1.Cid(), report.Block1)
+		assert.Equal(t, abi.ChainEpoch(44), report.Epoch)
+		// The report failed on chain.
+		assert.Equal(t, ReportFailed, report.Status)
+		assert.Equal(t, exitcode.ErrIllegalArgument, report.ExitCode)
+	})
+
+	t.Run("does not report unprovable faults", func(t *testing.T) {
+		sender := &fakeReportSender{nextCid: cidGetter}
+		jw := &recordingWriter{}
+		reporter := NewConsensusFaultReporter(reporterAddr, gasPrice, gasLimit, &fakeReporterChain{}, sender, &fakeReportWaiter{}, jw)
+
+		block1 := &block.Block{Miner: minerAddr, Height: 43, Parents: block.NewTipSetKey(cidGetter())}
+		block2 := &block.Block{Miner: minerAddr, Height: 44, Parents: block.NewTipSetKey(cidGetter())}
+
+		report, err := reporter.Report(ctx, ConsensusFault{block1, block2})
+		assert.Error(t, err)
+		assert.Equal(t, ReportUnprovable, report.Status)
+		assert.Empty(t, sender.sent)
+		assert.Equal(t, []string{"ConsensusFaultReport"}, jw.events)
+	})
+}
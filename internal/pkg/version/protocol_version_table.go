@@ -41,6 +41,19 @@ func (pvt *ProtocolVersionTable) VersionAt(height abi.ChainEpoch) (uint64, error
 	return pvt.versions[idx-1].Version, nil
 }
 
+// VersionsActivatedBetween returns the protocol versions which come into effect after the height
+// `from` and at or before the height `to`, in order. More than one version may be activated
+// between two heights when the heights are separated by null rounds.
+func (pvt *ProtocolVersionTable) VersionsActivatedBetween(from, to abi.ChainEpoch) []uint64 {
+	var versions []uint64
+	for _, version := range pvt.versions {
+		if version.EffectiveAt > from && version.EffectiveAt <= to {
+			versions = append(versions, version.Version)
+		}
+	}
+	return versions
+}
+
 // ProtocolVersionTableBuilder constructs a protocol version table
 type ProtocolVersionTableBuilder struct {
 	network  string
@@ -5,6 +5,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/filecoin-project/go-filecoin/internal/pkg/config"
 	tf "github.com/filecoin-project/go-filecoin/internal/pkg/testhelpers/testflags"
 
 	"testing"
@@ -112,6 +113,48 @@ func TestUpgradeTable(t *testing.T) {
 		}
 	})
 
+	t.Run("finds versions activated between heights", func(t *testing.T) {
+		put, err := NewProtocolVersionTableBuilder(network).
+			Add(network, 0, abi.ChainEpoch(0)).
+			Add(network, 1, abi.ChainEpoch(10)).
+			Add(network, 2, abi.ChainEpoch(12)).
+			Add(network, 3, abi.ChainEpoch(20)).
+			Build()
+		require.NoError(t, err)
+
+		assert.Empty(t, put.VersionsActivatedBetween(abi.ChainEpoch(0), abi.ChainEpoch(9)))
+		assert.Equal(t, []uint64{1}, put.VersionsActivatedBetween(abi.ChainEpoch(9), abi.ChainEpoch(10)))
+		assert.Empty(t, put.VersionsActivatedBetween(abi.ChainEpoch(10), abi.ChainEpoch(11)))
+		// null rounds may skip over several activations
+		assert.Equal(t, []uint64{1, 2}, put.VersionsActivatedBetween(abi.ChainEpoch(8), abi.ChainEpoch(15)))
+	})
+
+	t.Run("schedules configured versions on the current network", func(t *testing.T) {
+		put, err := ConfigureProtocolVersions("localnet-270a8688", []config.ProtocolUpgradeConfig{
+			{Version: 1, EffectiveAt: abi.ChainEpoch(10)},
+		})
+		require.NoError(t, err)
+
+		version, err := put.VersionAt(abi.ChainEpoch(9))
+		require.NoError(t, err)
+		assert.Equal(t, uint64(Protocol0), version)
+		version, err = put.VersionAt(abi.ChainEpoch(10))
+		require.NoError(t, err)
+		assert.Equal(t, uint64(1), version)
+	})
+
+	t.Run("rejects configured versions on other networks", func(t *testing.T) {
+		scheduled := []config.ProtocolUpgradeConfig{{Version: 1, EffectiveAt: abi.ChainEpoch(10)}}
+		for _, network := range []string{"testnet", "alpha2"} {
+			_, err := ConfigureProtocolVersions(network, scheduled)
+			assert.Error(t, err, network)
+		}
+
+		// the built in versions are still configured without scheduled upgrades
+		_, err := ConfigureProtocolVersions("testnet", nil)
+		assert.NoError(t, err)
+	})
+
 	t.Run("does not permit the same version number twice", func(t *testing.T) {
 		_, err := NewProtocolVersionTableBuilder(network).
 			Add(network, 0, abi.ChainEpoch(0)).
@@ -2,6 +2,9 @@ package version
 
 import (
 	"github.com/filecoin-project/specs-actors/actors/abi"
+	"github.com/pkg/errors"
+
+	"github.com/filecoin-project/go-filecoin/internal/pkg/config"
 )
 
 // TEST is the network name for internal tests
@@ -10,15 +13,31 @@ const TEST = "gfctest"
 // Protocol0 is the first protocol version
 const Protocol0 = 0
 
-// ConfigureProtocolVersions configures all protocol upgrades for all known networks.
+// upgradeableNetworks are the networks on which protocol upgrades may be scheduled in
+// configuration: devnets and local networks, whose upgrades need no coordination with others.
+var upgradeableNetworks = map[string]bool{
+	"interop":  true,
+	"localnet": true,
+	TEST:       true,
+}
+
+// ConfigureProtocolVersions configures all protocol upgrades for all known networks, and any
+// upgrades scheduled for the current network in its configuration. Upgrades may only be
+// scheduled in configuration on devnets and local networks.
 // TODO: support arbitrary network names at "latest" protocol version so that only coordinated
 // network upgrades need to be represented here. See #3491.
-func ConfigureProtocolVersions(network string) (*ProtocolVersionTable, error) {
-	return NewProtocolVersionTableBuilder(network).
+func ConfigureProtocolVersions(network string, scheduled []config.ProtocolUpgradeConfig) (*ProtocolVersionTable, error) {
+	builder := NewProtocolVersionTableBuilder(network).
 		Add("alpha2", Protocol0, abi.ChainEpoch(0)).
 		Add("interop", Protocol0, abi.ChainEpoch(0)).
 		Add("localnet", Protocol0, abi.ChainEpoch(0)).
 		Add("testnet", Protocol0, abi.ChainEpoch(0)).
-		Add(TEST, Protocol0, abi.ChainEpoch(0)).
-		Build()
+		Add(TEST, Protocol0, abi.ChainEpoch(0))
+	if len(scheduled) > 0 && !upgradeableNetworks[builder.network] {
+		return nil, errors.Errorf("protocol upgrades may only be configured on a devnet or localnet, not %s", network)
+	}
+	for _, upgrade := range scheduled {
+		builder.Add(builder.network, upgrade.Version, upgrade.EffectiveAt)
+	}
+	return builder.Build()
 }
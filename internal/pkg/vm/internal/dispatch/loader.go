@@ -20,6 +20,17 @@ func (cl CodeLoader) GetActorImpl(code cid.Cid) (Dispatcher, error) {
 	return &actorDispatcher{code: code, actor: actor}, nil
 }
 
+// With returns a copy of the code loader which executes `actor` for the code cid `code`,
+// replacing any existing implementation. It is used to swap actor code in network upgrades.
+func (cl CodeLoader) With(code cid.Cid, actor Actor) CodeLoader {
+	actors := make(map[cid.Cid]Actor, len(cl.actors)+1)
+	for c, a := range cl.actors {
+		actors[c] = a
+	}
+	actors[code] = actor
+	return CodeLoader{actors: actors}
+}
+
 // CodeLoaderBuilder helps you build a CodeLoader.
 type CodeLoaderBuilder struct {
 	actors map[cid.Cid]Actor
@@ -16,6 +16,11 @@ type VMInterpreter interface {
 	//
 	// Note: any message processing error will be present as an `ExitCode` in the `MessageReceipt`.
 	ApplyTipSetMessages(blocks []BlockMessagesInfo, head block.TipSetKey, epoch abi.ChainEpoch, rnd crypto.RandomnessSource) ([]message.Receipt, error)
+
+	// ApplyMessage applies a single message as if included in a block at `epoch` on top of `head`,
+	// without block rewards, cron or committing the resulting state. It is intended for previewing
+	// the outcome and gas usage of a message.
+	ApplyMessage(msg *types.UnsignedMessage, onChainMsgSize int, head block.TipSetKey, epoch abi.ChainEpoch, rnd crypto.RandomnessSource) message.Receipt
 }
 
 // BlockMessagesInfo contains messages for one block in a tipset.
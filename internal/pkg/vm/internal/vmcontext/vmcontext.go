@@ -45,9 +45,13 @@ type VM struct {
 	syscalls     SyscallsImpl
 	currentHead  block.TipSetKey
 	currentEpoch abi.ChainEpoch
+	pricelists   PricelistLookup
 	pricelist    gascost.Pricelist
 }
 
+// PricelistLookup selects the gas prices in effect at an epoch.
+type PricelistLookup func(epoch abi.ChainEpoch) gascost.Pricelist
+
 // ActorImplLookup provides access to upgradeable actor code.
 type ActorImplLookup interface {
 	GetActorImpl(code cid.Cid) (dispatch.Dispatcher, error)
@@ -68,12 +72,18 @@ type internalMessage struct {
 // NewVM creates a new runtime for executing messages.
 // Dragons: change to take a root and the store, build the tree internally
 func NewVM(actorImpls ActorImplLookup, store *storage.VMStorage, st state.Tree, syscalls SyscallsImpl) VM {
+	return NewVMWithPricelists(actorImpls, gascost.PricelistByEpoch, store, st, syscalls)
+}
+
+// NewVMWithPricelists creates a new runtime charging gas with the prices selected by `pricelists`.
+func NewVMWithPricelists(actorImpls ActorImplLookup, pricelists PricelistLookup, store *storage.VMStorage, st state.Tree, syscalls SyscallsImpl) VM {
 	return VM{
 		context:    context.Background(),
 		actorImpls: actorImpls,
 		store:      store,
 		state:      st,
 		syscalls:   syscalls,
+		pricelists: pricelists,
 		// loaded during execution
 		// currentEpoch: ..,
 	}
@@ -83,7 +93,7 @@ func NewVM(actorImpls ActorImplLookup, store *storage.VMStorage, st state.Tree,
 //
 // This method is intended to be used in the generation of the genesis block only.
 func (vm *VM) ApplyGenesisMessage(from address.Address, to address.Address, method abi.MethodNum, value abi.TokenAmount, params interface{}, rnd crypto.RandomnessSource) (interface{}, error) {
-	vm.pricelist = gascost.PricelistByEpoch(vm.currentEpoch)
+	vm.pricelist = vm.pricelists(vm.currentEpoch)
 
 	// normalize from addr
 	var ok bool
@@ -197,7 +207,7 @@ func (vm *VM) ApplyTipSetMessages(blocks []interpreter.BlockMessagesInfo, head b
 	// update current tipset
 	vm.currentHead = head
 	vm.currentEpoch = epoch
-	vm.pricelist = gascost.PricelistByEpoch(epoch)
+	vm.pricelist = vm.pricelists(epoch)
 
 	// create message tracker
 	// Note: the same message could have been included by more than one miner
@@ -280,6 +290,18 @@ func (vm *VM) ApplyTipSetMessages(blocks []interpreter.BlockMessagesInfo, head b
 	return receipts, nil
 }
 
+// ApplyMessage implements interpreter.VMInterpreter
+func (vm *VM) ApplyMessage(msg *types.UnsignedMessage, onChainMsgSize int, head block.TipSetKey, epoch abi.ChainEpoch, rnd crypto.RandomnessSource) message.Receipt {
+	vm.currentHead = head
+	vm.currentEpoch = epoch
+	vm.pricelist = vm.pricelists(epoch)
+
+	// applyMessage normalizes the sender address in place
+	m := *msg
+	receipt, _, _ := vm.applyMessage(&m, onChainMsgSize, rnd)
+	return receipt
+}
+
 // applyImplicitMessage applies messages automatically generated by the vm itself.
 //
 // This messages do not consume client gas and must not fail.
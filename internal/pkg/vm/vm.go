@@ -5,6 +5,7 @@ import (
 
 	"github.com/filecoin-project/go-filecoin/internal/pkg/vm/actor/builtin"
 	"github.com/filecoin-project/go-filecoin/internal/pkg/vm/internal/dispatch"
+	"github.com/filecoin-project/go-filecoin/internal/pkg/vm/internal/gascost"
 	"github.com/filecoin-project/go-filecoin/internal/pkg/vm/internal/interpreter"
 	"github.com/filecoin-project/go-filecoin/internal/pkg/vm/internal/message"
 	"github.com/filecoin-project/go-filecoin/internal/pkg/vm/internal/storage"
@@ -35,6 +36,13 @@ func NewVM(st state.Tree, store *storage.VMStorage, syscalls SyscallsImpl) Inter
 	return &vm
 }
 
+// NewConfiguredVM creates a new VM interpreter executing actor code from `actors` and charging
+// gas with the prices selected by `pricelists`.
+func NewConfiguredVM(actors ActorCodeLoader, pricelists PricelistLookup, st state.Tree, store *storage.VMStorage, syscalls SyscallsImpl) Interpreter {
+	vm := vmcontext.NewVMWithPricelists(actors, pricelists, store, st, syscalls)
+	return &vm
+}
+
 // NewStorage creates a new Storage for the VM.
 func NewStorage(bs blockstore.Blockstore) Storage {
 	return storage.NewStorage(bs)
@@ -46,5 +54,17 @@ var DefaultActors = builtin.DefaultActors
 // ActorCodeLoader allows yo to load an actor's code based on its id an epoch.
 type ActorCodeLoader = dispatch.CodeLoader
 
+// ActorImpl is the executable code of an actor.
+type ActorImpl = dispatch.Actor
+
+// Pricelist provides prices for operations in the VM.
+type Pricelist = gascost.Pricelist
+
+// PricelistLookup selects the gas prices in effect at an epoch.
+type PricelistLookup = vmcontext.PricelistLookup
+
+// PricelistByEpoch selects the built-in gas prices in effect at an epoch.
+var PricelistByEpoch = gascost.PricelistByEpoch
+
 // ActorMethodSignature wraps a specific method and allows you to encode/decodes input/output bytes into concrete types.
 type ActorMethodSignature = dispatch.MethodSignature
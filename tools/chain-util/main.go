@@ -9,6 +9,7 @@ import (
 	cli "gopkg.in/urfave/cli.v2"
 
 	export "github.com/filecoin-project/go-filecoin/tools/chain-util/pkg/export"
+	fsck "github.com/filecoin-project/go-filecoin/tools/chain-util/pkg/fsck"
 )
 
 var log = logging.Logger("chain-util")
@@ -18,8 +19,9 @@ func init() {
 }
 
 const (
-	repoFlag = "repo"
-	outFlag  = "out"
+	repoFlag       = "repo"
+	outFlag        = "out"
+	stateDepthFlag = "state-depth"
 )
 
 var exportCmd = &cli.Command{
@@ -34,6 +36,10 @@ var exportCmd = &cli.Command{
 			Name:  outFlag,
 			Usage: "the file to export the chain to",
 		},
+		&cli.UintFlag{
+			Name:  stateDepthFlag,
+			Usage: "export state trees and receipts for only this many of the most recent tipsets",
+		},
 	},
 	Action: func(cctx *cli.Context) error {
 		cfg, err := parseFlags(cctx)
@@ -44,17 +50,57 @@ var exportCmd = &cli.Command{
 		if err != nil {
 			return err
 		}
-		if err := chainOut.Export(context.Background()); err == nil {
+		if cctx.IsSet(stateDepthFlag) {
+			err = chainOut.ExportSnapshot(context.Background(), cfg.stateDepth)
+		} else {
+			err = chainOut.Export(context.Background())
+		}
+		if err == nil {
 			fmt.Printf("Exported chain with head: %s to: %s", chainOut.Head, cfg.outFile.Name())
 		}
 		return err
 	},
 }
 
+var fsckCmd = &cli.Command{
+	Name:  "fsck",
+	Usage: "Check that the chain in a repo is complete and uncorrupted",
+	Flags: []cli.Flag{
+		&cli.PathFlag{
+			Name:  repoFlag,
+			Usage: "the repo where go-filecoin was initialized",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		repoPath := cctx.Path(repoFlag)
+		if repoPath == "" {
+			return fmt.Errorf("filecoin repo path required")
+		}
+		report, err := fsck.Check(context.Background(), repoPath)
+		if err != nil {
+			return err
+		}
+		for _, problem := range report.Problems {
+			state := "unreadable"
+			if problem.Missing {
+				state = "missing"
+			} else if problem.Corrupt {
+				state = "corrupt"
+			}
+			fmt.Printf("%s %s %s at height %d: %s\n", state, problem.Kind, problem.Cid, problem.Height, problem.Err)
+		}
+		fmt.Printf("Checked %d objects in %d tipsets from head: %s, found %d problems\n", report.Objects, report.Tipsets, report.Head, len(report.Problems))
+		if len(report.Problems) > 0 {
+			return fmt.Errorf("chain is incomplete or corrupt")
+		}
+		return nil
+	},
+}
+
 func main() {
 	app := &cli.App{
 		Name:     "chain-export",
-		Commands: []*cli.Command{exportCmd},
+		Commands: []*cli.Command{exportCmd, fsckCmd},
 	}
 	app.Setup()
 
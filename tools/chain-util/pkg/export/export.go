@@ -79,6 +79,13 @@ func (ce *ChainExporter) Export(ctx context.Context) error {
 	return chain.Export(ctx, ce.Head, ce, msgStore, ce, ce.out)
 }
 
+// ExportSnapshot will export a chain snapshot to the writer `out`, including
+// state trees and message receipts only for the `stateDepth` most recent tipsets.
+func (ce *ChainExporter) ExportSnapshot(ctx context.Context, stateDepth uint) error {
+	msgStore := chain.NewMessageStore(ce.bstore)
+	return chain.ExportSnapshot(ctx, ce.Head, ce, msgStore, ce, ce.out, stateDepth)
+}
+
 // GetTipSet gets the TipSet for a given TipSetKey from the ChainExporter blockstore.
 func (ce *ChainExporter) GetTipSet(key block.TipSetKey) (block.TipSet, error) {
 	var blks []*block.Block
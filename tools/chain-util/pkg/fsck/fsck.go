@@ -0,0 +1,62 @@
+package fsck
+
+import (
+	"context"
+	"path/filepath"
+
+	"github.com/filecoin-project/specs-actors/actors/abi"
+	"github.com/ipfs/go-datastore"
+	badgerds "github.com/ipfs/go-ds-badger2"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	logging "github.com/ipfs/go-log"
+	errors "github.com/pkg/errors"
+
+	block "github.com/filecoin-project/go-filecoin/internal/pkg/block"
+	chain "github.com/filecoin-project/go-filecoin/internal/pkg/chain"
+	encoding "github.com/filecoin-project/go-filecoin/internal/pkg/encoding"
+)
+
+var log = logging.Logger("chain-util/fsck")
+
+// Check checks the integrity of the chain in the repo at `repoPath`, which
+// is opened read-only, from its head back to genesis.
+func Check(ctx context.Context, repoPath string) (*chain.FsckReport, error) {
+	badgerOpt := &badgerds.DefaultOptions
+	badgerOpt.ReadOnly = true
+
+	badgerPath := filepath.Join(repoPath, "badger/")
+	log.Infof("opening badger datastore: %s", badgerPath)
+	badgerDS, err := badgerds.NewDatastore(badgerPath, badgerOpt)
+	if err != nil {
+		return nil, err
+	}
+	defer badgerDS.Close() // nolint: errcheck
+	bstore := blockstore.NewBlockstore(badgerDS)
+
+	chainPath := filepath.Join(repoPath, "chain/")
+	log.Infof("opening chain datastore: %s", chainPath)
+	chainDS, err := badgerds.NewDatastore(chainPath, badgerOpt)
+	if err != nil {
+		return nil, err
+	}
+	defer chainDS.Close() // nolint: errcheck
+
+	var head block.TipSetKey
+	if err := readKey(chainDS, chain.HeadKey, &head); err != nil {
+		return nil, errors.Wrap(err, "failed to read HeadKey")
+	}
+	var prunedHeight abi.ChainEpoch
+	if err := readKey(chainDS, chain.PrunedHeightKey, &prunedHeight); err != nil && err != datastore.ErrNotFound {
+		return nil, errors.Wrap(err, "failed to read PrunedHeightKey")
+	}
+
+	return chain.Fsck(ctx, bstore, head, prunedHeight)
+}
+
+func readKey(ds datastore.Datastore, key datastore.Key, out interface{}) error {
+	bb, err := ds.Get(key)
+	if err != nil {
+		return err
+	}
+	return encoding.Decode(bb, out)
+}
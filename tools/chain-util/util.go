@@ -8,8 +8,9 @@ import (
 )
 
 type config struct {
-	repoPath string
-	outFile  *os.File
+	repoPath   string
+	outFile    *os.File
+	stateDepth uint
 }
 
 func parseFlags(cctx *cli.Context) (*config, error) {
@@ -29,8 +30,9 @@ func parseFlags(cctx *cli.Context) (*config, error) {
 	}
 
 	return &config{
-		repoPath: repoPath,
-		outFile:  f,
+		repoPath:   repoPath,
+		outFile:    f,
+		stateDepth: cctx.Uint(stateDepthFlag),
 	}, nil
 
 }